@@ -1,15 +1,29 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"text/template"
 	"time"
+
+	"LeviathanMapper/scope"
 )
 
 const (
@@ -17,6 +31,10 @@ const (
 	defaultConcurrency = 20
 	retryLimit         = 3
 	retryDelay         = 2 * time.Second
+	zoomEyePageSize    = 20
+	hunterHowPageSize  = 100
+	intelXDomainType   = 2 // phonebook selector type for domains
+	quakePageSize      = 100
 )
 
 // API Variables
@@ -24,16 +42,47 @@ var (
 	apiKeySecurityTrails = os.Getenv("SECURITYTRAILS_API_KEY")
 	apiKeyShodan         = os.Getenv("SHODAN_API_KEY")
 	apiKeyVirusTotal     = os.Getenv("VIRUSTOTAL_API_KEY")
+	apiKeyLeakIX         = os.Getenv("LEAKIX_API_KEY")
+	apiKeyZoomEye        = os.Getenv("ZOOMEYE_API_KEY")
+	zoomEyeUsername      = os.Getenv("ZOOMEYE_USERNAME")
+	zoomEyePassword      = os.Getenv("ZOOMEYE_PASSWORD")
+	fofaEmail            = os.Getenv("FOFA_EMAIL")
+	apiKeyFofa           = os.Getenv("FOFA_KEY")
+	apiKeyHunterHow      = os.Getenv("HUNTERHOW_API_KEY")
+	apiKeyIntelX         = os.Getenv("INTELX_API_KEY")
+	apiKeyWhoisXML       = os.Getenv("WHOISXML_API_KEY")
+	passiveTotalUsername = os.Getenv("PASSIVETOTAL_USERNAME")
+	apiKeyPassiveTotal   = os.Getenv("PASSIVETOTAL_API_KEY")
+	apiKeyQuake          = os.Getenv("QUAKE_API_KEY")
+	apiKeyBeVigil        = os.Getenv("BEVIGIL_API_KEY")
+	apiKeyDNSRepo        = os.Getenv("DNSREPO_API_KEY")
+	apiKeyGoogle         = os.Getenv("GOOGLE_API_KEY")
+	googleSearchEngineID = os.Getenv("GOOGLE_CSE_ID")
 )
 
 // Global Variables
 var (
 	concurrency    int
 	proxyURL       string
-	subdomainChan  chan string
-	uniqueSubs     = make(map[string]struct{})
-	wg             sync.WaitGroup
-	mu             sync.Mutex // Mutex to avoid duplicates in the map
+	requestTimeout = defaultTimeout
+	rateLimit      float64 // Requests started per second, 0 for no limit
+	resolveNames   bool    // Resolve every result to its A/AAAA records
+	dropNXDomain   bool    // Drop results whose name does not exist
+	onlyResolved   bool    // Drop results that resolve to no address
+	canaryID       string  // Engagement identifier appended to outgoing traffic
+	crtShDatabase  bool    // Query crt.sh through PostgreSQL instead of HTTP
+	resultChan     chan Result
+	uniqueResults  = make(map[string]Result)    // Results by dedup key
+	firstSeen      = make(map[string]time.Time) // Earliest evidence of each subdomain
+	initFailures   []string                     // Sources that could not be initialized
+	pastRuns       *history                     // Hosts recorded by previous runs, nil without -history
+	newOnly        bool                         // Only report hosts absent from pastRuns
+	diffMode       bool                         // Only report the changes since the last run in pastRuns
+	previousRun    map[string]bool              // Hosts of that run, nil without -diff
+	quietStream    bool                         // Skip the live output, e.g. when -format is used
+	liveResults    func(Result)                 // Receives the results of the live output, set by streaming RPCs
+	jsonOutput     bool                         // Print the final results as JSON lines
+	mu             sync.Mutex                   // Mutex to avoid duplicates in the map
 	httpClient     *http.Client
 )
 
@@ -49,7 +98,7 @@ func configureHTTPClient() {
 		}
 
 		// Validate if the proxy is reachable
-		conn, err := net.DialTimeout("tcp", proxy.Host, defaultTimeout)
+		conn, err := net.DialTimeout("tcp", proxy.Host, requestTimeout)
 		if err != nil {
 			fmt.Println("Error connecting to the proxy:", err)
 			os.Exit(1)
@@ -58,201 +107,2125 @@ func configureHTTPClient() {
 
 		// Configure transport with proxy
 		transport.Proxy = http.ProxyURL(proxy)
+		jarmProxy = proxy
 		fmt.Println("Proxy configured:", proxyURL)
 	}
 
+	var roundTripper http.RoundTripper = transport
+	if mockDir != "" {
+		roundTripper = mockTransport{dir: mockDir}
+		fmt.Println("Mock mode: sources read their responses from", mockDir)
+	}
+	if canaryID != "" {
+		roundTripper = canaryTransport{base: roundTripper, identifier: canaryID}
+		fmt.Println("Canary identifier appended to User-Agent:", canaryID)
+	}
+
+	// Each source bounds its requests with its own timeout
+	roundTripper = timeoutTransport{base: roundTripper}
+
+	if rateLimit > 0 {
+		roundTripper = rateLimitTransport{base: roundTripper, ticks: time.Tick(time.Duration(float64(time.Second) / rateLimit))}
+		fmt.Printf("Rate limit: %g requests per second\n", rateLimit)
+	}
+
 	httpClient = &http.Client{
-		Timeout:   defaultTimeout,
+		Transport: roundTripper,
+	}
+	dohClient = &http.Client{
+		Timeout:   requestTimeout,
 		Transport: transport,
 	}
+	configureProbeClient(transport.Proxy)
+}
+
+// Transport that appends the engagement identifier to the User-Agent of every
+// request, so blue teams can tell authorized traffic apart in their logs
+type canaryTransport struct {
+	base       http.RoundTripper
+	identifier string
+}
+
+func (t canaryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	userAgent := req.UserAgent()
+	if userAgent == "" {
+		userAgent = "LeviathanMapper"
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent+" "+t.identifier)
+	return t.base.RoundTrip(req)
+}
+
+// Transport that waits for the next tick before each request, spacing
+// requests from every source evenly
+type rateLimitTransport struct {
+	base  http.RoundTripper
+	ticks <-chan time.Time
+}
+
+func (t rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	select {
+	case <-t.ticks:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Error returned when a source keeps answering with a non-200 status code
+type statusError struct {
+	code int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.code)
 }
 
 // Perform an HTTP request with retries
 func fetchWithRetries(req *http.Request) (*http.Response, error) {
+	return doWithRetries(req, false)
+}
+
+// Send a request with retries; with stopOnLimit a 429 answer is returned at
+// once so the caller can switch keys. Failed connections, timeouts and the
+// statuses retryableStatus accepts are retried with backoff; other statuses
+// are returned at once. A request with a body is retried only when the body
+// can be replayed through GetBody, as http.NewRequest sets for byte readers.
+func doWithRetries(req *http.Request, stopOnLimit bool) (*http.Response, error) {
 	var resp *http.Response
 	var err error
 
 	for i := 0; i < retryLimit; i++ {
+		if i > 0 && req.Body != nil && req.Body != http.NoBody {
+			if req.GetBody == nil {
+				return nil, err
+			}
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
 		resp, err = httpClient.Do(req)
 		if err == nil && resp.StatusCode == 200 {
 			return resp, nil
 		}
-		time.Sleep(retryDelay)
+		if req.Context().Err() != nil {
+			return nil, req.Context().Err()
+		}
+		if err != nil {
+			resp = nil
+		} else {
+			resp.Body.Close()
+			err = statusError{code: resp.StatusCode}
+			if !retryableStatus(resp.StatusCode) || stopOnLimit && resp.StatusCode == http.StatusTooManyRequests {
+				return nil, err
+			}
+		}
+		if i == retryLimit-1 {
+			break
+		}
+		delay, ok := retryWait(resp, i)
+		if !ok {
+			return nil, err
+		}
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
 	}
 	return nil, err
 }
 
-// Function to query Crt.sh
-func fetchFromCrtSh(domain string) {
-	defer wg.Done()
-	url := fmt.Sprintf("https://crt.sh/?q=%%25.%s&output=json", domain)
-	req, _ := http.NewRequest("GET", url, nil)
+// Perform a request against each endpoint in order until one answers,
+// returning the response together with the endpoint that served it
+func fetchWithFailover(endpoints []string, build func(base string) *http.Request) (*http.Response, string, error) {
+	err := errors.New("no endpoints configured")
+	for _, base := range endpoints {
+		var resp *http.Response
+		resp, err = fetchWithRetries(build(base))
+		if err == nil {
+			return resp, base, nil
+		}
+	}
+	return nil, "", err
+}
 
-	resp, err := fetchWithRetries(req)
+// Function to query Crt.sh, failing over to the configured mirrors
+func fetchFromCrtSh(ctx context.Context, domain string, opts crtShOptions, out chan<- Result) {
+	resp, endpoint, err := fetchWithFailover(opts.Endpoints, func(base string) *http.Request {
+		url := fmt.Sprintf("%s/?q=%%25.%s&output=json", strings.TrimRight(base, "/"), domain)
+		if opts.Deduplicate {
+			url += "&deduplicate=Y"
+		}
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		return req
+	})
 	if err != nil {
 		fmt.Println("Error querying Crt.sh:", err)
 		return
 	}
 	defer resp.Body.Close()
+	if endpoint != opts.Endpoints[0] {
+		fmt.Println("Crt.sh primary endpoint unavailable, results served by:", endpoint)
+	}
 
 	var results []map[string]interface{}
 	if err := json.NewDecoder(resp.Body).Decode(&results); err == nil {
 		for _, entry := range results {
-			if subdomain, ok := entry["name_value"].(string); ok {
-				addSubdomain(subdomain)
+			// A certificate entry lists every name it covers, one per line
+			if names, ok := entry["name_value"].(string); ok {
+				notBefore, _ := entry["not_before"].(string)
+				issued, _ := time.Parse("2006-01-02T15:04:05", notBefore)
+				for _, subdomain := range strings.Split(names, "\n") {
+					out <- Result{Host: subdomain, Source: "crtsh"}
+					recordFirstSeen(subdomain, issued)
+				}
 			}
 		}
 	}
 }
 
 // Function to query SecurityTrails
-func fetchFromSecurityTrails(domain string) {
-	defer wg.Done()
+func fetchFromSecurityTrails(ctx context.Context, domain string, opts securityTrailsOptions, out chan<- Result) {
 	if apiKeySecurityTrails == "" {
-		fmt.Println("SecurityTrails not configured. Skipping results.")
+		sourceNotConfigured("SecurityTrails")
 		return
 	}
 
-	url := fmt.Sprintf("https://api.securitytrails.com/v1/domain/%s/subdomains", domain)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("apikey", apiKeySecurityTrails)
-
-	resp, err := fetchWithRetries(req)
+	url := fmt.Sprintf("https://api.securitytrails.com/v1/domain/%s/subdomains?include_inactive=%t", domain, opts.IncludeInactive)
+	resp, err := fetchWithKeys("securitytrails", func(key string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Add("apikey", key)
+		return req
+	})
 	if err != nil {
 		fmt.Println("Error querying SecurityTrails:", err)
 		return
 	}
-	defer resp.Body.Close()
 
+	var subdomains []string
 	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if err == nil {
 		if subs, found := result["subdomains"].([]interface{}); found {
 			for _, sub := range subs {
-				addSubdomain(fmt.Sprintf("%s.%s", sub, domain))
+				subdomain := fmt.Sprintf("%s.%s", sub, domain)
+				subdomains = append(subdomains, subdomain)
+				out <- Result{Host: subdomain, Source: "securitytrails"}
+			}
+		}
+	}
+
+	if !opts.History {
+		return
+	}
+	// Historical records of the apex and the first subdomains found surface
+	// hosts and addresses that no longer exist in current DNS
+	for _, recordType := range []string{"a", "aaaa", "mx", "ns"} {
+		fetchSecurityTrailsHistory(ctx, domain, domain, recordType, opts.HistoryPages, out)
+	}
+	for i, subdomain := range subdomains {
+		if i >= opts.HistorySubdomains {
+			break
+		}
+		fetchSecurityTrailsHistory(ctx, domain, subdomain, "a", opts.HistoryPages, out)
+	}
+}
+
+// Function to read the SecurityTrails DNS history of a host for one record type
+func fetchSecurityTrailsHistory(ctx context.Context, domain, host, recordType string, pages int, out chan<- Result) {
+	for page := 1; page <= pages; page++ {
+		url := fmt.Sprintf("https://api.securitytrails.com/v1/history/%s/dns/%s?page=%d", host, recordType, page)
+		resp, err := fetchWithKeys("securitytrails", func(key string) *http.Request {
+			req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+			req.Header.Add("apikey", key)
+			return req
+		})
+		if err != nil {
+			fmt.Println("Error querying SecurityTrails history:", err)
+			return
+		}
+
+		var result struct {
+			Pages   int `json:"pages"`
+			Records []struct {
+				FirstSeen string `json:"first_seen"`
+				Values    []struct {
+					IP         string `json:"ip"`
+					IPv6       string `json:"ipv6"`
+					Host       string `json:"host"`
+					Nameserver string `json:"nameserver"`
+				} `json:"values"`
+			} `json:"records"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, record := range result.Records {
+			seen, _ := time.Parse("2006-01-02", record.FirstSeen)
+			recordFirstSeen(host, seen)
+			for _, value := range record.Values {
+				switch {
+				case value.IP != "":
+					out <- Result{Host: host, IP: value.IP, Source: "securitytrails"}
+				case value.IPv6 != "":
+					out <- Result{Host: host, IP: value.IPv6, Source: "securitytrails"}
+				}
+				// Mail and name servers inside the domain are hosts of their own
+				for _, name := range []string{value.Host, value.Nameserver} {
+					if hostname := scope.NormalizeHost(name); hostname != "" && scope.IsInScope(hostname, domain) {
+						out <- Result{Host: hostname, Source: "securitytrails"}
+						recordFirstSeen(hostname, seen)
+					}
+				}
 			}
 		}
+		if page >= result.Pages {
+			return
+		}
 	}
 }
 
 // Function to query Shodan
-func fetchFromShodan(domain string) {
-	defer wg.Done()
+func fetchFromShodan(ctx context.Context, domain string, out chan<- Result) {
 	if apiKeyShodan == "" {
-		fmt.Println("Shodan not configured. Skipping results.")
+		sourceNotConfigured("Shodan")
 		return
 	}
 
-	url := fmt.Sprintf("https://api.shodan.io/dns/domain/%s?key=%s", domain, apiKeyShodan)
-	req, _ := http.NewRequest("GET", url, nil)
-
-	resp, err := fetchWithRetries(req)
+	resp, err := fetchWithKeys("shodan", func(key string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://api.shodan.io/dns/domain/%s?key=%s", domain, key), nil)
+		return req
+	})
 	if err != nil {
 		fmt.Println("Error querying Shodan:", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	var result map[string]interface{}
+	var result struct {
+		Subdomains []string `json:"subdomains"`
+		Data       []struct {
+			Subdomain string `json:"subdomain"`
+			Type      string `json:"type"`
+			Value     string `json:"value"`
+		} `json:"data"`
+	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
-		if subs, found := result["subdomains"].([]interface{}); found {
-			for _, sub := range subs {
-				addSubdomain(fmt.Sprintf("%s.%s", sub, domain))
+		for _, sub := range result.Subdomains {
+			out <- Result{Host: fmt.Sprintf("%s.%s", sub, domain), Source: "shodan"}
+		}
+		// Address records carry the IP the subdomain resolved to
+		for _, record := range result.Data {
+			if record.Subdomain != "" && (record.Type == "A" || record.Type == "AAAA") {
+				out <- Result{Host: fmt.Sprintf("%s.%s", record.Subdomain, domain), IP: record.Value, Source: "shodan"}
 			}
 		}
 	}
 }
 
-// Function to query VirusTotal
-func fetchFromVirusTotal(domain string) {
-	defer wg.Done()
+// Function to query VirusTotal, following the result cursor up to the page cap
+func fetchFromVirusTotal(ctx context.Context, domain string, opts virusTotalOptions, out chan<- Result) {
 	if apiKeyVirusTotal == "" {
-		fmt.Println("VirusTotal not configured. Skipping results.")
+		sourceNotConfigured("VirusTotal")
+		return
+	}
+
+	start := resumeCursor("virustotal", domain, 0)
+	cursor := start.Next
+	for page := start.Page; page < opts.MaxPages; page++ {
+		endpoint := fmt.Sprintf("https://www.virustotal.com/api/v3/domains/%s/subdomains?limit=40", domain)
+		if cursor != "" {
+			endpoint += "&cursor=" + cursor
+		}
+		resp, err := fetchWithKeys("virustotal", func(key string) *http.Request {
+			req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+			req.Header.Add("x-apikey", key)
+			return req
+		})
+		if err != nil {
+			fmt.Println("Error querying VirusTotal:", err)
+			return
+		}
+
+		var result struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+			Meta struct {
+				Cursor string `json:"cursor"`
+			} `json:"meta"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, entry := range result.Data {
+			out <- Result{Host: entry.ID, Source: "virustotal"}
+		}
+		if result.Meta.Cursor == "" {
+			return
+		}
+		cursor = url.QueryEscape(result.Meta.Cursor)
+		saveCursor("virustotal", domain, sourceCursor{Page: page + 1, Next: cursor})
+	}
+}
+
+// Function to query LeakIX
+func fetchFromLeakIX(ctx context.Context, domain string, out chan<- Result) {
+	if apiKeyLeakIX == "" {
+		sourceNotConfigured("LeakIX")
+		return
+	}
+
+	url := fmt.Sprintf("https://leakix.net/api/subdomains/%s", domain)
+	resp, err := fetchWithKeys("leakix", func(key string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Add("api-key", key)
+		req.Header.Add("accept", "application/json")
+		return req
+	})
+	if err != nil {
+		fmt.Println("Error querying LeakIX:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var results []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err == nil {
+		for _, entry := range results {
+			if subdomain, ok := entry["subdomain"].(string); ok {
+				out <- Result{Host: subdomain, Source: "leakix"}
+			}
+		}
+	}
+}
+
+// Function to query ZoomEye host search, paging within the remaining quota
+func fetchFromZoomEye(ctx context.Context, domain string, opts zoomEyeOptions, out chan<- Result) {
+	authHeader, authValue := zoomEyeAuth(ctx)
+	if authHeader == "" {
+		sourceNotConfigured("ZoomEye")
+		return
+	}
+
+	pages := opts.MaxPages
+	if remaining, err := zoomEyeRemainingQuota(ctx, authHeader, authValue); err == nil && remaining < pages {
+		pages = remaining
+	}
+	if pages <= 0 {
+		fmt.Println("ZoomEye quota exhausted. Skipping results.")
 		return
 	}
 
-	url := fmt.Sprintf("https://www.virustotal.com/api/v3/domains/%s/subdomains", domain)
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("x-apikey", apiKeyVirusTotal)
+	query := url.QueryEscape("hostname:*." + domain)
+	for page := resumeCursor("zoomeye", domain, 1).Page; page <= pages; page++ {
+		endpoint := fmt.Sprintf("https://api.zoomeye.org/host/search?query=%s&page=%d", query, page)
+		req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		req.Header.Add(authHeader, authValue)
+
+		resp, err := fetchWithRetries(req)
+		if err != nil {
+			fmt.Println("Error querying ZoomEye:", err)
+			return
+		}
+
+		var result struct {
+			Total   int `json:"total"`
+			Matches []struct {
+				IP       string `json:"ip"`
+				PortInfo struct {
+					Hostname string `json:"hostname"`
+					Port     int    `json:"port"`
+				} `json:"portinfo"`
+			} `json:"matches"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, match := range result.Matches {
+			if match.PortInfo.Hostname != "" {
+				out <- Result{Host: match.PortInfo.Hostname, IP: match.IP, Port: match.PortInfo.Port, Source: "zoomeye"}
+			}
+		}
+		if len(result.Matches) == 0 || page*zoomEyePageSize >= result.Total {
+			return
+		}
+		saveCursor("zoomeye", domain, sourceCursor{Page: page + 1})
+	}
+}
+
+// Build the ZoomEye auth header, preferring an API key over a JWT login
+func zoomEyeAuth(ctx context.Context) (string, string) {
+	if apiKeyZoomEye != "" {
+		return "API-KEY", nextKey("zoomeye")
+	}
+	if zoomEyeUsername == "" || zoomEyePassword == "" {
+		return "", ""
+	}
+
+	body, _ := json.Marshal(map[string]string{"username": zoomEyeUsername, "password": zoomEyePassword})
+	req, _ := http.NewRequestWithContext(ctx, "POST", "https://api.zoomeye.org/user/login", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error logging in to ZoomEye:", err)
+		return "", ""
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.AccessToken == "" {
+		fmt.Println("Error logging in to ZoomEye: no access token returned")
+		return "", ""
+	}
+	return "Authorization", "JWT " + result.AccessToken
+}
+
+// Ask ZoomEye how many search requests are left on the account
+func zoomEyeRemainingQuota(ctx context.Context, authHeader, authValue string) (int, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://api.zoomeye.org/resources-info", nil)
+	req.Header.Add(authHeader, authValue)
 
 	resp, err := fetchWithRetries(req)
 	if err != nil {
-		fmt.Println("Error querying VirusTotal:", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Resources struct {
+			Search int `json:"search"`
+		} `json:"resources"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, err
+	}
+	return result.Resources.Search, nil
+}
+
+// Function to query FOFA
+func fetchFromFofa(ctx context.Context, domain string, opts fofaOptions, out chan<- Result) {
+	if fofaEmail == "" || apiKeyFofa == "" {
+		sourceNotConfigured("FOFA")
+		return
+	}
+
+	query := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`domain="%s"`, domain)))
+	resp, err := fetchWithKeys("fofa", func(key string) *http.Request {
+		email, key, _ := strings.Cut(key, ":")
+		params := url.Values{}
+		params.Set("email", email)
+		params.Set("key", key)
+		params.Set("qbase64", query)
+		params.Set("fields", "host,ip,port")
+		params.Set("size", fmt.Sprint(opts.Size))
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://fofa.info/api/v1/search/all?"+params.Encode(), nil)
+		return req
+	})
+	if err != nil {
+		fmt.Println("Error querying FOFA:", err)
 		return
 	}
 	defer resp.Body.Close()
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
-		if data, found := result["data"].([]interface{}); found {
-			for _, entry := range data {
-				if subdomain, ok := entry.(string); ok {
-					addSubdomain(subdomain)
-				}
+	var result struct {
+		Error   bool          `json:"error"`
+		ErrMsg  string        `json:"errmsg"`
+		Results []interface{} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return
+	}
+	if result.Error {
+		fmt.Println("Error querying FOFA:", result.ErrMsg)
+		return
+	}
+
+	// With a single field FOFA returns plain strings, otherwise one array per
+	// row holding host, ip and port
+	for _, row := range result.Results {
+		var fields []string
+		switch value := row.(type) {
+		case string:
+			fields = []string{value}
+		case []interface{}:
+			for _, field := range value {
+				text, _ := field.(string)
+				fields = append(fields, text)
 			}
 		}
+		if len(fields) == 0 {
+			continue
+		}
+
+		found := Result{Host: extractHostname(fields[0]), Source: "fofa"}
+		if len(fields) >= 3 {
+			found.IP = fields[1]
+			found.Port, _ = strconv.Atoi(fields[2])
+		}
+		if found.Host != "" {
+			out <- found
+		}
 	}
 }
 
-// Function to add subdomains avoiding duplicates
-func addSubdomain(subdomain string) {
-	mu.Lock() // Mutex to avoid race conditions
-	defer mu.Unlock()
+// Function to query Hunter.how over the configured time range
+func fetchFromHunterHow(ctx context.Context, domain string, opts hunterHowOptions, out chan<- Result) {
+	if apiKeyHunterHow == "" {
+		sourceNotConfigured("Hunter.how")
+		return
+	}
+
+	end := time.Now()
+	start := end.AddDate(0, 0, -opts.Days)
+	query := base64.URLEncoding.EncodeToString([]byte(fmt.Sprintf(`domain.suffix="%s"`, domain)))
+
+	for page := resumeCursor("hunterhow", domain, 1).Page; page <= opts.MaxPages; page++ {
+		resp, err := fetchWithKeys("hunterhow", func(key string) *http.Request {
+			params := url.Values{}
+			params.Set("api-key", key)
+			params.Set("query", query)
+			params.Set("page", fmt.Sprint(page))
+			params.Set("page_size", fmt.Sprint(hunterHowPageSize))
+			params.Set("start_time", start.Format("2006-01-02"))
+			params.Set("end_time", end.Format("2006-01-02"))
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://api.hunter.how/search?"+params.Encode(), nil)
+			return req
+		})
+		if err != nil {
+			fmt.Println("Error querying Hunter.how:", err)
+			return
+		}
+
+		var result struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Total int `json:"total"`
+				List  []struct {
+					Domain string `json:"domain"`
+					IP     string `json:"ip"`
+					Port   int    `json:"port"`
+				} `json:"list"`
+			} `json:"data"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+		if result.Code != 200 {
+			fmt.Println("Error querying Hunter.how:", result.Message)
+			return
+		}
+
+		for _, entry := range result.Data.List {
+			if entry.Domain != "" {
+				out <- Result{Host: entry.Domain, IP: entry.IP, Port: entry.Port, Source: "hunterhow"}
+			}
+		}
+		if len(result.Data.List) == 0 || page*hunterHowPageSize >= result.Data.Total {
+			return
+		}
+		saveCursor("hunterhow", domain, sourceCursor{Page: page + 1})
+	}
+}
+
+// Function to query the Intelligence X phonebook, paging through the selectors
+func fetchFromIntelX(ctx context.Context, domain string, opts intelXOptions, out chan<- Result) {
+	if apiKeyIntelX == "" {
+		sourceNotConfigured("IntelX")
+		return
+	}
 
-	// Ignore subdomains containing '*'
-	if containsWildcard(subdomain) {
-		fmt.Println("Ignoring subdomain with wildcard:", subdomain)
+	// Results can only be read with the key that started the search
+	key := nextKey("intelx")
+	base := "https://" + opts.Host
+	body, _ := json.Marshal(map[string]interface{}{
+		"term":       domain,
+		"maxresults": opts.MaxResults,
+		"media":      0,
+		"target":     1, // domains
+		"timeout":    20,
+	})
+	req, _ := http.NewRequestWithContext(ctx, "POST", base+"/phonebook/search", bytes.NewReader(body))
+	req.Header.Add("x-key", key)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error querying IntelX:", err)
+		return
+	}
+	var search struct {
+		ID string `json:"id"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&search)
+	resp.Body.Close()
+	if err != nil || search.ID == "" {
+		fmt.Println("Error querying IntelX: search was not accepted")
 		return
 	}
 
-	if _, exists := uniqueSubs[subdomain]; !exists {
-		uniqueSubs[subdomain] = struct{}{}
-		fmt.Println("Subdomain found:", subdomain)
+	// Status 0 means more results may follow, 3 means none are ready yet
+	for poll := 0; poll < opts.MaxPolls; poll++ {
+		endpoint := fmt.Sprintf("%s/phonebook/search/result?id=%s&limit=%d", base, search.ID, opts.MaxResults)
+		req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		req.Header.Add("x-key", key)
+
+		resp, err := fetchWithRetries(req)
+		if err != nil {
+			fmt.Println("Error querying IntelX:", err)
+			return
+		}
+
+		var result struct {
+			Status    int `json:"status"`
+			Selectors []struct {
+				Value string `json:"selectorvalue"`
+				Type  int    `json:"selectortype"`
+			} `json:"selectors"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, selector := range result.Selectors {
+			if selector.Type == intelXDomainType {
+				out <- Result{Host: selector.Value, Source: "intelx"}
+			}
+		}
+		switch result.Status {
+		case 1, 2:
+			return
+		case 3:
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
 }
 
-// Function to check if a subdomain contains a wildcard '*'
-func containsWildcard(subdomain string) bool {
-	return len(subdomain) > 0 && subdomain[0] == '*'
+// Function to query the WhoisXML API Subdomain Lookup
+func fetchFromWhoisXML(ctx context.Context, domain string, out chan<- Result) {
+	if apiKeyWhoisXML == "" {
+		sourceNotConfigured("WhoisXML")
+		return
+	}
+
+	resp, err := fetchWithKeys("whoisxml", func(key string) *http.Request {
+		endpoint := fmt.Sprintf("https://subdomains.whoisxmlapi.com/api/v1?apiKey=%s&domainName=%s&outputFormat=JSON", key, domain)
+		req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		return req
+	})
+	var statusErr statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusForbidden {
+		fmt.Println("WhoisXML credits exhausted or API key rejected. Skipping results.")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error querying WhoisXML:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result struct {
+			Count   int `json:"count"`
+			Records []struct {
+				Domain    string `json:"domain"`
+				FirstSeen int64  `json:"firstSeen"`
+			} `json:"records"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return
+	}
+
+	for _, record := range result.Result.Records {
+		out <- Result{Host: record.Domain, Source: "whoisxml"}
+		if record.FirstSeen > 0 {
+			recordFirstSeen(record.Domain, time.Unix(record.FirstSeen, 0))
+		}
+	}
+	// The lookup has no cursor, so a count above the records returned means the
+	// result set was capped on the provider side
+	if result.Result.Count > len(result.Result.Records) {
+		fmt.Printf("WhoisXML returned %d of %d subdomains.\n", len(result.Result.Records), result.Result.Count)
+	}
 }
 
-// Function to print all found subdomains
-func printAllSubdomains() {
-	fmt.Println("\n=== Unique Subdomains Found ===")
-	for subdomain := range uniqueSubs {
-		fmt.Println(subdomain)
+// Build PassiveTotal requests authenticated with a "user:key" credential
+func passiveTotalRequest(ctx context.Context, endpoint string) func(key string) *http.Request {
+	return func(key string) *http.Request {
+		username, key, _ := strings.Cut(key, ":")
+		req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+		req.SetBasicAuth(username, key)
+		return req
 	}
-	fmt.Println("==============================")
 }
 
-func main() {
-	domain := flag.String("domain", "", "Domain to search")
-	concurrencyFlag := flag.Int("concurrency", defaultConcurrency, "Number of concurrent goroutines")
-	proxyFlag := flag.String("proxy", "", "Proxy URL (optional)")
-	flag.Parse()
+// Function to query RiskIQ PassiveTotal (Microsoft Defender EASM) for child
+// hostnames and the passive DNS history of the domain
+func fetchFromPassiveTotal(ctx context.Context, domain string, out chan<- Result) {
+	if passiveTotalUsername == "" || apiKeyPassiveTotal == "" {
+		sourceNotConfigured("PassiveTotal")
+		return
+	}
 
-	if *domain == "" {
-		fmt.Println("Usage: go run main.go -domain example.com")
+	resp, err := fetchWithKeys("passivetotal", passiveTotalRequest(ctx, "https://api.passivetotal.org/v2/enrichment/subdomains?query="+domain))
+	if err != nil {
+		fmt.Println("Error querying PassiveTotal:", err)
+		return
+	}
+	var children struct {
+		Subdomains []string `json:"subdomains"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&children)
+	resp.Body.Close()
+	if err == nil {
+		for _, sub := range children.Subdomains {
+			out <- Result{Host: fmt.Sprintf("%s.%s", sub, domain), Source: "passivetotal"}
+		}
+	}
+
+	resp, err = fetchWithKeys("passivetotal", passiveTotalRequest(ctx, "https://api.passivetotal.org/v2/dns/passive?query="+domain))
+	if err != nil {
+		fmt.Println("Error querying PassiveTotal passive DNS:", err)
 		return
 	}
+	defer resp.Body.Close()
 
-	concurrency = *concurrencyFlag
-	proxyURL = *proxyFlag
+	var history struct {
+		FirstSeen string `json:"firstSeen"`
+		Results   []struct {
+			Resolve   string `json:"resolve"`
+			FirstSeen string `json:"firstSeen"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return
+	}
+	if seen, err := time.Parse("2006-01-02 15:04:05", history.FirstSeen); err == nil {
+		recordFirstSeen(domain, seen)
+	}
+	// Historical CNAME/MX/NS answers may point at other hosts of the domain
+	for _, record := range history.Results {
+		if hostname := scope.NormalizeHost(record.Resolve); hostname != domain && scope.IsInScope(hostname, domain) {
+			out <- Result{Host: hostname, Source: "passivetotal"}
+			if seen, err := time.Parse("2006-01-02 15:04:05", record.FirstSeen); err == nil {
+				recordFirstSeen(hostname, seen)
+			}
+		}
+	}
+}
 
-	// Configure the HTTP client
-	configureHTTPClient()
+// Function to query the 360 Quake service search
+func fetchFromQuake(ctx context.Context, domain string, opts quakeOptions, out chan<- Result) {
+	if apiKeyQuake == "" {
+		sourceNotConfigured("Quake")
+		return
+	}
+
+	for page := resumeCursor("quake", domain, 0).Page; page < opts.MaxPages; page++ {
+		body, _ := json.Marshal(map[string]interface{}{
+			"query": fmt.Sprintf(`domain:"%s"`, domain),
+			"start": page * quakePageSize,
+			"size":  quakePageSize,
+		})
+		req, _ := http.NewRequestWithContext(ctx, "POST", "https://quake.360.net/api/v3/search/quake_service", bytes.NewReader(body))
+		req.Header.Add("X-QuakeToken", nextKey("quake"))
+		req.Header.Add("Content-Type", "application/json")
+
+		resp, err := fetchWithRetries(req)
+		if err != nil {
+			fmt.Println("Error querying Quake:", err)
+			return
+		}
 
-	subdomainChan = make(chan string, concurrency)
+		var result struct {
+			Code    interface{} `json:"code"`
+			Message string      `json:"message"`
+			Data    []struct {
+				IP      string `json:"ip"`
+				Port    int    `json:"port"`
+				Domain  string `json:"domain"`
+				Service struct {
+					HTTP struct {
+						Host string `json:"host"`
+					} `json:"http"`
+				} `json:"service"`
+			} `json:"data"`
+			Meta struct {
+				Pagination struct {
+					Total int `json:"total"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+		// Quake answers 200 with a non-zero code for auth and quota errors
+		if code := fmt.Sprint(result.Code); code != "0" {
+			fmt.Println("Error querying Quake:", result.Message)
+			return
+		}
 
-	// Execute subdomain search
-	wg.Add(4)
-	go fetchFromCrtSh(*domain)
-	go fetchFromSecurityTrails(*domain)
-	go fetchFromShodan(*domain)
-	go fetchFromVirusTotal(*domain)
+		for _, entry := range result.Data {
+			host := entry.Service.HTTP.Host
+			if host == "" {
+				host = entry.Domain
+			}
+			if host != "" {
+				out <- Result{Host: extractHostname(host), IP: entry.IP, Port: entry.Port, Source: "quake"}
+			}
+		}
+		if len(result.Data) == 0 || (page+1)*quakePageSize >= result.Meta.Pagination.Total {
+			return
+		}
+		saveCursor("quake", domain, sourceCursor{Page: page + 1})
+	}
+}
+
+// Function to query BeVigil, which extracts hostnames from published mobile apps
+func fetchFromBeVigil(ctx context.Context, domain string, out chan<- Result) {
+	if apiKeyBeVigil == "" {
+		sourceNotConfigured("BeVigil")
+		return
+	}
+
+	url := fmt.Sprintf("https://osint.bevigil.com/api/%s/subdomains/", domain)
+	resp, err := fetchWithKeys("bevigil", func(key string) *http.Request {
+		req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+		req.Header.Add("X-Access-Token", key)
+		return req
+	})
+	if err != nil {
+		fmt.Println("Error querying BeVigil:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Subdomains []string `json:"subdomains"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil {
+		for _, subdomain := range result.Subdomains {
+			out <- Result{Host: subdomain, Source: "bevigil"}
+		}
+	}
+}
+
+// Function to query the Wayback Machine CDX index, keeping the first capture
+// of every hostname
+func fetchFromWayback(ctx context.Context, domain string, opts waybackOptions, out chan<- Result) {
+	endpoint := fmt.Sprintf("https://web.archive.org/cdx/search/cdx?url=*.%s&fl=original,timestamp&collapse=urlkey&output=json&limit=%d", domain, opts.Limit)
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error querying Wayback Machine:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// The first row is the field header
+	var rows [][]string
+	if err := json.NewDecoder(resp.Body).Decode(&rows); err != nil || len(rows) < 2 {
+		return
+	}
+	for _, row := range rows[1:] {
+		if len(row) < 2 {
+			continue
+		}
+		hostname := scope.NormalizeHost(row[0])
+		if !scope.IsInScope(hostname, domain) {
+			continue
+		}
+		captured, _ := time.Parse("20060102150405", row[1])
+		out <- Result{Host: hostname, Source: "wayback"}
+		recordFirstSeen(hostname, captured)
+	}
+}
+
+// Function to query ThreatMiner
+func fetchFromThreatMiner(ctx context.Context, domain string, out chan<- Result) {
+	url := fmt.Sprintf("https://api.threatminer.org/v2/domain.php?q=%s&rt=5", domain)
+	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error querying ThreatMiner:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		StatusCode string   `json:"status_code"`
+		Results    []string `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.StatusCode == "200" {
+		for _, subdomain := range result.Results {
+			out <- Result{Host: subdomain, Source: "threatminer"}
+		}
+	}
+}
+
+// Function to query Subdomain Center, which aggregates several crawlers and
+// answers with a plain JSON list of hostnames
+func fetchFromSubdomainCenter(ctx context.Context, domain string, out chan<- Result) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://api.subdomain.center/?domain="+url.QueryEscape(domain), nil)
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error querying Subdomain Center:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	var subdomains []string
+	if err := json.NewDecoder(resp.Body).Decode(&subdomains); err == nil {
+		for _, subdomain := range subdomains {
+			out <- Result{Host: subdomain, Source: "subdomaincenter"}
+		}
+	}
+}
+
+// Pattern for the hostname links in the DNSRepo search page
+var dnsRepoHostPattern = regexp.MustCompile(`href="[^"]*\?domain=([^"&]+)"`)
+
+// Function to query DNSRepo, using its API when a key is configured and the
+// public search page otherwise
+func fetchFromDNSRepo(ctx context.Context, domain string, out chan<- Result) {
+	if apiKeyDNSRepo != "" {
+		resp, err := fetchWithKeys("dnsrepo", func(key string) *http.Request {
+			params := url.Values{}
+			params.Set("apikey", key)
+			params.Set("search", domain)
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://dnsrepo.noc.org/api/?"+params.Encode(), nil)
+			return req
+		})
+		if err != nil {
+			fmt.Println("Error querying DNSRepo:", err)
+			return
+		}
+		defer resp.Body.Close()
+
+		var results []struct {
+			Domain string `json:"domain"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&results); err == nil {
+			for _, entry := range results {
+				if hostname := scope.NormalizeHost(entry.Domain); scope.IsInScope(hostname, domain) {
+					out <- Result{Host: hostname, Source: "dnsrepo"}
+				}
+			}
+		}
+		return
+	}
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", "https://dnsrepo.noc.org/?domain="+url.QueryEscape(domain), nil)
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		fmt.Println("Error querying DNSRepo:", err)
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return
+	}
+	for _, match := range dnsRepoHostPattern.FindAllSubmatch(body, -1) {
+		hostname, err := url.QueryUnescape(string(match[1]))
+		if err != nil {
+			continue
+		}
+		if hostname = scope.NormalizeHost(hostname); hostname != domain && scope.IsInScope(hostname, domain) {
+			out <- Result{Host: hostname, Source: "dnsrepo"}
+		}
+	}
+}
+
+// Patterns for the SiteDossier parentdomain listing
+var (
+	siteDossierHostPattern = regexp.MustCompile(`<a href="/site/([^"]+)">`)
+	siteDossierNextPattern = regexp.MustCompile(`<a href="(/parentdomain/[^"]+)"><b>Show next 100 items</b></a>`)
+)
+
+// Function to scrape SiteDossier, following the "show next 100 items" links
+func fetchFromSiteDossier(ctx context.Context, domain string, opts siteDossierOptions, out chan<- Result) {
+	start := resumeCursor("sitedossier", domain, 0)
+	next := "/parentdomain/" + domain
+	if start.Next != "" {
+		next = start.Next
+	}
+	for page := start.Page; page < opts.MaxPages && next != ""; page++ {
+		req, _ := http.NewRequestWithContext(ctx, "GET", "http://www.sitedossier.com"+next, nil)
+
+		resp, err := fetchWithRetries(req)
+		if err != nil {
+			fmt.Println("Error querying SiteDossier:", err)
+			return
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return
+		}
+
+		for _, match := range siteDossierHostPattern.FindAllSubmatch(body, -1) {
+			out <- Result{Host: strings.TrimSuffix(string(match[1]), "/"), Source: "sitedossier"}
+		}
+
+		next = ""
+		if match := siteDossierNextPattern.FindSubmatch(body); match != nil {
+			next = string(match[1])
+		}
+		saveCursor("sitedossier", domain, sourceCursor{Page: page + 1, Next: next})
+	}
+}
+
+// Strip the scheme, port and path from a host or URL returned by a source
+func extractHostname(raw string) string {
+	if strings.Contains(raw, "://") {
+		if parsed, err := url.Parse(raw); err == nil {
+			return parsed.Hostname()
+		}
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(raw); err == nil {
+		return host
+	}
+	return raw
+}
+
+// Report a source that cannot run with the current configuration
+func sourceNotConfigured(name string) {
+	fmt.Println(name + " not configured. Skipping results.")
+	mu.Lock()
+	defer mu.Unlock()
+	initFailures = append(initFailures, name)
+}
+
+// Register the API and scraping sources defined in this file
+func init() {
+	for _, source := range []sourceFunc{
+		{"crtsh", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			if crtShDatabase {
+				fetchFromCrtShDB(ctx, domain, session.Config.Sources.CrtSh, out)
+				return
+			}
+			fetchFromCrtSh(ctx, domain, session.Config.Sources.CrtSh, out)
+		}},
+		{"securitytrails", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromSecurityTrails(ctx, domain, session.Config.Sources.SecurityTrails, out)
+		}},
+		{"shodan", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromShodan(ctx, domain, out)
+		}},
+		{"virustotal", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromVirusTotal(ctx, domain, session.Config.Sources.VirusTotal, out)
+		}},
+		{"leakix", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromLeakIX(ctx, domain, out)
+		}},
+		{"zoomeye", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromZoomEye(ctx, domain, session.Config.Sources.ZoomEye, out)
+		}},
+		{"fofa", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromFofa(ctx, domain, session.Config.Sources.Fofa, out)
+		}},
+		{"hunterhow", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromHunterHow(ctx, domain, session.Config.Sources.HunterHow, out)
+		}},
+		{"intelx", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromIntelX(ctx, domain, session.Config.Sources.IntelX, out)
+		}},
+		{"whoisxml", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromWhoisXML(ctx, domain, out)
+		}},
+		{"passivetotal", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromPassiveTotal(ctx, domain, out)
+		}},
+		{"quake", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromQuake(ctx, domain, session.Config.Sources.Quake, out)
+		}},
+		{"bevigil", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromBeVigil(ctx, domain, out)
+		}},
+		{"wayback", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromWayback(ctx, domain, session.Config.Sources.Wayback, out)
+		}},
+		{"sitedossier", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromSiteDossier(ctx, domain, session.Config.Sources.SiteDossier, out)
+		}},
+		{"threatminer", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromThreatMiner(ctx, domain, out)
+		}},
+		{"dnsrepo", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromDNSRepo(ctx, domain, out)
+		}},
+		{"subdomaincenter", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromSubdomainCenter(ctx, domain, out)
+		}},
+	} {
+		registerSource(source)
+	}
+}
+
+func main() {
+	var domains listFlag
+	flag.Var(&domains, "domain", "Domain to search; repeat the flag or separate domains with commas")
+	domainListFlag := flag.String("dL", "", "File with one target domain per line")
+	concurrencyFlag := flag.Int("concurrency", defaultConcurrency, "Number of workers of each stage: sources run, names resolved, hosts probed and ports scanned at a time")
+	proxyFlag := flag.String("proxy", "", "Proxy URL (optional)")
+	mockFlag := flag.String("mock", "", "Directory of canned responses the sources read instead of the network, for testing")
+	configFlag := flag.String("config", "", "Path to a JSON, YAML or TOML configuration file (default ~/.config/leviathanmapper/config.yaml if it exists)")
+	sourcesFlag := flag.String("sources", "", "Comma-separated list of sources to run (default all)")
+	pluginsFlag := flag.String("plugins", "", "Directory of executables run as additional sources (default ~/.config/leviathanmapper/plugins if it exists)")
+	strictFlag := flag.Bool("strict", false, "Exit with status 1 if any requested source fails to initialize")
+	crtShDBFlag := flag.Bool("crtsh-db", false, "Query the public crt.sh PostgreSQL database instead of its HTTP endpoint")
+	resolveFlag := flag.Bool("resolve", false, "Resolve every discovered name to its A/AAAA records")
+	resolverRateFlag := flag.Float64("resolver-rate", 0, "Maximum queries per second sent to each resolver (default no limit)")
+	massDNSFlag := flag.String("massdns", "", "Path to a massdns binary used for brute forcing and resolution")
+	validateFlag := flag.Bool("validate", false, "Check every name that resolved again on trusted resolvers and drop the ones they do not confirm")
+	trustedResolversFlag := flag.String("trusted-resolvers", "", "File of trusted resolvers for -validate, in the format of -r (default Google and Cloudflare)")
+	dohFlag := flag.String("doh", "", "Resolve over DNS-over-HTTPS: cloudflare, google, quad9 or endpoint URLs, comma-separated")
+	axfrFlag := flag.Bool("axfr", false, "Attempt a zone transfer against every nameserver of the target")
+	ptrSweepFlag := flag.Bool("ptr-sweep", false, "Look up the PTR records of the /24 around every resolved address (requires -resolve)")
+	mailFlag := flag.Bool("mail", false, "Mine the MX, SPF and DMARC records of the target for mail and SaaS providers and in-scope hostnames")
+	recordsFlag := flag.Bool("records", false, "Gather the MX, NS, TXT, SRV and SOA records of the target and every subdomain")
+	zoneWalkFlag := flag.Bool("zonewalk", false, "Enumerate DNSSEC-signed zones by walking NSEC records or cracking NSEC3 hashes")
+	wordlistFlag := flag.String("w", "", "Wordlist whose words are resolved as subdomains of the target")
+	recursiveFlag := flag.Bool("recursive", false, "Run the sources that support it again against the discovered subdomains")
+	depthFlag := flag.Int("depth", 1, "Levels below the target enumerated by -recursive")
+	permuteFlag := flag.Bool("permute", false, "Resolve permutations of the discovered names once the sources finish")
+	permuteWordsFlag := flag.String("permute-words", "", "Word bank for -permute, one word per line (default built-in list)")
+	permuteLimitFlag := flag.Int("permute-limit", 50000, "Maximum permutations resolved per target, 0 for no limit")
+	resolversFlag := flag.String("r", "", "File with one DNS resolver per line (IP, IP:port, tls://host or DNS-over-HTTPS URL) used in turn by -resolve")
+	dropNXDomainFlag := flag.Bool("drop-nxdomain", false, "With -resolve, drop names that do not exist (NXDOMAIN)")
+	onlyResolvedFlag := flag.Bool("only-resolved", false, "With -resolve, drop names that did not resolve to any address")
+	flag.BoolVar(onlyResolvedFlag, "nW", false, "Short for -only-resolved")
+	dnssecFlag := flag.Bool("dnssec", false, "Check whether each name is in a signed zone and validates with DNSSEC")
+	probeFlag := flag.Bool("probe", false, "Probe every resolved host over HTTP and HTTPS and mark it alive or dead (requires -resolve)")
+	urlsFlag := flag.String("urls", "", "File receiving the URLs of the live web services found by -probe, one per line")
+	portsFlag := flag.String("ports", "", "Comma-separated ports probed by -probe, or web for the common web ports (default 80,443)")
+	techFlag := flag.String("tech", "", "Keep only the probed hosts running one of these comma-separated technologies, e.g. WordPress,Jenkins")
+	asnLookupFlag := flag.Bool("asn-lookup", false, "Look up the ASN and organization of every resolved address via Team Cymru and group the hosts by ASN (requires -resolve)")
+	byIPFlag := flag.Bool("by-ip", false, "After the results, list every resolved IP with the subdomains pointing at it (requires -resolve)")
+	rdapFlag := flag.Bool("rdap", false, "Look up the registrar and creation date of the apex and the owner of every resolved netblock over RDAP")
+	cloudFlag := flag.Bool("cloud", false, "Tag resolved addresses with the cloud provider and region holding them, from the published AWS, Azure, GCP, Oracle and DigitalOcean ranges (requires -resolve)")
+	asnFlag := flag.String("asn", "", "Comma-separated ASNs whose announced IPv4 prefixes are swept for in-scope PTR records and TLS certificates, e.g. AS12345")
+	asnExpandFlag := flag.Bool("asn-expand", false, "Sweep the announced prefixes of the ASNs found by -asn-lookup for hosts not behind a CDN, like -asn")
+	portScanFlag := flag.Bool("port-scan", false, "Scan the resolved addresses not behind a CDN for open TCP ports (requires -resolve)")
+	topPortsFlag := flag.Int("top-ports", 100, "Number of most common TCP ports scanned by -port-scan, up to 100")
+	scanTypeFlag := flag.String("scan-type", "connect", "How -port-scan tests ports: connect, or syn for a half-open scan needing root on Linux")
+	bannersFlag := flag.Bool("banners", false, "Grab the banner and TLS certificate of the open ports found by -port-scan and guess their service")
+	storeResponsesFlag := flag.String("store-responses", "", "Directory receiving the headers and bodies of the responses read by -probe, one file per host")
+	vantageFlag := flag.String("vantage", "", "Comma-separated proxies from which the live services found by -probe are fetched again, reporting the hosts that answer differently")
+	vantageWorkersFlag := flag.Bool("vantage-workers", false, "In coordinator mode, have every worker fetch the live services its peers probed and report the hosts that answer differently")
+	jarmFlag := flag.Bool("jarm", false, "Compute the JARM fingerprint of the probed HTTPS services and group the hosts sharing one (requires -probe)")
+	filterCDNFlag := flag.Bool("filter-cdn", false, "Skip the addresses of CDN-fronted hosts in the stages that scan IPs (-ptr-sweep, -internetdb)")
+	takeoverFlag := flag.Bool("takeover", false, "Flag names whose CNAME points at an unclaimed resource of a third-party service (requires -resolve)")
+	internetDBFlag := flag.Bool("internetdb", false, "Enrich resolved IPs with open ports, CPEs and vulns from Shodan InternetDB")
+	formatFlag := flag.String("format", "", "Go template used to print each result, e.g. '{{.Host}},{{.IP}},{{.Source}}'")
+	jsonFlag := flag.Bool("json", false, "Print every final result as a JSON object per line")
+	unicodeFlag := flag.Bool("unicode", false, "Show internationalized names in Unicode instead of Punycode")
+	dedupFlag := flag.String("dedup", string(dedupHost), "Uniqueness key for results: host, host+ip or host+port")
+	canaryFlag := flag.String("canary", "", "Identifier appended to the User-Agent of every request (optional)")
+	canaryPatternFlag := flag.String("canary-pattern", "", "Marker name resolved under the target with every -w batch, e.g. 'lm-{id}-{n}': {id} is the -canary identifier and {n} numbers the markers")
+	historyFlag := flag.String("history", "", "Directory where the hosts found for each target are recorded (optional)")
+	newOnlyFlag := flag.Bool("new-only", false, "Only report hosts never seen in previous runs (requires -history)")
+	notifyFlag := flag.String("notify", "", "Channels notified when each target finishes and of new hosts: slack, discord, telegram, email (comma-separated)")
+	emailDigestFlag := flag.String("email-digest", "", "Email a digest of new hosts every period (daily, weekly or e.g. 72h) instead of after each run (requires -notify email and -history)")
+	quietHoursFlag := flag.String("quiet-hours", "", "Daily window in which no active stage runs, e.g. 08:00-18:00; stages due in it wait until it ends")
+	quietTimezoneFlag := flag.String("quiet-timezone", "", "Time zone of -quiet-hours, e.g. Europe/Madrid (default local time)")
+	reportDirFlag := flag.String("report-dir", "", "Directory where a Markdown and an HTML digest of the hosts new and gone for each target are written every -report-period (requires -history)")
+	reportPeriodFlag := flag.String("report-period", "weekly", "Period of the -report-dir digests: daily, weekly or a duration such as 72h")
+	recheckFlag := flag.Int("recheck", 0, "Resolve hosts reported only by a -low-confidence source again in the next N runs, dropping them if they never resolve (requires -history)")
+	lowConfidenceFlag := flag.String("low-confidence", strings.Join(defaultLowConfidenceSources, ","), "Comma-separated sources whose hosts -recheck verifies when no other source reports them")
+	diffFlag := flag.Bool("diff", false, "Only report hosts new or disappeared since the previous run (requires -history)")
+	bestEffortFlag := flag.Bool("best-effort", false, "Skip sources that fail to initialize and keep going (default)")
+	flag.Var(globFlag{&resultFilter.Include}, "include", "Only keep hosts matching these globs, e.g. '*.prod.*' (comma-separated, repeatable)")
+	flag.Var(globFlag{&resultFilter.Exclude}, "exclude", "Drop hosts matching these globs, e.g. '*.dev.example.com' (comma-separated, repeatable)")
+	flag.Var(regexpFlag{&resultFilter.Include}, "include-regex", "Only keep hosts matching this regular expression (repeatable)")
+	flag.Var(regexpFlag{&resultFilter.Exclude}, "exclude-regex", "Drop hosts matching this regular expression (repeatable)")
+	scopeFlag := flag.String("scope", "", "Burp Suite scope JSON or file with one host/glob per line ('-' or '!' to exclude); findings are tagged in or out of scope")
+	scopeOnlyFlag := flag.Bool("scope-only", false, "Drop findings outside -scope instead of tagging them")
+	var importFlags listFlag
+	flag.Var(&importFlags, "import", "Output of a previous run whose hosts are treated as already known (comma-separated, repeatable)")
+	resumeFlag := flag.Bool("resume", false, "Checkpoint the run and continue an interrupted one from its checkpoint, skipping finished targets and sources")
+	envFileFlag := flag.String("env-file", "", "File with API keys as NAME=value lines (default .env in the working directory, if present)")
+	providerConfigFlag := flag.String("provider-config", "", "YAML file listing several API keys per source, used in rotation (optional)")
+	timeoutFlag := flag.Duration("timeout", defaultTimeout, "Timeout of each request")
+	sourceTimeoutFlag := flag.String("source-timeout", "", "Comma-separated request timeouts of individual sources, e.g. crtsh=2m,wayback=90s (default crtsh=90s, wayback=60s, threatminer, intelx and subdomaincenter 30s)")
+	rateLimitFlag := flag.Float64("rate-limit", 0, "Maximum number of requests started per second across all sources (default no limit)")
+	listenFlag := flag.String("listen", ":8080", "Address the REST API listens on in server mode")
+	jobsDirFlag := flag.String("jobs-dir", "", "Directory where server mode keeps its jobs, so they survive restarts")
+	redisFlag := flag.String("redis", "", "Redis URL of the distributed mode, e.g. redis://:password@localhost:6379/0")
+	chunkSizeFlag := flag.Int("chunk-size", 5000, "Words of the -w wordlist in each task queued by the coordinator")
+	// "leviathanmapper server" serves the REST API instead of scanning the
+	// given targets, "coordinator" hands them to the workers of the
+	// distributed mode and "worker" runs the tasks of the coordinators. The
+	// other flags apply to every job or task. "project export FILE" bundles
+	// the files the flags point at and "project import FILE [DIR]" unpacks
+	// them.
+	mode := ""
+	var projectAction, projectFile, projectDir string
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "server", "coordinator", "worker":
+			mode = os.Args[1]
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+		case "project":
+			if len(os.Args) < 4 || os.Args[2] != "export" && os.Args[2] != "import" {
+				fmt.Println("Usage: leviathanmapper project export FILE.tar.zst [flags] or leviathanmapper project import FILE.tar.zst [DIR]")
+				os.Exit(1)
+			}
+			mode, projectAction, projectFile = os.Args[1], os.Args[2], os.Args[3]
+			rest := os.Args[4:]
+			if projectAction == "import" && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+				projectDir, rest = rest[0], rest[1:]
+			}
+			os.Args = append(os.Args[:1], rest...)
+		}
+	}
+	serverMode := mode == "server"
+	// Modes taking their targets from elsewhere
+	queueMode := mode == "server" || mode == "worker"
+	flag.Parse()
+
+	envFile := *envFileFlag
+	if envFile == "" {
+		envFile = ".env"
+	}
+	if err := loadEnvFile(envFile, *envFileFlag != ""); err != nil {
+		fmt.Println("Error reading env file:", err)
+		os.Exit(1)
+	}
+	cfg := loadConfig(*configFlag)
+	applyConfigToFlags(cfg)
+	if mode == "project" {
+		configPath := *configFlag
+		if configPath == "" {
+			configPath = defaultConfigPath()
+		}
+		runProjectCommand(projectAction, projectFile, projectDir, []projectPart{
+			{name: "config", flag: "-config", path: configPath},
+			{name: "scope", flag: "-scope", path: *scopeFlag},
+			{name: "history", flag: "-history", path: *historyFlag, dir: true},
+			{name: "responses", flag: "-store-responses", path: *storeResponsesFlag, dir: true},
+			{name: "reports", flag: "-report-dir", path: *reportDirFlag, dir: true},
+		})
+		return
+	}
+	if *jsonFlag || *formatFlag != "" {
+		// Only the formatted or JSON results go to stdout, so it can feed
+		// other scripts; progress and diagnostics go to stderr
+		os.Stdout = os.Stderr
+	}
+
+	targets := uniqueTargets(domains)
+	if *domainListFlag != "" {
+		file, err := os.Open(*domainListFlag)
+		if err != nil {
+			fmt.Println("Error opening domain list:", err)
+			os.Exit(1)
+		}
+		listed, err := readTargets(file)
+		file.Close()
+		if err != nil {
+			fmt.Println("Error reading domain list:", err)
+			os.Exit(1)
+		}
+		targets = uniqueTargets(append(targets, listed...))
+	}
+	if len(targets) == 0 && stdinIsPiped() && !queueMode {
+		var err error
+		if targets, err = readTargets(os.Stdin); err != nil {
+			fmt.Println("Error reading domains from stdin:", err)
+			os.Exit(1)
+		}
+	}
+	if serverMode && (len(targets) > 0 || *resumeFlag) {
+		fmt.Println("Error: server mode takes its targets from the API and cannot be combined with -domain, -dL or -resume")
+		os.Exit(1)
+	}
+	if mode == "worker" && (len(targets) > 0 || *resumeFlag || *wordlistFlag != "") {
+		fmt.Println("Error: worker mode takes its targets and wordlist chunks from the coordinator and cannot be combined with -domain, -dL, -w or -resume")
+		os.Exit(1)
+	}
+	if (mode == "coordinator" || mode == "worker") && *redisFlag == "" {
+		fmt.Printf("Error: %s mode requires -redis\n", mode)
+		os.Exit(1)
+	}
+	if *chunkSizeFlag < 1 {
+		fmt.Println("Error: -chunk-size must be at least 1")
+		os.Exit(1)
+	}
+	if len(targets) == 0 && !queueMode {
+		fmt.Println("Usage: go run main.go -domain example.com")
+		fmt.Println("       go run main.go -dL domains.txt")
+		fmt.Println("       cat domains.txt | go run main.go")
+		fmt.Println("       go run main.go server -listen :8080")
+		fmt.Println("       go run main.go coordinator -redis redis://localhost:6379 -dL domains.txt")
+		fmt.Println("       go run main.go worker -redis redis://localhost:6379")
+		return
+	}
+	if *newOnlyFlag && *historyFlag == "" {
+		fmt.Println("Error: -new-only requires -history")
+		os.Exit(1)
+	}
+	if *diffFlag && *historyFlag == "" {
+		fmt.Println("Error: -diff requires -history")
+		os.Exit(1)
+	}
+	if *recheckFlag < 0 {
+		fmt.Println("Error: -recheck must be 0 or more")
+		os.Exit(1)
+	}
+	if *recheckFlag > 0 && *historyFlag == "" {
+		fmt.Println("Error: -recheck requires -history")
+		os.Exit(1)
+	}
+	if *diffFlag && *newOnlyFlag {
+		fmt.Println("Error: -diff and -new-only cannot be combined")
+		os.Exit(1)
+	}
+	if *ptrSweepFlag && !*resolveFlag {
+		fmt.Println("Error: -ptr-sweep requires -resolve")
+		os.Exit(1)
+	}
+	if *dohFlag != "" && *resolversFlag != "" {
+		fmt.Println("Error: use either -r or -doh; -r files can list DNS-over-HTTPS URLs too")
+		os.Exit(1)
+	}
+	if *takeoverFlag && !*resolveFlag {
+		fmt.Println("Error: -takeover requires -resolve")
+		os.Exit(1)
+	}
+	if *probeFlag && !*resolveFlag {
+		fmt.Println("Error: -probe requires -resolve")
+		os.Exit(1)
+	}
+	if *urlsFlag != "" && !*probeFlag {
+		fmt.Println("Error: -urls requires -probe")
+		os.Exit(1)
+	}
+	if *portsFlag != "" && !*probeFlag {
+		fmt.Println("Error: -ports requires -probe")
+		os.Exit(1)
+	}
+	if *techFlag != "" && !*probeFlag {
+		fmt.Println("Error: -tech requires -probe")
+		os.Exit(1)
+	}
+	if *asnLookupFlag && !*resolveFlag {
+		fmt.Println("Error: -asn-lookup requires -resolve")
+		os.Exit(1)
+	}
+	if *byIPFlag && !*resolveFlag {
+		fmt.Println("Error: -by-ip requires -resolve")
+		os.Exit(1)
+	}
+	if *cloudFlag && !*resolveFlag {
+		fmt.Println("Error: -cloud requires -resolve")
+		os.Exit(1)
+	}
+	if *asnExpandFlag && !*asnLookupFlag {
+		fmt.Println("Error: -asn-expand requires -asn-lookup")
+		os.Exit(1)
+	}
+	if *portScanFlag && !*resolveFlag {
+		fmt.Println("Error: -port-scan requires -resolve")
+		os.Exit(1)
+	}
+	if *topPortsFlag < 1 || *topPortsFlag > len(topTCPPorts) {
+		fmt.Printf("Error: -top-ports must be between 1 and %d\n", len(topTCPPorts))
+		os.Exit(1)
+	}
+	if *scanTypeFlag != "connect" && *scanTypeFlag != "syn" {
+		fmt.Printf("Error: unknown -scan-type %q (use connect or syn)\n", *scanTypeFlag)
+		os.Exit(1)
+	}
+	if *bannersFlag && !*portScanFlag {
+		fmt.Println("Error: -banners requires -port-scan")
+		os.Exit(1)
+	}
+	if *storeResponsesFlag != "" && !*probeFlag {
+		fmt.Println("Error: -store-responses requires -probe")
+		os.Exit(1)
+	}
+	if *vantageFlag != "" && !*probeFlag {
+		fmt.Println("Error: -vantage requires -probe")
+		os.Exit(1)
+	}
+	if *vantageWorkersFlag && mode != "coordinator" {
+		fmt.Println("Error: -vantage-workers only applies to coordinator mode")
+		os.Exit(1)
+	}
+	if *jarmFlag && !*probeFlag {
+		fmt.Println("Error: -jarm requires -probe")
+		os.Exit(1)
+	}
+	if *dropNXDomainFlag && !*resolveFlag {
+		fmt.Println("Error: -drop-nxdomain requires -resolve")
+		os.Exit(1)
+	}
+	if *onlyResolvedFlag && !*resolveFlag {
+		fmt.Println("Error: -only-resolved requires -resolve")
+		os.Exit(1)
+	}
+	if *scopeOnlyFlag && *scopeFlag == "" {
+		fmt.Println("Error: -scope-only requires -scope")
+		os.Exit(1)
+	}
+	if *scopeFlag != "" {
+		var err error
+		if engagementScope, err = loadScopeFile(*scopeFlag); err != nil {
+			fmt.Println("Error reading scope file:", err)
+			os.Exit(1)
+		}
+		scopeOnly = *scopeOnlyFlag
+	}
+	if *strictFlag && *bestEffortFlag {
+		fmt.Println("Error: -strict and -best-effort cannot be used together")
+		os.Exit(1)
+	}
+
+	if *concurrencyFlag < 1 {
+		fmt.Println("Error: -concurrency must be at least 1")
+		os.Exit(1)
+	}
+	concurrency = *concurrencyFlag
+	proxyURL = *proxyFlag
+	if *mockFlag != "" {
+		if info, err := os.Stat(*mockFlag); err != nil || !info.IsDir() {
+			fmt.Println("Error: -mock must be a directory of fixtures")
+			os.Exit(1)
+		}
+		if proxyURL != "" {
+			fmt.Println("Error: -mock cannot be combined with -proxy")
+			os.Exit(1)
+		}
+		// The fixtures only answer the HTTP requests of the sources; these
+		// options speak DNS, PostgreSQL or raw TCP and would reach the network
+		var network []string
+		for _, option := range []struct {
+			name string
+			set  bool
+		}{
+			{"-crtsh-db", *crtShDBFlag},
+			{"-r", *resolversFlag != ""},
+			{"-doh", *dohFlag != ""},
+			{"-trusted-resolvers", *trustedResolversFlag != ""},
+			{"-massdns", *massDNSFlag != ""},
+			{"-resolve", *resolveFlag},
+			{"-validate", *validateFlag},
+			{"-axfr", *axfrFlag},
+			{"-w", *wordlistFlag != ""},
+			{"-zonewalk", *zoneWalkFlag},
+			{"-permute", *permuteFlag},
+			{"-records", *recordsFlag},
+			{"-mail", *mailFlag},
+			{"-ptr-sweep", *ptrSweepFlag},
+			{"-dnssec", *dnssecFlag},
+			{"-asn", *asnFlag != ""},
+			{"-asn-expand", *asnExpandFlag},
+			{"-probe", *probeFlag},
+			{"-jarm", *jarmFlag},
+			{"-port-scan", *portScanFlag},
+			{"-banners", *bannersFlag},
+			{"-takeover", *takeoverFlag},
+			{"-recheck", *recheckFlag > 0},
+		} {
+			if option.set {
+				network = append(network, option.name)
+			}
+		}
+		if len(network) > 0 {
+			fmt.Println("Error: -mock only replaces the HTTP requests of the sources and cannot be combined with", strings.Join(network, ", "))
+			os.Exit(1)
+		}
+	}
+	mockDir = *mockFlag
+	canaryID = *canaryFlag
+	if *canaryPatternFlag != "" {
+		if strings.Contains(*canaryPatternFlag, "{id}") && canaryID == "" {
+			fmt.Println("Error: -canary-pattern uses {id} but no -canary identifier is set")
+			os.Exit(1)
+		}
+		// Workers get their wordlist chunks from the coordinator
+		if *wordlistFlag == "" && mode != "worker" {
+			fmt.Println("Error: -canary-pattern requires -w")
+			os.Exit(1)
+		}
+		if err := setupCanaryPattern(*canaryPatternFlag, canaryID); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	crtShDatabase = *crtShDBFlag
+	requestTimeout = *timeoutFlag
+	providerConfig := *providerConfigFlag
+	if providerConfig == "" {
+		providerConfig = defaultProviderConfigPath()
+	}
+	if err := loadProviderKeys(providerConfig); err != nil {
+		fmt.Println("Error reading provider keys:", err)
+		os.Exit(1)
+	}
+	rateLimit = *rateLimitFlag
+	pluginDir := *pluginsFlag
+	if pluginDir == "" {
+		pluginDir = defaultPluginDir()
+	}
+	if err := loadPlugins(pluginDir); err != nil {
+		fmt.Println("Error loading plugins:", err)
+		os.Exit(1)
+	}
+	for name, seconds := range cfg.SourceTimeouts {
+		sourceTimeouts[strings.ToLower(name)] = time.Duration(seconds * float64(time.Second))
+	}
+	if *sourceTimeoutFlag != "" {
+		timeouts, err := parseSourceTimeouts(*sourceTimeoutFlag)
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		for name, timeout := range timeouts {
+			sourceTimeouts[name] = timeout
+		}
+	}
+	known := make(map[string]bool, len(registeredSources))
+	for _, source := range registeredSources {
+		known[source.Name()] = true
+	}
+	for name := range sourceTimeouts {
+		if !known[name] {
+			fmt.Printf("Error: timeout given for unknown source %q\n", name)
+			os.Exit(1)
+		}
+	}
+	recheckRuns = *recheckFlag
+	lowConfidence = make(map[string]bool)
+	for _, name := range strings.Split(*lowConfidenceFlag, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name == "" {
+			continue
+		}
+		if !known[name] {
+			fmt.Printf("Error: unknown -low-confidence source %q\n", name)
+			os.Exit(1)
+		}
+		lowConfidence[name] = true
+	}
+	sources, err := selectSources(registeredSources, *sourcesFlag)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if *notifyFlag != "" {
+		if err := setupNotifiers(*notifyFlag, cfg.Notify); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if *emailDigestFlag != "" {
+		if emailDigest, err = parseDigestPeriod(*emailDigestFlag); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if !emailNotifications || *historyFlag == "" {
+			fmt.Println("Error: -email-digest requires -notify email and -history")
+			os.Exit(1)
+		}
+	}
+	if *reportDirFlag != "" {
+		if reportPeriod, err = parseDigestPeriod(*reportPeriodFlag); err != nil {
+			fmt.Println("Error in -report-period:", err)
+			os.Exit(1)
+		}
+		if *historyFlag == "" {
+			fmt.Println("Error: -report-dir requires -history")
+			os.Exit(1)
+		}
+		reportDir = *reportDirFlag
+	}
+	if *quietHoursFlag != "" {
+		if quietHours, err = parseQuietHours(*quietHoursFlag, *quietTimezoneFlag); err != nil {
+			fmt.Println("Error in -quiet-hours:", err)
+			os.Exit(1)
+		}
+	} else if *quietTimezoneFlag != "" {
+		fmt.Println("Error: -quiet-timezone requires -quiet-hours")
+		os.Exit(1)
+	}
+	// Active checks run only when asked for
+	if *axfrFlag {
+		sources = append(sources, sourceFunc{"axfr", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			if waitQuietHours(ctx, "the zone transfer") {
+				fetchFromAXFR(ctx, domain, out)
+			}
+		}})
+	}
+	if wordlist := *wordlistFlag; wordlist != "" {
+		sources = append(sources, sourceFunc{"bruteforce", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			if waitQuietHours(ctx, "the brute force") {
+				fetchFromBruteForce(ctx, domain, wordlist, out)
+			}
+		}})
+	}
+	if *zoneWalkFlag {
+		if *wordlistFlag != "" {
+			if nsec3Words, err = readWordlist(*wordlistFlag); err != nil {
+				fmt.Println("Error reading wordlist:", err)
+				os.Exit(1)
+			}
+		}
+		sources = append(sources, sourceFunc{"zonewalk", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			if waitQuietHours(ctx, "the zone walk") {
+				fetchFromZoneWalk(ctx, domain, out)
+			}
+		}})
+	}
+	dedupBy, err = parseDedupKey(*dedupFlag)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	if *jsonFlag && *formatFlag != "" {
+		fmt.Println("Error: use either -json or -format")
+		os.Exit(1)
+	}
+	jsonOutput = *jsonFlag
+	unicodeOutput = *unicodeFlag
+	if jsonOutput {
+		quietStream = true
+	}
+	var format *template.Template
+	if *formatFlag != "" {
+		format, err = template.New("format").Funcs(template.FuncMap{"join": strings.Join, "unicode": scope.ToUnicode}).Parse(*formatFlag)
+		if err != nil {
+			fmt.Println("Error parsing -format template:", err)
+			os.Exit(1)
+		}
+		quietStream = true
+	}
+
+	newOnly = *newOnlyFlag
+	diffMode = *diffFlag
+	resumeScan = *resumeFlag
+	keepCheckpoints = *resumeFlag
+	resolveNames = *resolveFlag
+	if *resolversFlag != "" {
+		if err := loadResolvers(*resolversFlag); err != nil {
+			fmt.Println("Error reading resolvers:", err)
+			os.Exit(1)
+		}
+	}
+	if *dohFlag != "" {
+		if err := useDoHResolvers(*dohFlag); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if *massDNSFlag != "" {
+		if massDNSPath, err = exec.LookPath(*massDNSFlag); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		if err := checkMassDNSResolvers(); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	if *trustedResolversFlag != "" {
+		if trustedResolvers, err = readResolvers(*trustedResolversFlag); err != nil {
+			fmt.Println("Error reading trusted resolvers:", err)
+			os.Exit(1)
+		}
+	} else if *validateFlag {
+		trustedResolvers = defaultTrustedResolvers
+	}
+	dropNXDomain = *dropNXDomainFlag
+	onlyResolved = *onlyResolvedFlag
+	checkDNSSEC = *dnssecFlag
+	filterCDN = *filterCDNFlag
+	computeJARM = *jarmFlag
+	if *vantageFlag != "" {
+		if vantageProxies, err = parseVantageProxies(*vantageFlag); err != nil {
+			fmt.Println("Error in -vantage:", err)
+			os.Exit(1)
+		}
+	}
+	compareWorkers = *vantageWorkersFlag
+	lookupASNs = *asnLookupFlag
+	classifyClouds = *cloudFlag
+	clusterByIP = *byIPFlag
+	lookupRDAP = *rdapFlag
+	expandASNs = *asnExpandFlag
+	if *asnFlag != "" {
+		if targetASNs, err = parseASNs(*asnFlag); err != nil {
+			fmt.Println("Error in -asn:", err)
+			os.Exit(1)
+		}
+	}
+	scanPorts = *portScanFlag
+	topPorts = *topPortsFlag
+	scanType = *scanTypeFlag
+	grabBanners = *bannersFlag
+	checkTakeovers = *takeoverFlag
+	probeHosts = *probeFlag
+	if *portsFlag != "" {
+		probePorts, err = parsePorts(*portsFlag)
+		if err != nil {
+			fmt.Println("Error in -ports:", err)
+			os.Exit(1)
+		}
+	}
+	if *techFlag != "" {
+		techFilter = strings.Split(*techFlag, ",")
+	}
+	if *urlsFlag != "" {
+		probeURLs, err = os.Create(*urlsFlag)
+		if err != nil {
+			fmt.Println("Error creating the URL list:", err)
+			os.Exit(1)
+		}
+		defer probeURLs.Close()
+	}
+	if *storeResponsesFlag != "" {
+		if err := os.MkdirAll(*storeResponsesFlag, 0o755); err != nil {
+			fmt.Println("Error creating the response directory:", err)
+			os.Exit(1)
+		}
+		responseDir = *storeResponsesFlag
+	}
+	if *recursiveFlag {
+		recursionDepth = *depthFlag
+	}
+	permuteNames = *permuteFlag
+	gatherRecords = *recordsFlag
+	mineMailRecords = *mailFlag
+	sweepPTR = *ptrSweepFlag
+	permutationLimit = *permuteLimitFlag
+	if *permuteWordsFlag != "" {
+		if err := loadPermutationWords(*permuteWordsFlag); err != nil {
+			fmt.Println("Error reading permutation words:", err)
+			os.Exit(1)
+		}
+	}
+	for _, path := range importFlags {
+		count, err := importResults(path)
+		if err != nil {
+			fmt.Println("Error importing results:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d known hosts from %s\n", count, path)
+	}
+
+	// Configure the HTTP client
+	configureHTTPClient()
+	// Health-check the supplied resolvers, over the proxy for DoH ones
+	if *resolversFlag != "" || *dohFlag != "" {
+		checkResolvers()
+	}
+	if *resolverRateFlag > 0 {
+		limitResolvers(*resolverRateFlag)
+	}
+
+	// The first Ctrl-C stops the scan and reports what it found; a second
+	// one exits at once
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		fmt.Println("\nInterrupted: stopping the scan and reporting the results found so far. Press Ctrl-C again to exit now.")
+		cancel()
+	}()
+
+	session := &Session{Config: cfg}
+	if serverMode {
+		// Job results are fetched from the API rather than printed
+		quietStream = true
+		if err := serveAPI(ctx, *listenFlag, *jobsDirFlag, sources, session, *historyFlag, *internetDBFlag); err != nil {
+			fmt.Println("Error running server:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	switch mode {
+	case "coordinator":
+		if err := runCoordinator(ctx, *redisFlag, targets, *wordlistFlag, *chunkSizeFlag, format); err != nil {
+			fmt.Println("Error running coordinator:", err)
+			os.Exit(1)
+		}
+		return
+	case "worker":
+		if err := runWorker(ctx, *redisFlag, sources, session, *historyFlag, *internetDBFlag); err != nil {
+			fmt.Println("Error running worker:", err)
+			os.Exit(1)
+		}
+		return
+	}
+	for _, target := range targets {
+		if ctx.Err() != nil {
+			break
+		}
+		scanTarget(ctx, target, sources, session, *historyFlag, *internetDBFlag, format)
+	}
+
+	if *strictFlag && len(initFailures) > 0 {
+		fmt.Println("Strict mode: sources failed to initialize:", strings.Join(uniqueStrings(initFailures), ", "))
+		os.Exit(1)
+	}
+}
+
+// Run every selected source against one target and print its results
+func scanTarget(ctx context.Context, domain string, sources []Source, session *Session, historyDir string, internetDB bool, format *template.Template) {
+	reported, err := enumerateTarget(ctx, domain, sources, session, historyDir, internetDB)
+	if errors.Is(err, errTargetFinished) {
+		fmt.Println("Skipping", domain+": already finished in the resumed run")
+		return
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+
+	printReport(reported, format, ctx.Err() == nil)
+}
+
+// Print the results of a target in the selected output format
+func printReport(reported []datedResult, format *template.Template, complete bool) {
+	if jsonOutput {
+		printJSONResults(reported)
+	} else if format != nil {
+		printFormattedResults(format, reported)
+	} else {
+		printAllResults(reported)
+		if clusterByIP {
+			printIPClusters(reported)
+		}
+		if lookupASNs {
+			printASNGroups(reported)
+		}
+		if classifyClouds {
+			printCloudFootprint(reported)
+		}
+		if diffMode {
+			printChangeSummary(reported, complete)
+		}
+	}
+}
+
+// Target skipped because the resumed run already finished it
+var errTargetFinished = errors.New("already finished in the resumed run")
+
+// Run every selected source and the later stages against one target, update
+// its history and send its notifications, returning the results to report.
+// The dedupe set starts empty for each target.
+func enumerateTarget(ctx context.Context, domain string, sources []Source, session *Session, historyDir string, internetDB bool) ([]datedResult, error) {
+	started := time.Now()
+	progress = startCheckpoint(domain)
+	if progress.Finished {
+		return nil, errTargetFinished
+	}
+	uniqueResults = make(map[string]Result)
+	firstSeen = make(map[string]time.Time)
+	hostSources = make(map[string]map[string]bool)
+	hostRecords = make(map[string]map[string][]string)
+	if historyDir != "" {
+		var err error
+		pastRuns, err = loadHistory(historyDir, domain)
+		if err != nil {
+			return nil, fmt.Errorf("reading history: %v", err)
+		}
+		if diffMode {
+			previousRun = pastRuns.lastRunHosts()
+		}
+	}
+
+	resultChan = make(chan Result, concurrency)
+	streamDone := make(chan struct{})
+	go streamResults(streamDone)
+
+	// Results found before the interruption of a resumed run
+	for _, r := range progress.Results {
+		addResult(r)
+	}
+	for host, seen := range progress.FirstSeen {
+		recordFirstSeen(host, seen)
+	}
+
+	// Execute subdomain search, skipping the sources a resumed run completed
+	pool := newWorkerPool(concurrency)
+	for _, source := range sources {
+		if sourceCompleted(source.Name()) {
+			continue
+		}
+		pool.Go(func() {
+			runSource(ctx, source, domain, session)
+			if ctx.Err() == nil {
+				markSourceCompleted(source.Name())
+			}
+		})
+	}
+	pool.Wait()
+	// Once interrupted, the stages that have not started are skipped and the
+	// results found so far are reported
+	active := func() bool { return ctx.Err() == nil }
+	// Stages reaching the target's hosts also wait out the -quiet-hours
+	activeStage := func(stage string) bool { return active() && waitQuietHours(ctx, stage) }
+	if recursionDepth > 0 && active() {
+		enumerateRecursively(ctx, domain, sources, session)
+	}
+	if permuteNames && activeStage("the permutations") {
+		permuteResults(ctx, domain)
+	}
+	if gatherRecords && active() {
+		collectRecords(ctx, domain)
+	}
+	if mineMailRecords && active() {
+		mineMailInfrastructure(domain)
+	}
+	close(resultChan)
+	<-streamDone
+
+	results := consolidateResults()
+	if scopeOnly {
+		kept := results[:0]
+		for _, result := range results {
+			if result.InScope {
+				kept = append(kept, result)
+			}
+		}
+		results = kept
+	}
+	if recheckRuns > 0 && pastRuns != nil && active() {
+		results = recheckDoubtfulHosts(ctx, results)
+	}
+	if resolveNames && active() {
+		results = resolveResults(ctx, domain, results, dropNXDomain, onlyResolved)
+	}
+	if trustedResolvers != nil && active() {
+		results = validateResults(ctx, results)
+	}
+	classifyCDNs(results)
+	if sweepPTR && activeStage("the PTR sweep") {
+		results = append(results, sweepReverseDNS(ctx, domain, results)...)
+	}
+	if checkDNSSEC && active() {
+		checkDNSSECStatus(results)
+	}
+	if lookupASNs && active() {
+		lookupResultASNs(ctx, results)
+	}
+	if classifyClouds && active() {
+		classifyCloudProviders(results)
+	}
+	if lookupRDAP && active() {
+		enrichWithRDAP(ctx, domain, results)
+	}
+	if (expandASNs || targetASNs != nil) && activeStage("the ASN sweep") {
+		results = append(results, expandASNRanges(ctx, domain, results)...)
+	}
+	if internetDB && active() {
+		enrichWithInternetDB(ctx, results)
+	}
+	if scanPorts && activeStage("the port scan") {
+		scanOpenPorts(ctx, results)
+		if grabBanners {
+			grabPortBanners(ctx, results)
+		}
+	}
+	if probeHosts && activeStage("the probe") {
+		results = probeResults(ctx, domain, results)
+		classifyCDNs(results)
+		if computeJARM {
+			reportJARMClusters(results)
+		}
+		if vantageProxies != nil && active() {
+			compareProxyVantages(ctx, results)
+		}
+	}
+	if checkTakeovers && activeStage("the takeover check") {
+		checkTakeoverResults(ctx, results)
+	}
+	if techFilter != nil {
+		results = filterByTechnology(results, techFilter)
+	}
+	names := make([]string, len(results))
+	for i, result := range results {
+		names[i] = result.Host
+	}
+	reported := results
+	var newHosts []string
+	if pastRuns != nil {
+		if newOnly {
+			reported = nil
+			for _, result := range results {
+				if !pastRuns.known(result.Host) {
+					reported = append(reported, result)
+				}
+			}
+		} else if diffMode {
+			reported = pastRuns.changes(results, ctx.Err() == nil)
+		}
+
+		for _, name := range names {
+			if !pastRuns.known(name) {
+				newHosts = append(newHosts, name)
+			}
+		}
+		pastRuns.update(names, time.Now())
+		// An interrupted run is not a baseline: its missing hosts would show
+		// up as disappeared and then as new again. An empty run is stored as
+		// an empty list, not left out.
+		if ctx.Err() == nil {
+			pastRuns.LastRun = append([]string{}, uniqueStrings(names)...)
+			sendDigestIfDue(ctx, pastRuns, len(pastRuns.LastRun), time.Now())
+			writeReportIfDue(pastRuns, time.Now())
+		}
+		if err := saveHistory(historyDir, pastRuns); err != nil {
+			fmt.Println("Error saving history:", err)
+		}
+	}
 
-	wg.Wait()
-	close(subdomainChan)
+	hosts := uniqueStrings(names)
+	sendNotifications(ctx, notification{
+		Domain:      domain,
+		Total:       len(hosts),
+		Hosts:       hosts,
+		New:         uniqueStrings(newHosts),
+		Interrupted: ctx.Err() != nil,
+		Duration:    time.Since(started).Round(time.Second),
+	})
 
-	// Print all found subdomains
-	printAllSubdomains()
+	// An interrupted target is left for -resume to finish
+	progress.Finished = ctx.Err() == nil
+	flushCheckpoint()
+	return reported, nil
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Look up the autonomous system of every resolved address, set by
+// -asn-lookup
+var lookupASNs bool
+
+// An autonomous system announcing one of the addresses of a result
+type asnInfo struct {
+	Number  int    `json:"number"`
+	Name    string `json:"name,omitempty"` // Organization holding the AS, as registered
+	Country string `json:"country,omitempty"`
+}
+
+// Label of the AS, e.g. "AS13335 CLOUDFLARENET, US"
+func (a asnInfo) String() string {
+	label := "AS" + strconv.Itoa(a.Number)
+	if a.Name != "" {
+		label += " " + a.Name
+	}
+	return label
+}
+
+// Name queried in Team Cymru's IP-to-ASN zones for an address: reversed
+// octets under origin.asn.cymru.com, reversed nibbles under
+// origin6.asn.cymru.com
+func cymruOriginName(ip string) string {
+	addr := net.ParseIP(ip)
+	if v4 := addr.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.origin.asn.cymru.com", v4[3], v4[2], v4[1], v4[0])
+	}
+	var nibbles []string
+	for i := len(addr) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, strconv.FormatUint(uint64(addr[i]&0x0f), 16), strconv.FormatUint(uint64(addr[i]>>4), 16))
+	}
+	return strings.Join(nibbles, ".") + ".origin6.asn.cymru.com"
+}
+
+// Split a Team Cymru TXT answer, "13335 | 104.16.0.0/13 | US | arin | 2014-03-28"
+func cymruFields(txt string) []string {
+	fields := strings.Split(txt, "|")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	return fields
+}
+
+// Autonomous systems originating the prefix of an address. Addresses
+// announced by several ASes list them all in the first field.
+func lookupOriginASNs(ip string) []asnInfo {
+	var found []asnInfo
+	for _, txt := range lookupRecords(cymruOriginName(ip), dnsTypeTXT) {
+		fields := cymruFields(txt)
+		if len(fields) < 3 {
+			continue
+		}
+		for _, number := range strings.Fields(fields[0]) {
+			if n, err := strconv.Atoi(number); err == nil {
+				found = append(found, asnInfo{Number: n, Country: fields[2]})
+			}
+		}
+	}
+	return found
+}
+
+// Registered name of an AS, from AS<n>.asn.cymru.com
+func lookupASName(number int) string {
+	for _, txt := range lookupRecords("AS"+strconv.Itoa(number)+".asn.cymru.com", dnsTypeTXT) {
+		if fields := cymruFields(txt); len(fields) >= 5 {
+			return fields[4]
+		}
+	}
+	return ""
+}
+
+// Attach the autonomous systems of their addresses to the results, looking
+// up each address and each AS once with at most -concurrency queries at a
+// time
+func lookupResultASNs(ctx context.Context, results []datedResult) {
+	var ips []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			if _, exists := seen[ip]; !exists {
+				seen[ip] = struct{}{}
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return
+	}
+	fmt.Printf("Looking up the ASNs of %d addresses\n", len(ips))
+
+	origins := make(map[string][]asnInfo)
+	names := make(map[int]string)
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			found := lookupOriginASNs(ip)
+			lock.Lock()
+			origins[ip] = found
+			for _, a := range found {
+				names[a.Number] = ""
+			}
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+
+	numbers := make([]int, 0, len(names))
+	for number := range names {
+		numbers = append(numbers, number)
+	}
+	for _, number := range numbers {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			name := lookupASName(number)
+			lock.Lock()
+			names[number] = name
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+
+	for i := range results {
+		var asns []asnInfo
+		listed := make(map[int]bool)
+		for _, ip := range results[i].IPs {
+			for _, a := range origins[ip] {
+				if !listed[a.Number] {
+					listed[a.Number] = true
+					a.Name = names[a.Number]
+					asns = append(asns, a)
+				}
+			}
+		}
+		results[i].ASNs = asns
+	}
+}
+
+// Print the results grouped by the autonomous systems of their addresses,
+// largest group first, so self-hosted, cloud and third-party assets stand
+// apart. Hosts announced by several ASes appear under each.
+func printASNGroups(results []datedResult) {
+	groups := make(map[int][]string)
+	labels := make(map[int]string)
+	var unknown []string
+	for _, r := range results {
+		if len(r.IPs) == 0 {
+			continue
+		}
+		if len(r.ASNs) == 0 {
+			unknown = append(unknown, r.label())
+		}
+		for _, a := range r.ASNs {
+			groups[a.Number] = append(groups[a.Number], r.label())
+			labels[a.Number] = a.String()
+		}
+	}
+	if len(groups) == 0 && len(unknown) == 0 {
+		return
+	}
+
+	numbers := make([]int, 0, len(groups))
+	for number := range groups {
+		numbers = append(numbers, number)
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		if len(groups[numbers[i]]) != len(groups[numbers[j]]) {
+			return len(groups[numbers[i]]) > len(groups[numbers[j]])
+		}
+		return numbers[i] < numbers[j]
+	})
+
+	fmt.Println("\n=== Subdomains by ASN ===")
+	for _, number := range numbers {
+		fmt.Printf("%s (%d hosts)\n", labels[number], len(groups[number]))
+		for _, host := range groups[number] {
+			fmt.Println("  " + host)
+		}
+	}
+	if len(unknown) > 0 {
+		fmt.Printf("Unknown ASN (%d hosts)\n", len(unknown))
+		for _, host := range unknown {
+			fmt.Println("  " + host)
+		}
+	}
+	fmt.Println("==============================")
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+var (
+	expandASNs bool  // Sweep the prefixes of the ASNs found by -asn-lookup, set by -asn-expand
+	targetASNs []int // ASNs whose prefixes are swept, set by -asn
+)
+
+// Most IPv4 addresses swept for one ASN; larger networks are clouds or
+// carriers whose space does not belong to the target
+const asnAddressLimit = 1 << 16
+
+// Time an address has to complete the TLS handshake of the sweep
+const asnTLSTimeout = 3 * time.Second
+
+// Parse the -asn list, e.g. "AS12345,64496"
+func parseASNs(value string) ([]int, error) {
+	var asns []int
+	for _, field := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(field)), "AS"))
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid ASN %q", field)
+		}
+		asns = append(asns, n)
+	}
+	return asns, nil
+}
+
+// IPv4 prefixes an AS announces, from RIPEstat
+func fetchAnnouncedPrefixes(ctx context.Context, asn int) ([]*net.IPNet, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("https://stat.ripe.net/data/announced-prefixes/data.json?resource=AS%d", asn), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var data struct {
+		Data struct {
+			Prefixes []struct {
+				Prefix string `json:"prefix"`
+			} `json:"prefixes"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, err
+	}
+	var prefixes []*net.IPNet
+	for _, p := range data.Data.Prefixes {
+		if _, network, err := net.ParseCIDR(p.Prefix); err == nil && network.IP.To4() != nil {
+			prefixes = append(prefixes, network)
+		}
+	}
+	return prefixes, nil
+}
+
+// Every address of the prefixes, once, or nil when there are more than
+// asnAddressLimit
+func prefixAddresses(prefixes []*net.IPNet) []string {
+	total := 0
+	for _, network := range prefixes {
+		ones, bits := network.Mask.Size()
+		total += 1 << (bits - ones)
+		if total > asnAddressLimit {
+			return nil
+		}
+	}
+	seen := make(map[string]struct{}, total)
+	var ips []string
+	for _, network := range prefixes {
+		for ip := network.IP.To4().Mask(network.Mask); network.Contains(ip); ip = nextIP(ip) {
+			if _, exists := seen[ip.String()]; !exists {
+				seen[ip.String()] = struct{}{}
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+	return ips
+}
+
+// The IPv4 address after ip
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// Names of the certificate an address presents on port 443
+func addressCertificateNames(ctx context.Context, ip string) []string {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: asnTLSTimeout}, Config: &tls.Config{InsecureSkipVerify: true}}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, "443"))
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return append([]string{certs[0].Subject.CommonName}, certs[0].DNSNames...)
+}
+
+// Fetch the certificate of every address, with at most -concurrency
+// handshakes at a time. In-scope names missing from known are added to it
+// and returned as new results carrying the address that presented them.
+func certificateScan(ctx context.Context, domain string, ips []string, known map[string]struct{}) []datedResult {
+	var found []datedResult
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			for _, name := range addressCertificateNames(ctx, ip) {
+				host := scope.NormalizeHost(strings.TrimPrefix(name, "*."))
+				if !scope.IsInScope(host, domain) || !resultFilter.Allows(host) || wasImported(host) || scopeOnly && !inEngagementScope(host) {
+					continue
+				}
+				lock.Lock()
+				if _, exists := known[host]; !exists {
+					known[host] = struct{}{}
+					found = append(found, datedResult{
+						Result:  Result{Host: host, IP: ip, Source: "tls"},
+						IPs:     []string{ip},
+						InScope: inEngagementScope(host),
+					})
+				}
+				lock.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+	return found
+}
+
+// Sweep the IPv4 prefixes announced by the -asn ASNs and, with -asn-expand,
+// by the ASNs of the hosts not behind a CDN, looking up the PTR record and
+// the TLS certificate of every address. In-scope names not found yet are
+// returned as new results.
+func expandASNRanges(ctx context.Context, domain string, results []datedResult) []datedResult {
+	asns := append([]int(nil), targetASNs...)
+	if expandASNs {
+		for _, r := range results {
+			if r.CDN != "" {
+				continue
+			}
+			for _, a := range r.ASNs {
+				asns = append(asns, a.Number)
+			}
+		}
+	}
+	asns = uniqueInts(asns)
+	if len(asns) == 0 {
+		return nil
+	}
+
+	known := make(map[string]struct{}, len(results))
+	for _, r := range results {
+		known[r.Host] = struct{}{}
+	}
+	var found []datedResult
+	for _, asn := range asns {
+		if ctx.Err() != nil {
+			break
+		}
+		prefixes, err := fetchAnnouncedPrefixes(ctx, asn)
+		if err != nil {
+			fmt.Printf("Error fetching the prefixes of AS%d: %v\n", asn, err)
+			continue
+		}
+		if len(prefixes) == 0 {
+			fmt.Printf("AS%d announces no IPv4 prefixes\n", asn)
+			continue
+		}
+		ips := prefixAddresses(prefixes)
+		if ips == nil {
+			fmt.Printf("Skipping AS%d: its %d prefixes hold more than %d addresses\n", asn, len(prefixes), asnAddressLimit)
+			continue
+		}
+		fmt.Printf("Sweeping %d addresses in %d prefixes of AS%d\n", len(ips), len(prefixes), asn)
+		found = append(found, reverseLookups(ctx, domain, ips, known)...)
+		found = append(found, certificateScan(ctx, domain, ips, known)...)
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Host < found[j].Host })
+	for _, r := range found {
+		if !quietStream {
+			fmt.Println("Subdomain found:", r.label())
+		}
+	}
+	fmt.Printf("ASN sweep found %d new names\n", len(found))
+	return found
+}
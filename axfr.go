@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Function to request a zone transfer from every nameserver of the domain,
+// importing the whole zone from the first one that allows it
+func fetchFromAXFR(ctx context.Context, domain string, out chan<- Result) {
+	servers, err := lookupNameservers(domain)
+	if err != nil {
+		fmt.Println("Error looking up nameservers for AXFR:", err)
+		return
+	}
+	for _, ns := range servers {
+		for _, ip := range lookupHost(ns).Addresses {
+			if ctx.Err() != nil {
+				return
+			}
+			records, err := transferZone(net.JoinHostPort(ip, "53"), domain)
+			if err != nil {
+				fmt.Printf("AXFR refused by %s (%s): %v\n", ns, ip, err)
+				continue
+			}
+			fmt.Printf("Zone transfer allowed by %s (%s): %d records\n", ns, ip, len(records))
+			for _, record := range records {
+				addZoneRecord("axfr", domain, record.Name, dnsTypeName(record.Type), recordTarget(record), out)
+			}
+			return
+		}
+	}
+}
+
+// Names of the authoritative nameservers of a domain
+func lookupNameservers(domain string) ([]string, error) {
+	var err error
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		var msg *dnsMessage
+		msg, err = queryDNS(pickResolver(), domain, dnsTypeNS)
+		if err != nil {
+			continue
+		}
+		var servers []string
+		for _, record := range msg.Answers {
+			if record.Type == dnsTypeNS {
+				servers = append(servers, record.Data)
+			}
+		}
+		if len(servers) == 0 {
+			return nil, errors.New("no NS records for " + domain)
+		}
+		return servers, nil
+	}
+	return nil, err
+}
+
+// Host a record points to, for the types whose data ends in a name
+func recordTarget(record dnsRecord) string {
+	switch record.Type {
+	case dnsTypeA, dnsTypeAAAA:
+		return record.Data
+	case dnsTypeCNAME, dnsTypeNS, dnsTypePTR, dnsTypeMX, dnsTypeSRV:
+		fields := strings.Fields(record.Data)
+		return fields[len(fields)-1]
+	}
+	return ""
+}
+
+// Request a full zone transfer over TCP. The zone is complete once the
+// closing SOA record arrives.
+func transferZone(server, zone string) ([]dnsRecord, error) {
+	conn, err := net.DialTimeout("tcp", server, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	if err := writeDNSStream(conn, buildDNSQuery(0, zone, dnsTypeAXFR, dnssecOff)); err != nil {
+		return nil, err
+	}
+
+	var records []dnsRecord
+	for soas := 0; soas < 2; {
+		data, err := readDNSStream(conn)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := parseDNSMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Rcode != dnsRcodeSuccess {
+			return nil, fmt.Errorf("rcode %d", msg.Rcode)
+		}
+		if len(msg.Answers) == 0 {
+			return nil, errors.New("empty transfer")
+		}
+		for _, record := range msg.Answers {
+			if record.Type == dnsTypeSOA {
+				soas++
+			}
+			records = append(records, record)
+		}
+		// Large zones take several messages; extend the deadline for each
+		conn.SetDeadline(time.Now().Add(requestTimeout))
+	}
+	return records, nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Grab the banner of every open port found by the scan, set by -banners
+var grabBanners bool
+
+// Time a service has to send its banner or answer the HTTP request
+const bannerTimeout = 2 * time.Second
+
+// Longest banner kept
+const bannerLimit = 256
+
+// Ports whose services speak TLS from the first byte
+var tlsPorts = map[int]bool{
+	443: true, 465: true, 636: true, 853: true, 989: true, 990: true, 992: true, 993: true, 994: true,
+	995: true, 2083: true, 2087: true, 3269: true, 4443: true, 5061: true, 6443: true, 8443: true, 9443: true,
+}
+
+// Service usually found on a port, for the ports a banner does not name
+var portServices = map[int]string{
+	21: "ftp", 22: "ssh", 23: "telnet", 25: "smtp", 53: "domain", 80: "http", 110: "pop3", 111: "rpcbind",
+	135: "msrpc", 139: "netbios-ssn", 143: "imap", 389: "ldap", 443: "http", 445: "microsoft-ds", 465: "smtp",
+	514: "shell", 548: "afp", 554: "rtsp", 587: "smtp", 631: "ipp", 636: "ldap", 873: "rsync", 990: "ftp",
+	993: "imap", 995: "pop3", 1433: "ms-sql-s", 1723: "pptp", 2049: "nfs", 3128: "http-proxy", 3306: "mysql",
+	3389: "ms-wbt-server", 5060: "sip", 5432: "postgresql", 5900: "vnc", 6000: "x11", 8080: "http", 8443: "http",
+	9100: "jetdirect",
+}
+
+// Banner prefixes naming the service that sent them
+var bannerServices = []struct {
+	prefix, service string
+}{
+	{"SSH-", "ssh"},
+	{"HTTP/", "http"},
+	{"+OK", "pop3"},
+	{"* OK", "imap"},
+	{"RFB ", "vnc"},
+	{"AMQP", "amqp"},
+	{"-ERR", "redis"},
+	{"-NOAUTH", "redis"},
+	{"@RSYNCD", "rsync"},
+}
+
+// Guess the service on a port from its banner, falling back to the port
+// number. Services reached over TLS are reported like nmap does, as
+// ssl/<service>, except HTTPS.
+func guessService(port int, banner string, overTLS bool) string {
+	service := ""
+	for _, known := range bannerServices {
+		if strings.HasPrefix(banner, known.prefix) {
+			service = known.service
+			break
+		}
+	}
+	upper := strings.ToUpper(banner)
+	if service == "" && strings.HasPrefix(banner, "220") {
+		switch {
+		case strings.Contains(upper, "FTP"):
+			service = "ftp"
+		case strings.Contains(upper, "SMTP"), strings.Contains(upper, "MAIL"):
+			service = "smtp"
+		}
+	}
+	// MySQL greets with a binary handshake packet: protocol 10, then the
+	// server version
+	if service == "" && len(banner) > 5 && banner[4] == 10 {
+		service = "mysql"
+	}
+	if service == "" {
+		service = portServices[port]
+	}
+	if overTLS {
+		if service == "http" || service == "" {
+			return "https"
+		}
+		return "ssl/" + service
+	}
+	return service
+}
+
+// Printable form of a banner: its first line, with control and non-ASCII
+// bytes escaped
+func cleanBanner(data []byte) string {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		data = data[:i]
+	}
+	if len(data) > bannerLimit {
+		data = data[:bannerLimit]
+	}
+	quoted := strconv.QuoteToASCII(string(data))
+	return quoted[1 : len(quoted)-1]
+}
+
+// Read what a service sends on its own, then what it answers to an HTTP
+// request when it stayed silent
+func readBanner(conn net.Conn, host string) []byte {
+	buf := make([]byte, bannerLimit*4)
+	conn.SetReadDeadline(time.Now().Add(bannerTimeout))
+	if n, _ := conn.Read(buf); n > 0 {
+		return buf[:n]
+	}
+	conn.SetDeadline(time.Now().Add(bannerTimeout))
+	if _, err := fmt.Fprintf(conn, "HEAD / HTTP/1.0\r\nHost: %s\r\n\r\n", host); err != nil {
+		return nil
+	}
+	n, _ := conn.Read(buf)
+	return buf[:n]
+}
+
+// Connect to an open port, over TLS on the TLS ports, and fill in its
+// banner, certificate and service guess
+func grabBanner(ctx context.Context, p *openPort, host string) {
+	dialer := &net.Dialer{Timeout: bannerTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.IP, strconv.Itoa(p.Port)))
+	if err != nil {
+		return
+	}
+	// conn is replaced when TLS fails
+	defer func() { conn.Close() }()
+
+	overTLS := false
+	if tlsPorts[p.Port] {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+		tlsConn.SetDeadline(time.Now().Add(bannerTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err == nil {
+			overTLS = true
+			if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+				p.TLS = certificateInfo(certs[0])
+			}
+			conn = tlsConn
+		} else {
+			// Not TLS after all: start over in the clear
+			conn.Close()
+			if conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(p.IP, strconv.Itoa(p.Port))); err != nil {
+				return
+			}
+		}
+	}
+
+	data := readBanner(conn, host)
+	p.Banner = cleanBanner(data)
+	p.Service = guessService(p.Port, string(data), overTLS)
+}
+
+// Grab the banners of the open ports of the results, with at most
+// -concurrency connections at a time. Ports shared by several hosts are
+// grabbed once, sending the first host's name as SNI and Host header.
+func grabPortBanners(ctx context.Context, results []datedResult) {
+	grabbed := make(map[string]*openPort)
+	hosts := make(map[string]string)
+	for _, r := range results {
+		for _, p := range r.OpenPorts {
+			key := net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+			if _, exists := grabbed[key]; !exists {
+				port := p
+				grabbed[key] = &port
+				hosts[key] = r.Host
+			}
+		}
+	}
+	if len(grabbed) == 0 {
+		return
+	}
+	fmt.Printf("Grabbing banners of %d open ports\n", len(grabbed))
+
+	pool := newWorkerPool(concurrency)
+	for key, p := range grabbed {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			grabBanner(ctx, p, hosts[key])
+		})
+	}
+	pool.Wait()
+
+	for i := range results {
+		for j, p := range results[i].OpenPorts {
+			results[i].OpenPorts[j] = *grabbed[net.JoinHostPort(p.IP, strconv.Itoa(p.Port))]
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Candidates resolved at a time, so large wordlists are not held in memory
+const bruteForceBatch = 1000
+
+// Marker name queried with every batch of the brute force, so the DNS logs
+// of the target show the authorized traffic. Set by -canary-pattern, with
+// {id} replaced by the -canary identifier and {n} numbering the markers.
+var (
+	canaryPattern string
+	canaryNames   *regexp.Regexp // Matches the markers, which are never reported
+	canaryCount   atomic.Int64
+)
+
+// Check a -canary-pattern and prepare its markers
+func setupCanaryPattern(pattern, id string) error {
+	pattern = strings.ToLower(strings.ReplaceAll(pattern, "{id}", id))
+	for _, label := range strings.Split(strings.ReplaceAll(pattern, "{n}", "0"), ".") {
+		if label == "" || len(label) > 63 || strings.Trim(label, "abcdefghijklmnopqrstuvwxyz0123456789-") != "" {
+			return fmt.Errorf("invalid -canary-pattern %q: markers must be DNS labels of letters, digits and hyphens", pattern)
+		}
+	}
+	canaryPattern = pattern
+	canaryNames = regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\{n\}`, "[0-9]+") + `\.`)
+	return nil
+}
+
+// Add the next canary marker under the domain to a batch of candidates
+func withCanaryMarker(domain string, batch []string) []string {
+	if canaryPattern == "" {
+		return batch
+	}
+	n := canaryCount.Add(1)
+	marker := strings.ReplaceAll(canaryPattern, "{n}", fmt.Sprint(n)) + "." + domain
+	return append(batch[:len(batch):len(batch)], marker)
+}
+
+// Function to find subdomains by resolving every word of a wordlist under
+// the domain. Names that only resolve to wildcard answers are discarded.
+func fetchFromBruteForce(ctx context.Context, domain, wordlist string, out chan<- Result) {
+	file, err := os.Open(wordlist)
+	if err != nil {
+		fmt.Println("Error reading wordlist:", err)
+		return
+	}
+	defer file.Close()
+
+	wildcards := detectWildcards(ctx, domain, nil)
+	candidates, hits := 0, 0
+	size := bruteForceBatch
+	if massDNSPath != "" {
+		size = massDNSBatch
+	}
+	batch := make([]string, 0, size)
+	flush := func() {
+		hits += addLiveCandidates(ctx, "bruteforce", withCanaryMarker(domain, batch), wildcards, func(r Result) { out <- r })
+		batch = batch[:0]
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word, ok := wordlistWord(scanner.Text())
+		if !ok {
+			continue
+		}
+		candidates++
+		batch = append(batch, word+"."+domain)
+		if len(batch) == size {
+			flush()
+		}
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		fmt.Println("Error reading wordlist:", err)
+	}
+	fmt.Printf("Brute force resolved %d of %d candidates\n", hits, candidates)
+}
+
+// Label of a wordlist line, skipping blank lines, comments and entries that
+// cannot be a label
+func wordlistWord(line string) (string, bool) {
+	word := strings.ToLower(strings.Trim(strings.TrimSpace(line), "."))
+	if word == "" || strings.HasPrefix(word, "#") || strings.ContainsAny(word, " \t*") {
+		return "", false
+	}
+	return word, true
+}
+
+// Resolve candidate names and add the ones that exist outside a wildcard,
+// returning how many did
+func addLiveCandidates(ctx context.Context, source string, candidates []string, wildcards map[string]map[string]struct{}, add func(Result)) int {
+	hits := 0
+	for host, answer := range resolveHosts(ctx, candidates) {
+		if len(answer.Addresses) == 0 || matchesWildcard(host, answer.Addresses, wildcards) || isCanaryMarker(host) {
+			continue
+		}
+		hits++
+		for _, ip := range answer.Addresses {
+			add(Result{Host: host, IP: ip, Source: source})
+		}
+	}
+	return hits
+}
+
+// Report whether a name is a brute-force canary marker
+func isCanaryMarker(host string) bool {
+	return canaryNames != nil && canaryNames.MatchString(host)
+}
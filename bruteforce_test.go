@@ -0,0 +1,40 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanaryPattern(t *testing.T) {
+	tests := []struct {
+		pattern, id string
+		wantErr     bool
+		marker      string // First marker added under example.com
+	}{
+		{pattern: "lm-{id}-{n}", id: "acme-2026", marker: "lm-acme-2026-1.example.com"},
+		{pattern: "{n}.Canary-{id}", id: "acme", marker: "1.canary-acme.example.com"},
+		{pattern: "lm-{id}", id: "acme 2026", wantErr: true},
+		{pattern: "lm..{n}", wantErr: true},
+		{pattern: "lm_{n}", wantErr: true},
+	}
+	for _, tt := range tests {
+		canaryPattern, canaryNames = "", nil
+		canaryCount.Store(0)
+		err := setupCanaryPattern(tt.pattern, tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: error %v, want error %v", tt.pattern, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		batch := withCanaryMarker("example.com", []string{"www.example.com"})
+		if want := []string{"www.example.com", tt.marker}; !reflect.DeepEqual(batch, want) {
+			t.Errorf("%q: batch %q, want %q", tt.pattern, batch, want)
+		}
+		if !isCanaryMarker(tt.marker) || isCanaryMarker("www.example.com") {
+			t.Errorf("%q: markers not told apart from candidates", tt.pattern)
+		}
+	}
+	canaryPattern, canaryNames = "", nil
+}
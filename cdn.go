@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net"
+	"strings"
+)
+
+// Skip the addresses of CDN-fronted hosts in the stages that scan IPs, set
+// by -filter-cdn
+var filterCDN bool
+
+// Published address ranges of the main CDN and WAF providers
+var cdnRanges = map[string][]string{
+	"Cloudflare": {
+		"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22", "141.101.64.0/18",
+		"108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20", "197.234.240.0/22", "198.41.128.0/17",
+		"162.158.0.0/15", "104.16.0.0/13", "104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+		"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32", "2405:8100::/32",
+		"2a06:98c0::/29", "2c0f:f248::/32",
+	},
+	"Fastly": {
+		"23.235.32.0/20", "43.249.72.0/22", "103.244.50.0/24", "103.245.222.0/23", "103.245.224.0/24",
+		"104.156.80.0/20", "140.248.64.0/18", "140.248.128.0/17", "146.75.0.0/17", "151.101.0.0/16",
+		"157.52.64.0/18", "167.82.0.0/17", "167.82.128.0/20", "167.82.160.0/20", "167.82.224.0/20",
+		"172.111.64.0/18", "185.31.16.0/22", "199.27.72.0/21", "199.232.0.0/16",
+		"2a04:4e40::/32", "2a04:4e42::/32",
+	},
+	"Amazon CloudFront": {
+		"13.32.0.0/15", "13.35.0.0/16", "13.224.0.0/14", "18.64.0.0/14", "18.154.0.0/15",
+		"18.160.0.0/15", "18.164.0.0/15", "18.172.0.0/15", "18.238.0.0/15", "18.244.0.0/15",
+		"52.84.0.0/15", "54.182.0.0/16", "54.192.0.0/16", "54.230.0.0/16", "54.239.128.0/18",
+		"99.84.0.0/16", "99.86.0.0/16", "143.204.0.0/16", "204.246.164.0/22", "205.251.192.0/19",
+		"216.137.32.0/19",
+	},
+	"Akamai": {
+		"2.16.0.0/13", "23.0.0.0/12", "23.32.0.0/11", "23.64.0.0/14", "23.72.0.0/13",
+		"23.192.0.0/11", "72.246.0.0/15", "88.221.0.0/16", "92.122.0.0/15", "95.100.0.0/15",
+		"96.6.0.0/15", "96.16.0.0/15", "104.64.0.0/10", "173.222.0.0/15", "184.24.0.0/13",
+		"184.50.0.0/15", "184.84.0.0/14",
+	},
+	"Imperva": {
+		"199.83.128.0/21", "198.143.32.0/19", "149.126.72.0/21", "103.28.248.0/22", "45.64.64.0/22",
+		"185.11.124.0/22", "192.230.64.0/18", "107.154.0.0/16", "45.60.0.0/16", "45.223.0.0/16",
+	},
+	"Sucuri": {
+		"192.88.134.0/23", "185.93.228.0/22", "66.248.200.0/22", "208.109.0.0/22",
+	},
+}
+
+// Suffixes of the CNAME targets each provider hands out
+var cdnCNAMEs = map[string][]string{
+	"Cloudflare":        {".cdn.cloudflare.net"},
+	"Fastly":            {".fastly.net", ".fastlylb.net"},
+	"Amazon CloudFront": {".cloudfront.net"},
+	"Akamai":            {".akamaiedge.net", ".edgekey.net", ".edgesuite.net", ".akamai.net", ".akamaihd.net", ".akamaized.net"},
+	"Imperva":           {".incapdns.net", ".impervadns.net"},
+	"Azure CDN":         {".azureedge.net", ".azurefd.net"},
+	"Edgecast":          {".edgecastcdn.net", ".systemcdn.net"},
+	"StackPath":         {".stackpathdns.com", ".stackpathcdn.com"},
+}
+
+// Technologies of the fingerprint database that reveal each provider in
+// the probe responses
+var cdnTechnologies = map[string]string{
+	"Cloudflare": "Cloudflare", "Fastly": "Fastly", "Amazon CloudFront": "Amazon CloudFront",
+	"Akamai": "Akamai", "Imperva": "Imperva", "Sucuri": "Sucuri",
+}
+
+type cdnNetwork struct {
+	network  *net.IPNet
+	provider string
+}
+
+var cdnNetworks = parseCDNRanges()
+
+func parseCDNRanges() []cdnNetwork {
+	var networks []cdnNetwork
+	for provider, ranges := range cdnRanges {
+		for _, cidr := range ranges {
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				panic(err)
+			}
+			networks = append(networks, cdnNetwork{network, provider})
+		}
+	}
+	return networks
+}
+
+// Provider whose ranges hold an address, empty for none
+func cdnForIP(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ""
+	}
+	for _, n := range cdnNetworks {
+		if n.network.Contains(addr) {
+			return n.provider
+		}
+	}
+	return ""
+}
+
+// Provider behind a CNAME chain, empty for none
+func cdnForCNAMEs(chain []string) string {
+	for _, name := range chain {
+		for provider, suffixes := range cdnCNAMEs {
+			for _, suffix := range suffixes {
+				if strings.HasSuffix(name, suffix) {
+					return provider
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Tell which results sit behind a CDN or WAF from their CNAME chain, their
+// addresses and, once probed, the headers of their web services. Results
+// already classified are left as they are.
+func classifyCDNs(results []datedResult) {
+	for i := range results {
+		r := &results[i]
+		if r.CDN != "" {
+			continue
+		}
+		if r.CDN = cdnForCNAMEs(r.CNAMEs); r.CDN != "" {
+			continue
+		}
+		for _, ip := range r.IPs {
+			if r.CDN = cdnForIP(ip); r.CDN != "" {
+				break
+			}
+		}
+		for _, service := range r.Probes {
+			for _, tech := range service.Technologies {
+				if provider, ok := cdnTechnologies[tech]; ok && r.CDN == "" {
+					r.CDN = provider
+				}
+			}
+		}
+	}
+}
+
+// Addresses of a result that scanning stages may target: all of them,
+// unless -filter-cdn is on and the host is CDN-fronted
+func scannableIPs(r datedResult) []string {
+	if filterCDN && r.CDN != "" {
+		return nil
+	}
+	return r.IPs
+}
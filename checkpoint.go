@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Progress of the scan of one target, written as sources report results so
+// an interrupted run can continue with -resume
+type checkpoint struct {
+	Domain string `json:"domain"`
+	// The whole target finished; resuming skips it
+	Finished bool `json:"finished"`
+	// Sources that ran to the end
+	Completed []string `json:"completed"`
+	// Where each paging source continues
+	Cursors   map[string]sourceCursor `json:"cursors"`
+	Results   []Result                `json:"results"`
+	FirstSeen map[string]time.Time    `json:"first_seen"`
+}
+
+// Next page of a paging source and, for cursor-based APIs, the token that
+// fetches it
+type sourceCursor struct {
+	Page int    `json:"page"`
+	Next string `json:"next,omitempty"`
+}
+
+// Shortest time between two writes of a checkpoint, which holds every
+// result found so far
+const checkpointInterval = 5 * time.Second
+
+var (
+	progress     *checkpoint // Checkpoint of the target being scanned
+	progressLock sync.Mutex
+	resumeScan   bool // Continue from the checkpoints left by a previous run
+	// Write checkpoints at all, with -resume or a server -jobs-dir
+	keepCheckpoints   bool
+	lastCheckpoint    time.Time
+	checkpointPending bool // A write is scheduled
+)
+
+// File holding the checkpoint of a target, in the user cache directory
+func checkpointPath(domain string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "leviathanmapper", "checkpoints", domain+".json")
+}
+
+// Start the checkpoint of a target. With -resume the previous checkpoint is
+// loaded; otherwise, or when there is none, the scan starts from scratch.
+func startCheckpoint(domain string) *checkpoint {
+	fresh := &checkpoint{Domain: domain, Cursors: make(map[string]sourceCursor), FirstSeen: make(map[string]time.Time)}
+	if !resumeScan {
+		return fresh
+	}
+	data, err := os.ReadFile(checkpointPath(domain))
+	if errors.Is(err, os.ErrNotExist) {
+		return fresh
+	}
+	saved := &checkpoint{}
+	if err == nil {
+		err = json.Unmarshal(data, saved)
+	}
+	if err != nil {
+		fmt.Println("Error reading checkpoint, starting from scratch:", err)
+		return fresh
+	}
+	if saved.Cursors == nil {
+		saved.Cursors = make(map[string]sourceCursor)
+	}
+	if saved.FirstSeen == nil {
+		saved.FirstSeen = make(map[string]time.Time)
+	}
+	return saved
+}
+
+// Report whether a source already ran to the end in the resumed run
+func sourceCompleted(name string) bool {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	for _, completed := range progress.Completed {
+		if completed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Record that a source finished and persist the progress
+func markSourceCompleted(name string) {
+	progressLock.Lock()
+	progress.Completed = append(progress.Completed, name)
+	delete(progress.Cursors, name)
+	progressLock.Unlock()
+	saveCheckpoint()
+}
+
+// Where a paging source continues, or the first page when it starts fresh.
+// Only queries for the target itself are checkpointed, not the ones the
+// recursive pass makes for its subdomains.
+func resumeCursor(source, domain string, firstPage int) sourceCursor {
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	if cursor, ok := progress.Cursors[source]; ok && domain == progress.Domain {
+		return cursor
+	}
+	return sourceCursor{Page: firstPage}
+}
+
+// Record the page a source continues from once the current one is processed
+func saveCursor(source, domain string, cursor sourceCursor) {
+	progressLock.Lock()
+	if domain != progress.Domain {
+		progressLock.Unlock()
+		return
+	}
+	progress.Cursors[source] = cursor
+	progressLock.Unlock()
+	saveCheckpoint()
+}
+
+// Persist the progress, at most once per checkpointInterval: a later write
+// is scheduled instead, so a cursor saved on every page does not rewrite
+// the whole result set each time
+func saveCheckpoint() {
+	if !keepCheckpoints {
+		return
+	}
+	progressLock.Lock()
+	if checkpointPending {
+		progressLock.Unlock()
+		return
+	}
+	wait := checkpointInterval - time.Since(lastCheckpoint)
+	if wait <= 0 {
+		progressLock.Unlock()
+		flushCheckpoint()
+		return
+	}
+	checkpointPending = true
+	target := progress
+	progressLock.Unlock()
+	time.AfterFunc(wait, func() {
+		progressLock.Lock()
+		checkpointPending = false
+		current := progress == target
+		progressLock.Unlock()
+		// The next target has its own checkpoint
+		if current {
+			flushCheckpoint()
+		}
+	})
+}
+
+// Write the progress together with every result found so far
+func flushCheckpoint() {
+	if !keepCheckpoints {
+		return
+	}
+	mu.Lock()
+	results := make([]Result, 0, len(uniqueResults))
+	for _, r := range uniqueResults {
+		results = append(results, r)
+	}
+	seen := make(map[string]time.Time, len(firstSeen))
+	for host, date := range firstSeen {
+		seen[host] = date
+	}
+	mu.Unlock()
+
+	progressLock.Lock()
+	defer progressLock.Unlock()
+	progress.Results = results
+	progress.FirstSeen = seen
+
+	path := checkpointPath(progress.Domain)
+	data, err := json.Marshal(progress)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		fmt.Println("Error saving checkpoint:", err)
+	}
+	lastCheckpoint = time.Now()
+}
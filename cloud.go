@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tag every resolved address with the cloud provider and region holding it,
+// set by -cloud
+var classifyClouds bool
+
+// An address range published by a cloud provider
+type cloudRange struct {
+	network  *net.IPNet
+	provider string
+	region   string
+}
+
+// Download page of the Azure service tags, whose file name changes weekly
+const azureServiceTagsPage = "https://www.microsoft.com/en-us/download/details.aspx?id=56519"
+
+var azureServiceTagsPattern = regexp.MustCompile(`https://download\.microsoft\.com/download/[^"']+/ServiceTags_Public_\d+\.json`)
+
+// Fetchers of the published ranges of each provider
+var cloudRangeSources = []struct {
+	provider string
+	fetch    func() ([]cloudRange, error)
+}{
+	{"AWS", fetchAWSRanges},
+	{"Azure", fetchAzureRanges},
+	{"GCP", fetchGCPRanges},
+	{"Oracle Cloud", fetchOracleRanges},
+	{"DigitalOcean", fetchDigitalOceanRanges},
+}
+
+// Fetch a URL and decode its JSON body into v
+func fetchJSON(url string, v any) error {
+	return fetchJSONContext(context.Background(), url, v)
+}
+
+// fetchJSON, giving up when ctx is cancelled
+func fetchJSONContext(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Append a range, skipping malformed CIDRs
+func appendCloudRange(ranges []cloudRange, cidr, provider, region string) []cloudRange {
+	if _, network, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil {
+		ranges = append(ranges, cloudRange{network, provider, region})
+	}
+	return ranges
+}
+
+func fetchAWSRanges() ([]cloudRange, error) {
+	var data struct {
+		Prefixes []struct {
+			Prefix string `json:"ip_prefix"`
+			Region string `json:"region"`
+		} `json:"prefixes"`
+		IPv6Prefixes []struct {
+			Prefix string `json:"ipv6_prefix"`
+			Region string `json:"region"`
+		} `json:"ipv6_prefixes"`
+	}
+	if err := fetchJSON("https://ip-ranges.amazonaws.com/ip-ranges.json", &data); err != nil {
+		return nil, err
+	}
+	var ranges []cloudRange
+	for _, p := range data.Prefixes {
+		ranges = appendCloudRange(ranges, p.Prefix, "AWS", p.Region)
+	}
+	for _, p := range data.IPv6Prefixes {
+		ranges = appendCloudRange(ranges, p.Prefix, "AWS", p.Region)
+	}
+	return ranges, nil
+}
+
+// Azure ranges, from the regional AzureCloud.<region> service tags
+func fetchAzureRanges() ([]cloudRange, error) {
+	resp, err := httpClient.Get(azureServiceTagsPage)
+	if err != nil {
+		return nil, err
+	}
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	link := azureServiceTagsPattern.Find(page)
+	if link == nil {
+		return nil, fmt.Errorf("no service tags link on %s", azureServiceTagsPage)
+	}
+
+	var data struct {
+		Values []struct {
+			Name       string `json:"name"`
+			Properties struct {
+				Region   string   `json:"region"`
+				Prefixes []string `json:"addressPrefixes"`
+			} `json:"properties"`
+		} `json:"values"`
+	}
+	if err := fetchJSON(string(link), &data); err != nil {
+		return nil, err
+	}
+	var ranges []cloudRange
+	for _, tag := range data.Values {
+		if !strings.HasPrefix(tag.Name, "AzureCloud.") {
+			continue
+		}
+		for _, prefix := range tag.Properties.Prefixes {
+			ranges = appendCloudRange(ranges, prefix, "Azure", tag.Properties.Region)
+		}
+	}
+	return ranges, nil
+}
+
+func fetchGCPRanges() ([]cloudRange, error) {
+	var data struct {
+		Prefixes []struct {
+			IPv4  string `json:"ipv4Prefix"`
+			IPv6  string `json:"ipv6Prefix"`
+			Scope string `json:"scope"`
+		} `json:"prefixes"`
+	}
+	if err := fetchJSON("https://www.gstatic.com/ipranges/cloud.json", &data); err != nil {
+		return nil, err
+	}
+	var ranges []cloudRange
+	for _, p := range data.Prefixes {
+		ranges = appendCloudRange(ranges, p.IPv4+p.IPv6, "GCP", p.Scope)
+	}
+	return ranges, nil
+}
+
+func fetchOracleRanges() ([]cloudRange, error) {
+	var data struct {
+		Regions []struct {
+			Region string `json:"region"`
+			CIDRs  []struct {
+				CIDR string `json:"cidr"`
+			} `json:"cidrs"`
+		} `json:"regions"`
+	}
+	if err := fetchJSON("https://docs.oracle.com/iaas/tools/public_ip_ranges.json", &data); err != nil {
+		return nil, err
+	}
+	var ranges []cloudRange
+	for _, region := range data.Regions {
+		for _, cidr := range region.CIDRs {
+			ranges = appendCloudRange(ranges, cidr.CIDR, "Oracle Cloud", region.Region)
+		}
+	}
+	return ranges, nil
+}
+
+// DigitalOcean publishes a geofeed: cidr,country,subdivision,city,postal
+// code. The city stands for the region.
+func fetchDigitalOceanRanges() ([]cloudRange, error) {
+	resp, err := httpClient.Get("https://digitalocean.com/geo/google.csv")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	reader := csv.NewReader(resp.Body)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var ranges []cloudRange
+	for _, record := range records {
+		region := ""
+		if len(record) > 3 {
+			region = record[3]
+		}
+		ranges = appendCloudRange(ranges, record[0], "DigitalOcean", region)
+	}
+	return ranges, nil
+}
+
+// Published ranges of every provider; providers that cannot be fetched
+// are reported and left out
+func fetchCloudRanges() []cloudRange {
+	var ranges []cloudRange
+	for _, source := range cloudRangeSources {
+		found, err := source.fetch()
+		if err != nil {
+			fmt.Printf("Error fetching the %s ranges: %v\n", source.provider, err)
+			continue
+		}
+		ranges = append(ranges, found...)
+	}
+	return ranges
+}
+
+// Most specific range holding an address
+func cloudForIP(ranges []cloudRange, ip string) (cloudRange, bool) {
+	addr := net.ParseIP(ip)
+	best, bestSize, found := cloudRange{}, -1, false
+	for _, r := range ranges {
+		if size, _ := r.network.Mask.Size(); size > bestSize && r.network.Contains(addr) {
+			best, bestSize, found = r, size, true
+		}
+	}
+	return best, found
+}
+
+// Tag the results with the provider and region of their first address held
+// by a cloud
+func classifyCloudProviders(results []datedResult) {
+	var ips []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			if _, exists := seen[ip]; !exists {
+				seen[ip] = struct{}{}
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return
+	}
+	ranges := fetchCloudRanges()
+	fmt.Printf("Matching %d addresses against %d cloud ranges\n", len(ips), len(ranges))
+
+	owners := make(map[string]cloudRange, len(ips))
+	for _, ip := range ips {
+		if r, ok := cloudForIP(ranges, ip); ok {
+			owners[ip] = r
+		}
+	}
+	for i := range results {
+		for _, ip := range results[i].IPs {
+			if r, ok := owners[ip]; ok {
+				results[i].Cloud, results[i].CloudRegion = r.provider, r.region
+				break
+			}
+		}
+	}
+}
+
+// Text shown for the cloud tag of a result
+func cloudSummary(r datedResult) string {
+	if r.CloudRegion == "" {
+		return "[cloud: " + r.Cloud + "]"
+	}
+	return "[cloud: " + r.Cloud + " " + r.CloudRegion + "]"
+}
+
+// Print how many hosts each provider holds, and in which regions
+func printCloudFootprint(results []datedResult) {
+	hosts := make(map[string]int)
+	regions := make(map[string]map[string]int)
+	for _, r := range results {
+		if r.Cloud == "" {
+			continue
+		}
+		hosts[r.Cloud]++
+		if regions[r.Cloud] == nil {
+			regions[r.Cloud] = make(map[string]int)
+		}
+		if r.CloudRegion != "" {
+			regions[r.Cloud][r.CloudRegion]++
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	providers := make([]string, 0, len(hosts))
+	for provider := range hosts {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		if hosts[providers[i]] != hosts[providers[j]] {
+			return hosts[providers[i]] > hosts[providers[j]]
+		}
+		return providers[i] < providers[j]
+	})
+
+	fmt.Println("\n=== Cloud footprint ===")
+	for _, provider := range providers {
+		var names []string
+		for region := range regions[provider] {
+			names = append(names, region)
+		}
+		sort.Slice(names, func(i, j int) bool {
+			counts := regions[provider]
+			if counts[names[i]] != counts[names[j]] {
+				return counts[names[i]] > counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+		parts := make([]string, len(names))
+		for i, region := range names {
+			parts[i] = fmt.Sprintf("%s: %d", region, regions[provider][region])
+		}
+		line := fmt.Sprintf("%s: %d hosts", provider, hosts[provider])
+		if len(parts) > 0 {
+			line += " (" + strings.Join(parts, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	fmt.Println("==============================")
+}
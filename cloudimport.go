@@ -0,0 +1,547 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// Credentials for the authoritative DNS importers
+var (
+	apiTokenCloudflare  = os.Getenv("CLOUDFLARE_API_TOKEN")
+	awsAccessKeyID      = os.Getenv("AWS_ACCESS_KEY_ID")
+	awsSecretAccessKey  = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	awsSessionToken     = os.Getenv("AWS_SESSION_TOKEN")
+	azureTenantID       = os.Getenv("AZURE_TENANT_ID")
+	azureClientID       = os.Getenv("AZURE_CLIENT_ID")
+	azureClientSecret   = os.Getenv("AZURE_CLIENT_SECRET")
+	azureSubscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
+	gcpCredentialsFile  = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	gcpProject          = os.Getenv("GOOGLE_CLOUD_PROJECT")
+)
+
+// Register the DNS hosting imports
+func init() {
+	for _, source := range []sourceFunc{
+		{"cloudflare", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromCloudflare(ctx, domain, out)
+		}},
+		{"route53", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromRoute53(ctx, domain, out)
+		}},
+		{"azuredns", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromAzureDNS(ctx, domain, out)
+		}},
+		{"gclouddns", func(ctx context.Context, domain string, _ *Session, out chan<- Result) {
+			fetchFromGoogleCloudDNS(ctx, domain, out)
+		}},
+	} {
+		registerSource(source)
+	}
+}
+
+// Add an authoritative DNS record: address records keep their IP, and
+// in-scope names in CNAME/MX/NS answers become hosts of their own
+func addZoneRecord(source, domain, name, recordType, content string, out chan<- Result) {
+	name = scope.NormalizeHost(name)
+	if !scope.IsInScope(name, domain) {
+		return
+	}
+	switch recordType {
+	case "A", "AAAA":
+		out <- Result{Host: name, IP: content, Source: source}
+	default:
+		out <- Result{Host: name, Source: source}
+		if target := scope.NormalizeHost(content); scope.IsInScope(target, domain) {
+			out <- Result{Host: target, Source: source}
+		}
+	}
+}
+
+// Function to import DNS records from the Cloudflare zones of the account
+// that are the target domain or one of its subdomains
+func fetchFromCloudflare(ctx context.Context, domain string, out chan<- Result) {
+	if apiTokenCloudflare == "" {
+		sourceNotConfigured("Cloudflare")
+		return
+	}
+
+	var zones []string
+	for page := 1; ; page++ {
+		var result struct {
+			Result []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"result"`
+			ResultInfo struct {
+				TotalPages int `json:"total_pages"`
+			} `json:"result_info"`
+		}
+		if err := bearerGet(ctx, fmt.Sprintf("https://api.cloudflare.com/client/v4/zones?page=%d&per_page=50", page), apiTokenCloudflare, &result); err != nil {
+			fmt.Println("Error listing Cloudflare zones:", err)
+			return
+		}
+		for _, zone := range result.Result {
+			if scope.IsInScope(zone.Name, domain) {
+				zones = append(zones, zone.ID)
+			}
+		}
+		if page >= result.ResultInfo.TotalPages {
+			break
+		}
+	}
+
+	for _, zone := range zones {
+		for page := 1; ; page++ {
+			var result struct {
+				Result []struct {
+					Name    string `json:"name"`
+					Type    string `json:"type"`
+					Content string `json:"content"`
+				} `json:"result"`
+				ResultInfo struct {
+					TotalPages int `json:"total_pages"`
+				} `json:"result_info"`
+			}
+			endpoint := fmt.Sprintf("https://api.cloudflare.com/client/v4/zones/%s/dns_records?page=%d&per_page=100", zone, page)
+			if err := bearerGet(ctx, endpoint, apiTokenCloudflare, &result); err != nil {
+				fmt.Println("Error listing Cloudflare DNS records:", err)
+				break
+			}
+			for _, record := range result.Result {
+				addZoneRecord("cloudflare", domain, record.Name, record.Type, record.Content, out)
+			}
+			if page >= result.ResultInfo.TotalPages {
+				break
+			}
+		}
+	}
+}
+
+// Function to import the records of the Route53 hosted zones that are the
+// target domain or one of its subdomains
+func fetchFromRoute53(ctx context.Context, domain string, out chan<- Result) {
+	if awsAccessKeyID == "" || awsSecretAccessKey == "" {
+		sourceNotConfigured("Route53")
+		return
+	}
+
+	var zones []string
+	marker := ""
+	for {
+		query := url.Values{}
+		if marker != "" {
+			query.Set("marker", marker)
+		}
+		var result struct {
+			HostedZones []struct {
+				ID   string `xml:"Id"`
+				Name string `xml:"Name"`
+			} `xml:"HostedZones>HostedZone"`
+			IsTruncated bool   `xml:"IsTruncated"`
+			NextMarker  string `xml:"NextMarker"`
+		}
+		if err := route53Get(ctx, "/2013-04-01/hostedzone", query, &result); err != nil {
+			fmt.Println("Error listing Route53 hosted zones:", err)
+			return
+		}
+		for _, zone := range result.HostedZones {
+			if scope.IsInScope(zone.Name, domain) {
+				zones = append(zones, strings.TrimPrefix(zone.ID, "/hostedzone/"))
+			}
+		}
+		if !result.IsTruncated {
+			break
+		}
+		marker = result.NextMarker
+	}
+
+	for _, zone := range zones {
+		query := url.Values{}
+		for {
+			var result struct {
+				RecordSets []struct {
+					Name    string   `xml:"Name"`
+					Type    string   `xml:"Type"`
+					Values  []string `xml:"ResourceRecords>ResourceRecord>Value"`
+					AliasTo string   `xml:"AliasTarget>DNSName"`
+				} `xml:"ResourceRecordSets>ResourceRecordSet"`
+				IsTruncated          bool   `xml:"IsTruncated"`
+				NextRecordName       string `xml:"NextRecordName"`
+				NextRecordType       string `xml:"NextRecordType"`
+				NextRecordIdentifier string `xml:"NextRecordIdentifier"`
+			}
+			if err := route53Get(ctx, "/2013-04-01/hostedzone/"+zone+"/rrset", query, &result); err != nil {
+				fmt.Println("Error listing Route53 records:", err)
+				break
+			}
+			for _, record := range result.RecordSets {
+				for _, value := range record.Values {
+					addZoneRecord("route53", domain, record.Name, record.Type, value, out)
+				}
+				// Alias records point at AWS resources instead of holding values
+				if record.AliasTo != "" {
+					addZoneRecord("route53", domain, record.Name, "ALIAS", record.AliasTo, out)
+				}
+			}
+			if !result.IsTruncated {
+				break
+			}
+			query = url.Values{}
+			query.Set("name", result.NextRecordName)
+			query.Set("type", result.NextRecordType)
+			if result.NextRecordIdentifier != "" {
+				query.Set("identifier", result.NextRecordIdentifier)
+			}
+		}
+	}
+}
+
+// Perform a Route53 API request signed with AWS Signature Version 4 and
+// decode its XML body
+func route53Get(ctx context.Context, path string, query url.Values, into interface{}) error {
+	const host, region, service = "route53.amazonaws.com", "us-east-1", "route53"
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	// SigV4 wants RFC 3986 encoding, so spaces must be %20 rather than +
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+	headers := map[string]string{"host": host, "x-amz-date": amzDate}
+	if awsSessionToken != "" {
+		headers["x-amz-security-token"] = awsSessionToken
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	emptyPayload := sha256.Sum256(nil)
+	canonicalRequest := strings.Join([]string{
+		"GET", path, canonicalQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(emptyPayload[:]),
+	}, "\n")
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	credentialScope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + credentialScope + "\n" + hex.EncodeToString(hashedRequest[:])
+
+	key := hmacSHA256([]byte("AWS4"+awsSecretAccessKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	endpoint := "https://" + host + path
+	if canonicalQuery != "" {
+		endpoint += "?" + canonicalQuery
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	for name, value := range headers {
+		if name != "host" {
+			req.Header.Set(name, value)
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		awsAccessKeyID, credentialScope, signedHeaders, signature))
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(into)
+}
+
+// HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Function to import the records of the Azure DNS zones of the subscription
+// that are the target domain or one of its subdomains
+func fetchFromAzureDNS(ctx context.Context, domain string, out chan<- Result) {
+	if azureTenantID == "" || azureClientID == "" || azureClientSecret == "" || azureSubscriptionID == "" {
+		sourceNotConfigured("Azure DNS")
+		return
+	}
+
+	token, err := fetchOAuthToken(ctx, "https://login.microsoftonline.com/"+azureTenantID+"/oauth2/v2.0/token", url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {azureClientID},
+		"client_secret": {azureClientSecret},
+		"scope":         {"https://management.azure.com/.default"},
+	})
+	if err != nil {
+		fmt.Println("Error authenticating to Azure:", err)
+		sourceNotConfigured("Azure DNS")
+		return
+	}
+
+	var zones []string
+	next := "https://management.azure.com/subscriptions/" + azureSubscriptionID + "/providers/Microsoft.Network/dnszones?api-version=2018-05-01"
+	for next != "" {
+		var result struct {
+			Value []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if err := bearerGet(ctx, next, token, &result); err != nil {
+			fmt.Println("Error listing Azure DNS zones:", err)
+			return
+		}
+		for _, zone := range result.Value {
+			if scope.IsInScope(zone.Name, domain) {
+				zones = append(zones, zone.ID)
+			}
+		}
+		next = result.NextLink
+	}
+
+	for _, zone := range zones {
+		next := "https://management.azure.com" + zone + "/all?api-version=2018-05-01"
+		for next != "" {
+			var result struct {
+				Value []struct {
+					Properties struct {
+						FQDN     string `json:"fqdn"`
+						ARecords []struct {
+							IPv4Address string `json:"ipv4Address"`
+						} `json:"ARecords"`
+						AAAARecords []struct {
+							IPv6Address string `json:"ipv6Address"`
+						} `json:"AAAARecords"`
+						CNAMERecord *struct {
+							CNAME string `json:"cname"`
+						} `json:"CNAMERecord"`
+						MXRecords []struct {
+							Exchange string `json:"exchange"`
+						} `json:"MXRecords"`
+						NSRecords []struct {
+							NSDName string `json:"nsdname"`
+						} `json:"NSRecords"`
+					} `json:"properties"`
+				} `json:"value"`
+				NextLink string `json:"nextLink"`
+			}
+			if err := bearerGet(ctx, next, token, &result); err != nil {
+				fmt.Println("Error listing Azure DNS records:", err)
+				break
+			}
+			for _, record := range result.Value {
+				props := record.Properties
+				addZoneRecord("azuredns", domain, props.FQDN, "NAME", "", out)
+				for _, a := range props.ARecords {
+					addZoneRecord("azuredns", domain, props.FQDN, "A", a.IPv4Address, out)
+				}
+				for _, aaaa := range props.AAAARecords {
+					addZoneRecord("azuredns", domain, props.FQDN, "AAAA", aaaa.IPv6Address, out)
+				}
+				if props.CNAMERecord != nil {
+					addZoneRecord("azuredns", domain, props.FQDN, "CNAME", props.CNAMERecord.CNAME, out)
+				}
+				for _, mx := range props.MXRecords {
+					addZoneRecord("azuredns", domain, props.FQDN, "MX", mx.Exchange, out)
+				}
+				for _, ns := range props.NSRecords {
+					addZoneRecord("azuredns", domain, props.FQDN, "NS", ns.NSDName, out)
+				}
+			}
+			next = result.NextLink
+		}
+	}
+}
+
+// Function to import the records of the Google Cloud DNS managed zones of the
+// project that are the target domain or one of its subdomains
+func fetchFromGoogleCloudDNS(ctx context.Context, domain string, out chan<- Result) {
+	if gcpCredentialsFile == "" {
+		sourceNotConfigured("Google Cloud DNS")
+		return
+	}
+
+	token, project, err := googleServiceAccountToken(ctx, gcpCredentialsFile, "https://www.googleapis.com/auth/ndev.clouddns.readonly")
+	if err != nil {
+		fmt.Println("Error authenticating to Google Cloud:", err)
+		sourceNotConfigured("Google Cloud DNS")
+		return
+	}
+	if gcpProject != "" {
+		project = gcpProject
+	}
+	base := "https://dns.googleapis.com/dns/v1/projects/" + url.PathEscape(project) + "/managedZones"
+
+	var zones []string
+	pageToken := ""
+	for {
+		var result struct {
+			ManagedZones []struct {
+				Name    string `json:"name"`
+				DNSName string `json:"dnsName"`
+			} `json:"managedZones"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := bearerGet(ctx, base+"?pageToken="+url.QueryEscape(pageToken), token, &result); err != nil {
+			fmt.Println("Error listing Google Cloud DNS zones:", err)
+			return
+		}
+		for _, zone := range result.ManagedZones {
+			if scope.IsInScope(zone.DNSName, domain) {
+				zones = append(zones, zone.Name)
+			}
+		}
+		if pageToken = result.NextPageToken; pageToken == "" {
+			break
+		}
+	}
+
+	for _, zone := range zones {
+		pageToken := ""
+		for {
+			var result struct {
+				RRSets []struct {
+					Name    string   `json:"name"`
+					Type    string   `json:"type"`
+					RRDatas []string `json:"rrdatas"`
+				} `json:"rrsets"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			endpoint := base + "/" + url.PathEscape(zone) + "/rrsets?pageToken=" + url.QueryEscape(pageToken)
+			if err := bearerGet(ctx, endpoint, token, &result); err != nil {
+				fmt.Println("Error listing Google Cloud DNS records:", err)
+				break
+			}
+			for _, rrset := range result.RRSets {
+				for _, data := range rrset.RRDatas {
+					// MX data is "priority exchange"; the name is the last field
+					fields := strings.Fields(data)
+					if len(fields) > 0 {
+						addZoneRecord("gclouddns", domain, rrset.Name, rrset.Type, fields[len(fields)-1], out)
+					}
+				}
+			}
+			if pageToken = result.NextPageToken; pageToken == "" {
+				break
+			}
+		}
+	}
+}
+
+// Exchange a Google service account key for an OAuth access token using a
+// signed JWT assertion, returning the token and the key's project
+func googleServiceAccountToken(ctx context.Context, path, oauthScope string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	var account struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+		ProjectID   string `json:"project_id"`
+	}
+	if err := json.Unmarshal(data, &account); err != nil {
+		return "", "", err
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return "", "", errors.New("service account private key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", "", err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", "", errors.New("service account private key is not an RSA key")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": oauthScope,
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", "", err
+	}
+
+	token, err := fetchOAuthToken(ctx, account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	})
+	return token, account.ProjectID, err
+}
+
+// Request an OAuth access token with a form-encoded grant
+func fetchOAuthToken(ctx context.Context, tokenURL string, form url.Values) (string, error) {
+	req, _ := http.NewRequestWithContext(ctx, "POST", tokenURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.AccessToken == "" {
+		return "", fmt.Errorf("no access token returned: %s", result.ErrorDescription)
+	}
+	return result.AccessToken, nil
+}
+
+// Perform a request authenticated with an OAuth bearer token and decode its
+// JSON body
+func bearerGet(ctx context.Context, endpoint, token string, into interface{}) error {
+	req, _ := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(into)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration loaded from the file given with -config, in JSON, YAML or
+// TOML. Flags given on the command line override the file values.
+type config struct {
+	// Sources run when -sources is not given
+	EnabledSources []string `json:"enabled_sources"`
+	// Timeout of each request, in seconds
+	TimeoutSeconds float64 `json:"timeout_seconds"`
+	// Request timeout of individual sources, in seconds, overriding
+	// timeout_seconds for them
+	SourceTimeouts map[string]float64 `json:"source_timeouts"`
+	Proxy          string             `json:"proxy"`
+	Concurrency    int                `json:"concurrency"`
+	// Maximum number of requests started per second across all sources
+	RateLimit float64       `json:"rate_limit"`
+	Output    outputConfig  `json:"output"`
+	Notify    notifyConfig  `json:"notify"`
+	Sources   sourcesConfig `json:"sources"`
+
+	// Daily window without active stages and its time zone, as with
+	// -quiet-hours and -quiet-timezone
+	QuietHours    string `json:"quiet_hours"`
+	QuietTimezone string `json:"quiet_timezone"`
+}
+
+// Output defaults
+type outputConfig struct {
+	// Go template applied to each result, as with -format
+	Format string `json:"format"`
+	// Uniqueness key, as with -dedup
+	Dedup string `json:"dedup"`
+	// History directory, as with -history
+	History string `json:"history"`
+	// Digest reports, as with -report-dir and -report-period
+	ReportDir    string `json:"report_dir"`
+	ReportPeriod string `json:"report_period"`
+}
+
+// Notification defaults
+type notifyConfig struct {
+	// Channels notified, as with -notify
+	Channels []string `json:"channels"`
+	// Go templates of the message sent when a target finishes and of the one
+	// listing hosts never seen before
+	CompleteTemplate string `json:"complete_template"`
+	NewTemplate      string `json:"new_template"`
+	// Templates of the emails sent for each target and for digests; their
+	// first line is the subject
+	EmailTemplate  string `json:"email_template"`
+	DigestTemplate string `json:"digest_template"`
+	// Period of the email digests, as with -email-digest
+	EmailDigest string `json:"email_digest"`
+}
+
+// Per-source options, one block per provider
+type sourcesConfig struct {
+	CrtSh          crtShOptions          `json:"crtsh"`
+	SecurityTrails securityTrailsOptions `json:"securitytrails"`
+	VirusTotal     virusTotalOptions     `json:"virustotal"`
+	ZoomEye        zoomEyeOptions        `json:"zoomeye"`
+	Fofa           fofaOptions           `json:"fofa"`
+	HunterHow      hunterHowOptions      `json:"hunterhow"`
+	IntelX         intelXOptions         `json:"intelx"`
+	Wayback        waybackOptions        `json:"wayback"`
+	SiteDossier    siteDossierOptions    `json:"sitedossier"`
+	Quake          quakeOptions          `json:"quake"`
+	Bing           searchEngineOptions   `json:"bing"`
+	DuckDuckGo     searchEngineOptions   `json:"duckduckgo"`
+	Yandex         searchEngineOptions   `json:"yandex"`
+	Baidu          searchEngineOptions   `json:"baidu"`
+	Google         googleOptions         `json:"google"`
+}
+
+// Options for Crt.sh
+type crtShOptions struct {
+	// Ask crt.sh to collapse precertificate/certificate pairs
+	Deduplicate bool `json:"deduplicate"`
+	// Base URLs tried in order; later entries are mirrors used when the
+	// primary is down
+	Endpoints []string `json:"endpoints"`
+	// With -crtsh-db, only read certificates newer than the last run
+	// (requires -history)
+	Incremental bool `json:"incremental"`
+	// With -crtsh-db, maximum number of identity rows read per run
+	DBLimit int `json:"db_limit"`
+}
+
+// Options for SecurityTrails
+type securityTrailsOptions struct {
+	// Include subdomains that no longer have DNS records
+	IncludeInactive bool `json:"include_inactive"`
+	// Also read historical A/AAAA/MX/NS records of the apex and A records of
+	// the first subdomains found
+	History bool `json:"history"`
+	// Maximum number of history pages read per host and record type
+	HistoryPages int `json:"history_pages"`
+	// Number of subdomains whose A record history is read
+	HistorySubdomains int `json:"history_subdomains"`
+}
+
+// Options for VirusTotal
+type virusTotalOptions struct {
+	// Maximum number of result pages to request (40 subdomains per page)
+	MaxPages int `json:"max_pages"`
+}
+
+// Options for ZoomEye
+type zoomEyeOptions struct {
+	// Maximum number of host search pages to request (20 results per page)
+	MaxPages int `json:"max_pages"`
+}
+
+// Options for FOFA
+type fofaOptions struct {
+	// Number of results requested from the search API
+	Size int `json:"size"`
+}
+
+// Options for Hunter.how
+type hunterHowOptions struct {
+	// Number of days back from today covered by the search
+	Days int `json:"days"`
+	// Maximum number of result pages to request (100 results per page)
+	MaxPages int `json:"max_pages"`
+}
+
+// Options for Intelligence X
+type intelXOptions struct {
+	// API host for the account tier (free.intelx.io for free keys)
+	Host string `json:"host"`
+	// Maximum number of selectors requested per search and per page
+	MaxResults int `json:"max_results"`
+	// Maximum number of result pages to fetch
+	MaxPolls int `json:"max_polls"`
+}
+
+// Options for the Wayback Machine
+type waybackOptions struct {
+	// Maximum number of unique archived URLs read from the CDX index
+	Limit int `json:"limit"`
+}
+
+// Options for SiteDossier
+type siteDossierOptions struct {
+	// Maximum number of listing pages to scrape (100 hosts per page)
+	MaxPages int `json:"max_pages"`
+}
+
+// Options for 360 Quake
+type quakeOptions struct {
+	// Maximum number of result pages to request (100 results per page)
+	MaxPages int `json:"max_pages"`
+}
+
+// Options shared by the search engine scrapers
+type searchEngineOptions struct {
+	// Maximum number of result pages to scrape
+	MaxPages int `json:"max_pages"`
+	// Base delay between pages; each wait adds a random amount up to the same
+	DelaySeconds float64 `json:"delay_seconds"`
+}
+
+// Options for the Google Programmable Search Engine
+type googleOptions struct {
+	// Maximum number of queries sent per run (10 results each)
+	MaxQueries int `json:"max_queries"`
+	// Queries allowed per day across all runs; the free tier allows 100
+	DailyLimit int `json:"daily_limit"`
+}
+
+// Default options used when no configuration file is given
+func defaultConfig() config {
+	return config{
+		// Sources whose answers often take longer than the default timeout
+		SourceTimeouts: map[string]float64{
+			"crtsh":           90,
+			"wayback":         60,
+			"threatminer":     30,
+			"intelx":          30,
+			"subdomaincenter": 30,
+		},
+		Sources: sourcesConfig{
+			CrtSh:          crtShOptions{Deduplicate: true, Endpoints: []string{"https://crt.sh"}, DBLimit: 10000},
+			SecurityTrails: securityTrailsOptions{HistoryPages: 1, HistorySubdomains: 10},
+			VirusTotal:     virusTotalOptions{MaxPages: 5},
+			ZoomEye:        zoomEyeOptions{MaxPages: 5},
+			Fofa:           fofaOptions{Size: 100},
+			HunterHow:      hunterHowOptions{Days: 30, MaxPages: 5},
+			IntelX:         intelXOptions{Host: "2.intelx.io", MaxResults: 1000, MaxPolls: 5},
+			Wayback:        waybackOptions{Limit: 10000},
+			SiteDossier:    siteDossierOptions{MaxPages: 10},
+			Quake:          quakeOptions{MaxPages: 5},
+			Bing:           searchEngineOptions{MaxPages: 10, DelaySeconds: 2},
+			DuckDuckGo:     searchEngineOptions{MaxPages: 10, DelaySeconds: 2},
+			Yandex:         searchEngineOptions{MaxPages: 5, DelaySeconds: 3},
+			Baidu:          searchEngineOptions{MaxPages: 5, DelaySeconds: 3},
+			Google:         googleOptions{MaxQueries: 10, DailyLimit: 100},
+		},
+	}
+}
+
+// Configuration file read when -config is not given, if it exists
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.yaml", "config.yml", "config.toml", "config.json"} {
+		path := filepath.Join(dir, "leviathanmapper", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// Load the configuration file on top of the defaults
+func loadConfig(path string) config {
+	cfg := defaultConfig()
+	if path == "" {
+		if path = defaultConfigPath(); path == "" {
+			return cfg
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Error reading config file:", err)
+		os.Exit(1)
+	}
+	if data, err = configToJSON(path, data); err == nil {
+		err = json.Unmarshal(data, &cfg)
+	}
+	if err != nil {
+		fmt.Println("Error parsing config file:", err)
+		os.Exit(1)
+	}
+	return cfg
+}
+
+// Use the file values for the flags that were not given on the command line
+func applyConfigToFlags(cfg config) {
+	values := make(map[string]string)
+	if len(cfg.EnabledSources) > 0 {
+		values["sources"] = strings.Join(cfg.EnabledSources, ",")
+	}
+	if cfg.TimeoutSeconds > 0 {
+		values["timeout"] = time.Duration(cfg.TimeoutSeconds * float64(time.Second)).String()
+	}
+	if cfg.Proxy != "" {
+		values["proxy"] = cfg.Proxy
+	}
+	if cfg.Concurrency > 0 {
+		values["concurrency"] = strconv.Itoa(cfg.Concurrency)
+	}
+	if cfg.RateLimit > 0 {
+		values["rate-limit"] = strconv.FormatFloat(cfg.RateLimit, 'f', -1, 64)
+	}
+	if cfg.QuietHours != "" {
+		values["quiet-hours"] = cfg.QuietHours
+	}
+	if cfg.QuietTimezone != "" {
+		values["quiet-timezone"] = cfg.QuietTimezone
+	}
+	if cfg.Output.Format != "" {
+		values["format"] = cfg.Output.Format
+	}
+	if cfg.Output.Dedup != "" {
+		values["dedup"] = cfg.Output.Dedup
+	}
+	if cfg.Output.History != "" {
+		values["history"] = expandHome(cfg.Output.History)
+	}
+	if cfg.Output.ReportDir != "" {
+		values["report-dir"] = expandHome(cfg.Output.ReportDir)
+	}
+	if cfg.Output.ReportPeriod != "" {
+		values["report-period"] = cfg.Output.ReportPeriod
+	}
+	if len(cfg.Notify.Channels) > 0 {
+		values["notify"] = strings.Join(cfg.Notify.Channels, ",")
+	}
+	if cfg.Notify.EmailDigest != "" {
+		values["email-digest"] = cfg.Notify.EmailDigest
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for name, value := range values {
+		if given[name] {
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			fmt.Printf("Error in config file: invalid %s: %v\n", name, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// Expand a leading ~ to the home directory, which the shell does for flags
+// but not for file values
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Convert a YAML or TOML configuration file to JSON, picking the format from
+// the file extension, so every format shares the JSON field tags. Any other
+// extension is assumed to already be JSON.
+func configToJSON(path string, data []byte) ([]byte, error) {
+	var (
+		tree map[string]interface{}
+		err  error
+	)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		tree, err = parseYAML(string(data))
+	case ".toml":
+		tree, err = parseTOML(string(data))
+	default:
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// A meaningful line of a YAML document
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// Parse the YAML subset used by configuration files: nested mappings, block
+// and flow sequences, and plain or quoted scalars. Anchors, multi-line
+// strings and multiple documents are not supported.
+func parseYAML(data string) (map[string]interface{}, error) {
+	var lines []yamlLine
+	for i, raw := range strings.Split(data, "\n") {
+		text := strings.TrimRight(stripComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if trimmed[0] == '\t' {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	value, rest, err := parseYAMLBlock(lines, lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("line %d: unexpected indentation", rest[0].number)
+	}
+	tree, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("line %d: the document must be a mapping", lines[0].number)
+	}
+	return tree, nil
+}
+
+// Parse the mapping or sequence starting at the first line, which sits at
+// the given indentation, and return the lines after it
+func parseYAMLBlock(lines []yamlLine, indent int) (interface{}, []yamlLine, error) {
+	if lines[0].text == "-" || strings.HasPrefix(lines[0].text, "- ") {
+		return parseYAMLSequence(lines, indent)
+	}
+	return parseYAMLMapping(lines, indent)
+}
+
+func parseYAMLMapping(lines []yamlLine, indent int) (interface{}, []yamlLine, error) {
+	mapping := make(map[string]interface{})
+	for len(lines) > 0 && lines[0].indent == indent {
+		line := lines[0]
+		lines = lines[1:]
+		key, value, found := cutYAMLKey(line.text)
+		if !found {
+			return nil, nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		if value != "" {
+			scalar, err := parseYAMLValue(value)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			mapping[key] = scalar
+			continue
+		}
+		// An empty value opens a nested block; sequences may sit at the
+		// same indentation as their key
+		if len(lines) > 0 && (lines[0].indent > indent || lines[0].indent == indent && strings.HasPrefix(lines[0].text, "- ")) {
+			child, rest, err := parseYAMLBlock(lines, lines[0].indent)
+			if err != nil {
+				return nil, nil, err
+			}
+			mapping[key] = child
+			lines = rest
+			continue
+		}
+		mapping[key] = nil
+	}
+	if len(lines) > 0 && lines[0].indent > indent {
+		return nil, nil, fmt.Errorf("line %d: unexpected indentation", lines[0].number)
+	}
+	return mapping, lines, nil
+}
+
+func parseYAMLSequence(lines []yamlLine, indent int) (interface{}, []yamlLine, error) {
+	sequence := []interface{}{}
+	for len(lines) > 0 && lines[0].indent == indent && (lines[0].text == "-" || strings.HasPrefix(lines[0].text, "- ")) {
+		line := lines[0]
+		item := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		lines = lines[1:]
+
+		switch _, _, isMapping := cutYAMLKey(item); {
+		case item == "":
+			if len(lines) == 0 || lines[0].indent <= indent {
+				sequence = append(sequence, nil)
+				continue
+			}
+			child, rest, err := parseYAMLBlock(lines, lines[0].indent)
+			if err != nil {
+				return nil, nil, err
+			}
+			sequence = append(sequence, child)
+			lines = rest
+		case isMapping:
+			// "- key: value" starts a mapping indented past the dash
+			nested := append([]yamlLine{{number: line.number, indent: indent + 2, text: item}}, lines...)
+			child, rest, err := parseYAMLMapping(nested, indent+2)
+			if err != nil {
+				return nil, nil, err
+			}
+			sequence = append(sequence, child)
+			lines = rest
+		default:
+			scalar, err := parseYAMLValue(item)
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %v", line.number, err)
+			}
+			sequence = append(sequence, scalar)
+		}
+	}
+	return sequence, lines, nil
+}
+
+// Split "key: value", leaving flow collections and quoted scalars alone
+func cutYAMLKey(text string) (string, string, bool) {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return "", "", false
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text, 0)
+		if end < 0 || !strings.HasPrefix(text[end+1:], ":") {
+			return "", "", false
+		}
+		key, err := unquoteScalar(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[end+2:]), true
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// Parse a scalar or a flow sequence such as [a, "b", 3]
+func parseYAMLValue(text string) (interface{}, error) {
+	if strings.HasPrefix(text, "[") {
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %q", text)
+		}
+		items := []interface{}{}
+		for _, item := range splitFlowItems(text[1 : len(text)-1]) {
+			value, err := parseYAMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	}
+	if strings.HasPrefix(text, "{") {
+		return nil, fmt.Errorf("flow mappings are not supported")
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		return unquoteScalar(text)
+	}
+	switch text {
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	return text, nil
+}
+
+// A TOML table being filled and the key path that names it
+type tomlTable struct {
+	values map[string]interface{}
+	path   string
+}
+
+// Parse the TOML subset used by configuration files: tables, dotted keys,
+// strings, numbers, booleans and (possibly multi-line) arrays. Inline
+// tables, arrays of tables and dates are not supported.
+func parseTOML(data string) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	current := tomlTable{values: root}
+	lines := strings.Split(data, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		text := strings.TrimSpace(stripComment(lines[i]))
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "[") {
+			if strings.HasPrefix(text, "[[") {
+				return nil, fmt.Errorf("line %d: arrays of tables are not supported", number)
+			}
+			if !strings.HasSuffix(text, "]") {
+				return nil, fmt.Errorf("line %d: malformed table header", number)
+			}
+			keys, err := splitTOMLKey(text[1 : len(text)-1])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", number, err)
+			}
+			table, err := tomlSubtable(root, keys)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", number, err)
+			}
+			current = tomlTable{values: table, path: strings.Join(keys, ".")}
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", number)
+		}
+		keys, err := splitTOMLKey(text[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+		raw := strings.TrimSpace(text[eq+1:])
+		// Arrays may continue over the following lines until balanced
+		for strings.HasPrefix(raw, "[") && !balancedBrackets(raw) && i+1 < len(lines) {
+			i++
+			raw += " " + strings.TrimSpace(stripComment(lines[i]))
+		}
+		value, err := parseTOMLValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+
+		table, err := tomlSubtable(current.values, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", number, err)
+		}
+		last := keys[len(keys)-1]
+		if _, exists := table[last]; exists {
+			return nil, fmt.Errorf("line %d: duplicate key %q", number, strings.Trim(current.path+"."+strings.Join(keys, "."), "."))
+		}
+		table[last] = value
+	}
+	return root, nil
+}
+
+// Walk to the table named by keys, creating the missing levels
+func tomlSubtable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, key := range keys {
+		next, exists := table[key]
+		if !exists {
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+			continue
+		}
+		child, ok := next.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %q is not a table", key)
+		}
+		table = child
+	}
+	return table, nil
+}
+
+// Split a possibly dotted and quoted TOML key
+func splitTOMLKey(text string) ([]string, error) {
+	var keys []string
+	for _, part := range splitOutsideQuotes(text, '.') {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty key in %q", strings.TrimSpace(text))
+		}
+		if part[0] == '"' || part[0] == '\'' {
+			unquoted, err := unquoteScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			part = unquoted
+		}
+		keys = append(keys, part)
+	}
+	return keys, nil
+}
+
+func parseTOMLValue(text string) (interface{}, error) {
+	if text == "" {
+		return nil, fmt.Errorf("missing value")
+	}
+	switch {
+	case text[0] == '"' || text[0] == '\'':
+		return unquoteScalar(text)
+	case text[0] == '[':
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		items := []interface{}{}
+		for _, item := range splitFlowItems(text[1 : len(text)-1]) {
+			value, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case text[0] == '{':
+		return nil, fmt.Errorf("inline tables are not supported")
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	}
+	number := strings.ReplaceAll(text, "_", "")
+	if n, err := strconv.ParseInt(number, 0, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(number, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %q", text)
+}
+
+// Remove a trailing # comment that is not inside a quoted string
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			end := closingQuote(line, i)
+			if end < 0 {
+				return line
+			}
+			i = end
+		case '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// Index of the quote closing the string that opens at start, or -1
+func closingQuote(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote:
+			// Single-quoted YAML escapes a quote by doubling it
+			if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// Decode a double- or single-quoted scalar
+func unquoteScalar(text string) (string, error) {
+	if len(text) < 2 || closingQuote(text, 0) != len(text)-1 {
+		return "", fmt.Errorf("unterminated string %s", text)
+	}
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(text)
+}
+
+// Split the items of a flow sequence or array on top-level commas
+func splitFlowItems(text string) []string {
+	var items []string
+	for _, item := range splitOutsideQuotes(text, ',') {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Split text on sep, ignoring separators inside quotes or nested brackets
+func splitOutsideQuotes(text string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '"' || c == '\'':
+			if end := closingQuote(text, i); end > 0 {
+				i = end
+			}
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// Report whether every [ in text is closed, ignoring quoted brackets
+func balancedBrackets(text string) bool {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"', '\'':
+			end := closingQuote(text, i)
+			if end < 0 {
+				return false
+			}
+			i = end
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+	}
+	return depth == 0
+}
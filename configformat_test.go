@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigToJSON(t *testing.T) {
+	tests := []struct {
+		name, path, data string
+		want             string // JSON, with sorted keys
+	}{
+		{
+			name: "yaml mappings and sequences",
+			path: "config.yaml",
+			data: `---
+# Keys of the sources
+api_keys:
+  virustotal: "abc#123" # quoted hash
+  shodan: 'it''s'
+sources: [crtsh, "wayback", 3]
+exclude:
+- dev.*
+-   staging.*
+concurrency: 20
+timeout: 2.5
+resolve: true
+proxy: ~
+`,
+			want: `{"api_keys":{"shodan":"it's","virustotal":"abc#123"},"concurrency":20,"exclude":["dev.*","staging.*"],"proxy":null,"resolve":true,"sources":["crtsh","wayback",3],"timeout":2.5}`,
+		},
+		{
+			name: "yaml sequence of mappings",
+			path: "config.yml",
+			data: "webhooks:\n  - url: https://example.com/hook\n    events: [new]\n  -\n    url: http://b\n",
+			want: `{"webhooks":[{"events":["new"],"url":"https://example.com/hook"},{"url":"http://b"}]}`,
+		},
+		{
+			name: "yaml empty document",
+			path: "config.yaml",
+			data: "# nothing\n",
+			want: `{}`,
+		},
+		{
+			name: "toml tables and dotted keys",
+			path: "config.toml",
+			data: `concurrency = 1_000
+timeout = 0x10
+resolve = false
+exclude = [
+  "dev.*", # development
+  'staging.*',
+]
+
+[api_keys]
+virustotal = "abc#123"
+"security.trails" = "x"
+censys.id = "id"
+`,
+			want: `{"api_keys":{"censys":{"id":"id"},"security.trails":"x","virustotal":"abc#123"},"concurrency":1000,"exclude":["dev.*","staging.*"],"resolve":false,"timeout":16}`,
+		},
+		{
+			name: "json unchanged",
+			path: "config.json",
+			data: `{"concurrency": 5}`,
+			want: `{"concurrency": 5}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := configToJSON(tt.path, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigToJSONErrors(t *testing.T) {
+	tests := []struct {
+		path, data string
+		want       string // Part of the error
+	}{
+		{"config.yaml", "a: 1\n\tb: 2\n", "line 2: tabs"},
+		{"config.yaml", "a: 1\n   b: 2\n", "line 2: unexpected indentation"},
+		{"config.yaml", "just a scalar\n", "line 1: expected \"key: value\""},
+		{"config.yaml", "- a\n- b\n", "the document must be a mapping"},
+		{"config.yaml", "a: [b, c\n", "unterminated flow sequence"},
+		{"config.yaml", "a: {b: c}\n", "flow mappings are not supported"},
+		{"config.yaml", "a: \"b\n", "unterminated string"},
+		{"config.toml", "[[hosts]]\n", "arrays of tables are not supported"},
+		{"config.toml", "[a\n", "malformed table header"},
+		{"config.toml", "a\n", "expected \"key = value\""},
+		{"config.toml", "a = 1\na = 2\n", "line 2: duplicate key \"a\""},
+		{"config.toml", "a = 1\n[a]\n", "key \"a\" is not a table"},
+		{"config.toml", "a = { b = 1 }\n", "inline tables are not supported"},
+		{"config.toml", "a = yes\n", "invalid value"},
+		{"config.toml", "a..b = 1\n", "empty key"},
+		{"config.toml", "a =\n", "missing value"},
+	}
+	for _, tt := range tests {
+		_, err := configToJSON(tt.path, []byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s %q: error %v, want %q", tt.path, tt.data, err, tt.want)
+		}
+	}
+}
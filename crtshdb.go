@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	crtShDBAddress = "crt.sh:5432"
+	crtShDBUser    = "guest"
+	crtShDBName    = "certwatch"
+	crtShDBTimeout = 2 * time.Minute
+)
+
+// Only plain hostnames are interpolated into the SQL sent to crt.sh
+var sqlSafeDomain = regexp.MustCompile(`^[a-zA-Z0-9.-]+$`)
+
+// Function to query the public crt.sh PostgreSQL instance instead of the
+// HTTP endpoint. With the incremental option, only certificates newer than
+// the last one recorded in the target history are read.
+func fetchFromCrtShDB(ctx context.Context, domain string, opts crtShOptions, out chan<- Result) {
+	if !sqlSafeDomain.MatchString(domain) {
+		fmt.Println("Error querying Crt.sh database: invalid domain", domain)
+		return
+	}
+
+	var lastID int64
+	if opts.Incremental && pastRuns == nil {
+		fmt.Println("Crt.sh incremental queries need -history. Reading every certificate.")
+	}
+	if opts.Incremental && pastRuns != nil {
+		lastID = pastRuns.CrtShCertificateID
+	}
+	query := fmt.Sprintf(`SELECT cai.certificate_id, cai.name_value, x509_notBefore(cai.certificate)
+FROM certificate_and_identities cai
+WHERE plainto_tsquery('certwatch', '%[1]s') @@ identities(cai.certificate)
+  AND cai.name_value ILIKE '%%.%[1]s'
+  AND cai.certificate_id > %[2]d
+ORDER BY cai.certificate_id
+LIMIT %[3]d`, domain, lastID, opts.DBLimit)
+
+	rows, err := queryPostgres(ctx, crtShDBAddress, crtShDBUser, crtShDBName, query)
+	if err != nil {
+		fmt.Println("Error querying Crt.sh database:", err)
+		return
+	}
+
+	maxID := lastID
+	for _, row := range rows {
+		if len(row) < 3 {
+			continue
+		}
+		id, _ := strconv.ParseInt(row[0], 10, 64)
+		if id > maxID {
+			maxID = id
+		}
+		issued, _ := time.Parse("2006-01-02 15:04:05", row[2])
+		out <- Result{Host: row[1], Source: "crtsh"}
+		recordFirstSeen(row[1], issued)
+	}
+
+	if opts.Incremental && pastRuns != nil {
+		mu.Lock()
+		pastRuns.CrtShCertificateID = maxID
+		mu.Unlock()
+	}
+}
+
+// Run a single query using the PostgreSQL simple query protocol and return
+// every row as text. Only trust authentication is supported, which is what
+// the crt.sh guest account uses.
+func queryPostgres(ctx context.Context, address, user, database, query string) ([][]string, error) {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Closing the connection unblocks the reads when the scan is interrupted
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+	conn.SetDeadline(time.Now().Add(crtShDBTimeout))
+	reader := bufio.NewReader(conn)
+
+	// Startup message: protocol 3.0 followed by name/value parameters
+	var startup []byte
+	startup = binary.BigEndian.AppendUint32(startup, 196608)
+	for _, param := range []string{"user", user, "database", database, "application_name", "LeviathanMapper"} {
+		startup = append(startup, param...)
+		startup = append(startup, 0)
+	}
+	startup = append(startup, 0)
+	if _, err := conn.Write(append(binary.BigEndian.AppendUint32(nil, uint32(len(startup)+4)), startup...)); err != nil {
+		return nil, err
+	}
+
+	if err := waitForPostgresReady(reader); err != nil {
+		return nil, err
+	}
+
+	if err := writePostgresMessage(conn, 'Q', append([]byte(query), 0)); err != nil {
+		return nil, err
+	}
+
+	var rows [][]string
+	var queryErr error
+	for {
+		kind, payload, err := readPostgresMessage(reader)
+		if err != nil {
+			return nil, err
+		}
+		switch kind {
+		case 'D':
+			rows = append(rows, parsePostgresRow(payload))
+		case 'E':
+			queryErr = postgresError(payload)
+		case 'Z':
+			writePostgresMessage(conn, 'X', nil)
+			return rows, queryErr
+		}
+	}
+}
+
+// Consume the authentication exchange until the server is ready for queries
+func waitForPostgresReady(reader *bufio.Reader) error {
+	for {
+		kind, payload, err := readPostgresMessage(reader)
+		if err != nil {
+			return err
+		}
+		switch kind {
+		case 'R':
+			if len(payload) < 4 {
+				return errors.New("malformed authentication request")
+			}
+			if method := binary.BigEndian.Uint32(payload); method != 0 {
+				return fmt.Errorf("unsupported authentication method %d", method)
+			}
+		case 'E':
+			return postgresError(payload)
+		case 'Z':
+			return nil
+		}
+	}
+}
+
+// Write a typed protocol message
+func writePostgresMessage(w io.Writer, kind byte, payload []byte) error {
+	message := append([]byte{kind}, binary.BigEndian.AppendUint32(nil, uint32(len(payload)+4))...)
+	_, err := w.Write(append(message, payload...))
+	return err
+}
+
+// Read a typed protocol message
+func readPostgresMessage(reader *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length < 4 {
+		return 0, nil, errors.New("malformed message length")
+	}
+	payload := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+// Decode a DataRow message; NULL columns become empty strings
+func parsePostgresRow(payload []byte) []string {
+	if len(payload) < 2 {
+		return nil
+	}
+	count := int(binary.BigEndian.Uint16(payload))
+	payload = payload[2:]
+	row := make([]string, 0, count)
+	for i := 0; i < count && len(payload) >= 4; i++ {
+		size := int32(binary.BigEndian.Uint32(payload))
+		payload = payload[4:]
+		if size < 0 || int(size) > len(payload) {
+			row = append(row, "")
+			continue
+		}
+		row = append(row, string(payload[:size]))
+		payload = payload[size:]
+	}
+	return row
+}
+
+// Turn an ErrorResponse into an error carrying the server message
+func postgresError(payload []byte) error {
+	// Fields are a type byte followed by a NUL-terminated string
+	for len(payload) > 1 {
+		field := payload[0]
+		end := 1
+		for end < len(payload) && payload[end] != 0 {
+			end++
+		}
+		if field == 'M' {
+			return errors.New(string(payload[1:end]))
+		}
+		if end >= len(payload) {
+			break
+		}
+		payload = payload[end+1:]
+	}
+	return errors.New("unknown database error")
+}
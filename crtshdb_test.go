@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// DataRow payload with the given columns; nil is a NULL column
+func testPostgresRow(columns ...[]byte) []byte {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(len(columns)))
+	for _, column := range columns {
+		if column == nil {
+			payload = binary.BigEndian.AppendUint32(payload, 0xffffffff)
+			continue
+		}
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(column)))
+		payload = append(payload, column...)
+	}
+	return payload
+}
+
+func TestParsePostgresRow(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []string
+	}{
+		{"columns", testPostgresRow([]byte("42"), []byte("www.example.com"), []byte("2024-01-02 03:04:05")), []string{"42", "www.example.com", "2024-01-02 03:04:05"}},
+		{"null and empty", testPostgresRow(nil, []byte(""), []byte("x")), []string{"", "", "x"}},
+		{"no columns", testPostgresRow(), []string{}},
+		{"truncated count", []byte{0}, nil},
+		{"fewer columns than counted", testPostgresRow([]byte("a"), []byte("b"))[:9], []string{"a"}},
+	}
+	for _, tt := range tests {
+		if got := parsePostgresRow(tt.payload); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPostgresError(t *testing.T) {
+	tests := []struct {
+		payload, want string
+	}{
+		{"SERROR\x00C42P01\x00Mrelation \"x\" does not exist\x00\x00", `relation "x" does not exist`},
+		{"Mno terminator", "no terminator"},
+		{"SFATAL\x00C28000\x00\x00", "unknown database error"},
+		{"SFATAL", "unknown database error"},
+		{"", "unknown database error"},
+	}
+	for _, tt := range tests {
+		if err := postgresError([]byte(tt.payload)); err.Error() != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.payload, err, tt.want)
+		}
+	}
+}
+
+func TestReadPostgresMessage(t *testing.T) {
+	var stream bytes.Buffer
+	writePostgresMessage(&stream, 'Q', []byte("SELECT 1\x00"))
+	writePostgresMessage(&stream, 'X', nil)
+	reader := bufio.NewReader(&stream)
+	for _, want := range []struct {
+		kind    byte
+		payload string
+	}{{'Q', "SELECT 1\x00"}, {'X', ""}} {
+		kind, payload, err := readPostgresMessage(reader)
+		if err != nil || kind != want.kind || string(payload) != want.payload {
+			t.Errorf("read %c %q %v, want %c %q", kind, payload, err, want.kind, want.payload)
+		}
+	}
+
+	for name, data := range map[string]string{
+		"short length":      "Z\x00\x00\x00\x03",
+		"truncated header":  "Z\x00\x00",
+		"truncated payload": "D\x00\x00\x00\x10abc",
+	} {
+		if _, _, err := readPostgresMessage(bufio.NewReader(strings.NewReader(data))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Serve one connection as a PostgreSQL server asking for the given
+// authentication method, 0 being trust. A trusted client gets rows as the
+// answer to its query, followed by an ErrorResponse when message is not
+// empty. The startup parameters and the query received are sent back.
+func servePostgres(t *testing.T, auth uint32, rows [][]byte, message string) (string, <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan []string, 1)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var length [4]byte
+		io.ReadFull(reader, length[:])
+		startup := make([]byte, binary.BigEndian.Uint32(length[:])-4)
+		io.ReadFull(reader, startup)
+		params := strings.Split(strings.TrimRight(string(startup[4:]), "\x00"), "\x00")
+
+		writePostgresMessage(conn, 'R', binary.BigEndian.AppendUint32(nil, auth))
+		if auth != 0 {
+			received <- params
+			return
+		}
+		writePostgresMessage(conn, 'S', []byte("server_version\x0016\x00"))
+		writePostgresMessage(conn, 'Z', []byte("I"))
+		_, query, _ := readPostgresMessage(reader)
+		writePostgresMessage(conn, 'T', []byte("\x00\x01id\x00"))
+		for _, row := range rows {
+			writePostgresMessage(conn, 'D', row)
+		}
+		if message != "" {
+			writePostgresMessage(conn, 'E', []byte("SERROR\x00M"+message+"\x00\x00"))
+		}
+		writePostgresMessage(conn, 'C', []byte("SELECT 1\x00"))
+		writePostgresMessage(conn, 'Z', []byte("I"))
+		received <- append(params, strings.TrimSuffix(string(query), "\x00"))
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestQueryPostgres(t *testing.T) {
+	address, received := servePostgres(t, 0, [][]byte{
+		testPostgresRow([]byte("1"), []byte("a.example.com")),
+		testPostgresRow([]byte("2"), nil),
+	}, "")
+	rows, err := queryPostgres(context.Background(), address, "guest", "certwatch", "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{{"1", "a.example.com"}, {"2", ""}}; !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %q, want %q", rows, want)
+	}
+	want := []string{"user", "guest", "database", "certwatch", "application_name", "LeviathanMapper", "SELECT 1"}
+	if got := <-received; !reflect.DeepEqual(got, want) {
+		t.Errorf("server received %q, want %q", got, want)
+	}
+
+	// Rows read before an error are returned with it
+	address, _ = servePostgres(t, 0, [][]byte{testPostgresRow([]byte("1"))}, "canceling statement due to statement timeout")
+	rows, err = queryPostgres(context.Background(), address, "guest", "certwatch", "SELECT 1")
+	if err == nil || err.Error() != "canceling statement due to statement timeout" || len(rows) != 1 {
+		t.Errorf("got %q, %v", rows, err)
+	}
+
+	// Password authentication (cleartext, 3) is refused
+	address, _ = servePostgres(t, 3, nil, "")
+	if _, err := queryPostgres(context.Background(), address, "guest", "certwatch", "SELECT 1"); err == nil || err.Error() != "unsupported authentication method 3" {
+		t.Errorf("error %v, want the unsupported method", err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// Response codes that leave a CNAME dangling, by name
+var danglingRcodes = map[int]string{dnsRcodeNXDomain: "NXDOMAIN", dnsRcodeServFail: "SERVFAIL"}
+
+// Look for a CNAME of host left pointing at a name that does not resolve,
+// returning the chain and the response code of its target. When resolution
+// saw no chain, usually because the resolver failed on the broken target,
+// the CNAME record of the host is asked for directly.
+func findDanglingCNAME(host string, chain []string) ([]string, string) {
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		server := pickResolver()
+		cnames := chain
+		if len(cnames) == 0 {
+			msg, err := queryDNS(server, host, dnsTypeCNAME)
+			if err != nil {
+				continue
+			}
+			if cnames, _ = followCNAMEs(host, msg.Answers); len(cnames) == 0 {
+				return nil, ""
+			}
+		}
+		msg, err := queryDNS(server, cnames[len(cnames)-1], dnsTypeA)
+		if err != nil {
+			continue
+		}
+		return cnames, danglingRcodes[msg.Rcode]
+	}
+	return nil, ""
+}
+
+// Check the hosts that resolved to no address for dangling CNAMEs. It
+// returns the chain and response code of each dangling one.
+func findDanglingCNAMEs(ctx context.Context, hosts []string, resolved map[string]resolution) map[string]resolution {
+	var unresolved []string
+	for _, host := range hosts {
+		if len(resolved[host].Addresses) == 0 {
+			unresolved = append(unresolved, host)
+		}
+	}
+	checked := resolveWith(ctx, unresolved, func(host string) resolution {
+		chain, rcode := findDanglingCNAME(host, resolved[host].CNAMEs)
+		return resolution{CNAMEs: chain, Dangling: rcode}
+	})
+
+	dangling := make(map[string]resolution)
+	for _, host := range unresolved {
+		if answer := checked[host]; answer.Dangling != "" {
+			dangling[host] = answer
+			fmt.Printf("Dangling CNAME: %s -> %s (%s)\n", host, answer.CNAMEs[len(answer.CNAMEs)-1], answer.Dangling)
+		}
+	}
+	return dangling
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Changes of a target over a -report-period, written by -report-dir
+type digestReport struct {
+	Domain string
+	Since  time.Time // Previous report, zero for the first one
+	Until  time.Time
+	Total  int      // Hosts found by the last complete run
+	New    []string // Hosts first seen in the period
+	Gone   []string // Hosts seen in the period but missing from the last run
+}
+
+var (
+	reportDir    string        // Set by -report-dir
+	reportPeriod time.Duration // Time between reports, set by -report-period
+)
+
+// Layouts of the reports, one per file extension
+const (
+	markdownReportTemplate = `# LeviathanMapper digest: {{.Domain}}
+
+{{if .Since.IsZero}}Up to{{else}}From {{.Since.Format "2006-01-02 15:04"}} to{{end}} {{.Until.Format "2006-01-02 15:04"}}: {{len .New}} new, {{len .Gone}} gone, {{.Total}} found by the last run.
+
+## New hosts ({{len .New}})
+{{range .New}}
+- ` + "`{{.}}`" + `{{else}}
+None.{{end}}
+
+## Gone hosts ({{len .Gone}})
+{{range .Gone}}
+- ` + "`{{.}}`" + `{{else}}
+None.{{end}}
+`
+	htmlReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>LeviathanMapper digest: {{.Domain}}</title>
+<style>body{font-family:sans-serif;max-width:60em;margin:2em auto}code{background:#f2f2f2;padding:0 .2em}</style>
+</head>
+<body>
+<h1>LeviathanMapper digest: {{.Domain}}</h1>
+<p>{{if .Since.IsZero}}Up to{{else}}From {{.Since.Format "2006-01-02 15:04"}} to{{end}} {{.Until.Format "2006-01-02 15:04"}}: {{len .New}} new, {{len .Gone}} gone, {{.Total}} found by the last run.</p>
+<h2>New hosts ({{len .New}})</h2>
+{{with .New}}<ul>{{range .}}
+<li><code>{{.}}</code></li>{{end}}
+</ul>{{else}}<p>None.</p>{{end}}
+<h2>Gone hosts ({{len .Gone}})</h2>
+{{with .Gone}}<ul>{{range .}}
+<li><code>{{.}}</code></li>{{end}}
+</ul>{{else}}<p>None.</p>{{end}}
+</body>
+</html>
+`
+)
+
+var (
+	markdownReport = template.Must(template.New("markdown").Parse(markdownReportTemplate))
+	htmlReport     = htmltemplate.Must(htmltemplate.New("html").Parse(htmlReportTemplate))
+)
+
+// Hosts seen since a time that the last complete run did not report
+func (h *history) goneSince(since time.Time) []string {
+	last := h.lastRunHosts()
+	var hosts []string
+	for host, entry := range h.Hosts {
+		if !last[host] && entry.LastSeen.After(since) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Write the Markdown and HTML digest of a target once the -report-period
+// has passed since the previous one, recording when it was written. The
+// files are named after the target and the day, e.g. example.com-2026-01-05.md.
+func writeReportIfDue(h *history, now time.Time) {
+	if reportDir == "" || now.Sub(h.ReportSent) < reportPeriod {
+		return
+	}
+	report := digestReport{
+		Domain: h.Domain,
+		Since:  h.ReportSent,
+		Until:  now,
+		Total:  len(h.LastRun),
+		New:    h.seenSince(h.ReportSent),
+		Gone:   h.goneSince(h.ReportSent),
+	}
+	if err := os.MkdirAll(reportDir, 0o755); err != nil {
+		fmt.Println("Error writing digest report:", err)
+		return
+	}
+	base := filepath.Join(reportDir, h.Domain+"-"+now.Format("2006-01-02"))
+	var markdown, html strings.Builder
+	if err := markdownReport.Execute(&markdown, report); err != nil {
+		fmt.Println("Error writing digest report:", err)
+		return
+	}
+	if err := htmlReport.Execute(&html, report); err != nil {
+		fmt.Println("Error writing digest report:", err)
+		return
+	}
+	for path, content := range map[string]string{base + ".md": markdown.String(), base + ".html": html.String()} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			fmt.Println("Error writing digest report:", err)
+			return
+		}
+	}
+	fmt.Printf("Digest report of %s written to %s.md and %s.html\n", h.Domain, base, base)
+	h.ReportSent = now
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReportIfDue(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 6, 0, 0, 0, time.UTC) }
+	h := &history{
+		Domain: "example.com",
+		Hosts: map[string]historyEntry{
+			"www.example.com":        {FirstSeen: day(1), LastSeen: day(9)},
+			"<b>new</b>.example.com": {FirstSeen: day(8), LastSeen: day(9)},
+			"old.example.com":        {FirstSeen: day(1), LastSeen: day(7)},
+			"long-gone.example.com":  {FirstSeen: day(1), LastSeen: day(1)},
+		},
+		LastRun:    []string{"www.example.com", "<b>new</b>.example.com"},
+		ReportSent: day(2),
+	}
+	reportDir, reportPeriod = t.TempDir(), 7*24*time.Hour
+	defer func() { reportDir = "" }()
+
+	writeReportIfDue(h, day(8))
+	if !h.ReportSent.Equal(day(2)) {
+		t.Fatal("report written before the period passed")
+	}
+	writeReportIfDue(h, day(9))
+	if !h.ReportSent.Equal(day(9)) {
+		t.Fatal("report not recorded")
+	}
+
+	base := filepath.Join(reportDir, "example.com-2026-01-09")
+	markdown, err := os.ReadFile(base + ".md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"From 2026-01-02 06:00 to 2026-01-09 06:00: 1 new, 1 gone, 2 found", "- `<b>new</b>.example.com`", "- `old.example.com`"} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("Markdown report lacks %q:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(string(markdown), "long-gone") || strings.Contains(string(markdown), "- `www") {
+		t.Errorf("Markdown report lists hosts unchanged in the period:\n%s", markdown)
+	}
+	html, err := os.ReadFile(base + ".html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "<code>&lt;b&gt;new&lt;/b&gt;.example.com</code>") {
+		t.Errorf("HTML report does not escape host names:\n%s", html)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// Redis list the coordinators push tasks to and every worker pops from
+const taskQueueKey = "leviathanmapper:tasks"
+
+// Time the replies of a run are kept, so those of an abandoned coordinator
+// do not pile up
+const replyTTL = 24 * time.Hour
+
+// Wait of each blocking pop, after which an interruption is noticed
+const popWait = 2 * time.Second
+
+// Unit of work of the distributed mode: the enumeration of a domain with
+// the sources of the worker, one chunk of the brute force, or the live
+// services a worker fetches to compare its vantage point with the others
+type distributedTask struct {
+	Run    string   `json:"run"`
+	ID     int      `json:"id"`
+	Domain string   `json:"domain,omitempty"`
+	Words  []string `json:"words,omitempty"` // Brute-force chunk, empty for the enumeration
+	URLs   []string `json:"urls,omitempty"`  // Services of a reachability task
+}
+
+// Answer of a worker to a task
+type taskReply struct {
+	ID           int                      `json:"id"`
+	Worker       string                   `json:"worker"`
+	Results      []datedResult            `json:"results"`
+	Reachability map[string]vantageResult `json:"reachability,omitempty"` // Answer to each URL of a reachability task
+	Error        string                   `json:"error,omitempty"`
+}
+
+// Redis list receiving the replies of a run
+func replyKey(run string) string {
+	return "leviathanmapper:replies:" + run
+}
+
+// Queue one enumeration task per target and the wordlist in chunks of
+// chunkSize words per target, then gather the replies of the workers and
+// print the deduplicated results of each target. An interruption withdraws
+// the tasks no worker has taken and prints what arrived.
+func runCoordinator(ctx context.Context, redisURL string, targets []string, wordlist string, chunkSize int, format *template.Template) error {
+	conn, err := dialRedis(ctx, redisURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var words []string
+	if wordlist != "" {
+		file, err := os.Open(wordlist)
+		if err != nil {
+			return err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if word, ok := wordlistWord(scanner.Text()); ok {
+				words = append(words, word)
+			}
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	run := hex.EncodeToString(id)
+	var tasks []distributedTask
+	for _, domain := range targets {
+		tasks = append(tasks, distributedTask{Run: run, ID: len(tasks), Domain: domain})
+		for start := 0; start < len(words); start += chunkSize {
+			chunk := words[start:min(start+chunkSize, len(words))]
+			tasks = append(tasks, distributedTask{Run: run, ID: len(tasks), Domain: domain, Words: chunk})
+		}
+	}
+	payloads := make(map[int]string, len(tasks))
+	for _, task := range tasks {
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		payloads[task.ID] = string(data)
+		if _, err := conn.do("LPUSH", taskQueueKey, string(data)); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Queued %d tasks for %d targets (run %s)\n", len(tasks), len(targets), run)
+
+	// Results of each target, in arrival order, and their index by dedup
+	// key. Those of the enumeration win over bare brute-force hits, as they
+	// carry the later stages.
+	results := make(map[string][]datedResult, len(targets))
+	index := make(map[string]map[string]int, len(targets))
+	var workers []string
+	seenWorkers := make(map[string]bool)
+	for _, domain := range targets {
+		index[domain] = make(map[string]int)
+	}
+	for done := 0; done < len(tasks) && ctx.Err() == nil; {
+		value, ok, err := conn.brpop(popWait, replyKey(run))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var reply taskReply
+		if err := json.Unmarshal([]byte(value), &reply); err != nil || reply.ID < 0 || reply.ID >= len(tasks) || payloads[reply.ID] == "" {
+			fmt.Println("Ignoring malformed reply")
+			continue
+		}
+		task := tasks[reply.ID]
+		delete(payloads, reply.ID)
+		done++
+		if !seenWorkers[reply.Worker] {
+			seenWorkers[reply.Worker] = true
+			workers = append(workers, reply.Worker)
+		}
+		if reply.Error != "" {
+			fmt.Printf("Task %d (%s) failed on %s: %s\n", task.ID, task.Domain, reply.Worker, reply.Error)
+		}
+		for _, r := range reply.Results {
+			i, exists := index[task.Domain][r.key()]
+			switch {
+			case !exists:
+				index[task.Domain][r.key()] = len(results[task.Domain])
+				results[task.Domain] = append(results[task.Domain], r)
+			case len(task.Words) == 0:
+				results[task.Domain][i] = r
+			}
+		}
+		fmt.Printf("%s finished task %d of %d (%d results)\n", reply.Worker, done, len(tasks), len(reply.Results))
+	}
+
+	complete := ctx.Err() == nil
+	if !complete {
+		withdrawn := 0
+		for _, payload := range payloads {
+			if removed, _ := conn.do("LREM", taskQueueKey, "1", payload); removed == int64(1) {
+				withdrawn++
+			}
+		}
+		fmt.Printf("Withdrew %d queued tasks, %d still running on workers\n", withdrawn, len(payloads)-withdrawn)
+	}
+	if compareWorkers && complete {
+		if err := compareWorkerVantages(ctx, conn, run, len(tasks), workers, results); err != nil {
+			return err
+		}
+	}
+	conn.do("DEL", replyKey(run))
+
+	for _, domain := range targets {
+		fmt.Println("\nResults for", domain)
+		printReport(results[domain], format, complete)
+	}
+	return nil
+}
+
+// Pop tasks and answer them until interrupted, the ones meant for this
+// worker first. The enumeration runs the sources and stages selected on the
+// worker command line; an interrupted task goes back to the queue for
+// another worker.
+func runWorker(ctx context.Context, redisURL string, sources []Source, session *Session, historyDir string, internetDB bool) error {
+	conn, err := dialRedis(ctx, redisURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	hostname, _ := os.Hostname()
+	name := hostname + "/" + strconv.Itoa(os.Getpid())
+	fmt.Println("Worker", name, "waiting for tasks")
+
+	for ctx.Err() == nil {
+		value, ok, err := conn.brpop(popWait, workerQueueKey(name), taskQueueKey)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var task distributedTask
+		if err := json.Unmarshal([]byte(value), &task); err != nil || task.Run == "" {
+			fmt.Println("Ignoring malformed task")
+			continue
+		}
+
+		reply := taskReply{ID: task.ID, Worker: name}
+		if len(task.URLs) > 0 {
+			fmt.Printf("Fetching %d live services for the reachability comparison\n", len(task.URLs))
+			reply.Reachability = fetchWorkerVantage(ctx, name, task.URLs)
+		} else if len(task.Words) > 0 {
+			fmt.Printf("Brute forcing %d words under %s\n", len(task.Words), task.Domain)
+			reply.Results = bruteForceChunk(ctx, task.Domain, task.Words)
+		} else {
+			fmt.Println("Enumerating", task.Domain)
+			if reply.Results, err = enumerateTarget(ctx, task.Domain, sources, session, historyDir, internetDB); err != nil {
+				reply.Error = err.Error()
+			}
+		}
+		if ctx.Err() != nil {
+			// Back at the tail, so it is the next task popped
+			if _, err := conn.do("RPUSH", taskQueueKey, value); err != nil {
+				return err
+			}
+			fmt.Println("Interrupted: returned the task to the queue")
+			return nil
+		}
+
+		data, err := json.Marshal(reply)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.do("LPUSH", replyKey(task.Run), string(data)); err != nil {
+			return err
+		}
+		conn.do("EXPIRE", replyKey(task.Run), strconv.Itoa(int(replyTTL/time.Second)))
+	}
+	return nil
+}
+
+// Resolve one chunk of the brute force under a domain, leaving out
+// wildcard answers. The chunk waits out the worker's -quiet-hours first.
+func bruteForceChunk(ctx context.Context, domain string, words []string) []datedResult {
+	if !waitQuietHours(ctx, "the brute force chunk") {
+		return nil
+	}
+	wildcards := detectWildcards(ctx, domain, nil)
+	var results []datedResult
+	for start := 0; start < len(words) && ctx.Err() == nil; start += bruteForceBatch {
+		var candidates []string
+		for _, word := range words[start:min(start+bruteForceBatch, len(words))] {
+			candidates = append(candidates, word+"."+domain)
+		}
+		addLiveCandidates(ctx, "bruteforce", withCanaryMarker(domain, candidates), wildcards, func(r Result) {
+			results = append(results, datedResult{Result: r, InScope: inEngagementScope(r.Host)})
+		})
+	}
+	return results
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS record types used by the resolution stages
+const (
+	dnsTypeA     uint16 = 1
+	dnsTypeNS    uint16 = 2
+	dnsTypeCNAME uint16 = 5
+	dnsTypeSOA   uint16 = 6
+	dnsTypePTR   uint16 = 12
+	dnsTypeMX    uint16 = 15
+	dnsTypeTXT   uint16 = 16
+	dnsTypeAAAA  uint16 = 28
+	dnsTypeSRV   uint16 = 33
+	dnsTypeOPT   uint16 = 41
+	dnsTypeRRSIG uint16 = 46
+	dnsTypeNSEC  uint16 = 47
+	dnsTypeNSEC3 uint16 = 50
+	dnsTypeAXFR  uint16 = 252
+	dnsTypeCAA   uint16 = 257
+)
+
+// Response codes
+const (
+	dnsRcodeSuccess  = 0
+	dnsRcodeServFail = 2
+	dnsRcodeNXDomain = 3
+	dnsRcodeRefused  = 5
+)
+
+// Names of the record types, as written in zone files
+var dnsTypeNames = map[uint16]string{
+	dnsTypeA: "A", dnsTypeNS: "NS", dnsTypeCNAME: "CNAME", dnsTypeSOA: "SOA", dnsTypePTR: "PTR",
+	dnsTypeMX: "MX", dnsTypeTXT: "TXT", dnsTypeAAAA: "AAAA", dnsTypeSRV: "SRV", dnsTypeNSEC: "NSEC",
+	dnsTypeCAA: "CAA", dnsTypeNSEC3: "NSEC3", 43: "DS", dnsTypeRRSIG: "RRSIG", 48: "DNSKEY", 51: "NSEC3PARAM",
+}
+
+// Name of a record type, or TYPEnnn for unknown ones
+func dnsTypeName(t uint16) string {
+	if name, ok := dnsTypeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// A resource record; Data holds the record in zone file presentation form
+type dnsRecord struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	Data string
+}
+
+// A parsed DNS message
+type dnsMessage struct {
+	ID         uint16
+	Rcode      int
+	Truncated  bool
+	Authentic  bool // AD bit: the resolver validated the answer with DNSSEC
+	Answers    []dnsRecord
+	Authority  []dnsRecord
+	Additional []dnsRecord
+}
+
+// How a query asks for DNSSEC data
+type dnssecMode int
+
+const (
+	dnssecOff       dnssecMode = iota
+	dnssecRecords              // DO bit: the answer carries the DNSSEC records
+	dnssecUnchecked            // DO and CD bits: the resolver skips validation too
+)
+
+// Build a recursive query for one name and type. An EDNS0 OPT record
+// advertises a larger UDP payload so most answers avoid truncation, and
+// carries the DO bit asking for the DNSSEC records of the answer when mode
+// is not dnssecOff.
+func buildDNSQuery(id uint16, name string, qtype uint16, mode dnssecMode) []byte {
+	msg := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	if mode == dnssecUnchecked {
+		binary.BigEndian.PutUint16(msg[2:], 0x0110) // RD, CD
+	} else {
+		binary.BigEndian.PutUint16(msg[2:], 0x0100) // RD
+	}
+	binary.BigEndian.PutUint16(msg[4:], 1)  // QDCOUNT
+	binary.BigEndian.PutUint16(msg[10:], 1) // ARCOUNT
+	msg = appendDNSName(msg, name)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	msg = binary.BigEndian.AppendUint16(msg, 1) // IN
+
+	// OPT: root name, type, UDP size, extended rcode/flags, no options
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, dnsTypeOPT)
+	msg = binary.BigEndian.AppendUint16(msg, 1232)
+	if mode != dnssecOff {
+		msg = binary.BigEndian.AppendUint32(msg, 0x8000) // DO
+	} else {
+		msg = binary.BigEndian.AppendUint32(msg, 0)
+	}
+	msg = binary.BigEndian.AppendUint16(msg, 0)
+	return msg
+}
+
+// Append a name in uncompressed wire format
+func appendDNSName(msg []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	return append(msg, 0)
+}
+
+// Parse a DNS message
+func parseDNSMessage(msg []byte) (*dnsMessage, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("short DNS message")
+	}
+	flags := binary.BigEndian.Uint16(msg[2:])
+	parsed := &dnsMessage{
+		ID:        binary.BigEndian.Uint16(msg[0:]),
+		Rcode:     int(flags & 0x000f),
+		Truncated: flags&0x0200 != 0,
+		Authentic: flags&0x0020 != 0,
+	}
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(msg[4+2*i:]))
+	}
+
+	offset := 12
+	for i := 0; i < counts[0]; i++ {
+		_, next, err := readDNSName(msg, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+	sections := []*[]dnsRecord{&parsed.Answers, &parsed.Authority, &parsed.Additional}
+	for s, section := range sections {
+		for i := 0; i < counts[s+1]; i++ {
+			record, next, err := readDNSRecord(msg, offset)
+			if err != nil {
+				return nil, err
+			}
+			offset = next
+			if record.Type != dnsTypeOPT {
+				*section = append(*section, record)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// Read a possibly compressed name starting at offset, returning it and the
+// offset right after it
+func readDNSName(msg []byte, offset int) (string, int, error) {
+	var labels []string
+	end := -1
+	for jumps := 0; ; {
+		if offset >= len(msg) {
+			return "", 0, errors.New("name outside DNS message")
+		}
+		length := int(msg[offset])
+		switch {
+		case length == 0:
+			if end < 0 {
+				end = offset + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")), end, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(msg) {
+				return "", 0, errors.New("truncated name pointer")
+			}
+			if jumps++; jumps > 64 {
+				return "", 0, errors.New("name compression loop")
+			}
+			if end < 0 {
+				end = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(msg[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(msg) {
+				return "", 0, errors.New("label outside DNS message")
+			}
+			labels = append(labels, string(msg[offset+1:offset+1+length]))
+			offset += 1 + length
+		}
+	}
+}
+
+// Read one resource record
+func readDNSRecord(msg []byte, offset int) (dnsRecord, int, error) {
+	name, offset, err := readDNSName(msg, offset)
+	if err != nil {
+		return dnsRecord{}, 0, err
+	}
+	if offset+10 > len(msg) {
+		return dnsRecord{}, 0, errors.New("truncated resource record")
+	}
+	record := dnsRecord{
+		Name: name,
+		Type: binary.BigEndian.Uint16(msg[offset:]),
+		TTL:  binary.BigEndian.Uint32(msg[offset+4:]),
+	}
+	length := int(binary.BigEndian.Uint16(msg[offset+8:]))
+	start := offset + 10
+	if start+length > len(msg) {
+		return dnsRecord{}, 0, errors.New("truncated record data")
+	}
+	record.Data, err = formatDNSData(msg, start, length, record.Type)
+	if err != nil {
+		return dnsRecord{}, 0, err
+	}
+	return record, start + length, nil
+}
+
+// Render record data in presentation form. Types without a dedicated
+// format are written as hex.
+func formatDNSData(msg []byte, start, length int, rtype uint16) (string, error) {
+	data := msg[start : start+length]
+	name := func(offset int) (string, int, error) { return readDNSName(msg, offset) }
+
+	switch rtype {
+	case dnsTypeA, dnsTypeAAAA:
+		if len(data) != net.IPv4len && len(data) != net.IPv6len {
+			return "", errors.New("malformed address record")
+		}
+		return net.IP(data).String(), nil
+	case dnsTypeNS, dnsTypeCNAME, dnsTypePTR:
+		target, _, err := name(start)
+		return target, err
+	case dnsTypeMX:
+		if len(data) < 3 {
+			return "", errors.New("malformed MX record")
+		}
+		exchange, _, err := name(start + 2)
+		return fmt.Sprintf("%d %s", binary.BigEndian.Uint16(data), exchange), err
+	case dnsTypeSRV:
+		if len(data) < 7 {
+			return "", errors.New("malformed SRV record")
+		}
+		target, _, err := name(start + 6)
+		return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(data), binary.BigEndian.Uint16(data[2:]),
+			binary.BigEndian.Uint16(data[4:]), target), err
+	case dnsTypeSOA:
+		mname, next, err := name(start)
+		if err != nil {
+			return "", err
+		}
+		rname, next, err := name(next)
+		if err != nil || next+20 > start+length {
+			return "", errors.New("malformed SOA record")
+		}
+		fields := msg[next:]
+		return fmt.Sprintf("%s %s %d %d %d %d %d", mname, rname,
+			binary.BigEndian.Uint32(fields), binary.BigEndian.Uint32(fields[4:]), binary.BigEndian.Uint32(fields[8:]),
+			binary.BigEndian.Uint32(fields[12:]), binary.BigEndian.Uint32(fields[16:])), nil
+	case dnsTypeTXT:
+		var parts []string
+		for i := 0; i < len(data); {
+			size := int(data[i])
+			if i+1+size > len(data) {
+				return "", errors.New("malformed TXT record")
+			}
+			parts = append(parts, string(data[i+1:i+1+size]))
+			i += 1 + size
+		}
+		return strings.Join(parts, ""), nil
+	case dnsTypeCAA:
+		if len(data) < 2 || 2+int(data[1]) > len(data) {
+			return "", errors.New("malformed CAA record")
+		}
+		tagEnd := 2 + int(data[1])
+		return fmt.Sprintf("%d %s %q", data[0], data[2:tagEnd], data[tagEnd:]), nil
+	case dnsTypeNSEC:
+		// The next name is never compressed
+		next, offset, err := name(start)
+		if err != nil {
+			return "", err
+		}
+		types := append([]string{next}, nsecTypes(msg[offset:start+length])...)
+		return strings.Join(types, " "), nil
+	case dnsTypeNSEC3:
+		// Algorithm, flags, iterations, salt, next hashed owner, types
+		if len(data) < 5 || 5+int(data[4]) >= len(data) {
+			return "", errors.New("malformed NSEC3 record")
+		}
+		saltEnd := 5 + int(data[4])
+		hashEnd := saltEnd + 1 + int(data[saltEnd])
+		if hashEnd > len(data) {
+			return "", errors.New("malformed NSEC3 record")
+		}
+		salt := hex.EncodeToString(data[5:saltEnd])
+		if salt == "" {
+			salt = "-"
+		}
+		next := strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(data[saltEnd+1 : hashEnd]))
+		fields := append([]string{strconv.Itoa(int(data[0])), strconv.Itoa(int(data[1])),
+			strconv.Itoa(int(binary.BigEndian.Uint16(data[2:]))), salt, next}, nsecTypes(data[hashEnd:])...)
+		return strings.Join(fields, " "), nil
+	}
+	return hex.EncodeToString(data), nil
+}
+
+// Decode the type bitmap of an NSEC record
+func nsecTypes(bitmap []byte) []string {
+	var types []string
+	for len(bitmap) >= 2 {
+		window, size := int(bitmap[0]), int(bitmap[1])
+		if 2+size > len(bitmap) {
+			break
+		}
+		for i, octet := range bitmap[2 : 2+size] {
+			for bit := 0; bit < 8; bit++ {
+				if octet&(0x80>>bit) != 0 {
+					types = append(types, dnsTypeName(uint16(window*256+i*8+bit)))
+				}
+			}
+		}
+		bitmap = bitmap[2+size:]
+	}
+	return types
+}
+
+// Send a query to a DNS server over UDP, retrying over TCP when the answer
+// is truncated. DNS-over-HTTPS and DNS-over-TLS resolvers are queried over
+// their own transport instead.
+func queryDNS(server, name string, qtype uint16) (*dnsMessage, error) {
+	return exchangeDNS(server, name, qtype, dnssecOff)
+}
+
+// Send a query with the DO bit set, so the answer carries NSEC, NSEC3 and
+// signature records
+func queryDNSSEC(server, name string, qtype uint16) (*dnsMessage, error) {
+	return exchangeDNS(server, name, qtype, dnssecRecords)
+}
+
+// Send a query with the DO and CD bits set, so the resolver returns the
+// answer and its signatures even when they fail validation
+func queryDNSSECUnchecked(server, name string, qtype uint16) (*dnsMessage, error) {
+	return exchangeDNS(server, name, qtype, dnssecUnchecked)
+}
+
+// Send one query over the transport of the server
+func exchangeDNS(server, name string, qtype uint16, mode dnssecMode) (*dnsMessage, error) {
+	waitForResolver(server)
+	if isDoHResolver(server) {
+		// RFC 8484 asks for ID 0 so answers stay cacheable
+		return queryDoH(server, buildDNSQuery(0, name, qtype, mode))
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := buildDNSQuery(id, name, qtype, mode)
+	if isDoTResolver(server) {
+		return queryDoT(server, query)
+	}
+
+	conn, err := net.DialTimeout("udp", server, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that do not answer this query
+		if n < 2 || binary.BigEndian.Uint16(buf) != id {
+			continue
+		}
+		msg, err := parseDNSMessage(buf[:n])
+		if err != nil {
+			return nil, err
+		}
+		if msg.Truncated {
+			return queryDNSTCP(server, query)
+		}
+		return msg, nil
+	}
+}
+
+// Send a query over TCP and read its single answer
+func queryDNSTCP(server string, query []byte) (*dnsMessage, error) {
+	conn, err := net.DialTimeout("tcp", server, requestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return exchangeDNSStream(conn, query)
+}
+
+// Send a query over an established stream connection, closing it once the
+// answer is read
+func exchangeDNSStream(conn net.Conn, query []byte) (*dnsMessage, error) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	if err := writeDNSStream(conn, query); err != nil {
+		return nil, err
+	}
+	answer, err := readDNSStream(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSMessage(answer)
+}
+
+// Write a message with the two-byte length prefix used over streams
+func writeDNSStream(w io.Writer, msg []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return err
+}
+
+// Read a length-prefixed message from a stream
+func readDNSStream(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	_, err := io.ReadFull(r, msg)
+	return msg, err
+}
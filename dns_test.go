@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Pointer to the name of the question of testResponse
+var questionName = []byte{0xc0, 12}
+
+// A resource record with a TTL of 300
+func testRecord(name []byte, rtype uint16, data []byte) []byte {
+	record := append([]byte{}, name...)
+	record = binary.BigEndian.AppendUint16(record, rtype)
+	record = binary.BigEndian.AppendUint16(record, 1)
+	record = binary.BigEndian.AppendUint32(record, 300)
+	record = binary.BigEndian.AppendUint16(record, uint16(len(data)))
+	return append(record, data...)
+}
+
+// A response with the given flags to a question for www.example.com,
+// holding the records as answers
+func testResponse(flags uint16, answers ...[]byte) []byte {
+	msg := binary.BigEndian.AppendUint16(nil, 0x1234)
+	msg = binary.BigEndian.AppendUint16(msg, flags)
+	msg = binary.BigEndian.AppendUint16(msg, 1)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(answers)))
+	msg = append(msg, 0, 0, 0, 0)
+	msg = appendDNSName(msg, "www.example.com")
+	msg = append(msg, 0, 1, 0, 1)
+	for _, answer := range answers {
+		msg = append(msg, answer...)
+	}
+	return msg
+}
+
+func TestParseDNSMessage(t *testing.T) {
+	txt := []byte("\x05hello\x06 world")
+	caa := append([]byte{0, 5}, "issueletsencrypt.org"...)
+	soa := append(appendDNSName(nil, "ns1.example.com"), questionName...)
+	soa = append(soa, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 0, 0, 5)
+	mx := append([]byte{0, 10}, questionName...)
+	srv := append([]byte{0, 1, 0, 2, 0x01, 0xbb}, questionName...)
+	// Next name, then a bitmap of window 0 with A (1), MX (15) and AAAA (28)
+	nsec := append(appendDNSName(nil, "z.example.com"), 0, 4, 0x40, 0x01, 0x00, 0x08)
+	// SHA-1, no flags, 10 iterations, salt ab, hash of 5 bytes, A and RRSIG
+	nsec3 := []byte{1, 0, 0, 10, 1, 0xab, 5, 0, 0, 0, 0, 0, 0, 6, 0x40, 0, 0, 0, 0, 0x02}
+
+	tests := []struct {
+		name   string
+		record []byte
+		want   dnsRecord
+	}{
+		{"A", testRecord(questionName, dnsTypeA, []byte{192, 0, 2, 1}), dnsRecord{"www.example.com", dnsTypeA, 300, "192.0.2.1"}},
+		{"AAAA", testRecord(questionName, dnsTypeAAAA, []byte{0x20, 1, 0xd, 0xb8, 15: 1}), dnsRecord{"www.example.com", dnsTypeAAAA, 300, "2001:db8::1"}},
+		{"CNAME", testRecord(questionName, dnsTypeCNAME, append([]byte{3, 'c', 'd', 'n'}, questionName...)), dnsRecord{"www.example.com", dnsTypeCNAME, 300, "cdn.www.example.com"}},
+		{"uppercase owner", testRecord(appendDNSName(nil, "WWW.Example.COM"), dnsTypeA, []byte{192, 0, 2, 1}), dnsRecord{"www.example.com", dnsTypeA, 300, "192.0.2.1"}},
+		{"MX", testRecord(questionName, dnsTypeMX, mx), dnsRecord{"www.example.com", dnsTypeMX, 300, "10 www.example.com"}},
+		{"SRV", testRecord(questionName, dnsTypeSRV, srv), dnsRecord{"www.example.com", dnsTypeSRV, 300, "1 2 443 www.example.com"}},
+		{"SOA", testRecord(questionName, dnsTypeSOA, soa), dnsRecord{"www.example.com", dnsTypeSOA, 300, "ns1.example.com www.example.com 1 2 3 4 5"}},
+		{"TXT", testRecord(questionName, dnsTypeTXT, txt), dnsRecord{"www.example.com", dnsTypeTXT, 300, "hello world"}},
+		{"CAA", testRecord(questionName, dnsTypeCAA, caa), dnsRecord{"www.example.com", dnsTypeCAA, 300, `0 issue "letsencrypt.org"`}},
+		{"NSEC", testRecord(questionName, dnsTypeNSEC, nsec), dnsRecord{"www.example.com", dnsTypeNSEC, 300, "z.example.com A MX AAAA"}},
+		{"NSEC3", testRecord(questionName, dnsTypeNSEC3, nsec3), dnsRecord{"www.example.com", dnsTypeNSEC3, 300, "1 0 10 ab 00000000 A RRSIG"}},
+		{"unknown type", testRecord(questionName, 99, []byte{0xca, 0xfe}), dnsRecord{"www.example.com", 99, 300, "cafe"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := parseDNSMessage(testResponse(0x8180, tt.record))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []dnsRecord{tt.want}; !reflect.DeepEqual(msg.Answers, want) {
+				t.Errorf("answers %+v, want %+v", msg.Answers, want)
+			}
+		})
+	}
+}
+
+func TestParseDNSMessageHeader(t *testing.T) {
+	// NXDOMAIN with the TC and AD bits set
+	msg, err := parseDNSMessage(testResponse(0x82a3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 0x1234 || msg.Rcode != dnsRcodeNXDomain || !msg.Truncated || !msg.Authentic || len(msg.Answers) != 0 {
+		t.Errorf("got %+v", msg)
+	}
+
+	// The query carries an OPT record, which is not reported
+	query, err := parseDNSMessage(buildDNSQuery(7, "www.example.com.", dnsTypeAAAA, dnssecRecords))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.ID != 7 || len(query.Additional) != 0 {
+		t.Errorf("got %+v", query)
+	}
+}
+
+func TestParseDNSMessageErrors(t *testing.T) {
+	loop := testResponse(0x8180)
+	loop = append(loop, 0xc0, byte(len(loop))) // A name pointing to itself
+	binary.BigEndian.PutUint16(loop[6:], 1)
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want string
+	}{
+		{"short header", []byte{0x12, 0x34, 0x81}, "short DNS message"},
+		{"question outside", testResponse(0x8180)[:14], "label outside DNS message"},
+		{"compression loop", loop, "name compression loop"},
+		{"truncated record", testResponse(0x8180, testRecord(questionName, dnsTypeA, []byte{192, 0, 2, 1})[:6]), "truncated resource record"},
+		{"truncated data", testResponse(0x8180, testRecord(questionName, dnsTypeA, []byte{192, 0, 2, 1})[:13]), "truncated record data"},
+		{"bad address", testResponse(0x8180, testRecord(questionName, dnsTypeA, []byte{192, 0, 2})), "malformed address record"},
+		{"bad TXT", testResponse(0x8180, testRecord(questionName, dnsTypeTXT, []byte("\x09short"))), "malformed TXT record"},
+		{"bad MX", testResponse(0x8180, testRecord(questionName, dnsTypeMX, []byte{0, 10})), "malformed MX record"},
+		{"pointer outside", testResponse(0x8180, testRecord([]byte{0xc0, 0xff}, dnsTypeA, []byte{192, 0, 2, 1})), "name outside DNS message"},
+	}
+	for _, tt := range tests {
+		if _, err := parseDNSMessage(tt.msg); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestDNSStream(t *testing.T) {
+	query := buildDNSQuery(1, "example.com", dnsTypeA, dnssecOff)
+	var stream bytes.Buffer
+	if err := writeDNSStream(&stream, query); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.BigEndian.Uint16(stream.Bytes()); int(got) != len(query) {
+		t.Errorf("length prefix %d, want %d", got, len(query))
+	}
+	msg, err := readDNSStream(&stream)
+	if err != nil || !bytes.Equal(msg, query) {
+		t.Errorf("read %x, %v, want %x", msg, err, query)
+	}
+	if _, err := readDNSStream(bytes.NewReader([]byte{0, 10, 1, 2})); err == nil {
+		t.Error("expected an error for a truncated message")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Check the DNSSEC status of every result, set by -dnssec
+var checkDNSSEC bool
+
+// DNSSEC status of a name, as defined by RFC 4035
+const (
+	dnssecSecure        = "secure"        // Signed and validated
+	dnssecInsecure      = "insecure"      // The zone is not signed
+	dnssecBogus         = "bogus"         // Signed, but the signatures fail validation
+	dnssecIndeterminate = "indeterminate" // Signed, but the resolver could not build a chain of trust
+)
+
+var dnssecTurn atomic.Uint32
+
+// Validating resolvers used for the check: the trusted resolvers, which
+// are public resolvers that validate DNSSEC unless -trusted-resolvers says
+// otherwise
+func dnssecResolver() string {
+	servers := trustedResolvers
+	if servers == nil {
+		servers = defaultTrustedResolvers
+	}
+	return servers[int(dnssecTurn.Add(1)-1)%len(servers)]
+}
+
+// Whether a message carries signatures, over the answer or over the NSEC or
+// NSEC3 proof that the name does not exist
+func hasSignatures(msg *dnsMessage) bool {
+	return hasRecordType(msg.Answers, dnsTypeRRSIG) || hasRecordType(msg.Authority, dnsTypeRRSIG)
+}
+
+// Find the DNSSEC status of a name by looking it up on a validating
+// resolver. A validated answer has the AD bit. A validation failure shows up
+// as SERVFAIL, and is told apart from a broken server by asking again with
+// checking disabled. An empty status means the name could not be checked.
+func lookupDNSSEC(host string) string {
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		server := dnssecResolver()
+		msg, err := queryDNSSEC(server, host, dnsTypeA)
+		if err != nil {
+			continue
+		}
+		switch {
+		case msg.Rcode == dnsRcodeServFail:
+			unchecked, err := queryDNSSECUnchecked(server, host, dnsTypeA)
+			if err != nil || unchecked.Rcode == dnsRcodeServFail {
+				continue
+			}
+			return dnssecBogus
+		case msg.Authentic:
+			return dnssecSecure
+		case hasSignatures(msg):
+			return dnssecIndeterminate
+		default:
+			return dnssecInsecure
+		}
+	}
+	return ""
+}
+
+// Record the DNSSEC status of every result and report the bogus and
+// indeterminate ones, which point at broken signing or a broken chain of
+// trust
+func checkDNSSECStatus(results []datedResult) {
+	var hosts []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		if _, exists := seen[r.Host]; !exists {
+			seen[r.Host] = struct{}{}
+			hosts = append(hosts, r.Host)
+		}
+	}
+
+	statuses := make(map[string]string, len(hosts))
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, host := range hosts {
+		pool.Go(func() {
+			status := lookupDNSSEC(host)
+			lock.Lock()
+			statuses[host] = status
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+
+	counts := make(map[string]int)
+	for _, host := range hosts {
+		status := statuses[host]
+		counts[status]++
+		if status == dnssecBogus || status == dnssecIndeterminate {
+			fmt.Printf("DNSSEC %s: %s\n", status, host)
+		}
+	}
+	for i := range results {
+		results[i].DNSSEC = statuses[results[i].Host]
+	}
+	fmt.Printf("DNSSEC: %d secure, %d insecure, %d bogus, %d indeterminate, %d unchecked\n",
+		counts[dnssecSecure], counts[dnssecInsecure], counts[dnssecBogus], counts[dnssecIndeterminate], counts[""])
+}
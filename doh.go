@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Well-known DNS-over-HTTPS endpoints that -doh accepts by name
+var dohEndpoints = map[string]string{
+	"cloudflare": "https://cloudflare-dns.com/dns-query",
+	"google":     "https://dns.google/dns-query",
+	"quad9":      "https://dns.quad9.net/dns-query",
+}
+
+// Client for DNS-over-HTTPS queries. It goes through -proxy like the
+// sources but is not bound by -rate-limit, which is meant for their APIs.
+var dohClient = http.DefaultClient
+
+// Report whether a resolver is a DNS-over-HTTPS endpoint
+func isDoHResolver(server string) bool {
+	return strings.HasPrefix(server, "https://")
+}
+
+// Use DNS-over-HTTPS resolvers, given as a comma-separated list of endpoint
+// names or URLs, instead of plain DNS
+func useDoHResolvers(list string) error {
+	var loaded []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if endpoint, ok := dohEndpoints[strings.ToLower(name)]; ok {
+			name = endpoint
+		}
+		if parsed, err := url.Parse(name); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("invalid DNS-over-HTTPS endpoint %q (use cloudflare, google, quad9 or an https:// URL)", name)
+		}
+		loaded = append(loaded, name)
+	}
+	resolvers = loaded
+	return nil
+}
+
+// Send a query to a DNS-over-HTTPS endpoint as an RFC 8484 POST request
+func queryDoH(endpoint string, query []byte) (*dnsMessage, error) {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered with status %d", endpoint, resp.StatusCode)
+	}
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, err
+	}
+	return parseDNSMessage(answer)
+}
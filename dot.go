@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"strings"
+)
+
+// Port of DNS-over-TLS resolvers given without one
+const dotPort = "853"
+
+// Report whether a resolver is a DNS-over-TLS server, written tls://host
+func isDoTResolver(server string) bool {
+	return strings.HasPrefix(server, "tls://")
+}
+
+// Normalize a tls:// resolver so it always carries a port
+func parseDoTResolver(server string) (string, bool) {
+	address := strings.TrimPrefix(server, "tls://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		host := strings.Trim(address, "[]")
+		if host == "" {
+			return "", false
+		}
+		address = net.JoinHostPort(host, dotPort)
+	}
+	return "tls://" + address, true
+}
+
+// Send a query to a DNS-over-TLS server (RFC 7858). The certificate is
+// checked against the host of the resolver, name or IP.
+func queryDoT(server string, query []byte) (*dnsMessage, error) {
+	address := strings.TrimPrefix(server, "tls://")
+	host, _, _ := net.SplitHostPort(address)
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	if err != nil {
+		return nil, err
+	}
+	return exchangeDNSStream(conn, query)
+}
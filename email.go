@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	smtpServer   = os.Getenv("SMTP_SERVER") // host:port; 465 uses implicit TLS, other ports STARTTLS when offered
+	smtpUsername = os.Getenv("SMTP_USERNAME")
+	smtpPassword = os.Getenv("SMTP_PASSWORD")
+	smtpFrom     = os.Getenv("SMTP_FROM")
+	smtpTo       = os.Getenv("SMTP_TO") // Comma-separated recipients
+)
+
+// Emails sent for each target and for digests. The first line of the
+// rendered template is the subject and the rest the body.
+const (
+	defaultEmailTemplate = `LeviathanMapper: {{.Domain}}{{with .New}} ({{len .}} new){{end}}{{if .Interrupted}} (interrupted){{end}}
+{{.Total}} hosts found in {{.Duration}}.
+{{range .Hosts}}
+{{.}}{{if $.IsNew .}} [new]{{end}}{{end}}`
+	defaultDigestTemplate = `LeviathanMapper digest: {{.Domain}} ({{len .New}} new)
+{{len .New}} hosts first seen{{if not .Since.IsZero}} since {{.Since.Format "2006-01-02 15:04"}}{{end}}, {{.Total}} found by the last run.
+{{range .New}}
+{{.}}{{end}}`
+)
+
+var (
+	// Whether -notify includes email
+	emailNotifications bool
+	// With -email-digest, time between digests; per-target emails are not
+	// sent then
+	emailDigest    time.Duration
+	emailTemplate  *template.Template
+	digestTemplate *template.Template
+)
+
+// Parse a -email-digest period: daily, weekly or a duration such as 72h
+func parseDigestPeriod(value string) (time.Duration, error) {
+	switch value {
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("invalid digest period %q (use daily, weekly or a duration such as 72h)", value)
+	}
+	return period, nil
+}
+
+// Check the SMTP variables and parse the email templates
+func setupEmail(cfg notifyConfig) error {
+	if smtpServer == "" || smtpFrom == "" || smtpTo == "" {
+		return fmt.Errorf("email notifications require SMTP_SERVER, SMTP_FROM and SMTP_TO")
+	}
+	if _, _, err := net.SplitHostPort(smtpServer); err != nil {
+		return fmt.Errorf("invalid SMTP_SERVER %q: expected host:port", smtpServer)
+	}
+
+	email, digest := cfg.EmailTemplate, cfg.DigestTemplate
+	if email == "" {
+		email = defaultEmailTemplate
+	}
+	if digest == "" {
+		digest = defaultDigestTemplate
+	}
+	var err error
+	if emailTemplate, err = template.New("email").Funcs(template.FuncMap{"join": strings.Join}).Parse(email); err != nil {
+		return fmt.Errorf("invalid email_template: %v", err)
+	}
+	if digestTemplate, err = template.New("digest").Funcs(template.FuncMap{"join": strings.Join}).Parse(digest); err != nil {
+		return fmt.Errorf("invalid digest_template: %v", err)
+	}
+	emailNotifications = true
+	return nil
+}
+
+// Render a template into an email and send it
+func sendTemplatedEmail(ctx context.Context, message *template.Template, n notification) error {
+	var text strings.Builder
+	if err := message.Execute(&text, n); err != nil {
+		return err
+	}
+	subject, body, _ := strings.Cut(text.String(), "\n")
+	return sendEmail(ctx, subject, strings.TrimLeft(body, "\n"))
+}
+
+// Send a plain-text email to the SMTP_TO recipients
+func sendEmail(ctx context.Context, subject, body string) error {
+	host, port, _ := net.SplitHostPort(smtpServer)
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	var conn net.Conn
+	var err error
+	if port == "465" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", smtpServer)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", smtpServer)
+	}
+	if err != nil {
+		return err
+	}
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+	conn.SetDeadline(time.Now().Add(time.Minute))
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok && port != "465" {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if smtpUsername != "" {
+		if err := client.Auth(smtp.PlainAuth("", smtpUsername, smtpPassword, host)); err != nil {
+			return err
+		}
+	}
+
+	var recipients []string
+	for _, address := range strings.Split(smtpTo, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			recipients = append(recipients, address)
+		}
+	}
+	if err := client.Mail(smtpFrom); err != nil {
+		return err
+	}
+	for _, address := range recipients {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	headers := []string{
+		"From: " + smtpFrom,
+		"To: " + strings.Join(recipients, ", "),
+		"Subject: " + mime.QEncoding.Encode("utf-8", subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	if _, err := fmt.Fprintf(w, "%s\r\n\r\n%s\r\n", strings.Join(headers, "\r\n"), body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// Email the hosts first seen since the last digest once the -email-digest
+// period has passed, recording when it was sent
+func sendDigestIfDue(ctx context.Context, h *history, total int, now time.Time) {
+	if !emailNotifications || emailDigest == 0 || now.Sub(h.DigestSent) < emailDigest {
+		return
+	}
+	n := notification{Domain: h.Domain, Total: total, New: h.seenSince(h.DigestSent), Since: h.DigestSent}
+	if err := sendTemplatedEmail(ctx, digestTemplate, n); err != nil {
+		fmt.Println("Error sending email digest:", err)
+		return
+	}
+	h.DigestSent = now
+}
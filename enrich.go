@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Open ports, CPEs, tags and known vulnerabilities Shodan InternetDB has for
+// the addresses of an asset
+type internetDBInfo struct {
+	Ports []int    `json:"ports"`
+	CPEs  []string `json:"cpes"`
+	Tags  []string `json:"tags"`
+	Vulns []string `json:"vulns"`
+}
+
+// Attach resolved addresses and InternetDB data to every result. Hosts
+// reported without an IP are resolved first, unless -resolve already did.
+func enrichWithInternetDB(ctx context.Context, results []datedResult) {
+	var hosts []string
+	for _, r := range results {
+		if r.IP == "" && len(r.IPs) == 0 {
+			hosts = append(hosts, r.Host)
+		}
+	}
+	resolved := resolveHosts(ctx, hosts)
+
+	for i := range results {
+		switch {
+		case len(results[i].IPs) > 0:
+		case results[i].IP != "":
+			results[i].IPs = []string{results[i].IP}
+		default:
+			results[i].IPs = resolved[results[i].Host].Addresses
+		}
+	}
+	classifyCDNs(results)
+
+	var ips []string
+	seen := make(map[string]struct{})
+	for i := range results {
+		for _, ip := range scannableIPs(results[i]) {
+			if _, exists := seen[ip]; !exists {
+				seen[ip] = struct{}{}
+				ips = append(ips, ip)
+			}
+		}
+	}
+
+	info := queryInternetDB(ctx, ips)
+	for i := range results {
+		var merged internetDBInfo
+		for _, ip := range results[i].IPs {
+			if data, ok := info[ip]; ok {
+				merged.Ports = append(merged.Ports, data.Ports...)
+				merged.CPEs = append(merged.CPEs, data.CPEs...)
+				merged.Tags = append(merged.Tags, data.Tags...)
+				merged.Vulns = append(merged.Vulns, data.Vulns...)
+			}
+		}
+		merged.Ports = uniqueInts(merged.Ports)
+		merged.CPEs = uniqueStrings(merged.CPEs)
+		merged.Tags = uniqueStrings(merged.Tags)
+		merged.Vulns = uniqueStrings(merged.Vulns)
+		results[i].InternetDB = merged
+	}
+}
+
+// Query InternetDB for every IP, bounded by -concurrency. IPs it knows
+// nothing about answer 404 and are left out.
+func queryInternetDB(ctx context.Context, ips []string) map[string]internetDBInfo {
+	info := make(map[string]internetDBInfo, len(ips))
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			req, _ := http.NewRequestWithContext(ctx, "GET", "https://internetdb.shodan.io/"+ip, nil)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				fmt.Println("Error querying InternetDB:", err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			var data internetDBInfo
+			if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+				return
+			}
+			lock.Lock()
+			info[ip] = data
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+	return info
+}
+
+// Summary of the enrichment data printed next to a result
+func (info internetDBInfo) summary() string {
+	var parts []string
+	if len(info.Ports) > 0 {
+		ports := make([]string, len(info.Ports))
+		for i, port := range info.Ports {
+			ports[i] = strconv.Itoa(port)
+		}
+		parts = append(parts, "ports: "+strings.Join(ports, ","))
+	}
+	if len(info.Vulns) > 0 {
+		parts = append(parts, "vulns: "+strings.Join(info.Vulns, ","))
+	}
+	if len(info.CPEs) > 0 {
+		parts = append(parts, "cpes: "+strings.Join(info.CPEs, ","))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(parts, "] [") + "]"
+}
+
+// Sorted copy of values without duplicates
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	var unique []string
+	for _, value := range values {
+		if _, exists := seen[value]; !exists {
+			seen[value] = struct{}{}
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// Sorted copy of values without duplicates
+func uniqueInts(values []int) []int {
+	seen := make(map[int]struct{}, len(values))
+	var unique []int
+	for _, value := range values {
+		if _, exists := seen[value]; !exists {
+			seen[value] = struct{}{}
+			unique = append(unique, value)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
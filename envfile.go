@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Credential variables read from the environment at startup, refreshed
+// after a .env file is loaded
+var envCredentials = map[string]*string{
+	"SECURITYTRAILS_API_KEY":         &apiKeySecurityTrails,
+	"SHODAN_API_KEY":                 &apiKeyShodan,
+	"VIRUSTOTAL_API_KEY":             &apiKeyVirusTotal,
+	"LEAKIX_API_KEY":                 &apiKeyLeakIX,
+	"ZOOMEYE_API_KEY":                &apiKeyZoomEye,
+	"ZOOMEYE_USERNAME":               &zoomEyeUsername,
+	"ZOOMEYE_PASSWORD":               &zoomEyePassword,
+	"FOFA_EMAIL":                     &fofaEmail,
+	"FOFA_KEY":                       &apiKeyFofa,
+	"HUNTERHOW_API_KEY":              &apiKeyHunterHow,
+	"INTELX_API_KEY":                 &apiKeyIntelX,
+	"WHOISXML_API_KEY":               &apiKeyWhoisXML,
+	"PASSIVETOTAL_USERNAME":          &passiveTotalUsername,
+	"PASSIVETOTAL_API_KEY":           &apiKeyPassiveTotal,
+	"QUAKE_API_KEY":                  &apiKeyQuake,
+	"BEVIGIL_API_KEY":                &apiKeyBeVigil,
+	"DNSREPO_API_KEY":                &apiKeyDNSRepo,
+	"GOOGLE_API_KEY":                 &apiKeyGoogle,
+	"GOOGLE_CSE_ID":                  &googleSearchEngineID,
+	"CLOUDFLARE_API_TOKEN":           &apiTokenCloudflare,
+	"AWS_ACCESS_KEY_ID":              &awsAccessKeyID,
+	"AWS_SECRET_ACCESS_KEY":          &awsSecretAccessKey,
+	"AWS_SESSION_TOKEN":              &awsSessionToken,
+	"AZURE_TENANT_ID":                &azureTenantID,
+	"AZURE_CLIENT_ID":                &azureClientID,
+	"AZURE_CLIENT_SECRET":            &azureClientSecret,
+	"AZURE_SUBSCRIPTION_ID":          &azureSubscriptionID,
+	"GOOGLE_APPLICATION_CREDENTIALS": &gcpCredentialsFile,
+	"GOOGLE_CLOUD_PROJECT":           &gcpProject,
+	"SLACK_WEBHOOK_URL":              &slackWebhookURL,
+	"DISCORD_WEBHOOK_URL":            &discordWebhookURL,
+	"TELEGRAM_BOT_TOKEN":             &telegramBotToken,
+	"TELEGRAM_CHAT_ID":               &telegramChatID,
+	"SMTP_SERVER":                    &smtpServer,
+	"SMTP_USERNAME":                  &smtpUsername,
+	"SMTP_PASSWORD":                  &smtpPassword,
+	"SMTP_FROM":                      &smtpFrom,
+	"SMTP_TO":                        &smtpTo,
+}
+
+// Load KEY=VALUE lines from a .env file into the environment. Variables
+// already set in the shell win over the file. Without an explicit path, a
+// .env file in the working directory is used when present.
+func loadEnvFile(path string, explicit bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, found := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return fmt.Errorf("line %d: expected NAME=value", number)
+		}
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", number, err)
+		}
+		if _, set := os.LookupEnv(name); !set {
+			os.Setenv(name, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for name, variable := range envCredentials {
+		*variable = os.Getenv(name)
+	}
+	return nil
+}
+
+// Decode a .env value: double quotes allow escapes, single quotes are
+// literal and unquoted values end at a " #" comment
+func parseEnvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		end := closingQuote(value, 0)
+		if end < 0 {
+			return "", errors.New("unterminated double-quoted value")
+		}
+		return strconv.Unquote(value[:end+1])
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", errors.New("unterminated single-quoted value")
+		}
+		return value[1 : end+1], nil
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
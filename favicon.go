@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Largest favicon read by the probe
+const faviconLimit = 1 << 20
+
+// Icon link of an HTML page
+var iconPattern = regexp.MustCompile(`(?is)<link[^>]+rel=["'][^"']*\bicon\b[^"']*["'][^>]*>`)
+var hrefPattern = regexp.MustCompile(`(?is)href=["']([^"']+)["']`)
+
+// 32-bit MurmurHash3 with seed 0, as a signed integer like Python's mmh3
+func murmur3(data []byte) int32 {
+	const c1, c2 = 0xcc9e2d51, 0x1b873593
+	var h uint32
+	blocks := len(data) / 4
+	for i := 0; i < blocks; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	var k uint32
+	tail := data[blocks*4:]
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return int32(h)
+}
+
+// Favicon hash searched by Shodan (http.favicon.hash) and FOFA
+// (icon_hash): the MurmurHash3 of the icon encoded in base64 with a line
+// break every 76 characters and at the end
+func faviconHash(icon []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(icon)
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\n")
+		encoded = encoded[76:]
+	}
+	lines.WriteString(encoded + "\n")
+	return murmur3([]byte(lines.String()))
+}
+
+// Location of the icon of a page: its icon link, or /favicon.ico
+func faviconURL(page *url.URL, body []byte) string {
+	if link := iconPattern.Find(body); link != nil {
+		if href := hrefPattern.FindSubmatch(link); href != nil {
+			if icon, err := page.Parse(string(href[1])); err == nil {
+				return icon.String()
+			}
+		}
+	}
+	icon, _ := page.Parse("/favicon.ico")
+	return icon.String()
+}
+
+// Download the icon of a page and hash it
+func fetchFaviconHash(ctx context.Context, page *url.URL, body []byte) (int32, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, faviconURL(page, body), nil)
+	if err != nil {
+		return 0, false
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return 0, false
+	}
+	defer resp.Body.Close()
+	icon, err := io.ReadAll(io.LimitReader(resp.Body, faviconLimit))
+	if err != nil || resp.StatusCode != http.StatusOK || len(icon) == 0 {
+		return 0, false
+	}
+	// Single-page apps answer every path with their index page
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return 0, false
+	}
+	return faviconHash(icon), true
+}
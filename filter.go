@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Include and exclude patterns applied to every result before it is
+// recorded or printed
+var resultFilter scope.Filter
+
+// Regular expressions given with -include-regex or -exclude-regex; the flag
+// can be repeated
+type regexpFlag struct {
+	patterns *[]*regexp.Regexp
+}
+
+func (f regexpFlag) String() string {
+	if f.patterns == nil {
+		return ""
+	}
+	var exprs []string
+	for _, pattern := range *f.patterns {
+		exprs = append(exprs, pattern.String())
+	}
+	return strings.Join(exprs, " ")
+}
+
+func (f regexpFlag) Set(value string) error {
+	pattern, err := regexp.Compile(value)
+	if err != nil {
+		return err
+	}
+	*f.patterns = append(*f.patterns, pattern)
+	return nil
+}
+
+// Globs given with -include or -exclude; the flag can be repeated and takes
+// comma-separated values
+type globFlag struct {
+	patterns *[]*regexp.Regexp
+}
+
+func (f globFlag) String() string {
+	return regexpFlag(f).String()
+}
+
+func (f globFlag) Set(value string) error {
+	for _, glob := range strings.Split(value, ",") {
+		if glob = strings.TrimSpace(glob); glob == "" {
+			continue
+		}
+		pattern, err := scope.Glob(glob)
+		if err != nil {
+			return err
+		}
+		*f.patterns = append(*f.patterns, pattern)
+	}
+	return nil
+}
+
+// Engagement scope loaded with -scope, nil when none was given
+var engagementScope *scope.Filter
+
+// Drop results outside the engagement scope instead of tagging them
+var scopeOnly bool
+
+// Load a Burp Suite scope export or a plain list of hosts and globs,
+// telling them apart by the JSON object of the former
+func loadScopeFile(path string) (*scope.Filter, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		return scope.ParseBurp(data)
+	}
+	return scope.ParseList(bytes.NewReader(data))
+}
+
+// Report whether a host is inside the engagement scope; every host is when
+// no scope was given
+func inEngagementScope(host string) bool {
+	return engagementScope == nil || engagementScope.Allows(host)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Signs of a web technology in a response. Patterns are case-insensitive;
+// the first group, when present, captures the version.
+type techFingerprint struct {
+	name    string
+	headers map[string]string // Header name to a pattern on its value
+	cookies []string          // Names of cookies the technology sets
+	body    []string          // Patterns on the page
+}
+
+// Technologies a probed host must run to be reported, set by -tech
+var techFilter []string
+
+// Built-in fingerprints, in the manner of Wappalyzer: servers, proxies and
+// CDNs, languages and frameworks, CMSs and common self-hosted applications
+var techFingerprints = []techFingerprint{
+	{name: "Nginx", headers: map[string]string{"Server": `nginx(?:/([\d.]+))?`}},
+	{name: "OpenResty", headers: map[string]string{"Server": `openresty(?:/([\d.]+))?`}},
+	{name: "Apache", headers: map[string]string{"Server": `apache(?:/([\d.]+))?`}},
+	{name: "Apache Tomcat", body: []string{`apache tomcat/([\d.]+)`}},
+	{name: "Microsoft IIS", headers: map[string]string{"Server": `microsoft-iis(?:/([\d.]+))?`}},
+	{name: "LiteSpeed", headers: map[string]string{"Server": `litespeed`}},
+	{name: "Caddy", headers: map[string]string{"Server": `^caddy`}},
+	{name: "Envoy", headers: map[string]string{"Server": `^envoy`, "X-Envoy-Upstream-Service-Time": ``}},
+	{name: "Gunicorn", headers: map[string]string{"Server": `gunicorn(?:/([\d.]+))?`}},
+	{name: "Werkzeug", headers: map[string]string{"Server": `werkzeug(?:/([\d.]+))?`}},
+	{name: "Kestrel", headers: map[string]string{"Server": `kestrel`}},
+	{name: "Cloudflare", headers: map[string]string{"Server": `^cloudflare`, "CF-Ray": ``}},
+	{name: "Amazon CloudFront", headers: map[string]string{"X-Amz-Cf-Id": ``, "Via": `cloudfront`}},
+	{name: "Amazon S3", headers: map[string]string{"Server": `^amazons3`}},
+	{name: "Akamai", headers: map[string]string{"X-Akamai-Transformed": ``, "Server": `^akamaighost`}},
+	{name: "Fastly", headers: map[string]string{"X-Fastly-Request-ID": ``, "Fastly-Debug-Digest": ``}},
+	{name: "Imperva", headers: map[string]string{"X-Iinfo": ``, "X-CDN": `imperva|incapsula`}},
+	{name: "Sucuri", headers: map[string]string{"X-Sucuri-ID": ``, "Server": `^sucuri`}},
+	{name: "Varnish", headers: map[string]string{"X-Varnish": ``, "Via": `varnish`}},
+	{name: "Vercel", headers: map[string]string{"Server": `^vercel`, "X-Vercel-Id": ``}},
+	{name: "Netlify", headers: map[string]string{"Server": `^netlify`, "X-NF-Request-ID": ``}},
+	{name: "GitHub Pages", headers: map[string]string{"Server": `^github\.com`}},
+	{name: "PHP", headers: map[string]string{"X-Powered-By": `php(?:/([\d.]+))?`}, cookies: []string{"PHPSESSID"}},
+	{name: "ASP.NET", headers: map[string]string{"X-Powered-By": `asp\.net`, "X-AspNet-Version": `([\d.]+)`}, cookies: []string{"ASP.NET_SessionId"}},
+	{name: "Java", cookies: []string{"JSESSIONID"}},
+	{name: "Express", headers: map[string]string{"X-Powered-By": `^express$`}},
+	{name: "Next.js", headers: map[string]string{"X-Powered-By": `next\.js ?([\d.]+)?`}, body: []string{`/_next/static/`}},
+	{name: "Nuxt.js", body: []string{`window\.__nuxt__`, `/_nuxt/`}},
+	{name: "Django", cookies: []string{"csrftoken", "django_language"}, body: []string{`name=["']csrfmiddlewaretoken["']`}},
+	{name: "Laravel", cookies: []string{"laravel_session"}},
+	{name: "Ruby on Rails", headers: map[string]string{"X-Powered-By": `phusion passenger`}, body: []string{`name=["']csrf-param["'] content=["']authenticity_token["']`}},
+	{name: "React", body: []string{`data-reactroot`, `id=["']react-root["']`}},
+	{name: "Angular", body: []string{`ng-version=["']([\d.]+)["']`}},
+	{name: "Vue.js", body: []string{`data-v-[0-9a-f]{8}`, `vue(?:\.min)?\.js`}},
+	{name: "jQuery", body: []string{`jquery[.-]([\d.]+)(?:\.min)?\.js`, `/jquery(?:\.min)?\.js`}},
+	{name: "Bootstrap", body: []string{`bootstrap(?:\.min)?\.(?:css|js)`}},
+	{name: "WordPress", body: []string{`<meta[^>]+content=["']wordpress ?([\d.]+)?`, `/wp-(?:content|includes)/`}},
+	{name: "Drupal", headers: map[string]string{"X-Generator": `drupal ?(\d+)?`, "X-Drupal-Cache": ``}, body: []string{`drupal\.settings`}},
+	{name: "Joomla", body: []string{`<meta[^>]+content=["']joomla`}},
+	{name: "Magento", headers: map[string]string{"X-Magento-Cache-Debug": ``}, body: []string{`mage/cookies`, `mage\.cookies`}},
+	{name: "Shopify", headers: map[string]string{"X-ShopId": ``}, body: []string{`cdn\.shopify\.com`}},
+	{name: "Ghost", body: []string{`<meta[^>]+content=["']ghost ?([\d.]+)?`}},
+	{name: "Grafana", body: []string{`grafanabootdata`, `<title>grafana</title>`}},
+	{name: "Kibana", headers: map[string]string{"Kbn-Version": `([\d.]+)`, "Kbn-Name": ``}},
+	{name: "Jenkins", headers: map[string]string{"X-Jenkins": `([\d.]+)`}},
+	{name: "GitLab", cookies: []string{"_gitlab_session"}, body: []string{`gon\.gitlab_url`}},
+	{name: "Jira", cookies: []string{"atlassian.xsrf.token"}, body: []string{`ajs-version-number`}},
+	{name: "Confluence", headers: map[string]string{"X-Confluence-Request-Time": ``}},
+	{name: "Outlook Web App", body: []string{`/owa/auth/`}},
+	{name: "Citrix Gateway", body: []string{`/vpn/resources/`, `citrix gateway`}, cookies: []string{"NSC_TMAA"}},
+}
+
+// Compiled patterns of the fingerprints, by pattern text
+var techPatterns = compileTechPatterns()
+
+func compileTechPatterns() map[string]*regexp.Regexp {
+	patterns := make(map[string]*regexp.Regexp)
+	add := func(pattern string) {
+		if _, exists := patterns[pattern]; !exists {
+			patterns[pattern] = regexp.MustCompile("(?i)" + pattern)
+		}
+	}
+	for _, fingerprint := range techFingerprints {
+		for _, pattern := range fingerprint.headers {
+			add(pattern)
+		}
+		for _, pattern := range fingerprint.body {
+			add(pattern)
+		}
+	}
+	return patterns
+}
+
+// Match a pattern, returning the version it captured
+func matchTech(pattern, text string) (version string, ok bool) {
+	match := techPatterns[pattern].FindStringSubmatch(text)
+	if match == nil {
+		return "", false
+	}
+	if len(match) > 1 {
+		version = match[1]
+	}
+	return version, true
+}
+
+// Technologies seen in a response, with their version when it shows
+func fingerprintResponse(resp *http.Response, body []byte) []string {
+	cookies := make(map[string]struct{})
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = struct{}{}
+	}
+	page := string(body)
+
+	var found []string
+	for _, fingerprint := range techFingerprints {
+		matched, version := false, ""
+		for header, pattern := range fingerprint.headers {
+			if values, present := resp.Header[http.CanonicalHeaderKey(header)]; present {
+				for _, value := range values {
+					if v, ok := matchTech(pattern, value); ok {
+						matched = true
+						if v != "" {
+							version = v
+						}
+					}
+				}
+			}
+		}
+		for _, name := range fingerprint.cookies {
+			if _, set := cookies[name]; set {
+				matched = true
+			}
+		}
+		for _, pattern := range fingerprint.body {
+			if v, ok := matchTech(pattern, page); ok {
+				matched = true
+				if v != "" {
+					version = v
+				}
+			}
+		}
+		if matched {
+			found = append(found, strings.TrimSpace(fingerprint.name+" "+version))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return strings.ToLower(found[i]) < strings.ToLower(found[j]) })
+	return found
+}
+
+// Whether a result runs one of the technologies, compared by lower-case
+// name without the version
+func runsTechnology(r datedResult, names map[string]struct{}) bool {
+	for _, service := range r.Probes {
+		for _, tech := range service.Technologies {
+			tech = strings.ToLower(tech)
+			for name := range names {
+				// "apache 2.4" runs Apache, "apache tomcat" does not
+				version := strings.TrimPrefix(tech, name+" ")
+				if tech == name || version != tech && version[0] >= '0' && version[0] <= '9' {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Keep the results running one of the technologies of -tech
+func filterByTechnology(results []datedResult, filter []string) []datedResult {
+	names := make(map[string]struct{}, len(filter))
+	for _, name := range filter {
+		names[strings.ToLower(strings.TrimSpace(name))] = struct{}{}
+	}
+	kept := results[:0]
+	for _, r := range results {
+		if runsTechnology(r, names) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// gRPC service of proto/leviathanmapper.proto, served by the server
+// subcommand next to the REST API. Its two messages are small enough to
+// encode by hand instead of depending on the protobuf runtime.
+const grpcService = "leviathanmapper.v1.LeviathanMapper"
+
+// gRPC status codes
+const (
+	grpcOK              = 0
+	grpcCancelled       = 1
+	grpcInvalidArgument = 3
+	grpcInternal        = 13
+	grpcUnavailable     = 14
+	grpcUnauthenticated = 16
+)
+
+// Largest request message accepted
+const maxGRPCMessage = 1 << 20
+
+// EnumerateRequest of the proto definitions
+type enumerateRequest struct {
+	Domain  string
+	Sources []string
+}
+
+// Decode an EnumerateRequest, skipping unknown fields
+func decodeEnumerateRequest(data []byte) (enumerateRequest, error) {
+	var request enumerateRequest
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return request, errors.New("malformed field tag")
+		}
+		data = data[n:]
+		field, wireType := tag>>3, tag&7
+		var value []byte
+		switch wireType {
+		case 0: // varint
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return request, errors.New("malformed varint")
+			}
+			data = data[n:]
+			continue
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return request, errors.New("truncated field")
+			}
+			data = data[8:]
+			continue
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return request, errors.New("truncated field")
+			}
+			data = data[4:]
+			continue
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return request, errors.New("truncated field")
+			}
+			value, data = data[n:n+int(length)], data[n+int(length):]
+		default:
+			return request, fmt.Errorf("unsupported wire type %d", wireType)
+		}
+		switch field {
+		case 1:
+			request.Domain = string(value)
+		case 2:
+			request.Sources = append(request.Sources, string(value))
+		}
+	}
+	return request, nil
+}
+
+// Encode a result as an EnumerateResult
+func encodeEnumerateResult(r Result) []byte {
+	var message []byte
+	appendString := func(field uint64, value string) {
+		if value != "" {
+			message = binary.AppendUvarint(message, field<<3|2)
+			message = binary.AppendUvarint(message, uint64(len(value)))
+			message = append(message, value...)
+		}
+	}
+	appendString(1, r.Host)
+	appendString(2, r.IP)
+	if r.Port != 0 {
+		message = binary.AppendUvarint(message, 3<<3)
+		message = binary.AppendUvarint(message, uint64(r.Port))
+	}
+	appendString(4, r.Source)
+	return message
+}
+
+// Read one length-prefixed gRPC message
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > maxGRPCMessage {
+		return nil, errors.New("message too large")
+	}
+	message := make([]byte, length)
+	_, err := io.ReadFull(r, message)
+	return message, err
+}
+
+// Write one length-prefixed, uncompressed gRPC message
+func writeGRPCMessage(w io.Writer, message []byte) error {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	_, err := w.Write(append(frame, message...))
+	return err
+}
+
+// End the call with a status, in the trailers once the response started or
+// as a trailers-only response otherwise
+func writeGRPCStatus(w http.ResponseWriter, started bool, code int, message string) {
+	prefix := ""
+	if started {
+		prefix = http.TrailerPrefix
+	} else {
+		w.Header().Set("Content-Type", "application/grpc")
+	}
+	w.Header().Set(prefix+"Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set(prefix+"Grpc-Message", grpcEscape(message))
+	}
+	if !started {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Percent-encode a status message as the gRPC spec requires for bytes
+// outside printable ASCII and for %
+func grpcEscape(message string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		} else {
+			escaped.WriteByte(c)
+		}
+	}
+	return escaped.String()
+}
+
+// Enumerate(EnumerateRequest) returns (stream EnumerateResult): queue a job
+// and stream its results as they are found. The job is cancelled when the
+// client goes away.
+func (s *jobServer) enumerate(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC requires HTTP/2 and an application/grpc body", http.StatusUnsupportedMediaType)
+		return
+	}
+	message, err := readGRPCMessage(r.Body)
+	if err != nil {
+		writeGRPCStatus(w, false, grpcInvalidArgument, "reading request: "+err.Error())
+		return
+	}
+	request, err := decodeEnumerateRequest(message)
+	if err != nil {
+		writeGRPCStatus(w, false, grpcInvalidArgument, "decoding request: "+err.Error())
+		return
+	}
+	domain := scope.NormalizeHost(request.Domain)
+	if domain == "" {
+		writeGRPCStatus(w, false, grpcInvalidArgument, "missing domain")
+		return
+	}
+	if _, err := selectSources(s.sources, strings.Join(request.Sources, ",")); err != nil {
+		writeGRPCStatus(w, false, grpcInvalidArgument, err.Error())
+		return
+	}
+
+	live := make(chan Result)
+	queued, ok := s.enqueue(domain, request.Sources, live)
+	if !ok {
+		writeGRPCStatus(w, false, grpcUnavailable, "too many queued jobs")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for {
+		select {
+		case result, open := <-live:
+			if !open {
+				j, _ := s.lookup(queued.ID)
+				switch j.Status {
+				case jobFailed:
+					writeGRPCStatus(w, true, grpcInternal, j.Error)
+				case jobCancelled:
+					writeGRPCStatus(w, true, grpcCancelled, "job cancelled")
+				case jobDone:
+					writeGRPCStatus(w, true, grpcOK, "")
+				default:
+					// Stopped by the shutdown of the server before it
+					// finished, so the results sent are incomplete
+					writeGRPCStatus(w, true, grpcUnavailable, "server shutting down")
+				}
+				return
+			}
+			if err := writeGRPCMessage(w, encodeEnumerateResult(result)); err != nil {
+				s.cancelJob(queued.ID)
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			s.cancelJob(queued.ID)
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeEnumerateRequest(t *testing.T) {
+	field := func(number uint64, value string) []byte {
+		data := binary.AppendUvarint(nil, number<<3|2)
+		data = binary.AppendUvarint(data, uint64(len(value)))
+		return append(data, value...)
+	}
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    enumerateRequest
+		wantErr string
+	}{
+		{name: "empty", data: nil},
+		{name: "domain", data: field(1, "example.com"), want: enumerateRequest{Domain: "example.com"}},
+		{
+			name: "repeated sources",
+			data: join(field(2, "crtsh"), field(1, "example.com"), field(2, "wayback")),
+			want: enumerateRequest{Domain: "example.com", Sources: []string{"crtsh", "wayback"}},
+		},
+		{
+			// A varint, a fixed64, a fixed32 and a string of fields added to
+			// the proto later
+			name: "unknown fields",
+			data: join([]byte{3 << 3, 0x96, 0x01}, []byte{4<<3 | 1, 1, 2, 3, 4, 5, 6, 7, 8},
+				[]byte{5<<3 | 5, 1, 2, 3, 4}, field(6, "x"), field(1, "example.com")),
+			want: enumerateRequest{Domain: "example.com"},
+		},
+		{name: "last domain wins", data: join(field(1, "a.com"), field(1, "b.com")), want: enumerateRequest{Domain: "b.com"}},
+		{name: "long field", data: field(1, strings.Repeat("a", 300)), want: enumerateRequest{Domain: strings.Repeat("a", 300)}},
+		{name: "truncated string", data: field(1, "example.com")[:5], wantErr: "truncated field"},
+		{name: "truncated fixed64", data: []byte{4<<3 | 1, 1, 2}, wantErr: "truncated field"},
+		{name: "truncated fixed32", data: []byte{5<<3 | 5, 1}, wantErr: "truncated field"},
+		{name: "malformed varint", data: []byte{3 << 3, 0x96}, wantErr: "malformed varint"},
+		{name: "malformed tag", data: []byte{0x80}, wantErr: "malformed field tag"},
+		{name: "group", data: []byte{7<<3 | 3}, wantErr: "unsupported wire type 3"},
+	}
+	for _, tt := range tests {
+		got, err := decodeEnumerateRequest(tt.data)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestEncodeEnumerateResult(t *testing.T) {
+	got := encodeEnumerateResult(Result{Host: "www.example.com", IP: "192.0.2.1", Port: 443, Source: "crtsh"})
+	want := []byte("\x0a\x0fwww.example.com\x12\x09192.0.2.1\x18\xbb\x03\x22\x05crtsh")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	// Empty fields are left out
+	if got := encodeEnumerateResult(Result{Host: "a.example.com"}); !bytes.Equal(got, []byte("\x0a\x0da.example.com")) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestGRPCMessageFraming(t *testing.T) {
+	var stream bytes.Buffer
+	for _, message := range [][]byte{[]byte("first"), nil, []byte("third")} {
+		if err := writeGRPCMessage(&stream, message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.HasPrefix(stream.Bytes(), []byte("\x00\x00\x00\x00\x05first")) {
+		t.Errorf("frame %q", stream.Bytes())
+	}
+	for _, want := range []string{"first", "", "third"} {
+		message, err := readGRPCMessage(&stream)
+		if err != nil || string(message) != want {
+			t.Errorf("read %q, %v, want %q", message, err, want)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		frame []byte
+		want  string
+	}{
+		{"compressed", []byte("\x01\x00\x00\x00\x01a"), "compressed messages are not supported"},
+		{"too large", []byte("\x00\x10\x00\x00\x01"), "message too large"},
+		{"truncated prefix", []byte("\x00\x00"), "unexpected EOF"},
+		{"truncated message", []byte("\x00\x00\x00\x00\x05ab"), "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		if _, err := readGRPCMessage(bytes.NewReader(tt.frame)); err == nil || err.Error() != tt.want {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWriteGRPCStatus(t *testing.T) {
+	// Before the response started the status goes in the headers
+	w := httptest.NewRecorder()
+	writeGRPCStatus(w, false, grpcInvalidArgument, "bad domain: 100% ünicode\n")
+	if got := w.Header().Get("Grpc-Status"); got != "3" {
+		t.Errorf("status %q, want 3", got)
+	}
+	if got, want := w.Header().Get("Grpc-Message"), "bad domain: 100%25 %C3%BCnicode%0A"; got != want {
+		t.Errorf("message %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/grpc" {
+		t.Errorf("content type %q", got)
+	}
+
+	// Afterwards it goes in the trailers
+	w = httptest.NewRecorder()
+	writeGRPCStatus(w, true, grpcOK, "")
+	if got := w.Header().Get("Trailer:Grpc-Status"); got != "0" {
+		t.Errorf("trailer status %q, want 0", got)
+	}
+	if _, ok := w.Header()["Trailer:Grpc-Message"]; ok {
+		t.Error("empty message sent")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Hosts recorded for a target across previous runs, stored as one JSON file
+// per domain inside the directory given with -history
+type history struct {
+	Domain string                  `json:"domain"`
+	Hosts  map[string]historyEntry `json:"hosts"`
+	// Highest crt.sh certificate ID read, for incremental database queries
+	CrtShCertificateID int64 `json:"crtsh_certificate_id,omitempty"`
+	// Hosts reported by the last complete run, the baseline of -diff
+	LastRun []string `json:"last_run"`
+	// When the last -email-digest was sent
+	DigestSent time.Time `json:"digest_sent,omitempty"`
+	// When the last -report-dir digest was written
+	ReportSent time.Time `json:"report_sent,omitempty"`
+	// Doubtful hosts followed by -recheck and their disposition
+	Rechecks map[string]recheckEntry `json:"rechecks,omitempty"`
+}
+
+// When a host was first and last reported for the target
+type historyEntry struct {
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Path of the history file for a domain
+func historyPath(dir, domain string) string {
+	return filepath.Join(dir, domain+".json")
+}
+
+// Load the history of a domain; a missing file means the target has never
+// been scanned and yields an empty history
+func loadHistory(dir, domain string) (*history, error) {
+	h := &history{Domain: domain, Hosts: make(map[string]historyEntry)}
+	data, err := os.ReadFile(historyPath(dir, domain))
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, h); err != nil {
+		return nil, err
+	}
+	if h.Hosts == nil {
+		h.Hosts = make(map[string]historyEntry)
+	}
+	return h, nil
+}
+
+// Report whether a host was seen in any previous run
+func (h *history) known(host string) bool {
+	_, exists := h.Hosts[host]
+	return exists
+}
+
+// Hosts reported by the last complete run. Files written before the last run
+// was recorded fall back to the hosts seen most recently.
+func (h *history) lastRunHosts() map[string]bool {
+	hosts := make(map[string]bool)
+	if h.LastRun != nil {
+		for _, host := range h.LastRun {
+			hosts[host] = true
+		}
+		return hosts
+	}
+	var latest time.Time
+	for _, entry := range h.Hosts {
+		if entry.LastSeen.After(latest) {
+			latest = entry.LastSeen
+		}
+	}
+	for host, entry := range h.Hosts {
+		if entry.LastSeen.Equal(latest) {
+			hosts[host] = true
+		}
+	}
+	return hosts
+}
+
+// Results of the hosts missing from the last complete run, marked new,
+// followed by the hosts of that run no longer found, marked disappeared.
+// Disappearances are only reported when the current run is complete too.
+func (h *history) changes(results []datedResult, complete bool) []datedResult {
+	previous := h.lastRunHosts()
+	current := make(map[string]bool, len(results))
+	var changes []datedResult
+	for _, r := range results {
+		current[r.Host] = true
+		if !previous[r.Host] {
+			r.Change = "new"
+			changes = append(changes, r)
+		}
+	}
+	if !complete {
+		return changes
+	}
+
+	var gone []string
+	for host := range previous {
+		if !current[host] {
+			gone = append(gone, host)
+		}
+	}
+	sort.Strings(gone)
+	for _, host := range gone {
+		changes = append(changes, datedResult{Result: Result{Host: host}, InScope: inEngagementScope(host), Change: "disappeared"})
+	}
+	return changes
+}
+
+// Print how many hosts appeared and disappeared since the last run
+func printChangeSummary(changes []datedResult, complete bool) {
+	added := make(map[string]bool)
+	disappeared := 0
+	for _, r := range changes {
+		if r.Change == "disappeared" {
+			disappeared++
+		} else {
+			added[r.Host] = true
+		}
+	}
+	fmt.Printf("Changes since the previous run: %d new, %d disappeared\n", len(added), disappeared)
+	if !complete {
+		fmt.Println("The scan was interrupted, so hosts it did not find are not reported as disappeared")
+	}
+}
+
+// Hosts first seen after a time, sorted
+func (h *history) seenSince(since time.Time) []string {
+	var hosts []string
+	for host, entry := range h.Hosts {
+		if entry.FirstSeen.After(since) {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Record the hosts found in the current run
+func (h *history) update(hosts []string, now time.Time) {
+	for _, host := range hosts {
+		entry, exists := h.Hosts[host]
+		if !exists {
+			entry.FirstSeen = now
+		}
+		entry.LastSeen = now
+		h.Hosts[host] = entry
+	}
+}
+
+// Write the history atomically so an interrupted run cannot corrupt it
+func saveHistory(dir string, h *history) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := historyPath(dir, h.Domain) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, historyPath(dir, h.Domain))
+}
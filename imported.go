@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Hosts reported by an earlier run and loaded with -import; they are treated
+// as already known and neither reported nor counted again
+var importedHosts = make(map[string]struct{})
+
+// Load the hosts of a previous run's output. JSON arrays of hostnames or of
+// objects with a host field are read as such; anything else is read line by
+// line, accepting JSON lines, the "Subdomain found:" stream and plain or
+// formatted lines whose first field is the host.
+func importResults(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var hosts []string
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var entries []json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return 0, err
+		}
+		for _, entry := range entries {
+			hosts = append(hosts, importedHost(entry))
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "{") {
+				hosts = append(hosts, importedHost(json.RawMessage(line)))
+				continue
+			}
+			line = strings.TrimSpace(strings.TrimPrefix(line, "Subdomain found:"))
+			if fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' || r == '\t' }); len(fields) > 0 {
+				hosts = append(hosts, fields[0])
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for _, host := range hosts {
+		// Headers, separators and other non-host lines have no dot
+		if host = scope.NormalizeHost(host); strings.Contains(host, ".") {
+			if _, exists := importedHosts[host]; !exists {
+				importedHosts[host] = struct{}{}
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+// Host of a JSON entry: a bare string or an object with a host field
+func importedHost(entry json.RawMessage) string {
+	var host string
+	if json.Unmarshal(entry, &host) == nil {
+		return host
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(entry, &object) != nil {
+		return ""
+	}
+	for _, key := range []string{"host", "Host", "hostname", "subdomain"} {
+		if value, ok := object[key].(string); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// Report whether a host came from an imported run
+func wasImported(host string) bool {
+	_, exists := importedHosts[scope.NormalizeHost(host)]
+	return exists
+}
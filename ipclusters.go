@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Print the results grouped by address after the list, set by -by-ip
+var clusterByIP bool
+
+// Print every resolved address with the hosts pointing at it, most shared
+// first, so shared hosting, load balancers and stray records stand out
+func printIPClusters(results []datedResult) {
+	hosts := make(map[string][]string)
+	for _, r := range results {
+		for _, ip := range r.IPs {
+			hosts[ip] = append(hosts[ip], r.label())
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+
+	ips := make([]string, 0, len(hosts))
+	for ip := range hosts {
+		ips = append(ips, ip)
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		if len(hosts[ips[i]]) != len(hosts[ips[j]]) {
+			return len(hosts[ips[i]]) > len(hosts[ips[j]])
+		}
+		return ips[i] < ips[j]
+	})
+
+	shared := 0
+	fmt.Println("\n=== Subdomains by IP ===")
+	for _, ip := range ips {
+		names := hosts[ip]
+		sort.Strings(names)
+		if len(names) > 1 {
+			shared++
+		}
+		fmt.Printf("%s (%d hosts): %s\n", ip, len(names), strings.Join(names, ", "))
+	}
+	fmt.Printf("%d unique IPs, %d shared by several hosts\n", len(ips), shared)
+	fmt.Println("==============================")
+}
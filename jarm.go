@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Compute the JARM fingerprint of the HTTPS services found by the probe,
+// set by -jarm
+var computeJARM bool
+
+// The -proxy the handshakes are tunneled through, like the probe's requests
+var jarmProxy *url.URL
+
+// Fingerprint of a server that completed none of the handshakes
+const emptyJARM = "00000000000000000000000000000000000000000000000000000000000000"
+
+// Published fingerprints of well-known stacks
+var knownJARMs = map[string]string{
+	"07d14d16d21d21d07c42d41d00041d24a458a375eef0c576d23a7bab9a9fb1": "Cobalt Strike",
+	"07d14d16d21d21d00042d43d000000aa99ce74e2c6d013c745aa52b5cc042d": "Metasploit",
+}
+
+// One of the ten Client Hellos of JARM
+type jarmProbe struct {
+	version        string // TLS_1.1, TLS_1.2 or TLS_1.3
+	ciphers        string // ALL or NO1.3
+	cipherOrder    string
+	grease         bool
+	rareALPN       bool
+	support        string // 1.2_SUPPORT, 1.3_SUPPORT or NO_SUPPORT
+	extensionOrder string
+}
+
+// The probes, in the order their answers make up the fingerprint
+var jarmProbes = []jarmProbe{
+	{"TLS_1.2", "ALL", "FORWARD", false, false, "1.2_SUPPORT", "REVERSE"},
+	{"TLS_1.2", "ALL", "REVERSE", false, false, "1.2_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "TOP_HALF", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "BOTTOM_HALF", false, true, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.2", "ALL", "MIDDLE_OUT", true, true, "NO_SUPPORT", "REVERSE"},
+	{"TLS_1.1", "ALL", "FORWARD", false, false, "NO_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "FORWARD", false, false, "1.3_SUPPORT", "REVERSE"},
+	{"TLS_1.3", "ALL", "REVERSE", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "NO1.3", "FORWARD", false, false, "1.3_SUPPORT", "FORWARD"},
+	{"TLS_1.3", "ALL", "MIDDLE_OUT", true, false, "1.3_SUPPORT", "REVERSE"},
+}
+
+// Cipher suites offered by the probes; the NO1.3 list leaves out the
+// TLS 1.3 ones
+var jarmCiphers = []uint16{
+	0x0016, 0x0033, 0x0067, 0xc09e, 0xc0a2, 0x009e, 0x0039, 0x006b, 0xc09f, 0xc0a3, 0x009f, 0x0045,
+	0x00be, 0x0088, 0x00c4, 0x009a, 0xc008, 0xc009, 0xc023, 0xc0ac, 0xc0ae, 0xc02b, 0xc00a, 0xc024,
+	0xc0ad, 0xc0af, 0xc02c, 0xc072, 0xc073, 0xcca9, 0x1302, 0x1301, 0xcc14, 0xc007, 0xc012, 0xc013,
+	0xc027, 0xc02f, 0xc014, 0xc028, 0xc030, 0xc060, 0xc061, 0xc076, 0xc077, 0xcca8, 0x1305, 0x1304,
+	0x1303, 0xcc13, 0xc011, 0x000a, 0x002f, 0x003c, 0xc09c, 0xc0a0, 0x009c, 0x0035, 0x003d, 0xc09d,
+	0xc0a1, 0x009d, 0x0041, 0x00ba, 0x0084, 0x00c0, 0x0007, 0x0004, 0x0005,
+}
+
+// Cipher suites in the order used to encode the selected one in the hash
+var jarmCipherIndex = []uint16{
+	0x0004, 0x0005, 0x0007, 0x000a, 0x0016, 0x002f, 0x0033, 0x0035, 0x0039, 0x003c, 0x003d, 0x0041,
+	0x0045, 0x0067, 0x006b, 0x0084, 0x0088, 0x009a, 0x009c, 0x009d, 0x009e, 0x009f, 0x00ba, 0x00be,
+	0x00c0, 0x00c4, 0xc007, 0xc008, 0xc009, 0xc00a, 0xc011, 0xc012, 0xc013, 0xc014, 0xc023, 0xc024,
+	0xc027, 0xc028, 0xc02b, 0xc02c, 0xc02f, 0xc030, 0xc060, 0xc061, 0xc072, 0xc073, 0xc076, 0xc077,
+	0xc09c, 0xc09d, 0xc09e, 0xc09f, 0xc0a0, 0xc0a1, 0xc0a2, 0xc0a3, 0xc0ac, 0xc0ad, 0xc0ae, 0xc0af,
+	0xcc13, 0xcc14, 0xcca8, 0xcca9, 0x1301, 0x1302, 0x1303, 0x1304, 0x1305,
+}
+
+var jarmGrease = []uint16{
+	0x0a0a, 0x1a1a, 0x2a2a, 0x3a3a, 0x4a4a, 0x5a5a, 0x6a6a, 0x7a7a,
+	0x8a8a, 0x9a9a, 0xaaaa, 0xbaba, 0xcaca, 0xdada, 0xeaea, 0xfafa,
+}
+
+// ALPN protocols offered, from weakest to strongest; the rare list leaves
+// out h2 and http/1.1
+var (
+	jarmALPNs     = []string{"http/0.9", "http/1.0", "http/1.1", "spdy/1", "spdy/2", "spdy/3", "h2", "h2c", "hq"}
+	jarmRareALPNs = []string{"http/0.9", "http/1.0", "spdy/1", "spdy/2", "spdy/3", "h2c", "hq"}
+)
+
+// Reorder a list the way JARM does
+func jarmMung[T any](items []T, order string) []T {
+	n := len(items)
+	var out []T
+	switch order {
+	case "REVERSE":
+		for i := n - 1; i >= 0; i-- {
+			out = append(out, items[i])
+		}
+	case "BOTTOM_HALF":
+		if n%2 == 1 {
+			out = append(out, items[n/2+1:]...)
+		} else {
+			out = append(out, items[n/2:]...)
+		}
+	case "TOP_HALF":
+		// The top half in reverse, led by the middle item for odd lengths
+		if n%2 == 1 {
+			out = append(out, items[n/2])
+		}
+		out = append(out, jarmMung(jarmMung(items, "REVERSE"), "BOTTOM_HALF")...)
+	case "MIDDLE_OUT":
+		middle := n / 2
+		if n%2 == 1 {
+			out = append(out, items[middle])
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle+i], items[middle-i])
+			}
+		} else {
+			for i := 1; i <= middle; i++ {
+				out = append(out, items[middle-1+i], items[middle-i])
+			}
+		}
+	default:
+		out = items
+	}
+	return out
+}
+
+func randomGrease() uint16 {
+	var b [1]byte
+	rand.Read(b[:])
+	return jarmGrease[int(b[0])%len(jarmGrease)]
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+// Prefix data with its length in size bytes
+func withLength(data []byte, size int) []byte {
+	var out []byte
+	if size == 1 {
+		out = []byte{byte(len(data))}
+	} else {
+		out = binary.BigEndian.AppendUint16(nil, uint16(len(data)))
+	}
+	return append(out, data...)
+}
+
+// Extensions of a probe's Client Hello
+func jarmExtensions(host string, probe jarmProbe) []byte {
+	var ext []byte
+	if probe.grease {
+		ext = binary.BigEndian.AppendUint16(ext, randomGrease())
+		ext = append(ext, 0, 0)
+	}
+
+	// Server name
+	sni := append([]byte{0}, withLength([]byte(host), 2)...)
+	ext = append(ext, 0x00, 0x00)
+	ext = append(ext, withLength(withLength(sni, 2), 2)...)
+
+	ext = append(ext, 0x00, 0x17, 0x00, 0x00)                                                             // Extended master secret
+	ext = append(ext, 0x00, 0x01, 0x00, 0x01, 0x01)                                                       // Max fragment length
+	ext = append(ext, 0xff, 0x01, 0x00, 0x01, 0x00)                                                       // Renegotiation info
+	ext = append(ext, 0x00, 0x0a, 0x00, 0x0a, 0x00, 0x08, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18, 0x00, 0x19) // Supported groups
+	ext = append(ext, 0x00, 0x0b, 0x00, 0x02, 0x01, 0x00)                                                 // EC point formats
+	ext = append(ext, 0x00, 0x23, 0x00, 0x00)                                                             // Session ticket
+
+	alpns := jarmALPNs
+	if probe.rareALPN {
+		alpns = jarmRareALPNs
+	}
+	var protocols []byte
+	for _, alpn := range jarmMung(alpns, probe.extensionOrder) {
+		protocols = append(protocols, withLength([]byte(alpn), 1)...)
+	}
+	ext = append(ext, 0x00, 0x10)
+	ext = append(ext, withLength(withLength(protocols, 2), 2)...)
+
+	ext = append(ext, 0x00, 0x0d, 0x00, 0x14, 0x00, 0x12, 0x04, 0x03, 0x08, 0x04, 0x04, 0x01,
+		0x05, 0x03, 0x08, 0x05, 0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01) // Signature algorithms
+
+	// Key share
+	var share []byte
+	if probe.grease {
+		share = binary.BigEndian.AppendUint16(share, randomGrease())
+		share = append(share, 0x00, 0x01, 0x00)
+	}
+	share = append(share, 0x00, 0x1d, 0x00, 0x20)
+	share = append(share, randomBytes(32)...)
+	ext = append(ext, 0x00, 0x33)
+	ext = append(ext, withLength(withLength(share, 2), 2)...)
+
+	ext = append(ext, 0x00, 0x2d, 0x00, 0x02, 0x01, 0x01) // PSK key exchange modes
+
+	if probe.version == "TLS_1.3" || probe.support == "1.2_SUPPORT" {
+		versions := []uint16{0x0301, 0x0302, 0x0303}
+		if probe.support != "1.2_SUPPORT" {
+			versions = append(versions, 0x0304)
+		}
+		var list []byte
+		if probe.grease {
+			list = binary.BigEndian.AppendUint16(list, randomGrease())
+		}
+		for _, version := range jarmMung(versions, probe.extensionOrder) {
+			list = binary.BigEndian.AppendUint16(list, version)
+		}
+		ext = append(ext, 0x00, 0x2b)
+		ext = append(ext, withLength(withLength(list, 1), 2)...)
+	}
+	return withLength(ext, 2)
+}
+
+// Client Hello record of a probe
+func jarmClientHello(host string, probe jarmProbe) []byte {
+	record, hello := []byte{0x16, 0x03, 0x03}, []byte{0x03, 0x03}
+	switch probe.version {
+	case "TLS_1.3":
+		record = []byte{0x16, 0x03, 0x01}
+	case "TLS_1.1":
+		record, hello = []byte{0x16, 0x03, 0x02}, []byte{0x03, 0x02}
+	}
+	hello = append(hello, randomBytes(32)...)
+	hello = append(hello, withLength(randomBytes(32), 1)...)
+
+	var suites []uint16
+	for _, cipher := range jarmCiphers {
+		if probe.ciphers == "NO1.3" && cipher>>8 == 0x13 {
+			continue
+		}
+		suites = append(suites, cipher)
+	}
+	suites = jarmMung(suites, probe.cipherOrder)
+	if probe.grease {
+		suites = append([]uint16{randomGrease()}, suites...)
+	}
+	var cipherBytes []byte
+	for _, cipher := range suites {
+		cipherBytes = binary.BigEndian.AppendUint16(cipherBytes, cipher)
+	}
+	hello = append(hello, withLength(cipherBytes, 2)...)
+	hello = append(hello, 0x01, 0x00) // One compression method: null
+	hello = append(hello, jarmExtensions(host, probe)...)
+
+	handshake := append([]byte{0x01, 0x00}, withLength(hello, 2)...)
+	return append(record, withLength(handshake, 2)...)
+}
+
+// Send a probe and read the first bytes of the answer
+func sendJARMProbe(addr, host string, probe jarmProbe) []byte {
+	var conn net.Conn
+	var err error
+	if jarmProxy != nil {
+		conn, err = dialProxyTunnel(jarmProxy, addr, requestTimeout)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, requestTimeout)
+	}
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+	if _, err := conn.Write(jarmClientHello(host, probe)); err != nil {
+		return nil
+	}
+	buf := make([]byte, 1484)
+	n, err := io.ReadAtLeast(conn, buf, 1)
+	if err != nil && n == 0 {
+		return nil
+	}
+	return buf[:n]
+}
+
+// Summary of a Server Hello: cipher|version|alpn|extensions, all empty for
+// anything but a Server Hello
+func readJARMAnswer(data []byte) string {
+	if len(data) < 44 || data[0] != 0x16 || data[5] != 0x02 {
+		return "|||"
+	}
+	helloLength := int(binary.BigEndian.Uint16(data[3:5]))
+	counter := int(data[43])
+	if len(data) < counter+46 {
+		return "|||"
+	}
+	cipher := hex.EncodeToString(data[counter+44 : counter+46])
+	version := hex.EncodeToString(data[9:11])
+	extensions, ok := readJARMExtensions(data, counter, helloLength)
+	if !ok {
+		return "|||"
+	}
+	return cipher + "|" + version + "|" + extensions
+}
+
+// ALPN and extension types of a Server Hello, as alpn|type-type-...
+func readJARMExtensions(data []byte, counter, helloLength int) (string, bool) {
+	if len(data) <= counter+47 {
+		return "", false
+	}
+	if data[counter+47] == 11 {
+		return "|", true
+	}
+	if len(data) >= counter+53 && string(data[counter+50:counter+53]) == "\x0e\xac\x0b" || len(data) >= 85 && string(data[82:85]) == "\x0f\xf0\x0b" {
+		return "|", true
+	}
+	if counter+42 >= helloLength {
+		return "|", true
+	}
+	if len(data) < counter+49 {
+		return "", false
+	}
+
+	count := counter + 49
+	maximum := int(binary.BigEndian.Uint16(data[counter+47:counter+49])) + count - 1
+	var types []string
+	alpn := ""
+	for count < maximum {
+		if len(data) < count+4 {
+			return "|", true
+		}
+		extType := data[count : count+2]
+		length := int(binary.BigEndian.Uint16(data[count+2 : count+4]))
+		end := min(count+4+length, len(data))
+		value := data[count+4 : end]
+		types = append(types, hex.EncodeToString(extType))
+		if extType[0] == 0x00 && extType[1] == 0x10 && alpn == "" && len(value) > 3 {
+			alpn = string(value[3:])
+		}
+		count += length + 4
+	}
+	return alpn + "|" + strings.Join(types, "-"), true
+}
+
+// Two hex digits for the cipher a server selected
+func jarmCipherByte(cipher string) string {
+	if cipher == "" {
+		return "00"
+	}
+	count := 1
+	for _, c := range jarmCipherIndex {
+		if fmt.Sprintf("%04x", c) == cipher {
+			break
+		}
+		count++
+	}
+	return fmt.Sprintf("%02x", count)
+}
+
+// One letter for the TLS version a server selected
+func jarmVersionByte(version string) string {
+	if len(version) < 4 {
+		return "0"
+	}
+	minor, err := strconv.Atoi(version[3:4])
+	if err != nil || minor > 5 {
+		return "0"
+	}
+	return string("abcdef"[minor])
+}
+
+// Hash the ten answers into the 62-character fingerprint: cipher and
+// version of each answer, then a truncated SHA-256 of the ALPNs and
+// extensions
+func jarmHash(answers []string) string {
+	var fuzzy, rest strings.Builder
+	empty := true
+	for _, answer := range answers {
+		parts := strings.SplitN(answer, "|", 4)
+		for len(parts) < 4 {
+			parts = append(parts, "")
+		}
+		if answer != "|||" {
+			empty = false
+		}
+		fuzzy.WriteString(jarmCipherByte(parts[0]))
+		fuzzy.WriteString(jarmVersionByte(parts[1]))
+		rest.WriteString(parts[2])
+		rest.WriteString(parts[3])
+	}
+	if empty {
+		return emptyJARM
+	}
+	sum := sha256.Sum256([]byte(rest.String()))
+	return fuzzy.String() + hex.EncodeToString(sum[:])[:32]
+}
+
+// JARM fingerprint of the TLS server at addr, sending host as the SNI
+func jarmFingerprint(addr, host string) string {
+	answers := make([]string, len(jarmProbes))
+	for i, probe := range jarmProbes {
+		answers[i] = readJARMAnswer(sendJARMProbe(addr, host, probe))
+	}
+	return jarmHash(answers)
+}
+
+// Print the fingerprints shared by several hosts and the ones matching a
+// known stack
+func reportJARMClusters(results []datedResult) {
+	hosts := make(map[string]map[string]struct{})
+	for _, r := range results {
+		for _, service := range r.Probes {
+			if service.JARM == "" || service.JARM == emptyJARM {
+				continue
+			}
+			if hosts[service.JARM] == nil {
+				hosts[service.JARM] = make(map[string]struct{})
+			}
+			hosts[service.JARM][r.Host] = struct{}{}
+		}
+	}
+	fingerprints := make([]string, 0, len(hosts))
+	for fingerprint := range hosts {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Strings(fingerprints)
+	for _, fingerprint := range fingerprints {
+		names := make([]string, 0, len(hosts[fingerprint]))
+		for host := range hosts[fingerprint] {
+			names = append(names, host)
+		}
+		sort.Strings(names)
+		if stack, known := knownJARMs[fingerprint]; known {
+			fmt.Printf("JARM %s matches %s: %s\n", fingerprint, stack, strings.Join(names, ", "))
+		} else if len(names) > 1 {
+			fmt.Printf("JARM %s shared by %d hosts: %s\n", fingerprint, len(names), strings.Join(names, ", "))
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Job as kept in the -jobs-dir directory, together with its results
+type storedJob struct {
+	job
+	Found []datedResult `json:"found"`
+}
+
+// File holding a job in the jobs directory
+func jobPath(dir, id string) string {
+	return filepath.Join(dir, id+".json")
+}
+
+// Load the jobs kept by a previous server, in submission order
+func loadJobs(dir string) ([]*job, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []*job
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var stored storedJob
+		if err := json.Unmarshal(data, &stored); err != nil || stored.ID == "" {
+			fmt.Println("Ignoring unreadable job file", entry.Name())
+			continue
+		}
+		j := stored.job
+		j.results = stored.Found
+		jobs = append(jobs, &j)
+	}
+	sort.SliceStable(jobs, func(a, b int) bool { return jobs[a].Created.Before(jobs[b].Created) })
+	return jobs, nil
+}
+
+// Write a job atomically to the jobs directory, when there is one. The
+// caller holds s.mu. Streaming jobs end with their call and are not kept.
+func (s *jobServer) saveJob(j *job) {
+	if s.jobsDir == "" || j.live != nil {
+		return
+	}
+	data, err := json.Marshal(storedJob{job: *j, Found: j.results})
+	if err == nil {
+		err = os.MkdirAll(s.jobsDir, 0o755)
+	}
+	path := jobPath(s.jobsDir, j.ID)
+	if err == nil {
+		err = os.WriteFile(path+".tmp", data, 0o644)
+	}
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		fmt.Println("Error saving job:", err)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// API keys of one provider, handed out in turn so the requests of a run
+// spread across accounts
+type keyRing struct {
+	mu   sync.Mutex
+	keys []string
+	next int
+}
+
+// Return the key for the next request
+func (r *keyRing) take() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := r.keys[r.next%len(r.keys)]
+	r.next++
+	return key
+}
+
+// Key rings by source name, built from the environment and -provider-config
+var providerKeys = make(map[string]*keyRing)
+
+// Variables holding the key of each provider. They keep the first key of the
+// ring, so the checks for a configured source work unchanged.
+var providerKeyVars = map[string]*string{
+	"securitytrails": &apiKeySecurityTrails,
+	"shodan":         &apiKeyShodan,
+	"virustotal":     &apiKeyVirusTotal,
+	"leakix":         &apiKeyLeakIX,
+	"zoomeye":        &apiKeyZoomEye,
+	"hunterhow":      &apiKeyHunterHow,
+	"intelx":         &apiKeyIntelX,
+	"whoisxml":       &apiKeyWhoisXML,
+	"quake":          &apiKeyQuake,
+	"bevigil":        &apiKeyBeVigil,
+	"dnsrepo":        &apiKeyDNSRepo,
+}
+
+// Providers whose credential is a pair, written as "user:key" in the
+// provider file
+var providerKeyPairs = map[string][2]*string{
+	"fofa":         {&fofaEmail, &apiKeyFofa},
+	"passivetotal": {&passiveTotalUsername, &apiKeyPassiveTotal},
+}
+
+// Provider file read when -provider-config is not given, if it exists
+func defaultProviderConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "leviathanmapper", "provider-config.yaml")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// Build the key rings from the environment variables and the provider file,
+// which lists several keys per source:
+//
+//	securitytrails:
+//	  - KEY1
+//	  - KEY2
+//	fofa: [user@example.com:KEY]
+func loadProviderKeys(path string) error {
+	listed := make(map[string][]string)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if data, err = configToJSON(path, data); err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &listed); err != nil {
+			return err
+		}
+	}
+
+	for source := range listed {
+		_, single := providerKeyVars[source]
+		_, pair := providerKeyPairs[source]
+		if !single && !pair {
+			return fmt.Errorf("unknown provider %q", source)
+		}
+	}
+
+	for source, variable := range providerKeyVars {
+		var keys []string
+		if *variable != "" {
+			keys = append(keys, *variable)
+		}
+		if ring := addKeyRing(source, append(keys, listed[source]...)); ring != nil {
+			*variable = ring.keys[0]
+		}
+	}
+	for source, variables := range providerKeyPairs {
+		var keys []string
+		if *variables[0] != "" && *variables[1] != "" {
+			keys = append(keys, *variables[0]+":"+*variables[1])
+		}
+		for _, key := range listed[source] {
+			if !strings.Contains(key, ":") {
+				return fmt.Errorf("%s keys must be written as user:key", source)
+			}
+			keys = append(keys, key)
+		}
+		if ring := addKeyRing(source, keys); ring != nil {
+			*variables[0], *variables[1], _ = strings.Cut(ring.keys[0], ":")
+		}
+	}
+	return nil
+}
+
+// Register the unique non-empty keys of a source
+func addKeyRing(source string, keys []string) *keyRing {
+	var unique []string
+	seen := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		if _, exists := seen[key]; exists || key == "" {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, key)
+	}
+	if len(unique) == 0 {
+		return nil
+	}
+	ring := &keyRing{keys: unique}
+	providerKeys[source] = ring
+	return ring
+}
+
+// Key of a source for the next request, in round-robin order
+func nextKey(source string) string {
+	if ring, ok := providerKeys[source]; ok {
+		return ring.take()
+	}
+	return ""
+}
+
+// Fetch with the next key of the source. A key answered with 429 Too Many
+// Requests is skipped in favour of the following one until every key has
+// been tried.
+func fetchWithKeys(source string, build func(key string) *http.Request) (*http.Response, error) {
+	ring, ok := providerKeys[source]
+	if !ok {
+		return fetchWithRetries(build(""))
+	}
+	if len(ring.keys) == 1 {
+		return fetchWithRetries(build(ring.take()))
+	}
+
+	var err error
+	for range ring.keys {
+		var resp *http.Response
+		resp, err = doWithRetries(build(ring.take()), true)
+		var statusErr statusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusTooManyRequests {
+			fmt.Printf("%s key rate limited, trying the next one\n", source)
+			continue
+		}
+		return resp, err
+	}
+	return nil, err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Mine the SPF, DMARC and MX records of the target, set by -mail
+var mineMailRecords bool
+
+// Most SPF includes and redirects followed, the DNS lookup limit of RFC 7208
+const spfLookupLimit = 10
+
+// Mail and SaaS providers by the suffix of the hosts they have customers
+// name in SPF, DMARC and MX records
+var mailProviders = []struct {
+	suffix, provider string
+}{
+	{"_spf.google.com", "Google Workspace"},
+	{"google.com", "Google Workspace"},
+	{"googlemail.com", "Google Workspace"},
+	{"protection.outlook.com", "Microsoft 365"},
+	{"outlook.com", "Microsoft 365"},
+	{"amazonses.com", "Amazon SES"},
+	{"sendgrid.net", "SendGrid"},
+	{"mailgun.org", "Mailgun"},
+	{"mcsv.net", "Mailchimp"},
+	{"mandrillapp.com", "Mandrill"},
+	{"mtasv.net", "Postmark"},
+	{"sparkpostmail.com", "SparkPost"},
+	{"salesforce.com", "Salesforce"},
+	{"exacttarget.com", "Salesforce Marketing Cloud"},
+	{"mktomail.com", "Marketo"},
+	{"hubspotemail.net", "HubSpot"},
+	{"zendesk.com", "Zendesk"},
+	{"freshdesk.com", "Freshdesk"},
+	{"atlassian.net", "Atlassian"},
+	{"zoho.com", "Zoho Mail"},
+	{"zoho.eu", "Zoho Mail"},
+	{"pphosted.com", "Proofpoint"},
+	{"mimecast.com", "Mimecast"},
+	{"messagelabs.com", "Broadcom Email Security"},
+	{"barracudanetworks.com", "Barracuda"},
+	{"iphmx.com", "Cisco Secure Email"},
+	{"mailcontrol.com", "Forcepoint"},
+	{"secureserver.net", "GoDaddy"},
+	{"ovh.net", "OVH"},
+	{"dmarcian.com", "dmarcian"},
+	{"agari.com", "Agari"},
+	{"valimail.com", "Valimail"},
+	{"ondmarc.com", "Red Sift OnDMARC"},
+	{"easydmarc.us", "EasyDMARC"},
+	{"easydmarc.eu", "EasyDMARC"},
+	{"uriports.com", "URIports"},
+	{"dmarc.postmarkapp.com", "Postmark"},
+}
+
+// Provider behind a mail host, empty for none
+func mailProvider(host string) string {
+	for _, known := range mailProviders {
+		if host == known.suffix || strings.HasSuffix(host, "."+known.suffix) {
+			return known.provider
+		}
+	}
+	return ""
+}
+
+// What the mail records of a domain reference
+type mailFinding struct {
+	kind  string // MX, SPF include, SPF ip4, DMARC rua...
+	value string
+}
+
+// The SPF policy of a name, empty when it publishes none
+func spfRecord(name string) string {
+	for _, txt := range lookupRecords(name, dnsTypeTXT) {
+		if strings.HasPrefix(strings.ToLower(txt), "v=spf1") {
+			return txt
+		}
+	}
+	return ""
+}
+
+// Walk the SPF policy of the domain and the policies it includes or
+// redirects to, up to spfLookupLimit of them
+func mineSPF(domain string) []mailFinding {
+	var findings []mailFinding
+	queue := []string{domain}
+	visited := map[string]bool{domain: true}
+	for lookups := 0; len(queue) > 0 && lookups <= spfLookupLimit; lookups++ {
+		name := queue[0]
+		queue = queue[1:]
+		terms := strings.Fields(spfRecord(name))
+		if len(terms) == 0 {
+			continue
+		}
+		for _, term := range terms[1:] {
+			term = strings.TrimLeft(strings.ToLower(term), "+-~?")
+			mechanism, value, found := strings.Cut(term, ":")
+			if !found {
+				mechanism, value, found = strings.Cut(term, "=")
+			}
+			if !found {
+				continue
+			}
+			switch mechanism {
+			case "include", "redirect":
+				findings = append(findings, mailFinding{"SPF " + mechanism, value})
+				if !visited[value] {
+					visited[value] = true
+					queue = append(queue, value)
+				}
+			case "a", "mx", "exists", "ip4", "ip6":
+				findings = append(findings, mailFinding{"SPF " + mechanism, value})
+			}
+		}
+	}
+	return findings
+}
+
+// Report destinations of the DMARC policy of the domain
+func mineDMARC(domain string) []mailFinding {
+	var findings []mailFinding
+	for _, txt := range lookupRecords("_dmarc."+domain, dnsTypeTXT) {
+		if !strings.HasPrefix(strings.ToLower(txt), "v=dmarc1") {
+			continue
+		}
+		for _, tag := range strings.Split(txt, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(tag), "=")
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key != "rua" && key != "ruf" {
+				continue
+			}
+			for _, uri := range strings.Split(value, ",") {
+				address := strings.TrimPrefix(strings.TrimSpace(uri), "mailto:")
+				// A size limit may follow the address, as in "!10m"
+				address, _, _ = strings.Cut(address, "!")
+				findings = append(findings, mailFinding{"DMARC " + key, address})
+			}
+		}
+	}
+	return findings
+}
+
+// Host a finding points at: the domain of an address, the host of a
+// mechanism, nothing for IP ranges and macros
+func findingHost(f mailFinding) string {
+	if f.kind == "SPF ip4" || f.kind == "SPF ip6" || strings.Contains(f.value, "%{") {
+		return ""
+	}
+	host := f.value
+	if _, after, found := strings.Cut(host, "@"); found {
+		host = after
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return scope.NormalizeHost(host)
+}
+
+// Mine the MX hosts, the SPF policy and the DMARC report destinations of
+// the target: print the third-party providers they reveal and add the
+// in-scope hostnames they mention as results
+func mineMailInfrastructure(domain string) {
+	var findings []mailFinding
+	for _, mx := range lookupRecords(domain, dnsTypeMX) {
+		if fields := strings.Fields(mx); len(fields) == 2 {
+			findings = append(findings, mailFinding{"MX", strings.TrimSuffix(fields[1], ".")})
+		}
+	}
+	findings = append(findings, mineSPF(domain)...)
+	findings = append(findings, mineDMARC(domain)...)
+	if len(findings) == 0 {
+		return
+	}
+
+	providers := make(map[string]struct{})
+	fmt.Println("Mail infrastructure of", domain+":")
+	for _, f := range findings {
+		line := fmt.Sprintf("    %s %s", f.kind, f.value)
+		host := findingHost(f)
+		if provider := mailProvider(host); provider != "" {
+			providers[provider] = struct{}{}
+			line += " (" + provider + ")"
+		}
+		fmt.Println(line)
+		if host != "" && host != domain && scope.IsInScope(host, domain) {
+			addSubdomain("mail", host)
+		}
+	}
+	if len(providers) > 0 {
+		names := make([]string, 0, len(providers))
+		for provider := range providers {
+			names = append(names, provider)
+		}
+		sort.Strings(names)
+		fmt.Println("Mail providers:", strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Candidates handed to each massdns run by the brute-force stage
+const massDNSBatch = 100000
+
+// Path of the massdns binary that resolves in place of the native resolver,
+// empty to resolve natively
+var massDNSPath string
+
+// Record types read from the massdns answers
+var massDNSTypes = map[string]uint16{"A": dnsTypeA, "CNAME": dnsTypeCNAME}
+
+// One answer line of massdns -o J
+type massDNSAnswer struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Resolver string `json:"resolver"`
+	Data     struct {
+		Answers []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			TTL  uint32 `json:"ttl"`
+			Data string `json:"data"`
+		} `json:"answers"`
+	} `json:"data"`
+}
+
+// Check that the resolver pool can be handed to massdns, which only speaks
+// plain DNS
+func checkMassDNSResolvers() error {
+	for _, server := range resolvers {
+		if isDoHResolver(server) || isDoTResolver(server) {
+			return fmt.Errorf("massdns cannot use the resolver %s", server)
+		}
+	}
+	return nil
+}
+
+// Resolve the A records of hosts with massdns across the resolver pool
+func resolveWithMassDNS(ctx context.Context, hosts []string) (map[string]resolution, error) {
+	dir, err := os.MkdirTemp("", "leviathanmapper-massdns")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var servers []string
+	for _, server := range resolvers {
+		if host, port, err := net.SplitHostPort(server); err == nil && port == "53" {
+			server = host
+		}
+		servers = append(servers, server)
+	}
+	resolversFile := dir + "/resolvers.txt"
+	namesFile := dir + "/names.txt"
+	outputFile := dir + "/answers.json"
+	if err := os.WriteFile(resolversFile, []byte(strings.Join(servers, "\n")+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(namesFile, []byte(strings.Join(hosts, "\n")+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, massDNSPath, "-q", "-r", resolversFile, "-t", "A", "-o", "J", "-w", outputFile, namesFile)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("massdns failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return readMassDNSAnswers(outputFile)
+}
+
+// Read the JSON lines written by massdns into resolutions
+func readMassDNSAnswers(path string) (map[string]resolution, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	resolved := make(map[string]resolution)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line massDNSAnswer
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			continue
+		}
+		host := strings.ToLower(strings.TrimSuffix(line.Name, "."))
+		// A name retried on several resolvers may appear more than once;
+		// an answer with addresses wins
+		if len(resolved[host].Addresses) > 0 {
+			continue
+		}
+
+		var records []dnsRecord
+		for _, answer := range line.Data.Answers {
+			rtype, ok := massDNSTypes[answer.Type]
+			if !ok {
+				continue
+			}
+			records = append(records, dnsRecord{
+				Name: strings.ToLower(strings.TrimSuffix(answer.Name, ".")),
+				Type: rtype,
+				TTL:  answer.TTL,
+				Data: strings.ToLower(strings.TrimSuffix(answer.Data, ".")),
+			})
+		}
+
+		answer := resolution{Resolver: line.Resolver, NXDomain: line.Status == "NXDOMAIN"}
+		chain, target := followCNAMEs(host, records)
+		answer.CNAMEs = chain
+		for _, record := range records {
+			answer.Answers = append(answer.Answers, dnsAnswer{record.Name, dnsTypeName(record.Type), record.Data, record.TTL})
+			if record.Type == dnsTypeA && record.Name == target {
+				answer.Addresses = append(answer.Addresses, record.Data)
+			}
+		}
+		resolved[host] = answer
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		return nil, errors.New("massdns wrote no answers")
+	}
+	return resolved, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory of canned responses the sources read instead of the network,
+// set by -mock
+var mockDir string
+
+// Transport answering every request from a fixture of mockDir, so the
+// pipeline runs deterministically offline. The fixture of a request is
+// <host>/<path and query>, with the characters that cannot appear in file
+// names replaced by _, or <host>/<path> when there is none for the query.
+// It holds the body of a 200 response, or a whole response starting with
+// its status line to test other status codes and headers.
+type mockTransport struct {
+	dir string
+}
+
+func (t mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	name := fixtureName(req.URL, true)
+	data, err := os.ReadFile(filepath.Join(t.dir, name))
+	if os.IsNotExist(err) && req.URL.RawQuery != "" {
+		data, err = os.ReadFile(filepath.Join(t.dir, fixtureName(req.URL, false)))
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no fixture %s", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("HTTP/")) {
+		return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// Fixture file of a URL, relative to the mock directory
+func fixtureName(u *url.URL, withQuery bool) string {
+	name := strings.TrimPrefix(u.EscapedPath(), "/")
+	if withQuery && u.RawQuery != "" {
+		name += "?" + u.RawQuery
+	}
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune(".-=&%,+", r):
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" || name == "." || name == ".." {
+		name = "index"
+	}
+	return filepath.Join(strings.ToLower(u.Hostname()), name)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Arguments of main when the test binary runs it in a child process,
+// separated by newlines
+const mainArgsEnv = "LEVIATHANMAPPER_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if args, ok := os.LookupEnv(mainArgsEnv); ok {
+		os.Args = append([]string{"leviathanmapper"}, strings.Split(args, "\n")...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// Run main in a child process with a clean environment and home directory,
+// so no API key, config file or checkpoint of the user is picked up, and
+// answer the sources from testdata/fixtures
+func runMock(t *testing.T, args ...string) (stdout, stderr string) {
+	t.Helper()
+	fixtures, err := filepath.Abs("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := t.TempDir()
+	args = append([]string{"-mock", fixtures, "-domain", "example.com", "-sources", "crtsh,wayback,subdomaincenter,threatminer"}, args...)
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = home
+	cmd.Env = []string{
+		mainArgsEnv + "=" + strings.Join(args, "\n"),
+		"HOME=" + home,
+		"XDG_CACHE_HOME=" + filepath.Join(home, "cache"),
+		"XDG_CONFIG_HOME=" + filepath.Join(home, "config"),
+		"PATH=" + os.Getenv("PATH"),
+	}
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v: %v\nstdout:\n%s\nstderr:\n%s", args, err, out.String(), errOut.String())
+	}
+	return out.String(), errOut.String()
+}
+
+// Non-empty lines of an output, sorted
+func sortedLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestMockPipeline(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			// Hosts reported by several sources appear once; the wildcard
+			// and the name outside the target are dropped
+			name: "dedupe",
+			args: []string{"-format", "{{.Host}}"},
+			want: []string{"a.example.com", "api.example.com", "dev.example.com", "mail.example.com", "www.example.com"},
+		},
+		{
+			name: "exclude",
+			args: []string{"-format", "{{.Host}}", "-exclude", "dev.*,www.*"},
+			want: []string{"a.example.com", "api.example.com", "mail.example.com"},
+		},
+		{
+			name: "include regex",
+			args: []string{"-format", "{{.Host}}", "-include-regex", "^(a|mail)\\."},
+			want: []string{"a.example.com", "mail.example.com"},
+		},
+		{
+			name: "format fields",
+			args: []string{"-format", "{{.Host}} {{.InScope}} {{.FirstSeen.Year}}", "-include", "a.*,dev.*"},
+			want: []string{"a.example.com true 2020", "dev.example.com true 2021"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, _ := runMock(t, tt.args...)
+			if got := sortedLines(stdout); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMockScope(t *testing.T) {
+	scopeFile := filepath.Join(t.TempDir(), "scope.txt")
+	if err := os.WriteFile(scopeFile, []byte("*.example.com\n!mail.example.com\n!dev.example.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, _ := runMock(t, "-scope", scopeFile, "-format", "{{.Host}} {{.InScope}}")
+	want := []string{"a.example.com true", "api.example.com true", "dev.example.com false", "mail.example.com false", "www.example.com true"}
+	if got := sortedLines(stdout); !reflect.DeepEqual(got, want) {
+		t.Errorf("tagged: got %q, want %q", got, want)
+	}
+
+	stdout, _ = runMock(t, "-scope", scopeFile, "-scope-only", "-format", "{{.Host}}")
+	want = []string{"a.example.com", "api.example.com", "www.example.com"}
+	if got := sortedLines(stdout); !reflect.DeepEqual(got, want) {
+		t.Errorf("scope-only: got %q, want %q", got, want)
+	}
+}
+
+func TestMockRefusesNetworkStages(t *testing.T) {
+	fixtures, _ := filepath.Abs("testdata/fixtures")
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = t.TempDir()
+	cmd.Env = []string{mainArgsEnv + "=" + strings.Join([]string{"-mock", fixtures, "-domain", "example.com", "-resolve", "-crtsh-db"}, "\n"), "HOME=" + cmd.Dir}
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected -mock with -resolve and -crtsh-db to fail, got:\n%s", output)
+	}
+	if !strings.Contains(string(output), "-crtsh-db, -resolve") {
+		t.Errorf("error does not name the options: %s", output)
+	}
+}
+
+func TestMockJSONLines(t *testing.T) {
+	stdout, stderr := runMock(t, "-json")
+	if !strings.Contains(stderr, "Ignoring subdomain with wildcard") {
+		t.Errorf("diagnostics missing from stderr:\n%s", stderr)
+	}
+	var hosts []string
+	for i, line := range strings.Split(strings.TrimSuffix(stdout, "\n"), "\n") {
+		var r datedResult
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("line %d is not a JSON result: %q: %v", i+1, line, err)
+		}
+		hosts = append(hosts, r.Host)
+	}
+	sort.Strings(hosts)
+	want := []string{"a.example.com", "api.example.com", "dev.example.com", "mail.example.com", "www.example.com"}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got %q, want %q", hosts, want)
+	}
+}
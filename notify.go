@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	slackWebhookURL   = os.Getenv("SLACK_WEBHOOK_URL")
+	discordWebhookURL = os.Getenv("DISCORD_WEBHOOK_URL")
+	telegramBotToken  = os.Getenv("TELEGRAM_BOT_TOKEN")
+	telegramChatID    = os.Getenv("TELEGRAM_CHAT_ID")
+)
+
+// Messages sent when a target finishes and when -history finds hosts never
+// seen before, unless the config file replaces them
+const (
+	defaultCompleteTemplate = `LeviathanMapper finished {{.Domain}}{{if .Interrupted}} (interrupted){{end}}: {{.Total}} hosts{{with .New}}, {{len .}} new{{end}} in {{.Duration}}`
+	defaultNewTemplate      = `{{len .New}} new subdomains of {{.Domain}}:{{range .New}}
+{{.}}{{end}}`
+)
+
+// Data available to the notification templates
+type notification struct {
+	Domain      string
+	Total       int           // Hosts found in the run
+	Hosts       []string      // Those hosts, sorted
+	New         []string      // Hosts never seen in previous runs, empty without -history
+	Interrupted bool          // The run was stopped with Ctrl-C
+	Duration    time.Duration // Time the target took
+	Since       time.Time     // Previous digest, only set for -email-digest
+}
+
+// Whether a host is one of the new ones
+func (n notification) IsNew(host string) bool {
+	i := sort.SearchStrings(n.New, host)
+	return i < len(n.New) && n.New[i] == host
+}
+
+// A chat service notifications are posted to
+type notifier struct {
+	name string
+	// Longest message the service accepts
+	limit int
+	post  func(ctx context.Context, text string) error
+}
+
+// Notifiers selected with -notify and the templates of their messages
+var (
+	notifiers        []notifier
+	completeTemplate *template.Template
+	newTemplate      *template.Template
+)
+
+// Set up the channels of a -notify list, e.g. "slack,telegram", failing
+// for unknown ones and for those whose variables are not set
+func setupNotifiers(list string, cfg notifyConfig) error {
+	for _, name := range strings.Split(list, ",") {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "slack":
+			if slackWebhookURL == "" {
+				return fmt.Errorf("slack notifications require SLACK_WEBHOOK_URL")
+			}
+			notifiers = append(notifiers, notifier{name: name, limit: 40000, post: func(ctx context.Context, text string) error {
+				return postWebhook(ctx, slackWebhookURL, map[string]string{"text": text})
+			}})
+		case "discord":
+			if discordWebhookURL == "" {
+				return fmt.Errorf("discord notifications require DISCORD_WEBHOOK_URL")
+			}
+			notifiers = append(notifiers, notifier{name: name, limit: 2000, post: func(ctx context.Context, text string) error {
+				return postWebhook(ctx, discordWebhookURL, map[string]string{"content": text})
+			}})
+		case "email":
+			if err := setupEmail(cfg); err != nil {
+				return err
+			}
+		case "telegram":
+			if telegramBotToken == "" || telegramChatID == "" {
+				return fmt.Errorf("telegram notifications require TELEGRAM_BOT_TOKEN and TELEGRAM_CHAT_ID")
+			}
+			notifiers = append(notifiers, notifier{name: name, limit: 4096, post: func(ctx context.Context, text string) error {
+				endpoint := "https://api.telegram.org/bot" + telegramBotToken + "/sendMessage"
+				return postWebhook(ctx, endpoint, map[string]string{"chat_id": telegramChatID, "text": text})
+			}})
+		default:
+			return fmt.Errorf("unknown notification channel %q (use slack, discord, telegram or email)", name)
+		}
+	}
+
+	complete, newHosts := cfg.CompleteTemplate, cfg.NewTemplate
+	if complete == "" {
+		complete = defaultCompleteTemplate
+	}
+	if newHosts == "" {
+		newHosts = defaultNewTemplate
+	}
+	var err error
+	if completeTemplate, err = template.New("complete").Funcs(template.FuncMap{"join": strings.Join}).Parse(complete); err != nil {
+		return fmt.Errorf("invalid complete_template: %v", err)
+	}
+	if newTemplate, err = template.New("new").Funcs(template.FuncMap{"join": strings.Join}).Parse(newHosts); err != nil {
+		return fmt.Errorf("invalid new_template: %v", err)
+	}
+	return nil
+}
+
+// Post a JSON message; webhooks answer 200 or 204 on success
+func postWebhook(ctx context.Context, endpoint string, message map[string]string) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// The URL holds the webhook secret or the bot token
+		return urlErr.Err
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return statusError{code: resp.StatusCode}
+	}
+	return nil
+}
+
+// Send the completion message of a target and, when it found hosts never
+// seen before, the new-subdomain message; email gets a single message with
+// the results unless digests replace it. An interrupted scan is still
+// reported, so the requests do not use its cancelled context.
+func sendNotifications(ctx context.Context, n notification) {
+	ctx = context.WithoutCancel(ctx)
+	if emailNotifications && emailDigest == 0 {
+		if err := sendTemplatedEmail(ctx, emailTemplate, n); err != nil {
+			fmt.Println("Error sending email notification:", err)
+		}
+	}
+	if len(notifiers) == 0 {
+		return
+	}
+
+	messages := []*template.Template{completeTemplate}
+	if len(n.New) > 0 {
+		messages = append(messages, newTemplate)
+	}
+	for _, message := range messages {
+		var text strings.Builder
+		if err := message.Execute(&text, n); err != nil {
+			fmt.Println("Error formatting notification:", err)
+			continue
+		}
+		for _, channel := range notifiers {
+			if err := channel.post(ctx, truncateMessage(text.String(), channel.limit)); err != nil {
+				fmt.Printf("Error sending %s notification: %v\n", channel.name, err)
+			}
+		}
+	}
+}
+
+// Cut a message to the length a service accepts, on a line boundary when
+// possible
+func truncateMessage(text string, limit int) string {
+	if len([]rune(text)) <= limit {
+		return text
+	}
+	cut := string([]rune(text)[:limit-1])
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i+1]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Words combined with the discovered names when no -permute-words file is
+// given: environments, common roles and cloud regions
+var defaultPermutationWords = []string{
+	"dev", "development", "stage", "staging", "test", "qa", "uat", "prod", "preprod", "beta", "demo",
+	"api", "admin", "internal", "int", "old", "new", "backup", "v1", "v2",
+	"us", "eu", "ap", "us-east-1", "us-west-2", "eu-west-1", "eu-central-1", "ap-southeast-1",
+}
+
+var (
+	permuteNames     bool                      // Run the permutation stage after the sources
+	permutationWords = defaultPermutationWords // Word bank of the permutation stage
+	permutationLimit int                       // Maximum candidates resolved per target, 0 for no limit
+)
+
+// Load the word bank of the permutation stage
+func loadPermutationWords(path string) error {
+	words, err := readWordlist(path)
+	if err != nil {
+		return err
+	}
+	permutationWords = words
+	return nil
+}
+
+// Read one lowercase word per line, skipping blank lines and # comments
+func readWordlist(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word != "" && !strings.HasPrefix(word, "#") {
+			words = append(words, word)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("no words in %s", path)
+	}
+	return words, nil
+}
+
+// Resolve alterations of the names found by the sources and add the live
+// ones. It runs once the sources finish, so every name seeds candidates.
+func permuteResults(ctx context.Context, domain string) {
+	mu.Lock()
+	known := make(map[string]struct{}, len(uniqueResults))
+	var hosts []string
+	for _, r := range uniqueResults {
+		host := scope.NormalizeHost(r.Host)
+		if _, exists := known[host]; !exists && host != domain && scope.IsInScope(host, domain) {
+			known[host] = struct{}{}
+			hosts = append(hosts, host)
+		}
+	}
+	mu.Unlock()
+
+	candidates := permutations(domain, hosts, permutationWords, known, permutationLimit)
+	if len(candidates) == 0 {
+		return
+	}
+	fmt.Printf("Resolving %d permutations of %d names\n", len(candidates), len(hosts))
+	hits := addLiveCandidates(ctx, "permutation", candidates, detectWildcards(ctx, domain, candidates), addResult)
+	fmt.Printf("Permutations found %d new names\n", hits)
+}
+
+// Generate dnsgen-style alterations of hosts under the domain: words added
+// as new labels or joined to the first one with a dash, labels and dash
+// separated parts swapped for words, and numbered variants. Names in known
+// are skipped and generation stops at limit candidates, when positive.
+func permutations(domain string, hosts, words []string, known map[string]struct{}, limit int) []string {
+	seen := make(map[string]struct{})
+	var candidates []string
+	add := func(labels ...string) bool {
+		name := strings.Join(labels, ".") + "." + domain
+		if _, exists := known[name]; !exists {
+			if _, exists := seen[name]; !exists {
+				seen[name] = struct{}{}
+				candidates = append(candidates, name)
+			}
+		}
+		return limit <= 0 || len(candidates) < limit
+	}
+
+	for _, host := range hosts {
+		labels := strings.Split(strings.TrimSuffix(host, "."+domain), ".")
+		first := labels[0]
+		rest := labels[1:]
+
+		for _, word := range words {
+			// New label at every position
+			for i := 0; i <= len(labels); i++ {
+				inserted := append(append(append([]string{}, labels[:i]...), word), labels[i:]...)
+				if !add(inserted...) {
+					return candidates
+				}
+			}
+			// Joined to the first label
+			if !add(append([]string{word + "-" + first}, rest...)...) || !add(append([]string{first + "-" + word}, rest...)...) {
+				return candidates
+			}
+			// Swapped for a label or a dash separated part of one
+			for i, label := range labels {
+				swapped := append([]string{}, labels...)
+				swapped[i] = word
+				if !add(swapped...) {
+					return candidates
+				}
+				if parts := strings.Split(label, "-"); len(parts) > 1 {
+					for j := range parts {
+						replaced := append([]string{}, parts...)
+						replaced[j] = word
+						swapped[i] = strings.Join(replaced, "-")
+						if !add(swapped...) {
+							return candidates
+						}
+					}
+				}
+			}
+		}
+
+		for _, numbered := range numberedVariants(first) {
+			if !add(append([]string{numbered}, rest...)...) {
+				return candidates
+			}
+		}
+	}
+	return candidates
+}
+
+// Numbered forms of a label: 01/02 suffixes, and the neighbours of a
+// trailing number keeping its width (web02 gives web01 and web03)
+func numberedVariants(label string) []string {
+	digits := len(label)
+	for digits > 0 && label[digits-1] >= '0' && label[digits-1] <= '9' {
+		digits--
+	}
+	if digits == len(label) {
+		return []string{label + "01", label + "02", label + "-01", label + "-02", label + "1", label + "2"}
+	}
+
+	base, number := label[:digits], label[digits:]
+	n, err := strconv.Atoi(number)
+	if err != nil {
+		return nil
+	}
+	var variants []string
+	for _, next := range []int{n - 1, n + 1} {
+		if next >= 0 {
+			variants = append(variants, fmt.Sprintf("%s%0*d", base, len(number), next))
+		}
+	}
+	return variants
+}
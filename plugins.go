@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// An out-of-tree source: an executable run with the target domain as its
+// only argument, printing one JSON object per result on its standard
+// output, e.g. {"host":"vpn.example.com","ip":"192.0.2.10","port":443}
+type pluginSource struct {
+	name string
+	path string
+}
+
+func (p pluginSource) Name() string { return p.name }
+
+func (p pluginSource) Run(ctx context.Context, domain string, _ *Session) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		stdout, writer := io.Pipe()
+		cmd := exec.CommandContext(ctx, p.path, domain)
+		cmd.Stdout = writer
+		cmd.Stderr = os.Stderr
+		// Children of a killed plugin may keep its output open; stop waiting
+		// for them shortly after the interruption
+		cmd.WaitDelay = time.Second
+		if err := cmd.Start(); err != nil {
+			fmt.Printf("Error running plugin %s: %v\n", p.name, err)
+			return
+		}
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				fmt.Printf("Plugin %s failed: %v\n", p.name, err)
+			}
+			writer.Close()
+		}()
+
+		scanner := bufio.NewScanner(stdout)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var r Result
+			if err := json.Unmarshal([]byte(text), &r); err != nil || r.Host == "" {
+				fmt.Printf("Plugin %s: ignoring malformed line %d\n", p.name, line)
+				continue
+			}
+			r.Host = scope.NormalizeHost(r.Host)
+			r.Source = p.name
+			out <- r
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Printf("Error reading plugin %s: %v\n", p.name, err)
+		}
+		// Drain the rest of the output, which ends once the plugin exited
+		io.Copy(io.Discard, stdout)
+	}()
+	return out
+}
+
+// Plugin directory used when -plugins is not given, if it exists
+func defaultPluginDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	path := filepath.Join(dir, "leviathanmapper", "plugins")
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return ""
+	}
+	return path
+}
+
+// Register every executable of the directory as a source named after its
+// file name without extension, e.g. plugins/internal-cmdb.sh becomes
+// internal-cmdb
+func loadPlugins(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0o111 == 0 {
+			continue
+		}
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		for _, registered := range registeredSources {
+			if registered.Name() == name {
+				return fmt.Errorf("plugin %s has the name of an existing source", entry.Name())
+			}
+		}
+		registerSource(pluginSource{name: name, path: filepath.Join(dir, entry.Name())})
+	}
+	return nil
+}
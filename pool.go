@@ -0,0 +1,34 @@
+package main
+
+import "sync"
+
+// A fixed number of workers shared by the tasks of a stage. Every stage
+// that fans out, from the sources to resolution and probing, runs its tasks
+// through one sized by -concurrency.
+type workerPool struct {
+	slots   chan struct{}
+	pending sync.WaitGroup
+}
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// Run a task once a worker is free, blocking until then
+func (p *workerPool) Go(task func()) {
+	p.pending.Add(1)
+	p.slots <- struct{}{}
+	go func() {
+		defer p.pending.Done()
+		defer func() { <-p.slots }()
+		task()
+	}()
+}
+
+// Wait for every task started so far
+func (p *workerPool) Wait() {
+	p.pending.Wait()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scan the resolved addresses for open TCP ports, set by -port-scan
+var scanPorts bool
+
+// Number of top ports scanned, set by -top-ports
+var topPorts = 100
+
+// How ports are scanned: "connect" or "syn", set by -scan-type
+var scanType = "connect"
+
+// Time a port has to answer before it counts as closed
+const portScanTimeout = 1500 * time.Millisecond
+
+// The 100 most frequently open TCP ports, most frequent first, after the
+// nmap-services frequencies
+var topTCPPorts = []int{
+	80, 23, 443, 21, 22, 25, 3389, 110, 445, 139, 143, 53, 135, 3306, 8080, 1723, 111, 995, 993, 5900,
+	1025, 587, 8888, 199, 1720, 465, 548, 113, 81, 6001, 10000, 514, 5060, 179, 1026, 2000, 8443, 8000, 32768, 554,
+	26, 1433, 49152, 2001, 515, 8008, 49154, 1027, 5666, 646, 5000, 5631, 631, 49153, 8081, 2049, 88, 79, 5800, 106,
+	2121, 1110, 49155, 6000, 513, 990, 5357, 427, 49156, 543, 544, 5101, 144, 7, 389, 8009, 3128, 444, 9999, 5009,
+	7070, 5190, 3000, 5432, 1900, 3986, 13, 1029, 9, 5051, 6646, 49157, 1028, 873, 1755, 2717, 4899, 9100, 119, 37,
+}
+
+// A TCP port found open on one of the addresses of a result
+type openPort struct {
+	IP      string          `json:"ip"`
+	Port    int             `json:"port"`
+	Service string          `json:"service,omitempty"` // Service guessed from the banner or the port, with -banners
+	Banner  string          `json:"banner,omitempty"`  // First line the service sent, with -banners
+	TLS     *tlsCertificate `json:"tls,omitempty"`     // Certificate of the TLS ports, with -banners
+}
+
+// Text shown for the open ports of a result, with their service guesses
+func portsSummary(ports []openPort) string {
+	var parts []string
+	for _, p := range ports {
+		part := net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+		if p.Service != "" {
+			part += "/" + p.Service
+		}
+		parts = append(parts, part)
+	}
+	return "[open: " + strings.Join(parts, ", ") + "]"
+}
+
+// Whether a TCP connection to ip:port is accepted
+func connectScan(ctx context.Context, ip string, port int) bool {
+	dialer := &net.Dialer{Timeout: portScanTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Connect to every port of every address, with at most -concurrency
+// connections at a time
+func connectScanAll(ctx context.Context, ips []string, ports []int) map[string][]int {
+	open := make(map[string][]int)
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, ip := range ips {
+		for _, port := range ports {
+			if ctx.Err() != nil {
+				break
+			}
+			pool.Go(func() {
+				if connectScan(ctx, ip, port) {
+					lock.Lock()
+					open[ip] = append(open[ip], port)
+					lock.Unlock()
+				}
+			})
+		}
+	}
+	pool.Wait()
+	return open
+}
+
+// Scan the top -top-ports TCP ports of the addresses of the results and
+// attach the open ones. Hosts behind a CDN are skipped: their addresses are
+// the provider's edge, not the asset.
+func scanOpenPorts(ctx context.Context, results []datedResult) {
+	var ips []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		if r.CDN != "" {
+			continue
+		}
+		for _, ip := range r.IPs {
+			if _, exists := seen[ip]; !exists {
+				seen[ip] = struct{}{}
+				ips = append(ips, ip)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		return
+	}
+	ports := topTCPPorts[:topPorts]
+	fmt.Printf("Scanning %d addresses on the top %d ports (%s scan)\n", len(ips), len(ports), scanType)
+
+	var open map[string][]int
+	var err error
+	if scanType == "syn" {
+		if open, err = synScanAll(ctx, ips, ports); err != nil {
+			fmt.Println("SYN scan unavailable, falling back to connect scan:", err)
+		}
+	}
+	if scanType != "syn" || err != nil {
+		open = connectScanAll(ctx, ips, ports)
+	}
+
+	total := 0
+	for ip := range open {
+		sort.Ints(open[ip])
+		total += len(open[ip])
+	}
+	fmt.Printf("Found %d open ports on %d addresses\n", total, len(open))
+
+	for i := range results {
+		if results[i].CDN != "" {
+			continue
+		}
+		var found []openPort
+		for _, ip := range results[i].IPs {
+			for _, port := range open[ip] {
+				found = append(found, openPort{IP: ip, Port: port})
+			}
+		}
+		results[i].OpenPorts = found
+	}
+}
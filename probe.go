@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"LeviathanMapper/scope"
+)
+
+// Liveness of a probed host
+const (
+	hostAlive = "alive" // At least one web service answered
+	hostDead  = "dead"  // No port answered over HTTP or HTTPS
+)
+
+var (
+	probeHosts  bool              // Probe the resolved hosts over HTTP and HTTPS, set by -probe
+	probePorts  = []int{80, 443}  // Ports probed on every host, set by -ports
+	probeClient *http.Client      // Client of the probe stage, which reaches the targets themselves
+	probeURLs   *os.File          // File receiving the URLs of the live services, nil without -urls
+	probeIPs    map[string]string // Address dialed for each probed host
+)
+
+// Bytes of each response body read by the probe
+const probeBodyLimit = 1 << 20
+
+// Redirects followed from a probed URL before the probe keeps the last one
+// as the answer
+const probeRedirectLimit = 10
+
+// Title element of an HTML page
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// A redirect answered on the way to the final page
+type redirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+}
+
+// A web service that answered the probe
+type probeResult struct {
+	URL           string          `json:"url"`
+	Redirects     []redirectHop   `json:"redirects,omitempty"`    // Redirects followed from URL, in order
+	CrossDomain   bool            `json:"cross_domain,omitempty"` // The redirects left the registrable domain of the host
+	StatusCode    int             `json:"status_code"`            // Status of the final page, 0 when the redirects led nowhere
+	Title         string          `json:"title,omitempty"`
+	ContentLength int64           `json:"content_length"`
+	FinalURL      string          `json:"final_url,omitempty"`    // Where the redirects led, empty when there were none
+	Technologies  []string        `json:"technologies,omitempty"` // Server, frameworks and CMS seen in the response
+	TLS           *tlsCertificate `json:"tls,omitempty"`          // Certificate presented over HTTPS
+	FaviconHash   int32           `json:"favicon_hash,omitempty"` // Shodan and FOFA favicon hash of the page icon
+	JARM          string          `json:"jarm,omitempty"`         // JARM fingerprint of the TLS server, with -jarm
+	responses     []byte          // Raw responses of the chain, kept for -store-responses
+}
+
+// Text shown for the service: redirect chain, final URL, status, title,
+// length, technologies, favicon hash, certificate and JARM fingerprint
+func (p probeResult) summary() string {
+	var parts []string
+	for _, hop := range p.Redirects {
+		parts = append(parts, hop.URL, strconv.Itoa(hop.StatusCode), "->")
+	}
+	final := p.URL
+	if p.FinalURL != "" {
+		final = p.FinalURL
+	}
+	if p.StatusCode == 0 {
+		parts = append(parts, final, "unreachable")
+	} else {
+		parts = append(parts, final, strconv.Itoa(p.StatusCode))
+	}
+	if p.CrossDomain {
+		parts = append(parts, "(cross-domain)")
+	}
+	if p.Title != "" {
+		parts = append(parts, strconv.Quote(p.Title))
+	}
+	if p.StatusCode != 0 {
+		parts = append(parts, strconv.FormatInt(p.ContentLength, 10))
+	}
+	if len(p.Technologies) > 0 {
+		parts = append(parts, "tech: "+strings.Join(p.Technologies, ", "))
+	}
+	if p.FaviconHash != 0 {
+		parts = append(parts, "favicon: "+strconv.Itoa(int(p.FaviconHash)))
+	}
+	if p.TLS != nil {
+		parts = append(parts, p.TLS.summary())
+	}
+	if p.JARM != "" {
+		parts = append(parts, "jarm: "+p.JARM)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Title of an HTML page, unescaped and on one line
+func pageTitle(body []byte) string {
+	match := titlePattern.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
+
+// Build the client used to probe the targets. It dials the addresses found
+// by the resolution stage instead of asking the system resolver again,
+// and accepts any certificate, since recon targets often present
+// self-signed or mismatched ones. Redirects are left to probePort, which
+// records each hop.
+func configureProbeClient(proxy func(*http.Request) (*url.URL, error)) {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if host, port, err := net.SplitHostPort(addr); err == nil {
+				if ip, ok := probeIPs[host]; ok {
+					addr = net.JoinHostPort(ip, port)
+				}
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	var roundTripper http.RoundTripper = transport
+	if canaryID != "" {
+		roundTripper = canaryTransport{base: transport, identifier: canaryID}
+	}
+	probeClient = &http.Client{
+		Timeout:   requestTimeout,
+		Transport: roundTripper,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Ports probed by -ports web: the alternate ports where admin panels,
+// staging builds and development servers usually listen
+var topWebPorts = []int{
+	80, 81, 443, 591, 2082, 2083, 2086, 2087, 3000, 3001, 4443, 5000, 5001, 7001, 7443,
+	8000, 8001, 8008, 8080, 8081, 8088, 8443, 8800, 8880, 8888, 9000, 9090, 9443, 10443,
+}
+
+// Ports that only speak one scheme, even off their default
+var (
+	plainHTTPPorts = map[int]bool{80: true, 81: true, 591: true, 2082: true, 2086: true, 8008: true, 8080: true, 8880: true}
+	httpsPorts     = map[int]bool{443: true, 2083: true, 2087: true, 4443: true, 7443: true, 8443: true, 9443: true, 10443: true}
+)
+
+// Read the -ports list: comma-separated ports, or "web" for topWebPorts
+func parsePorts(value string) ([]int, error) {
+	if strings.TrimSpace(value) == "web" {
+		return topWebPorts, nil
+	}
+	var ports []int
+	seen := make(map[int]bool)
+	for _, field := range strings.Split(value, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port %q", strings.TrimSpace(field))
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// Schemes tried on a port, the likeliest first
+func probeSchemes(port int) []string {
+	switch {
+	case plainHTTPPorts[port]:
+		return []string{"http"}
+	case httpsPorts[port]:
+		return []string{"https"}
+	}
+	return []string{"https", "http"}
+}
+
+// URL of a scheme and port on a host, leaving out the default port
+func probeURL(scheme, host string, port int) string {
+	if scheme == "http" && port == 80 || scheme == "https" && port == 443 {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// Fetch a URL without following redirects, reading up to probeBodyLimit
+// bytes of the body
+func probeGet(ctx context.Context, target string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := probeClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, probeBodyLimit))
+	return resp, body, nil
+}
+
+// Probe one port of a host, returning the web service that answered on it
+func probePort(ctx context.Context, host string, port int) (probeResult, bool) {
+	for _, scheme := range probeSchemes(port) {
+		target := probeURL(scheme, host, port)
+		resp, body, err := probeGet(ctx, target)
+		if err != nil {
+			continue
+		}
+		service := probeResult{URL: target, responses: appendResponse(nil, resp, body)}
+		// The certificate is the one of the probed URL, before any redirect
+		if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+			service.TLS = certificateInfo(resp.TLS.PeerCertificates[0])
+		}
+		if computeJARM && scheme == "https" {
+			// Through -proxy the proxy resolves the name, as it does for
+			// the request above
+			addr := net.JoinHostPort(probeIPs[host], strconv.Itoa(port))
+			if jarmProxy != nil {
+				addr = net.JoinHostPort(host, strconv.Itoa(port))
+			}
+			service.JARM = jarmFingerprint(addr, host)
+		}
+
+		// Follow the redirects one by one, so a hop that cannot be reached,
+		// such as a parked or internal SSO host, still ends the chain
+		for len(service.Redirects) < probeRedirectLimit && resp != nil {
+			location, err := resp.Location()
+			if err != nil || resp.StatusCode < 300 || resp.StatusCode > 399 {
+				break
+			}
+			service.Redirects = append(service.Redirects, redirectHop{resp.Request.URL.String(), resp.StatusCode})
+			service.FinalURL = location.String()
+			resp, body, _ = probeGet(ctx, service.FinalURL)
+			if resp != nil {
+				service.responses = appendResponse(service.responses, resp, body)
+			}
+		}
+		if service.FinalURL != "" {
+			final, _ := url.Parse(service.FinalURL)
+			service.CrossDomain = scope.Apex(final.Hostname()) != scope.Apex(host)
+		}
+		if resp == nil {
+			// The chain ended on a URL that did not answer
+			return service, true
+		}
+
+		service.StatusCode = resp.StatusCode
+		service.Title = pageTitle(body)
+		service.Technologies = fingerprintResponse(resp, body)
+		service.ContentLength = int64(len(body))
+		// The declared length covers bodies cut at the read limit
+		if resp.ContentLength > service.ContentLength {
+			service.ContentLength = resp.ContentLength
+		}
+		if hash, ok := fetchFaviconHash(ctx, resp.Request.URL, body); ok {
+			service.FaviconHash = hash
+		}
+		return service, true
+	}
+	return probeResult{}, false
+}
+
+// Probe every resolved host and feed the in-scope names of the certificates
+// back as new results, which are resolved and probed in turn until no
+// certificate names anything new
+func probeResults(ctx context.Context, domain string, results []datedResult) []datedResult {
+	probeBatch(ctx, results)
+	for batch := results; ; {
+		batch = certificateNames(domain, results, batch)
+		if len(batch) == 0 {
+			return results
+		}
+		batch = resolveResults(ctx, domain, batch, dropNXDomain, onlyResolved)
+		probeBatch(ctx, batch)
+		results = append(results, batch...)
+	}
+}
+
+// Probe the resolved hosts of a batch on the probe ports, with at most
+// -concurrency connections at a time, and mark each one alive or dead. The
+// URLs of the live services go to the -urls file as well.
+func probeBatch(ctx context.Context, results []datedResult) {
+	probeIPs = make(map[string]string)
+	var hosts []string
+	for _, r := range results {
+		if _, exists := probeIPs[r.Host]; !exists && len(r.IPs) > 0 {
+			probeIPs[r.Host] = r.IPs[0]
+			hosts = append(hosts, r.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		return
+	}
+	ports := make([]string, len(probePorts))
+	for i, port := range probePorts {
+		ports[i] = strconv.Itoa(port)
+	}
+	fmt.Printf("Probing %d hosts on ports %s\n", len(hosts), strings.Join(ports, ", "))
+
+	found := make(map[string][]probeResult)
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, host := range hosts {
+		for _, port := range probePorts {
+			if ctx.Err() != nil {
+				break
+			}
+			pool.Go(func() {
+				if service, ok := probePort(ctx, host, port); ok {
+					lock.Lock()
+					found[host] = append(found[host], service)
+					lock.Unlock()
+				}
+			})
+		}
+	}
+	pool.Wait()
+
+	var urls []string
+	for host, services := range found {
+		sort.Slice(services, func(i, j int) bool { return services[i].URL < services[j].URL })
+		for _, service := range services {
+			urls = append(urls, service.URL)
+		}
+		found[host] = services
+		if responseDir != "" {
+			storeResponses(host, services)
+		}
+	}
+	for i := range results {
+		if _, probed := probeIPs[results[i].Host]; !probed {
+			continue
+		}
+		results[i].Probes = found[results[i].Host]
+		results[i].Liveness = hostDead
+		if len(results[i].Probes) > 0 {
+			results[i].Liveness = hostAlive
+		}
+	}
+	fmt.Printf("%d of %d probed hosts alive\n", len(found), len(hosts))
+
+	if probeURLs != nil {
+		sort.Strings(urls)
+		for _, target := range urls {
+			fmt.Fprintln(probeURLs, target)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Archive entry describing the parts of an exported project
+const projectManifestName = "manifest.json"
+
+// A file or directory of a project and the flag that points at it
+type projectPart struct {
+	name string // Name inside the archive
+	flag string
+	path string // Empty when the project does not use it
+	dir  bool
+}
+
+// Contents of manifest.json: the archive name of each part by flag
+type projectManifest struct {
+	Version int               `json:"version"`
+	Created time.Time         `json:"created"`
+	Parts   map[string]string `json:"parts"`
+}
+
+// Extensions of the project archives, zstd first
+var projectArchiveExtensions = []string{".tar.zst", ".tzst", ".tar.gz", ".tgz"}
+
+// Whether an archive name has one of the supported extensions
+func checkProjectArchiveName(file string) error {
+	for _, ext := range projectArchiveExtensions {
+		if strings.HasSuffix(file, ext) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: project archives are .tar.zst, .tzst, .tar.gz or .tgz files", file)
+}
+
+// Whether an archive is compressed with zstd rather than gzip
+func isZstdArchive(file string) bool {
+	return strings.HasSuffix(file, ".tar.zst") || strings.HasSuffix(file, ".tzst")
+}
+
+// Bundle the parts of a project into a compressed tar archive, replacing
+// the file only once it is complete
+func exportProject(file string, parts []projectPart) error {
+	if err := checkProjectArchiveName(file); err != nil {
+		return err
+	}
+	manifest := projectManifest{Version: 1, Created: time.Now().UTC(), Parts: make(map[string]string)}
+	var included []projectPart
+	for _, part := range parts {
+		if part.path == "" {
+			continue
+		}
+		info, err := os.Stat(part.path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && !part.dir {
+			return fmt.Errorf("%s: %s expects a file", part.path, part.flag)
+		}
+		if !info.IsDir() && part.dir {
+			return fmt.Errorf("%s: %s expects a directory", part.path, part.flag)
+		}
+		if !part.dir {
+			part.name += filepath.Ext(part.path)
+		}
+		manifest.Parts[part.flag] = part.name
+		included = append(included, part)
+	}
+	if len(included) == 0 {
+		return errors.New("nothing to export: give the -history, -config, -scope, -store-responses or -report-dir of the project")
+	}
+
+	tmp := file + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	var compressed io.WriteCloser = gzip.NewWriter(out)
+	if isZstdArchive(file) {
+		compressed = newZstdWriter(out)
+	}
+	archive := tar.NewWriter(compressed)
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = archive.WriteHeader(&tar.Header{Name: projectManifestName, Mode: 0o644, Size: int64(len(data)), ModTime: manifest.Created})
+	}
+	if err == nil {
+		_, err = archive.Write(data)
+	}
+	for _, part := range included {
+		if err != nil {
+			break
+		}
+		if !part.dir {
+			err = addToArchive(archive, part.path, part.name)
+			continue
+		}
+		err = filepath.WalkDir(part.path, func(name string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(part.path, name)
+			if err != nil {
+				return err
+			}
+			return addToArchive(archive, name, path.Join(part.name, filepath.ToSlash(rel)))
+		})
+	}
+	if err == nil {
+		err = archive.Close()
+	}
+	if err == nil {
+		err = compressed.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// Copy a regular file into the archive under a name
+func addToArchive(archive *tar.Writer, file, name string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(archive, in)
+	return err
+}
+
+// Extract an exported project into a new or empty directory, returning its
+// manifest. Entries escaping the directory and anything but regular files
+// are refused.
+func importProject(file, dir string) (projectManifest, error) {
+	var manifest projectManifest
+	if err := checkProjectArchiveName(file); err != nil {
+		return manifest, err
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return manifest, fmt.Errorf("%s is not empty", dir)
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return manifest, err
+	}
+	defer in.Close()
+	var compressed io.Reader = newZstdReader(in)
+	if !isZstdArchive(file) {
+		if compressed, err = gzip.NewReader(in); err != nil {
+			return manifest, err
+		}
+	}
+	archive := tar.NewReader(compressed)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manifest, err
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+		if header.Typeflag != tar.TypeReg || !fs.ValidPath(name) {
+			return manifest, fmt.Errorf("refusing archive entry %q", header.Name)
+		}
+		if name == projectManifestName {
+			if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+				return manifest, fmt.Errorf("reading %s: %v", projectManifestName, err)
+			}
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return manifest, err
+		}
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return manifest, err
+		}
+		_, err = io.Copy(out, archive)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return manifest, err
+		}
+	}
+	if manifest.Parts == nil {
+		return manifest, fmt.Errorf("%s has no %s, it is not a project archive", file, projectManifestName)
+	}
+	return manifest, nil
+}
+
+// Run "project export FILE" or "project import FILE [DIR]"
+func runProjectCommand(action, file, dir string, parts []projectPart) {
+	if action == "export" {
+		if err := exportProject(file, parts); err != nil {
+			fmt.Println("Error exporting project:", err)
+			os.Exit(1)
+		}
+		fmt.Println("Project exported to", file)
+		return
+	}
+
+	if dir == "" {
+		dir = filepath.Base(file)
+		for _, ext := range projectArchiveExtensions {
+			dir = strings.TrimSuffix(dir, ext)
+		}
+	}
+	manifest, err := importProject(file, dir)
+	if err != nil {
+		fmt.Println("Error importing project:", err)
+		os.Exit(1)
+	}
+	command := []string{"leviathanmapper"}
+	for _, part := range parts {
+		if name, ok := manifest.Parts[part.flag]; ok && fs.ValidPath(name) {
+			command = append(command, part.flag, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+	}
+	fmt.Printf("Project imported into %s; continue it with:\n  %s\n", dir, strings.Join(command, " "))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProjectRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"scope.txt":                     "*.example.com\n",
+		"history/example.com.json":      `{"domain":"example.com"}`,
+		"responses/www.example.com.txt": "HTTP/1.1 200 OK\n",
+		"responses/sub/api.txt":         "HTTP/1.1 403 Forbidden\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parts := []projectPart{
+		{name: "config", flag: "-config"},
+		{name: "scope", flag: "-scope", path: filepath.Join(src, "scope.txt")},
+		{name: "history", flag: "-history", path: filepath.Join(src, "history"), dir: true},
+		{name: "responses", flag: "-store-responses", path: filepath.Join(src, "responses"), dir: true},
+	}
+	for _, name := range []string{"acme.tar.zst", "acme.tar.gz"} {
+		archive := filepath.Join(t.TempDir(), name)
+		if err := exportProject(archive, parts); err != nil {
+			t.Fatal(err)
+		}
+
+		dst := filepath.Join(t.TempDir(), "acme")
+		manifest, err := importProject(archive, dst)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(manifest.Parts) != 3 || manifest.Parts["-scope"] != "scope.txt" || manifest.Parts["-history"] != "history" {
+			t.Errorf("%s: manifest parts %v", name, manifest.Parts)
+		}
+		for file, content := range files {
+			data, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(file)))
+			if err != nil || string(data) != content {
+				t.Errorf("%s: %s: got %q, %v", name, file, data, err)
+			}
+		}
+		if _, err := importProject(archive, dst); err == nil {
+			t.Errorf("%s: import into a non-empty directory succeeded", name)
+		}
+	}
+}
+
+func TestImportProjectRefusesEscapingEntries(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "evil.tgz")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := gzip.NewWriter(out)
+	w := tar.NewWriter(compressed)
+	w.WriteHeader(&tar.Header{Name: "../outside.txt", Mode: 0o644, Size: 1})
+	w.Write([]byte("x"))
+	w.Close()
+	compressed.Close()
+	out.Close()
+
+	dir := t.TempDir()
+	if _, err := importProject(archive, filepath.Join(dir, "project")); err == nil || !strings.Contains(err.Error(), "refusing") {
+		t.Errorf("got error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "outside.txt")); err == nil {
+		t.Error("entry written outside the project directory")
+	}
+}
+
+func TestProjectArchiveName(t *testing.T) {
+	for _, name := range []string{"acme.tar.zst", "acme.tzst", "acme.tar.gz", "acme.tgz"} {
+		if err := checkProjectArchiveName(name); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := checkProjectArchiveName("acme.zip"); err == nil {
+		t.Error("zip name accepted")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+
+	"LeviathanMapper/scope"
+)
+
+// Sweep the PTR records of the /24 around every resolved IPv4 address
+var sweepPTR bool
+
+// Group the resolved IPv4 addresses into /24 ranges and look up the PTR
+// record of every address in them. In-scope names not found yet are
+// returned as new results carrying the address they point back from.
+func sweepReverseDNS(ctx context.Context, domain string, results []datedResult) []datedResult {
+	known := make(map[string]struct{}, len(results))
+	ranges := make(map[string]struct{})
+	for _, r := range results {
+		known[r.Host] = struct{}{}
+		for _, ip := range scannableIPs(r) {
+			if v4 := net.ParseIP(ip).To4(); v4 != nil {
+				ranges[fmt.Sprintf("%d.%d.%d", v4[0], v4[1], v4[2])] = struct{}{}
+			}
+		}
+	}
+	if len(ranges) == 0 {
+		return nil
+	}
+	fmt.Printf("Sweeping PTR records of %d /24 ranges\n", len(ranges))
+
+	var ips []string
+	for prefix := range ranges {
+		for i := 0; i < 256; i++ {
+			ips = append(ips, fmt.Sprintf("%s.%d", prefix, i))
+		}
+	}
+	found := reverseLookups(ctx, domain, ips, known)
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Host < found[j].Host })
+	for _, r := range found {
+		if !quietStream {
+			fmt.Println("Subdomain found:", r.label())
+		}
+	}
+	fmt.Printf("PTR sweep found %d new names\n", len(found))
+	return found
+}
+
+// Look up the PTR record of every address, with at most -concurrency
+// queries at a time. In-scope names missing from known are added to it and
+// returned as new results carrying the address they point back from.
+func reverseLookups(ctx context.Context, domain string, ips []string, known map[string]struct{}) []datedResult {
+	var found []datedResult
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, ip := range ips {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			for _, name := range lookupRecords(reverseName(ip), dnsTypePTR) {
+				host := scope.NormalizeHost(name)
+				if !scope.IsInScope(host, domain) || !resultFilter.Allows(host) || wasImported(host) || scopeOnly && !inEngagementScope(host) {
+					continue
+				}
+				lock.Lock()
+				if _, exists := known[host]; !exists {
+					known[host] = struct{}{}
+					found = append(found, datedResult{
+						Result:  Result{Host: host, IP: ip, Source: "ptr"},
+						IPs:     []string{ip},
+						InScope: inEngagementScope(host),
+					})
+				}
+				lock.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+	return found
+}
+
+// Name queried for the PTR record of an IPv4 address
+func reverseName(ip string) string {
+	v4 := net.ParseIP(ip).To4()
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Daily window in which the active stages must not run, as with
+// -quiet-hours 08:00-18:00. A window whose end comes before its start
+// crosses midnight.
+type quietWindow struct {
+	start, end time.Duration // Clock times, from midnight
+	location   *time.Location
+}
+
+// Set by -quiet-hours, nil when the active stages may run at any time
+var quietHours *quietWindow
+
+// Read a -quiet-hours window and the time zone of -quiet-timezone, the
+// local one when empty
+func parseQuietHours(value, zone string) (*quietWindow, error) {
+	startText, endText, ok := strings.Cut(value, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid window %q (use HH:MM-HH:MM)", value)
+	}
+	var window quietWindow
+	for _, clock := range []struct {
+		text  string
+		value *time.Duration
+	}{{startText, &window.start}, {endText, &window.end}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(clock.text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid time %q (use HH:MM)", clock.text)
+		}
+		*clock.value = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("window %q is empty", value)
+	}
+	window.location = time.Local
+	if zone != "" {
+		location, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("unknown time zone %q", zone)
+		}
+		window.location = location
+	}
+	return &window, nil
+}
+
+// When the quiet hours around a time end, and whether the time falls in them
+func (w *quietWindow) endsAt(now time.Time) (time.Time, bool) {
+	now = now.In(w.location)
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+	day := now.Day()
+	switch {
+	case w.start < w.end && (clock < w.start || clock >= w.end):
+		return time.Time{}, false
+	case w.start > w.end && clock >= w.end && clock < w.start:
+		return time.Time{}, false
+	case w.start > w.end && clock >= w.start:
+		day++ // Ends tomorrow
+	}
+	// Built from the clock time so daylight saving changes are honored
+	end := time.Date(now.Year(), now.Month(), day, int(w.end/time.Hour), int(w.end%time.Hour/time.Minute), 0, 0, w.location)
+	return end, true
+}
+
+// Hold an active stage until the quiet hours are over, reporting whether it
+// may run; false means the run was interrupted while waiting. A stage that
+// already started is not stopped when the quiet hours begin.
+func waitQuietHours(ctx context.Context, stage string) bool {
+	if quietHours == nil {
+		return ctx.Err() == nil
+	}
+	until, quiet := quietHours.endsAt(time.Now())
+	if !quiet {
+		return ctx.Err() == nil
+	}
+	fmt.Printf("Quiet hours: %s queued until %s\n", stage, until.Format("2006-01-02 15:04 MST"))
+	timer := time.NewTimer(time.Until(until))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietWindow(t *testing.T) {
+	at := func(day, hour, minute int) time.Time { return time.Date(2026, 3, day, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		window string
+		now    time.Time
+		quiet  bool
+		until  time.Time
+	}{
+		{window: "08:00-18:00", now: at(2, 7, 59)},
+		{window: "08:00-18:00", now: at(2, 8, 0), quiet: true, until: at(2, 18, 0)},
+		{window: "08:00-18:00", now: at(2, 17, 59), quiet: true, until: at(2, 18, 0)},
+		{window: "08:00-18:00", now: at(2, 18, 0)},
+		{window: "22:00-06:30", now: at(2, 23, 0), quiet: true, until: at(3, 6, 30)},
+		{window: "22:00-06:30", now: at(3, 1, 0), quiet: true, until: at(3, 6, 30)},
+		{window: "22:00-06:30", now: at(3, 12, 0)},
+	}
+	for _, tt := range tests {
+		window, err := parseQuietHours(tt.window, "UTC")
+		if err != nil {
+			t.Fatal(err)
+		}
+		until, quiet := window.endsAt(tt.now)
+		if quiet != tt.quiet || !until.Equal(tt.until) {
+			t.Errorf("%s at %s: got %v until %s, want %v until %s", tt.window, tt.now.Format("15:04"), quiet, until, tt.quiet, tt.until)
+		}
+	}
+}
+
+func TestQuietWindowTimezone(t *testing.T) {
+	window, err := parseQuietHours("08:00-18:00", "Asia/Tokyo")
+	if err != nil {
+		t.Skip("time zone database unavailable:", err)
+	}
+	// 00:30 UTC is 09:30 in Tokyo
+	until, quiet := window.endsAt(time.Date(2026, 3, 2, 0, 30, 0, 0, time.UTC))
+	if !quiet || !until.Equal(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v until %s", quiet, until.UTC())
+	}
+}
+
+func TestParseQuietHoursErrors(t *testing.T) {
+	for _, value := range []string{"08:00", "8-18", "08:00-08:00", "25:00-06:00"} {
+		if _, err := parseQuietHours(value, ""); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+	if _, err := parseQuietHours("08:00-18:00", "Nowhere/City"); err == nil {
+		t.Error("unknown time zone accepted")
+	}
+}
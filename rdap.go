@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// Look up the registration of the apex and of the resolved netblocks over
+// RDAP, set by -rdap
+var lookupRDAP bool
+
+// Bootstrap service redirecting each query to the registry in charge
+const rdapBootstrap = "https://rdap.org"
+
+// An entity of an RDAP answer: a registrar, registrant or contact
+type rdapEntity struct {
+	Roles      []string `json:"roles"`
+	VCardArray []any    `json:"vcardArray"`
+}
+
+type rdapEvent struct {
+	Action string    `json:"eventAction"`
+	Date   time.Time `json:"eventDate"`
+}
+
+// Name of an entity: the organization of its vCard, else its full name
+func (e rdapEntity) name() string {
+	if len(e.VCardArray) < 2 {
+		return ""
+	}
+	properties, _ := e.VCardArray[1].([]any)
+	var fn, org string
+	for _, p := range properties {
+		fields, _ := p.([]any)
+		if len(fields) < 4 {
+			continue
+		}
+		value, _ := fields[3].(string)
+		switch fields[0] {
+		case "fn":
+			fn = value
+		case "org":
+			org = value
+		}
+	}
+	if org != "" {
+		return org
+	}
+	return fn
+}
+
+// Name of the first entity holding a role
+func entityWithRole(entities []rdapEntity, role string) string {
+	for _, e := range entities {
+		for _, r := range e.Roles {
+			if r == role {
+				return e.name()
+			}
+		}
+	}
+	return ""
+}
+
+// Registration of an apex domain
+type domainRegistration struct {
+	Registrar  string
+	Registrant string // Often redacted
+	Created    time.Time
+}
+
+func lookupDomainRDAP(ctx context.Context, domain string) (domainRegistration, error) {
+	var data struct {
+		Entities []rdapEntity `json:"entities"`
+		Events   []rdapEvent  `json:"events"`
+	}
+	if err := fetchJSONContext(ctx, rdapBootstrap+"/domain/"+domain, &data); err != nil {
+		return domainRegistration{}, err
+	}
+	reg := domainRegistration{
+		Registrar:  entityWithRole(data.Entities, "registrar"),
+		Registrant: entityWithRole(data.Entities, "registrant"),
+	}
+	for _, event := range data.Events {
+		if event.Action == "registration" {
+			reg.Created = event.Date
+		}
+	}
+	return reg, nil
+}
+
+// The netblock holding an address, as registered
+type netblockInfo struct {
+	Name    string `json:"name,omitempty"`
+	Handle  string `json:"handle,omitempty"`
+	Range   string `json:"range"` // CIDR, or first-last address when it is not one
+	Owner   string `json:"owner,omitempty"`
+	Country string `json:"country,omitempty"`
+	start   net.IP
+	end     net.IP
+}
+
+// Whether the netblock holds an address
+func (n netblockInfo) contains(ip net.IP) bool {
+	ip = ip.To16()
+	return bytes.Compare(ip, n.start.To16()) >= 0 && bytes.Compare(ip, n.end.To16()) <= 0
+}
+
+func lookupIPRDAP(ctx context.Context, ip string) (netblockInfo, error) {
+	var data struct {
+		Handle   string       `json:"handle"`
+		Name     string       `json:"name"`
+		Country  string       `json:"country"`
+		Start    string       `json:"startAddress"`
+		End      string       `json:"endAddress"`
+		Entities []rdapEntity `json:"entities"`
+		CIDRs    []struct {
+			V4     string `json:"v4prefix"`
+			V6     string `json:"v6prefix"`
+			Length int    `json:"length"`
+		} `json:"cidr0_cidrs"`
+	}
+	if err := fetchJSONContext(ctx, rdapBootstrap+"/ip/"+ip, &data); err != nil {
+		return netblockInfo{}, err
+	}
+	block := netblockInfo{
+		Name:    data.Name,
+		Handle:  data.Handle,
+		Range:   data.Start + "-" + data.End,
+		Owner:   entityWithRole(data.Entities, "registrant"),
+		Country: data.Country,
+		start:   net.ParseIP(data.Start),
+		end:     net.ParseIP(data.End),
+	}
+	if block.start == nil || block.end == nil {
+		return netblockInfo{}, fmt.Errorf("no address range in the answer for %s", ip)
+	}
+	if len(data.CIDRs) == 1 {
+		block.Range = data.CIDRs[0].V4 + data.CIDRs[0].V6 + "/" + strconv.Itoa(data.CIDRs[0].Length)
+	}
+	return block, nil
+}
+
+// Text shown for the netblock of a result
+func (n *netblockInfo) summary() string {
+	parts := []string{n.Range}
+	if n.Name != "" {
+		parts = append(parts, n.Name)
+	}
+	if n.Owner != "" {
+		parts = append(parts, n.Owner)
+	}
+	return "[netblock: " + strings.Join(parts, ", ") + "]"
+}
+
+// Print the registration of the apex and attach to every result the
+// netblock of its first address. Addresses inside a netblock already
+// fetched are not looked up again, which keeps the registries' rate limits.
+func enrichWithRDAP(ctx context.Context, domain string, results []datedResult) {
+	apex := scope.Apex(domain)
+	if reg, err := lookupDomainRDAP(ctx, apex); err != nil {
+		fmt.Printf("Error looking up the RDAP record of %s: %v\n", apex, err)
+	} else {
+		var parts []string
+		if reg.Registrar != "" {
+			parts = append(parts, "registrar "+reg.Registrar)
+		}
+		if reg.Registrant != "" {
+			parts = append(parts, "registrant "+reg.Registrant)
+		}
+		if !reg.Created.IsZero() {
+			parts = append(parts, "created "+reg.Created.Format("2006-01-02"))
+		}
+		fmt.Printf("RDAP of %s: %s\n", apex, strings.Join(parts, ", "))
+	}
+
+	var blocks []*netblockInfo
+	failed := make(map[string]bool)
+	for i := range results {
+		if ctx.Err() != nil {
+			break
+		}
+		if len(results[i].IPs) == 0 {
+			continue
+		}
+		ip := results[i].IPs[0]
+		addr := net.ParseIP(ip)
+		for _, block := range blocks {
+			if block.contains(addr) {
+				results[i].Netblock = block
+				break
+			}
+		}
+		if results[i].Netblock != nil || failed[ip] {
+			continue
+		}
+		block, err := lookupIPRDAP(ctx, ip)
+		if err != nil {
+			fmt.Printf("Error looking up the RDAP record of %s: %v\n", ip, err)
+			failed[ip] = true
+			continue
+		}
+		blocks = append(blocks, &block)
+		results[i].Netblock = &block
+	}
+	if len(blocks) > 0 {
+		fmt.Printf("RDAP found %d netblocks\n", len(blocks))
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Vantage point of the probe stage itself
+const directVantage = "direct"
+
+// Longest wait for the workers to answer their reachability tasks, so a
+// worker stopped meanwhile does not hold the coordinator forever
+const vantageWait = 10 * time.Minute
+
+var (
+	vantageProxies []*url.URL // Proxies of -vantage, each a vantage point of its own
+	compareWorkers bool       // Have every worker fetch the live services too, set by -vantage-workers
+)
+
+// How one vantage point reached a service
+type vantageResult struct {
+	Vantage    string `json:"vantage"`               // "direct", a proxy without its credentials, or a worker
+	StatusCode int    `json:"status_code,omitempty"` // First response, before any redirect; 0 when none came
+	Error      string `json:"error,omitempty"`
+}
+
+// Answer of the first live service of a host from each vantage point
+type reachability struct {
+	URL      string          `json:"url"`
+	Vantages []vantageResult `json:"vantages"`
+	// Some vantage points got another status or no answer, as with geo
+	// blocking or allowlisted address ranges
+	Differs bool `json:"differs,omitempty"`
+}
+
+// Text shown for a reachability difference, e.g.
+// "[reachability: direct 200, http://10.0.0.2:3128 403]"
+func (r reachability) summary() string {
+	parts := make([]string, len(r.Vantages))
+	for i, v := range r.Vantages {
+		switch {
+		case v.StatusCode != 0:
+			parts[i] = v.Vantage + " " + strconv.Itoa(v.StatusCode)
+		case v.Error != "":
+			parts[i] = v.Vantage + " " + v.Error
+		default:
+			parts[i] = v.Vantage + " unreachable"
+		}
+	}
+	return "[reachability: " + strings.Join(parts, ", ") + "]"
+}
+
+// Read the -vantage list of proxy URLs
+func parseVantageProxies(value string) ([]*url.URL, error) {
+	var proxies []*url.URL
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		proxy, err := url.Parse(field)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", field)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme in %q (use http, https or socks5)", field)
+		}
+		proxies = append(proxies, proxy)
+	}
+	if len(proxies) == 0 {
+		return nil, errors.New("no proxies listed")
+	}
+	return proxies, nil
+}
+
+// Name a proxy by its URL without credentials
+func vantageName(proxy *url.URL) string {
+	return proxy.Scheme + "://" + proxy.Host
+}
+
+// Client fetching services through a proxy the way the probe does: any
+// certificate is accepted and redirects are not followed. The proxy resolves
+// the names itself, so DNS answers differing by location count too.
+func vantageClient(proxy *url.URL) *http.Client {
+	transport := &http.Transport{
+		Proxy:             http.ProxyURL(proxy),
+		DialContext:       (&net.Dialer{Timeout: requestTimeout}).DialContext,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	var roundTripper http.RoundTripper = transport
+	if canaryID != "" {
+		roundTripper = canaryTransport{base: transport, identifier: canaryID}
+	}
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: roundTripper,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Fetch a URL with a client and report the first response
+func fetchFromVantage(ctx context.Context, client *http.Client, name, target string) vantageResult {
+	result := vantageResult{Vantage: name}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = client.Do(req); err == nil {
+			resp.Body.Close()
+			result.StatusCode = resp.StatusCode
+			return result
+		}
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		result.Error = "timeout"
+	} else {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// First response of a probed service: the first hop of its redirects, or
+// its status when it did not redirect
+func firstStatus(service probeResult) int {
+	if len(service.Redirects) > 0 {
+		return service.Redirects[0].StatusCode
+	}
+	return service.StatusCode
+}
+
+// Attach the vantage points of a host, noting whether they disagree
+func setReachability(r *datedResult, target string, vantages []vantageResult) {
+	sort.SliceStable(vantages, func(i, j int) bool { return vantages[i].Vantage < vantages[j].Vantage })
+	info := &reachability{URL: target, Vantages: vantages}
+	for _, v := range vantages[1:] {
+		if v.StatusCode != vantages[0].StatusCode {
+			info.Differs = true
+		}
+	}
+	r.Vantages = info
+}
+
+// Print how many live hosts answer differently across vantage points
+func reportReachability(results []datedResult) {
+	compared, differing := 0, 0
+	for _, r := range results {
+		if r.Vantages != nil {
+			compared++
+			if r.Vantages.Differs {
+				differing++
+			}
+		}
+	}
+	if compared > 0 {
+		fmt.Printf("%d of %d live hosts answer differently across vantage points\n", differing, compared)
+	}
+}
+
+// Fetch the first live service of every probed host through each -vantage
+// proxy and compare the answers with the direct probe
+func compareProxyVantages(ctx context.Context, results []datedResult) {
+	clients := make([]*http.Client, len(vantageProxies))
+	for i, proxy := range vantageProxies {
+		clients[i] = vantageClient(proxy)
+	}
+	var indexes []int
+	for i, r := range results {
+		if len(r.Probes) > 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	if len(indexes) == 0 {
+		return
+	}
+	fmt.Printf("Fetching %d live services from %d vantage points\n", len(indexes), len(vantageProxies))
+
+	vantages := make(map[int][]vantageResult, len(indexes))
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, i := range indexes {
+		service := results[i].Probes[0]
+		lock.Lock()
+		vantages[i] = []vantageResult{{Vantage: directVantage, StatusCode: firstStatus(service)}}
+		lock.Unlock()
+		for p, proxy := range vantageProxies {
+			if ctx.Err() != nil {
+				break
+			}
+			pool.Go(func() {
+				answer := fetchFromVantage(ctx, clients[p], vantageName(proxy), service.URL)
+				lock.Lock()
+				vantages[i] = append(vantages[i], answer)
+				lock.Unlock()
+			})
+		}
+	}
+	pool.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+	for _, i := range indexes {
+		setReachability(&results[i], results[i].Probes[0].URL, vantages[i])
+	}
+	reportReachability(results)
+}
+
+// Redis list of the tasks meant for one worker only
+func workerQueueKey(worker string) string {
+	return taskQueueKey + ":" + worker
+}
+
+// Fetch the URLs of a reachability task, as the worker sees them: the
+// hosts are resolved with the resolvers of the worker, then dialed as the
+// probe does, once the worker's -quiet-hours are over
+func fetchWorkerVantage(ctx context.Context, worker string, urls []string) map[string]vantageResult {
+	if !waitQuietHours(ctx, "the reachability fetch") {
+		return nil
+	}
+	var hosts []string
+	for _, target := range urls {
+		if u, err := url.Parse(target); err == nil {
+			hosts = append(hosts, u.Hostname())
+		}
+	}
+	probeIPs = make(map[string]string)
+	for host, answer := range resolveHosts(ctx, uniqueStrings(hosts)) {
+		if len(answer.Addresses) > 0 {
+			probeIPs[host] = answer.Addresses[0]
+		}
+	}
+
+	answers := make(map[string]vantageResult, len(urls))
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, target := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			answer := fetchFromVantage(ctx, probeClient, worker, target)
+			lock.Lock()
+			answers[target] = answer
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+	return answers
+}
+
+// Ask every worker that answered the run to fetch the first live service of
+// each probed host, and record what each one got. Task IDs start at
+// firstID, after those of the enumeration.
+func compareWorkerVantages(ctx context.Context, conn *redisConn, run string, firstID int, workers []string, results map[string][]datedResult) error {
+	urls := make(map[string]bool)
+	for _, domainResults := range results {
+		for _, r := range domainResults {
+			if len(r.Probes) > 0 {
+				urls[r.Probes[0].URL] = true
+			}
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+	if len(workers) < 2 {
+		fmt.Println("Only one worker answered the run, so there are no vantage points to compare")
+		return nil
+	}
+	list := make([]string, 0, len(urls))
+	for target := range urls {
+		list = append(list, target)
+	}
+	sort.Strings(list)
+
+	pending := make(map[int]string, len(workers))
+	for i, worker := range workers {
+		task := distributedTask{Run: run, ID: firstID + i, URLs: list}
+		data, err := json.Marshal(task)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.do("LPUSH", workerQueueKey(worker), string(data)); err != nil {
+			return err
+		}
+		pending[task.ID] = worker
+	}
+	fmt.Printf("Asked %d workers to fetch %d live services\n", len(workers), len(list))
+
+	answers := make(map[string][]vantageResult)
+	deadline := time.Now().Add(vantageWait)
+	for len(pending) > 0 && ctx.Err() == nil && time.Now().Before(deadline) {
+		value, ok, err := conn.brpop(popWait, replyKey(run))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		var reply taskReply
+		if err := json.Unmarshal([]byte(value), &reply); err != nil || pending[reply.ID] == "" {
+			fmt.Println("Ignoring malformed reply")
+			continue
+		}
+		delete(pending, reply.ID)
+		for target, answer := range reply.Reachability {
+			answers[target] = append(answers[target], answer)
+		}
+	}
+	for _, worker := range pending {
+		fmt.Println("No reachability answer from", worker)
+		conn.do("DEL", workerQueueKey(worker))
+	}
+
+	for _, domainResults := range results {
+		for i, r := range domainResults {
+			if len(r.Probes) == 0 || len(answers[r.Probes[0].URL]) < 2 {
+				continue
+			}
+			setReachability(&domainResults[i], r.Probes[0].URL, answers[r.Probes[0].URL])
+		}
+	}
+	var all []datedResult
+	for _, domainResults := range results {
+		all = append(all, domainResults...)
+	}
+	reportReachability(all)
+	return nil
+}
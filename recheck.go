@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// Dispositions of a host under -recheck
+const (
+	recheckPending      = "pending"      // Still failing resolution, checked again in the next runs
+	recheckResolved     = "resolved"     // Resolved in a later check and kept
+	recheckCorroborated = "corroborated" // Reported by another source and kept
+	recheckDiscarded    = "discarded"    // Failed every check and dropped from the results
+)
+
+// Sources whose reports alone are doubtful: archives of old URLs and
+// aggregators of scraped or stale passive DNS data
+var defaultLowConfidenceSources = []string{"wayback", "threatminer", "sitedossier", "subdomaincenter"}
+
+var (
+	recheckRuns   int                                // Later runs checking a doubtful host again before discarding it, 0 to keep every host
+	lowConfidence map[string]bool                    // Sources of -low-confidence
+	hostSources   = make(map[string]map[string]bool) // Sources reporting each host in the run, guarded by mu
+)
+
+// A host that failed resolution when only a low-confidence source reported
+// it, and what became of it
+type recheckEntry struct {
+	Source      string    `json:"source"`
+	Failures    int       `json:"failures"` // Later checks that failed resolution too
+	Disposition string    `json:"disposition"`
+	Updated     time.Time `json:"updated"`
+}
+
+// Note a source reporting a host in the current run
+func recordHostSource(host, source string) {
+	host = scope.NormalizeHost(host)
+	if hostSources[host] == nil {
+		hostSources[host] = make(map[string]bool)
+	}
+	hostSources[host][source] = true
+}
+
+// Whether a host was reported in the current run by a source that is not
+// low-confidence or by several sources
+func corroborated(host string) bool {
+	sources := hostSources[host]
+	if len(sources) > 1 {
+		return true
+	}
+	for source := range sources {
+		return !lowConfidence[source]
+	}
+	return false
+}
+
+// Update the disposition of a host after this run's check and report
+// whether it stays in the results, with the new disposition or "" when
+// there is nothing to record. Hosts that resolve or are corroborated are
+// kept and only recorded when they were pending or discarded; a doubtful
+// host failing resolution is pending for recheckRuns more runs and then
+// discarded, from then on as soon as it fails again.
+func (h *history) recheck(host, source string, confirmed, resolved bool, now time.Time) (bool, string) {
+	entry, exists := h.Rechecks[host]
+	switch {
+	case confirmed || resolved:
+		if !exists || entry.Disposition == recheckResolved || entry.Disposition == recheckCorroborated {
+			return true, ""
+		}
+		entry.Disposition = recheckResolved
+		if confirmed {
+			entry.Disposition = recheckCorroborated
+		}
+	case !exists || entry.Disposition == recheckResolved || entry.Disposition == recheckCorroborated:
+		entry = recheckEntry{Source: source, Disposition: recheckPending}
+	case entry.Disposition == recheckPending:
+		if entry.Failures++; entry.Failures >= recheckRuns {
+			entry.Disposition = recheckDiscarded
+		}
+	}
+	entry.Updated = now
+	if h.Rechecks == nil {
+		h.Rechecks = make(map[string]recheckEntry)
+	}
+	h.Rechecks[host] = entry
+	return entry.Disposition != recheckDiscarded, entry.Disposition
+}
+
+// Resolve the hosts that only a low-confidence source reported, along with
+// the pending ones of previous runs, and keep or drop them as their
+// disposition says. Pending hosts no source reported this time stay in the
+// results until they are discarded. Nothing is recorded when the resolution
+// is interrupted.
+func recheckDoubtfulHosts(ctx context.Context, results []datedResult) []datedResult {
+	reported := make(map[string]bool, len(results))
+	var hosts []string
+	sources := make(map[string]string)
+	for _, r := range results {
+		if !reported[r.Host] {
+			reported[r.Host] = true
+			if !corroborated(r.Host) || pastRuns.Rechecks[r.Host].Disposition == recheckPending {
+				hosts = append(hosts, r.Host)
+				sources[r.Host] = r.Source
+			}
+		}
+	}
+	for host, entry := range pastRuns.Rechecks {
+		if entry.Disposition != recheckPending || reported[host] {
+			continue
+		}
+		if !resultFilter.Allows(host) || scopeOnly && !inEngagementScope(host) {
+			continue
+		}
+		hosts = append(hosts, host)
+		sources[host] = entry.Source
+		results = append(results, datedResult{Result: Result{Host: host, Source: entry.Source}, InScope: inEngagementScope(host)})
+	}
+	if len(hosts) == 0 {
+		return results
+	}
+	sort.Strings(hosts)
+
+	resolved := resolveHosts(ctx, hosts)
+	if ctx.Err() != nil {
+		return results
+	}
+	now := time.Now()
+	dispositions := make(map[string]string, len(hosts))
+	dropped := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, host := range hosts {
+		keep, disposition := pastRuns.recheck(host, sources[host], corroborated(host), len(resolved[host].Addresses) > 0, now)
+		if disposition == "" {
+			continue
+		}
+		dispositions[host] = disposition
+		dropped[host] = !keep
+		counts[disposition]++
+	}
+	if len(dispositions) > 0 {
+		fmt.Printf("Re-checked %d doubtful hosts: %d resolved, %d corroborated, %d pending, %d discarded\n",
+			len(dispositions), counts[recheckResolved], counts[recheckCorroborated], counts[recheckPending], counts[recheckDiscarded])
+	}
+
+	kept := results[:0]
+	for _, r := range results {
+		if dropped[r.Host] {
+			continue
+		}
+		r.Recheck = dispositions[r.Host]
+		kept = append(kept, r)
+	}
+	return kept
+}
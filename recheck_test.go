@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryRecheck(t *testing.T) {
+	recheckRuns = 2
+	defer func() { recheckRuns = 0 }()
+	type check struct {
+		confirmed, resolved bool
+		keep                bool
+		disposition         string
+	}
+	failed := check{keep: true, disposition: recheckPending}
+	tests := []struct {
+		name   string
+		checks []check // One per run, in order
+	}{
+		{"resolves at once", []check{{resolved: true, keep: true}}},
+		{"corroborated at once", []check{{confirmed: true, keep: true}}},
+		{"discarded after the re-checks", []check{failed, failed, {keep: false, disposition: recheckDiscarded}}},
+		{"resolves in a re-check", []check{failed, {resolved: true, keep: true, disposition: recheckResolved}, {resolved: true, keep: true}}},
+		{"corroborated in a re-check", []check{failed, failed, {confirmed: true, keep: true, disposition: recheckCorroborated}}},
+		{"discarded host failing again", []check{failed, failed, {keep: false, disposition: recheckDiscarded}, {keep: false, disposition: recheckDiscarded}}},
+		{"discarded host resolving later", []check{failed, failed, {keep: false, disposition: recheckDiscarded}, {resolved: true, keep: true, disposition: recheckResolved}}},
+		{"resolved host failing later", []check{failed, {resolved: true, keep: true, disposition: recheckResolved}, failed, failed, {keep: false, disposition: recheckDiscarded}}},
+	}
+	for _, tt := range tests {
+		h := &history{}
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		for run, c := range tt.checks {
+			keep, disposition := h.recheck("old.example.com", "wayback", c.confirmed, c.resolved, now)
+			if keep != c.keep || disposition != c.disposition {
+				t.Errorf("%s, run %d: got %v %q, want %v %q", tt.name, run+1, keep, disposition, c.keep, c.disposition)
+			}
+			if entry, exists := h.Rechecks["old.example.com"]; c.disposition != "" && (!exists || entry.Source != "wayback" || !entry.Updated.Equal(now)) {
+				t.Errorf("%s, run %d: recorded %+v", tt.name, run+1, entry)
+			}
+			now = now.Add(24 * time.Hour)
+		}
+	}
+}
+
+func TestCorroborated(t *testing.T) {
+	lowConfidence = map[string]bool{"wayback": true, "threatminer": true}
+	defer func() { lowConfidence, hostSources = nil, make(map[string]map[string]bool) }()
+	hostSources = make(map[string]map[string]bool)
+	recordHostSource("a.example.com", "wayback")
+	recordHostSource("b.example.com", "crtsh")
+	recordHostSource("C.example.com", "wayback")
+	recordHostSource("c.example.com", "threatminer")
+
+	for host, want := range map[string]bool{"a.example.com": false, "b.example.com": true, "c.example.com": true, "d.example.com": false} {
+		if got := corroborated(host); got != want {
+			t.Errorf("corroborated(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
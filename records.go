@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Record types gathered by -records for the apex and every subdomain
+var recordTypes = []uint16{dnsTypeMX, dnsTypeNS, dnsTypeTXT, dnsTypeSRV, dnsTypeSOA}
+
+// Service labels whose SRV records are looked up under the apex
+var srvServices = []string{
+	"_sip._tcp", "_sip._udp", "_sips._tcp", "_xmpp-client._tcp", "_xmpp-server._tcp", "_ldap._tcp",
+	"_kerberos._tcp", "_kerberos._udp", "_autodiscover._tcp", "_caldav._tcp", "_carddav._tcp", "_imaps._tcp", "_submission._tcp",
+}
+
+// Hostnames inside TXT records, such as SPF includes or verification targets
+var txtHostPattern = regexp.MustCompile(`(?i)[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?(?:\.[a-z0-9_](?:[a-z0-9_-]{0,61}[a-z0-9])?)+`)
+
+var (
+	gatherRecords bool                           // Collect the records of -records
+	hostRecords   map[string]map[string][]string // Records of each host by type name, guarded by mu
+)
+
+// Query the MX, NS, TXT, SRV and SOA records of the apex and of every name
+// found so far. In-scope hostnames those records mention are added as
+// results, and the records are kept for the output.
+func collectRecords(ctx context.Context, domain string) {
+	mu.Lock()
+	names := []string{domain}
+	seen := map[string]struct{}{domain: {}}
+	for _, r := range uniqueResults {
+		host := scope.NormalizeHost(r.Host)
+		if _, exists := seen[host]; !exists && host != "" {
+			seen[host] = struct{}{}
+			names = append(names, host)
+		}
+	}
+	mu.Unlock()
+
+	pool := newWorkerPool(concurrency)
+	for _, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			records := make(map[string][]string)
+			for _, rtype := range recordTypes {
+				if values := lookupRecords(name, rtype); len(values) > 0 {
+					records[dnsTypeName(rtype)] = values
+				}
+			}
+			if name == domain {
+				for _, service := range srvServices {
+					for _, value := range lookupRecords(service+"."+domain, dnsTypeSRV) {
+						records["SRV"] = append(records["SRV"], service+" "+value)
+					}
+				}
+			}
+			if len(records) == 0 {
+				return
+			}
+			mu.Lock()
+			hostRecords[name] = records
+			mu.Unlock()
+			addRecordHosts(domain, records)
+		})
+	}
+	pool.Wait()
+
+	if records := hostRecords[domain]; len(records) > 0 {
+		fmt.Println("DNS records of", domain+":")
+		printRecords(records)
+	}
+}
+
+// Values of the records of one type, retrying on other resolvers when one
+// fails
+func lookupRecords(name string, rtype uint16) []string {
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		msg, err := queryDNS(pickResolver(), name, rtype)
+		if err != nil || msg.Rcode != dnsRcodeSuccess && msg.Rcode != dnsRcodeNXDomain {
+			continue
+		}
+		var values []string
+		for _, record := range msg.Answers {
+			if record.Type == rtype {
+				values = append(values, record.Data)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Add the in-scope hostnames the records point to or mention
+func addRecordHosts(domain string, records map[string][]string) {
+	for rtype, values := range records {
+		for _, value := range values {
+			var candidates []string
+			switch rtype {
+			case "TXT":
+				candidates = txtHostPattern.FindAllString(value, -1)
+			case "SOA":
+				candidates = strings.Fields(value)[:1]
+			default:
+				if fields := strings.Fields(value); len(fields) > 0 {
+					candidates = fields[len(fields)-1:]
+				}
+			}
+			for _, candidate := range candidates {
+				if host := scope.NormalizeHost(candidate); host != domain && scope.IsInScope(host, domain) {
+					addSubdomain("records", host)
+				}
+			}
+		}
+	}
+}
+
+// Print records indented, one per line, sorted by type
+func printRecords(records map[string][]string) {
+	types := make([]string, 0, len(records))
+	for rtype := range records {
+		types = append(types, rtype)
+	}
+	sort.Strings(types)
+	for _, rtype := range types {
+		for _, value := range records[rtype] {
+			fmt.Printf("    %s %s\n", rtype, value)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Sources whose queries accept a name at any level below the apex, so they
+// can enumerate the subdomains found in the first pass. crt.sh and Wayback
+// are left out: their wildcard query for the apex already covers every level.
+var recursiveSources = map[string]bool{
+	"securitytrails":  true,
+	"virustotal":      true,
+	"sitedossier":     true,
+	"threatminer":     true,
+	"subdomaincenter": true,
+}
+
+// Levels below the apex whose names are enumerated again; 0 disables the
+// recursive pass
+var recursionDepth int
+
+// Run the sources that support it against the names discovered at each
+// level below the apex, one level after another, so the names a level finds
+// seed the next one
+func enumerateRecursively(ctx context.Context, domain string, sources []Source, session *Session) {
+	var eligible []Source
+	for _, source := range sources {
+		if recursiveSources[source.Name()] {
+			eligible = append(eligible, source)
+		}
+	}
+	if len(eligible) == 0 {
+		fmt.Println("None of the selected sources supports recursive enumeration")
+		return
+	}
+
+	pool := newWorkerPool(concurrency)
+	for level := 1; level <= recursionDepth && ctx.Err() == nil; level++ {
+		seeds := namesAtLevel(domain, level)
+		if len(seeds) == 0 {
+			return
+		}
+		fmt.Printf("Enumerating %d subdomains at level %d\n", len(seeds), level)
+		for _, seed := range seeds {
+			for _, source := range eligible {
+				pool.Go(func() {
+					runSource(ctx, source, seed, session)
+				})
+			}
+		}
+		pool.Wait()
+	}
+}
+
+// Distinct in-scope names found so far with the given number of labels
+// below the apex
+func namesAtLevel(domain string, level int) []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	seen := make(map[string]struct{})
+	var names []string
+	for _, r := range uniqueResults {
+		host := scope.NormalizeHost(r.Host)
+		if host == domain || !scope.IsInScope(host, domain) {
+			continue
+		}
+		if strings.Count(strings.TrimSuffix(host, "."+domain), ".")+1 != level {
+			continue
+		}
+		if _, exists := seen[host]; !exists {
+			seen[host] = struct{}{}
+			names = append(names, host)
+		}
+	}
+	return names
+}
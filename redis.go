@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Minimal Redis client speaking RESP, enough for the list commands of the
+// distributed mode
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Error reply of the server
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Connect to a redis://[:password@]host[:port][/db] URL
+func dialRedis(ctx context.Context, rawURL string) (*redisConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "redis" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid Redis URL %q (expected redis://[:password@]host[:port][/db])", rawURL)
+	}
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	dialer := net.Dialer{Timeout: requestTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if password, ok := u.User.Password(); ok {
+		args := []string{"AUTH", password}
+		if user := u.User.Username(); user != "" {
+			args = []string{"AUTH", user, password}
+		}
+		if _, err := c.do(args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if _, err := c.do("SELECT", db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// Send a command and read its reply: a string, an int64, nil or a []any
+func (c *redisConn) do(args ...string) (any, error) {
+	return c.doTimeout(requestTimeout, args...)
+}
+
+// Send a command whose reply may take up to timeout, such as a blocking pop
+func (c *redisConn) doTimeout(timeout time.Duration, args ...string) (any, error) {
+	c.conn.SetDeadline(time.Now().Add(timeout))
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch kind, rest := line[0], line[1:]; kind {
+	case '+':
+		return rest, nil
+	case '-':
+		return nil, redisError(rest)
+	case ':':
+		return strconv.ParseInt(rest, 10, 64)
+	case '$':
+		length, err := strconv.Atoi(rest)
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(rest)
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// Pop from the tail of the first non-empty list of keys, waiting up to wait
+// for an element. A nil reply with no error means the wait ended empty.
+func (c *redisConn) brpop(wait time.Duration, keys ...string) (string, bool, error) {
+	args := append(append([]string{"BRPOP"}, keys...), strconv.Itoa(int(wait/time.Second)))
+	reply, err := c.doTimeout(wait+requestTimeout, args...)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) != 2 {
+		return "", false, fmt.Errorf("redis: unexpected BRPOP reply %v", reply)
+	}
+	value, _ := items[1].(string)
+	return value, true, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedisReadReply(t *testing.T) {
+	tests := []struct {
+		name, reply string
+		want        any
+		wantErr     bool
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "error", reply: "-WRONGPASS invalid password\r\n", wantErr: true},
+		{name: "integer", reply: ":42\r\n", want: int64(42)},
+		{name: "negative integer", reply: ":-1\r\n", want: int64(-1)},
+		{name: "bulk string", reply: "$12\r\nhello\r\nworld\r\n", want: "hello\r\nworld"},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: ""},
+		{name: "nil bulk string", reply: "$-1\r\n", want: nil},
+		{name: "array", reply: "*2\r\n$4\r\njobs\r\n:7\r\n", want: []any{"jobs", int64(7)}},
+		{name: "nested array", reply: "*2\r\n*1\r\n+a\r\n*0\r\n", want: []any{[]any{"a"}, []any{}}},
+		{name: "nil array", reply: "*-1\r\n", want: nil},
+		{name: "empty line", reply: "\r\n", wantErr: true},
+		{name: "unknown type", reply: "%2\r\n", wantErr: true},
+		{name: "bad integer", reply: ":forty\r\n", wantErr: true},
+		{name: "bad length", reply: "$x\r\n", wantErr: true},
+		{name: "truncated bulk string", reply: "$5\r\nhel", wantErr: true},
+		{name: "truncated array", reply: "*2\r\n+a\r\n", wantErr: true},
+		{name: "no line end", reply: "+OK", wantErr: true},
+	}
+	for _, tt := range tests {
+		c := &redisConn{reader: bufio.NewReader(strings.NewReader(tt.reply))}
+		got, err := c.readReply()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+
+	c := &redisConn{reader: bufio.NewReader(strings.NewReader("-ERR unknown command\r\n"))}
+	if _, err := c.readReply(); err != redisError("ERR unknown command") {
+		t.Errorf("error %v, want the redisError of the reply", err)
+	}
+}
+
+func TestRedisCommandEncoding(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	c := &redisConn{conn: client, reader: bufio.NewReader(client)}
+
+	// Arguments are sent as bulk strings, so they may hold line breaks
+	const want = "*3\r\n$5\r\nLPUSH\r\n$4\r\njobs\r\n$8\r\na b\r\nc d\r\n"
+	request := make(chan string, 1)
+	go func() {
+		defer server.Close()
+		data := make([]byte, len(want))
+		io.ReadFull(server, data)
+		request <- string(data)
+		io.WriteString(server, ":1\r\n")
+	}()
+	reply, err := c.do("LPUSH", "jobs", "a b\r\nc d")
+	if err != nil || reply != int64(1) {
+		t.Errorf("reply %#v, %v", reply, err)
+	}
+	if got := <-request; got != want {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
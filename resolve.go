@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"LeviathanMapper/scope"
+)
+
+// Outcome of resolving one host
+type resolution struct {
+	Addresses []string
+	CNAMEs    []string    // Aliases followed from the host to the name holding the addresses
+	NXDomain  bool        // The resolver answered that the name does not exist
+	Answers   []dnsAnswer // Every CNAME, A and AAAA record of the answers
+	Resolver  string      // Server that answered
+	Dangling  string      // Response code of a CNAME target that does not resolve
+}
+
+// A record seen while resolving a host, as reported in -json output
+type dnsAnswer struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	TTL   uint32 `json:"ttl"`
+}
+
+// DNS servers used by the resolution stage, taken in turn. They default to
+// the nameservers of the system.
+var (
+	resolvers    = systemResolvers()
+	resolverTurn atomic.Uint32
+)
+
+// Public resolvers used when the system configuration lists none
+var fallbackResolvers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+// Server for the next query
+func pickResolver() string {
+	return resolvers[int(resolverTurn.Add(1)-1)%len(resolvers)]
+}
+
+// Nameservers listed in /etc/resolv.conf
+func systemResolvers() []string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return fallbackResolvers
+	}
+	defer file.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" && net.ParseIP(fields[1]) != nil {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	if len(servers) == 0 {
+		return fallbackResolvers
+	}
+	return servers
+}
+
+// Resolve hosts to their A and AAAA records, bounded by -concurrency, or
+// their A records through massdns when -massdns is given
+func resolveHosts(ctx context.Context, hosts []string) map[string]resolution {
+	if massDNSPath != "" && len(hosts) > 0 {
+		resolved, err := resolveWithMassDNS(ctx, hosts)
+		if err == nil {
+			return resolved
+		}
+		fmt.Println("Error resolving with massdns, using the native resolver:", err)
+	}
+	return resolveWith(ctx, hosts, lookupHost)
+}
+
+// Resolve hosts concurrently with the given lookup
+func resolveWith(ctx context.Context, hosts []string, lookup func(string) resolution) map[string]resolution {
+	resolved := make(map[string]resolution, len(hosts))
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+
+	for _, host := range hosts {
+		if ctx.Err() != nil {
+			break
+		}
+		pool.Go(func() {
+			answer := lookup(host)
+			lock.Lock()
+			resolved[host] = answer
+			lock.Unlock()
+		})
+	}
+	pool.Wait()
+	return resolved
+}
+
+// Look a host up, moving to the next resolver when one times out or fails
+func lookupHost(host string) resolution {
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		if answer, err := lookupAt(pickResolver(), host); err == nil {
+			return answer
+		}
+	}
+	return resolution{}
+}
+
+// Query one server for the A and AAAA records of a host, keeping the CNAME
+// chain the answers go through
+func lookupAt(server, host string) (resolution, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	answer := resolution{Resolver: server}
+	for _, qtype := range []uint16{dnsTypeA, dnsTypeAAAA} {
+		msg, err := queryDNS(server, host, qtype)
+		if err != nil {
+			return resolution{}, err
+		}
+		if msg.Rcode != dnsRcodeSuccess && msg.Rcode != dnsRcodeNXDomain {
+			return resolution{}, fmt.Errorf("%s answered with rcode %d", server, msg.Rcode)
+		}
+		chain, target := followCNAMEs(host, msg.Answers)
+		if answer.CNAMEs == nil {
+			answer.CNAMEs = chain
+		}
+		for _, record := range msg.Answers {
+			// Both queries repeat the CNAME records; keep them once
+			if record.Type == qtype || record.Type == dnsTypeCNAME && qtype == dnsTypeA {
+				answer.Answers = append(answer.Answers, dnsAnswer{record.Name, dnsTypeName(record.Type), record.Data, record.TTL})
+			}
+		}
+		if msg.Rcode == dnsRcodeNXDomain {
+			answer.NXDomain = true
+			return answer, nil
+		}
+		for _, record := range msg.Answers {
+			if record.Type == qtype && record.Name == target {
+				answer.Addresses = append(answer.Addresses, record.Data)
+			}
+		}
+	}
+	return answer, nil
+}
+
+// Follow the CNAME records of an answer starting at name. It returns the
+// aliases in order and the name at the end of the chain.
+func followCNAMEs(name string, records []dnsRecord) ([]string, string) {
+	var chain []string
+	seen := map[string]struct{}{name: {}}
+	for {
+		next := ""
+		for _, record := range records {
+			if record.Type == dnsTypeCNAME && record.Name == name {
+				next = record.Data
+				break
+			}
+		}
+		if _, loop := seen[next]; next == "" || loop {
+			return chain, name
+		}
+		seen[next] = struct{}{}
+		chain = append(chain, next)
+		name = next
+	}
+}
+
+// Attach the addresses and CNAME chain of every result, keeping the IP a
+// source reported.
+// Names under a wildcard record are dropped when every address they resolve
+// to is a wildcard answer. With dropNXDomain, hosts that do not exist are
+// removed too, and with onlyResolved every host left without an address.
+func resolveResults(ctx context.Context, domain string, results []datedResult, dropNXDomain, onlyResolved bool) []datedResult {
+	var hosts []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		if _, exists := seen[r.Host]; !exists {
+			seen[r.Host] = struct{}{}
+			hosts = append(hosts, r.Host)
+		}
+	}
+	resolved := resolveHosts(ctx, hosts)
+	wildcards := detectWildcards(ctx, domain, hosts)
+	dangling := findDanglingCNAMEs(ctx, hosts, resolved)
+
+	kept := results[:0]
+	filtered := 0
+	for _, r := range results {
+		answer, looked := resolved[r.Host]
+		if dropNXDomain && answer.NXDomain {
+			continue
+		}
+		if r.IP == "" && matchesWildcard(r.Host, answer.Addresses, wildcards) {
+			filtered++
+			continue
+		}
+		if r.IP != "" {
+			r.IPs = append(r.IPs, r.IP)
+		}
+		r.IPs = uniqueStrings(append(r.IPs, answer.Addresses...))
+		// Hosts left unresolved by an interruption are kept
+		if onlyResolved && looked && len(r.IPs) == 0 {
+			continue
+		}
+		r.CNAMEs = answer.CNAMEs
+		if broken, found := dangling[r.Host]; found {
+			r.CNAMEs = broken.CNAMEs
+			r.Dangling = broken.Dangling
+		}
+		r.DNS = answer.Answers
+		r.Resolver = answer.Resolver
+		kept = append(kept, r)
+	}
+	if filtered > 0 {
+		fmt.Printf("Filtered %d results that only resolve to wildcard DNS answers\n", filtered)
+	}
+	return kept
+}
+
+// Number of random labels queried under each zone to collect its wildcard
+// answers
+const wildcardProbes = 3
+
+// Find the zones with wildcard DNS among the apex and the parents of the
+// hosts, by resolving random labels under them. The result maps each
+// wildcard zone to the addresses its wildcard answers with.
+func detectWildcards(ctx context.Context, domain string, hosts []string) map[string]map[string]struct{} {
+	zones := map[string]struct{}{domain: {}}
+	for _, host := range hosts {
+		for parent := parentZone(host); parent != "" && parent != domain && scope.IsInScope(parent, domain); parent = parentZone(parent) {
+			zones[parent] = struct{}{}
+		}
+	}
+
+	probes := make(map[string]string)
+	var names []string
+	for zone := range zones {
+		for i := 0; i < wildcardProbes; i++ {
+			name := randomLabel() + "." + zone
+			probes[name] = zone
+			names = append(names, name)
+		}
+	}
+
+	wildcards := make(map[string]map[string]struct{})
+	for name, answer := range resolveHosts(ctx, names) {
+		if len(answer.Addresses) == 0 {
+			continue
+		}
+		zone := probes[name]
+		if wildcards[zone] == nil {
+			wildcards[zone] = make(map[string]struct{})
+			fmt.Println("Wildcard DNS detected on", zone)
+		}
+		for _, ip := range answer.Addresses {
+			wildcards[zone][ip] = struct{}{}
+		}
+	}
+	return wildcards
+}
+
+// Report whether a host resolves only to the wildcard answers of one of its
+// ancestor zones
+func matchesWildcard(host string, addresses []string, wildcards map[string]map[string]struct{}) bool {
+	if len(addresses) == 0 {
+		return false
+	}
+	for zone := parentZone(host); zone != ""; zone = parentZone(zone) {
+		answers, ok := wildcards[zone]
+		if !ok {
+			continue
+		}
+		all := true
+		for _, ip := range addresses {
+			if _, wildcard := answers[ip]; !wildcard {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// Name one label up, or "" for a single label
+func parentZone(host string) string {
+	if i := strings.IndexByte(host, '.'); i >= 0 {
+		return host[i+1:]
+	}
+	return ""
+}
+
+// Random DNS label that no real host is expected to use
+func randomLabel() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return "lm-" + hex.EncodeToString(buf)
+}
+
+// Load one DNS server per line, as an IP or IP:port (port 53 by default), a
+// DNS-over-TLS server written tls://host[:port] or a DNS-over-HTTPS URL, and
+// use them instead of the system nameservers
+func loadResolvers(path string) error {
+	loaded, err := readResolvers(path)
+	if err != nil {
+		return err
+	}
+	resolvers = loaded
+	return nil
+}
+
+// Read a resolvers file in the format of -r
+func readResolvers(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var loaded []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if isDoHResolver(line) {
+			loaded = append(loaded, line)
+			continue
+		}
+		if isDoTResolver(line) {
+			server, ok := parseDoTResolver(line)
+			if !ok {
+				return nil, fmt.Errorf("invalid resolver %q", line)
+			}
+			loaded = append(loaded, server)
+			continue
+		}
+		server := line
+		if net.ParseIP(line) != nil {
+			server = net.JoinHostPort(line, "53")
+		}
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			return nil, fmt.Errorf("invalid resolver %q", line)
+		}
+		loaded = append(loaded, server)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(loaded) == 0 {
+		return nil, errors.New("no resolvers listed")
+	}
+	return loaded, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Name whose A records every honest resolver returns, and one of them
+	healthCheckName    = "one.one.one.one"
+	healthCheckAddress = "1.1.1.1"
+	// Zone without a wildcard, so random names under it must be NXDOMAIN
+	healthCheckNXZone = "example.com"
+)
+
+// Tickers pacing the queries sent to each resolver of the pool, set by
+// -resolver-rate
+var resolverLimits map[string]<-chan time.Time
+
+// Wait for the turn of a rate-limited resolver
+func waitForResolver(server string) {
+	if tick, ok := resolverLimits[server]; ok {
+		<-tick
+	}
+}
+
+// Limit every resolver of the pool to perSecond queries
+func limitResolvers(perSecond float64) {
+	resolverLimits = make(map[string]<-chan time.Time, len(resolvers))
+	for _, server := range resolvers {
+		resolverLimits[server] = time.Tick(time.Duration(float64(time.Second) / perSecond))
+	}
+}
+
+// Test a resolver: it must answer a known record correctly and report
+// NXDOMAIN for a name that does not exist. It returns the latency of the
+// first answer.
+func checkResolver(server string) (time.Duration, error) {
+	start := time.Now()
+	msg, err := queryDNS(server, healthCheckName, dnsTypeA)
+	if err != nil {
+		return 0, err
+	}
+	latency := time.Since(start)
+	correct := false
+	for _, record := range msg.Answers {
+		if record.Type == dnsTypeA && record.Data == healthCheckAddress {
+			correct = true
+		}
+	}
+	if !correct {
+		return 0, fmt.Errorf("wrong answer for %s", healthCheckName)
+	}
+
+	msg, err = queryDNS(server, randomLabel()+"."+healthCheckNXZone, dnsTypeA)
+	if err != nil {
+		return 0, err
+	}
+	if msg.Rcode != dnsRcodeNXDomain {
+		return 0, fmt.Errorf("answers for names that do not exist")
+	}
+	return latency, nil
+}
+
+// Health-check the resolver pool and keep the servers that pass, fastest
+// first. When none passes the pool is left as it was, since the checks
+// themselves may be what the network blocks.
+func checkResolvers() {
+	latencies := make(map[string]time.Duration)
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, server := range resolvers {
+		pool.Go(func() {
+			if latency, err := checkResolver(server); err == nil {
+				lock.Lock()
+				latencies[server] = latency
+				lock.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+
+	if len(latencies) == 0 {
+		fmt.Println("No resolver passed the health check; keeping all of them")
+		return
+	}
+	healthy := make([]string, 0, len(latencies))
+	for server := range latencies {
+		healthy = append(healthy, server)
+	}
+	sort.Slice(healthy, func(i, j int) bool { return latencies[healthy[i]] < latencies[healthy[j]] })
+	fmt.Printf("%d of %d resolvers healthy (fastest %s at %s)\n", len(healthy), len(resolvers), healthy[0], latencies[healthy[0]].Round(time.Millisecond))
+	resolvers = healthy
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// A subdomain reported by a source, with the address details the source
+// returned when it has them
+type Result struct {
+	Host   string `json:"host"`
+	IP     string `json:"ip,omitempty"`
+	Port   int    `json:"port,omitempty"`
+	Source string `json:"source"`
+}
+
+// Fields that make two results distinct, selected with -dedup
+type dedupKey string
+
+const (
+	dedupHost     dedupKey = "host"
+	dedupHostIP   dedupKey = "host+ip"
+	dedupHostPort dedupKey = "host+port"
+)
+
+// Uniqueness key applied to every result
+var dedupBy = dedupHost
+
+// Validate the value given to -dedup
+func parseDedupKey(value string) (dedupKey, error) {
+	switch key := dedupKey(value); key {
+	case dedupHost, dedupHostIP, dedupHostPort:
+		return key, nil
+	}
+	return "", fmt.Errorf("unknown dedup key %q (use host, host+ip or host+port)", value)
+}
+
+// Identity of the result under the configured dedup key
+func (r Result) key() string {
+	switch dedupBy {
+	case dedupHostIP:
+		return r.Host + "|" + r.IP
+	case dedupHostPort:
+		return r.Host + "|" + strconv.Itoa(r.Port)
+	}
+	return r.Host
+}
+
+// Whether the result carries the field the dedup key adds to the host
+func (r Result) hasKeyField() bool {
+	switch dedupBy {
+	case dedupHostIP:
+		return r.IP != ""
+	case dedupHostPort:
+		return r.Port != 0
+	}
+	return true
+}
+
+// Text shown for the result: the host plus the fields that are part of the key
+func (r Result) label() string {
+	host := displayHost(r.Host)
+	if !r.hasKeyField() {
+		return host
+	}
+	switch dedupBy {
+	case dedupHostIP:
+		return fmt.Sprintf("%s [%s]", host, r.IP)
+	case dedupHostPort:
+		return net.JoinHostPort(host, strconv.Itoa(r.Port))
+	}
+	return host
+}
+
+// Show internationalized names in Unicode instead of Punycode
+var unicodeOutput bool
+
+// Host as shown to the user, decoded from Punycode with -unicode
+func displayHost(host string) string {
+	if unicodeOutput {
+		return scope.ToUnicode(host)
+	}
+	return host
+}
+
+// Function to add results avoiding duplicates
+func addResult(r Result) {
+	mu.Lock() // Mutex to avoid race conditions
+	defer mu.Unlock()
+
+	// Ignore subdomains containing '*'
+	if containsWildcard(r.Host) {
+		fmt.Println("Ignoring subdomain with wildcard:", r.Host)
+		return
+	}
+	// Sources may report internationalized names in either form; keep one
+	r.Host = scope.ToASCII(r.Host)
+	if !resultFilter.Allows(r.Host) || wasImported(r.Host) {
+		return
+	}
+
+	recordHostSource(r.Host, r.Source)
+	key := r.key()
+	if _, exists := uniqueResults[key]; !exists {
+		uniqueResults[key] = r
+		resultChan <- r
+	}
+}
+
+// Function to add a subdomain reported without address details
+func addSubdomain(source, subdomain string) {
+	addResult(Result{Host: subdomain, Source: source})
+}
+
+// Keep the earliest date at which any source saw the subdomain
+func recordFirstSeen(subdomain string, seen time.Time) {
+	if seen.IsZero() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	if current, exists := firstSeen[subdomain]; !exists || seen.Before(current) {
+		firstSeen[subdomain] = seen
+	}
+}
+
+// Print results as soon as any source reports them, so results from fast
+// sources are usable while slower ones are still running
+func streamResults(done chan<- struct{}) {
+	for r := range resultChan {
+		if newOnly && pastRuns.known(scope.NormalizeHost(r.Host)) || previousRun != nil && previousRun[scope.NormalizeHost(r.Host)] || scopeOnly && !inEngagementScope(r.Host) {
+			continue
+		}
+		if liveResults != nil {
+			liveResults(r)
+		}
+		if !quietStream {
+			fmt.Println("Subdomain found:", r.label())
+		}
+	}
+	close(done)
+}
+
+// A result together with the estimated age of its host; this is the data
+// available to -format templates and written by -json
+type datedResult struct {
+	Result
+	FirstSeen   time.Time           `json:"first_seen"`
+	IPs         []string            `json:"ips,omitempty"`          // Addresses of the host, filled in by -resolve or enrichment
+	CNAMEs      []string            `json:"cnames,omitempty"`       // CNAME chain of the host, in order, filled in by -resolve
+	DNS         []dnsAnswer         `json:"dns,omitempty"`          // Records behind those addresses, with their TTLs
+	Resolver    string              `json:"resolver,omitempty"`     // Server that answered the resolution
+	DNSSEC      string              `json:"dnssec,omitempty"`       // DNSSEC status of the name, filled in by -dnssec
+	CDN         string              `json:"cdn,omitempty"`          // CDN or WAF provider fronting the host
+	Dangling    string              `json:"dangling,omitempty"`     // NXDOMAIN or SERVFAIL when the CNAME target does not resolve
+	Takeover    string              `json:"takeover,omitempty"`     // Service whose unclaimed resource the CNAME points at, filled in by -takeover
+	Cloud       string              `json:"cloud,omitempty"`        // Cloud provider holding those addresses, filled in by -cloud
+	CloudRegion string              `json:"cloud_region,omitempty"` // Region of the provider, when published
+	Netblock    *netblockInfo       `json:"netblock,omitempty"`     // Registered netblock of the first address, filled in by -rdap
+	ASNs        []asnInfo           `json:"asns,omitempty"`         // Autonomous systems announcing those addresses, filled in by -asn-lookup
+	OpenPorts   []openPort          `json:"open_ports,omitempty"`   // TCP ports open on those addresses, filled in by -port-scan
+	Liveness    string              `json:"liveness,omitempty"`     // "alive" or "dead", filled in by -probe
+	Probes      []probeResult       `json:"probes,omitempty"`       // Web services that answered the probe
+	Vantages    *reachability       `json:"vantages,omitempty"`     // First live service from each vantage point, filled in by -vantage
+	Records     map[string][]string `json:"records,omitempty"`      // MX, NS, TXT, SRV and SOA records by type, filled in by -records
+	InternetDB  internetDBInfo      `json:"internetdb"`             // Shodan InternetDB data for those addresses
+	InScope     bool                `json:"in_scope"`               // Inside the -scope rules, always true without them
+	Change      string              `json:"change,omitempty"`       // "new" or "disappeared" since the previous run, filled in by -diff
+	Recheck     string              `json:"recheck,omitempty"`      // Disposition of a doubtful host, filled in by -recheck
+}
+
+// Encode the result for -json, leaving out the first-seen date and the
+// InternetDB data when there are none
+func (r datedResult) MarshalJSON() ([]byte, error) {
+	type plain datedResult
+	out := struct {
+		plain
+		FirstSeen  *time.Time      `json:"first_seen,omitempty"`
+		InternetDB *internetDBInfo `json:"internetdb,omitempty"`
+	}{plain: plain(r)}
+	if !r.FirstSeen.IsZero() {
+		out.FirstSeen = &r.FirstSeen
+	}
+	if info := r.InternetDB; len(info.Ports)+len(info.CPEs)+len(info.Tags)+len(info.Vulns) > 0 {
+		out.InternetDB = &r.InternetDB
+	}
+	return json.Marshal(out)
+}
+
+// Final dedup pass over everything the sources reported, collapsing hosts
+// that only differ in case or a trailing dot. When the dedup key includes an
+// IP or port, records lacking it are dropped for hosts that have a complete
+// record. Results are ordered newest first, since recently created hosts are
+// usually the least hardened; hosts without any dated evidence come last.
+func consolidateResults() []datedResult {
+	index := make(map[string]int, len(uniqueResults))
+	complete := make(map[string]bool)
+	consolidated := make([]datedResult, 0, len(uniqueResults))
+	for _, r := range uniqueResults {
+		seen := firstSeen[r.Host]
+		r.Host = scope.NormalizeHost(r.Host)
+		if r.Host == "" {
+			continue
+		}
+		if r.hasKeyField() {
+			complete[r.Host] = true
+		}
+		if i, exists := index[r.key()]; exists {
+			if !seen.IsZero() && (consolidated[i].FirstSeen.IsZero() || seen.Before(consolidated[i].FirstSeen)) {
+				consolidated[i].FirstSeen = seen
+			}
+			continue
+		}
+		index[r.key()] = len(consolidated)
+		consolidated = append(consolidated, datedResult{Result: r, FirstSeen: seen, InScope: inEngagementScope(r.Host), Records: hostRecords[r.Host]})
+	}
+
+	// Every record of a host shares its earliest evidence
+	earliest := make(map[string]time.Time)
+	for _, r := range consolidated {
+		if current, exists := earliest[r.Host]; !r.FirstSeen.IsZero() && (!exists || r.FirstSeen.Before(current)) {
+			earliest[r.Host] = r.FirstSeen
+		}
+	}
+	kept := consolidated[:0]
+	for _, r := range consolidated {
+		if !r.hasKeyField() && complete[r.Host] {
+			continue
+		}
+		r.FirstSeen = earliest[r.Host]
+		kept = append(kept, r)
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		a, b := kept[i], kept[j]
+		if !a.FirstSeen.Equal(b.FirstSeen) {
+			if a.FirstSeen.IsZero() || b.FirstSeen.IsZero() {
+				return b.FirstSeen.IsZero()
+			}
+			return a.FirstSeen.After(b.FirstSeen)
+		}
+		return a.label() < b.label()
+	})
+	return kept
+}
+
+// Function to check if a subdomain contains a wildcard '*'
+func containsWildcard(subdomain string) bool {
+	return len(subdomain) > 0 && subdomain[0] == '*'
+}
+
+// Function to print all results
+func printAllResults(results []datedResult) {
+	fmt.Println("\n=== Unique Subdomains Found ===")
+	for _, r := range results {
+		line := r.label()
+		if len(r.CNAMEs) > 0 {
+			line += " => " + strings.Join(r.CNAMEs, " => ")
+		}
+		if resolveNames && len(r.IPs) > 0 {
+			line += " -> " + strings.Join(r.IPs, ", ")
+		}
+		if !r.FirstSeen.IsZero() {
+			line += fmt.Sprintf(" (first seen %s)", r.FirstSeen.Format("2006-01-02"))
+		}
+		if r.CDN != "" {
+			line += " [cdn: " + r.CDN + "]"
+		}
+		if r.Dangling != "" {
+			line += " [dangling CNAME: " + r.Dangling + "]"
+		}
+		if r.Takeover != "" {
+			line += " [takeover: " + r.Takeover + "]"
+		}
+		if r.DNSSEC != "" {
+			line += " [DNSSEC " + r.DNSSEC + "]"
+		}
+		if r.Cloud != "" {
+			line += " " + cloudSummary(r)
+		}
+		if r.Netblock != nil {
+			line += " " + r.Netblock.summary()
+		}
+		for _, a := range r.ASNs {
+			line += " [" + a.String() + "]"
+		}
+		if len(r.OpenPorts) > 0 {
+			line += " " + portsSummary(r.OpenPorts)
+		}
+		if r.Liveness == hostDead {
+			line += " [dead]"
+		}
+		if r.Recheck != "" {
+			line += " [recheck: " + r.Recheck + "]"
+		}
+		for _, service := range r.Probes {
+			line += " " + service.summary()
+		}
+		if r.Vantages != nil && r.Vantages.Differs {
+			line += " " + r.Vantages.summary()
+		}
+		if summary := r.InternetDB.summary(); summary != "" {
+			line += " " + summary
+		}
+		if !r.InScope {
+			line += " [out of scope]"
+		}
+		if r.Change != "" {
+			line += " [" + r.Change + "]"
+		}
+		fmt.Println(line)
+		printRecords(r.Records)
+	}
+	fmt.Println("==============================")
+}
+
+// Function to print every result as a JSON object on its own line
+func printJSONResults(results []datedResult) {
+	encoder := json.NewEncoder(resultOutput)
+	for _, r := range results {
+		if err := encoder.Encode(r); err != nil {
+			fmt.Println("Error encoding result:", err)
+			return
+		}
+	}
+}
+
+// Where the -format and -json results are written: the standard output,
+// while every other line goes to stderr with those options
+var resultOutput io.Writer = os.Stdout
+
+// Function to print every result on its own line using a -format template
+func printFormattedResults(format *template.Template, results []datedResult) {
+	for _, r := range results {
+		if err := format.Execute(resultOutput, r); err != nil {
+			fmt.Println("Error formatting result:", err)
+			return
+		}
+		fmt.Fprintln(resultOutput)
+	}
+}
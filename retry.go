@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest wait before a retry; a rate limit that resets later than this
+// ends the retries instead
+const maxRetryDelay = time.Minute
+
+// Whether a status code may succeed on a later attempt: rate limits, request
+// timeouts and server errors. Anything else, 401 and 403 included, will
+// answer the same again.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+// Delay before the given retry, counted from 0: exponential from retryDelay
+// with jitter, so sources hitting the same limit do not retry in lockstep
+func backoffDelay(retry int) time.Duration {
+	delay := retryDelay << retry
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// How long the server asks to wait before the next request, from
+// Retry-After or the rate limit headers of the providers that use them
+func rateLimitDelay(header http.Header, now time.Time) (time.Duration, bool) {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return time.Duration(seconds) * time.Second, true
+		}
+		if date, err := http.ParseTime(value); err == nil {
+			return date.Sub(now), true
+		}
+	}
+	// Seconds until the window resets: the IETF RateLimit fields and
+	// Discord-style X-RateLimit-Reset-After
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset-After"} {
+		if seconds, err := strconv.ParseFloat(header.Get(name), 64); err == nil {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+	}
+	// GitHub-style epoch of the reset, or seconds until it for APIs that
+	// reuse the name
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if reset > 1e9 {
+			return time.Unix(reset, 0).Sub(now), true
+		}
+		return time.Duration(reset) * time.Second, true
+	}
+	return 0, false
+}
+
+// Wait before retrying after a response, or false when the server asks for
+// more than maxRetryDelay
+func retryWait(resp *http.Response, retry int) (time.Duration, bool) {
+	if resp != nil {
+		if delay, ok := rateLimitDelay(resp.Header, time.Now()); ok {
+			if delay > maxRetryDelay {
+				return 0, false
+			}
+			if delay > 0 {
+				return delay, true
+			}
+		}
+	}
+	return backoffDelay(retry), true
+}
@@ -0,0 +1,208 @@
+package scope
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parameters of the Punycode bootstring encoding (RFC 3492)
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+// ToASCII returns host with every label holding non-ASCII characters
+// converted to its Punycode "xn--" form, so Unicode and ASCII spellings of a
+// name compare equal. Labels are only lowercased; the full UTS #46 mapping
+// is not applied.
+func ToASCII(host string) string {
+	if isASCII(host) {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !isASCII(label) {
+			labels[i] = "xn--" + punycodeEncode([]rune(strings.ToLower(label)))
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// ToUnicode returns host with its "xn--" labels decoded for display. Labels
+// that are not valid Punycode are kept as they are.
+func ToUnicode(host string) string {
+	if !strings.Contains(host, "xn--") {
+		return host
+	}
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, "xn--") {
+			continue
+		}
+		if decoded, err := punycodeDecode(label[len("xn--"):]); err == nil && len(decoded) > 0 {
+			labels[i] = string(decoded)
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Bias adaptation of RFC 3492 section 6.1
+func punyAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+// Threshold for the digit at position k
+func punyThreshold(k, bias int) int {
+	switch t := k - bias; {
+	case t < punyTMin:
+		return punyTMin
+	case t > punyTMax:
+		return punyTMax
+	default:
+		return t
+	}
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyDigitValue(c byte) (int, bool) {
+	switch {
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a'), true
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A'), true
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26, true
+	}
+	return 0, false
+}
+
+// Encode a label with Punycode (RFC 3492 section 6.3)
+func punycodeEncode(input []rune) string {
+	var output []byte
+	for _, c := range input {
+		if c < utf8.RuneSelf {
+			output = append(output, byte(c))
+		}
+	}
+	basic := len(output)
+	handled := basic
+	if basic > 0 {
+		output = append(output, '-')
+	}
+
+	n, delta, bias := punyInitialN, 0, punyInitialBias
+	for handled < len(input) {
+		next := int(utf8.MaxRune) + 1
+		for _, c := range input {
+			if int(c) >= n && int(c) < next {
+				next = int(c)
+			}
+		}
+		delta += (next - n) * (handled + 1)
+		n = next
+		for _, c := range input {
+			if int(c) < n {
+				delta++
+			}
+			if int(c) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				output = append(output, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(output)
+}
+
+// Decode a Punycode label (RFC 3492 section 6.2)
+func punycodeDecode(input string) ([]rune, error) {
+	var output []rune
+	rest := input
+	if i := strings.LastIndexByte(input, '-'); i >= 0 {
+		for _, c := range input[:i] {
+			if c >= utf8.RuneSelf {
+				return nil, errors.New("non-ASCII character in Punycode")
+			}
+			output = append(output, c)
+		}
+		rest = input[i+1:]
+	}
+
+	n, i, bias := punyInitialN, 0, punyInitialBias
+	for pos := 0; pos < len(rest); {
+		previous, weight := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos >= len(rest) {
+				return nil, errors.New("truncated Punycode")
+			}
+			digit, ok := punyDigitValue(rest[pos])
+			pos++
+			if !ok {
+				return nil, errors.New("invalid Punycode digit")
+			}
+			i += digit * weight
+			if i > 1<<30 {
+				return nil, errors.New("Punycode overflow")
+			}
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			weight *= punyBase - t
+		}
+		bias = punyAdapt(i-previous, len(output)+1, previous == 0)
+		n += i / (len(output) + 1)
+		if n > utf8.MaxRune {
+			return nil, errors.New("Punycode overflow")
+		}
+		i %= len(output) + 1
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return output, nil
+}
@@ -0,0 +1,53 @@
+package scope
+
+import "testing"
+
+func TestToASCII(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"www.bücher.example", "www.xn--bcher-kva.example"},
+		{"пример.рф", "xn--e1afmkfd.xn--p1ai"},
+		{"中国.cn", "xn--fiqs8s.cn"},
+		// Sample (L) of RFC 3492 section 7.1, mixing basic and non-basic
+		// code points, lowercased
+		{"3年B組金八先生.jp", "xn--3b-ww4c5e180e575a65lsy2b.jp"},
+	}
+	for _, tt := range tests {
+		if got := ToASCII(tt.host); got != tt.want {
+			t.Errorf("ToASCII(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		host, want string
+	}{
+		{"www.example.com", "www.example.com"},
+		{"xn--mnchen-3ya.de", "münchen.de"},
+		{"xn--e1afmkfd.xn--p1ai", "пример.рф"},
+		{"xn--3B-ww4c5e180e575a65lsy2b.jp", "3年B組金八先生.jp"},
+		// Labels that are not valid Punycode are kept
+		{"xn--mnchen-3y.de", "xn--mnchen-3y.de"},
+		{"xn--a@b.example", "xn--a@b.example"},
+		{"xn--99999999999.example", "xn--99999999999.example"},
+		{"xn--.example", "xn--.example"},
+	}
+	for _, tt := range tests {
+		if got := ToUnicode(tt.host); got != tt.want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestPunycodeDecodeErrors(t *testing.T) {
+	for _, label := range []string{"mnchen-3y", "a@b", "99999999999", "ü-3ya"} {
+		if decoded, err := punycodeDecode(label); err == nil {
+			t.Errorf("punycodeDecode(%q) = %q, want an error", label, string(decoded))
+		}
+	}
+}
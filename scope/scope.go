@@ -0,0 +1,258 @@
+// Package scope holds the hostname and scope helpers used by LeviathanMapper,
+// exposed so code embedding the engine applies the same rules to its own data.
+package scope
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Multi-label public suffixes under which registrable domains have three
+// labels. This is a short built-in list, not the full Public Suffix List.
+var multiLabelSuffixes = map[string]struct{}{
+	"co.uk": {}, "org.uk": {}, "ac.uk": {}, "gov.uk": {}, "me.uk": {}, "ltd.uk": {}, "plc.uk": {},
+	"com.au": {}, "net.au": {}, "org.au": {}, "edu.au": {}, "gov.au": {},
+	"co.nz": {}, "org.nz": {}, "govt.nz": {},
+	"co.jp": {}, "ne.jp": {}, "or.jp": {}, "ac.jp": {}, "go.jp": {},
+	"co.kr": {}, "or.kr": {}, "go.kr": {},
+	"com.br": {}, "net.br": {}, "org.br": {}, "gov.br": {},
+	"com.mx": {}, "org.mx": {}, "gob.mx": {},
+	"com.ar": {}, "org.ar": {}, "gob.ar": {},
+	"com.cn": {}, "net.cn": {}, "org.cn": {}, "gov.cn": {},
+	"com.hk": {}, "org.hk": {}, "com.tw": {}, "org.tw": {},
+	"co.in": {}, "net.in": {}, "org.in": {}, "gov.in": {},
+	"co.za": {}, "org.za": {}, "gov.za": {},
+	"com.sg": {}, "com.my": {}, "com.tr": {}, "com.co": {}, "com.pe": {}, "com.ve": {},
+	"co.il": {}, "org.il": {}, "co.id": {}, "or.id": {}, "com.ru": {}, "com.ua": {},
+}
+
+// NormalizeHost returns host in the canonical form used for comparisons:
+// lower case, internationalized labels in Punycode, and without surrounding
+// spaces, scheme, port, path or trailing dot.
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if strings.Contains(host, "://") {
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return ""
+		}
+		host = parsed.Hostname()
+	} else if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if i := strings.IndexAny(host, "/?#"); i >= 0 {
+		host = host[:i]
+	}
+	return ToASCII(strings.TrimSuffix(strings.ToLower(host), "."))
+}
+
+// Apex returns the registrable domain of host, e.g. "example.co.uk" for
+// "api.dev.example.co.uk". Hosts with fewer labels are returned unchanged.
+func Apex(host string) string {
+	host = NormalizeHost(host)
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return host
+	}
+
+	keep := 2
+	if len(labels) >= 3 {
+		if _, ok := multiLabelSuffixes[strings.Join(labels[len(labels)-2:], ".")]; ok {
+			keep = 3
+		}
+	}
+	if len(labels) <= keep {
+		return host
+	}
+	return strings.Join(labels[len(labels)-keep:], ".")
+}
+
+// IsInScope reports whether host is one of roots or a subdomain of one of
+// them. Matching is done on label boundaries, so "badexample.com" is not in
+// scope for "example.com".
+func IsInScope(host string, roots ...string) bool {
+	host = NormalizeHost(host)
+	if host == "" {
+		return false
+	}
+	for _, root := range roots {
+		root = strings.TrimPrefix(NormalizeHost(root), "*.")
+		if root == "" {
+			continue
+		}
+		if host == root || strings.HasSuffix(host, "."+root) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandWildcards replaces wildcard names such as "*.dev.example.com" with
+// the name they are rooted at ("dev.example.com"), which a wildcard
+// certificate or record shows to exist. The result is normalized, sorted and
+// free of duplicates.
+func ExpandWildcards(names []string) []string {
+	seen := make(map[string]struct{}, len(names))
+	expanded := make([]string, 0, len(names))
+	for _, name := range names {
+		name = NormalizeHost(name)
+		for strings.HasPrefix(name, "*.") {
+			name = name[2:]
+		}
+		if name == "" || strings.Contains(name, "*") {
+			continue
+		}
+		if _, exists := seen[name]; exists {
+			continue
+		}
+		seen[name] = struct{}{}
+		expanded = append(expanded, name)
+	}
+	sort.Strings(expanded)
+	return expanded
+}
+
+// Filter narrows a set of hosts with include and exclude patterns. A host
+// passes when it matches any include pattern, or there are none, and matches
+// no exclude pattern.
+type Filter struct {
+	Include []*regexp.Regexp
+	Exclude []*regexp.Regexp
+}
+
+// Allows reports whether host passes f. Hosts are normalized before
+// matching.
+func (f *Filter) Allows(host string) bool {
+	host = NormalizeHost(host)
+	for _, pattern := range f.Exclude {
+		if pattern.MatchString(host) {
+			return false
+		}
+	}
+	if len(f.Include) == 0 {
+		return true
+	}
+	for _, pattern := range f.Include {
+		if pattern.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// Glob compiles a shell-style pattern such as "*.dev.example.com" or
+// "*.prod.*" into a regular expression matching whole hostnames. "*" matches
+// any run of characters, dots included, and "?" matches a single character.
+func Glob(pattern string) (*regexp.Regexp, error) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, c := range NormalizeHost(pattern) {
+		switch c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// ParseBurp reads a scope exported from Burp Suite (Target > Scope > Save
+// options). Advanced mode entries contribute their host regular expression;
+// basic mode entries contribute the exact host of their URL prefix. Disabled
+// entries are ignored.
+func ParseBurp(data []byte) (*Filter, error) {
+	type entry struct {
+		Enabled bool   `json:"enabled"`
+		Host    string `json:"host"`
+		Prefix  string `json:"prefix"`
+	}
+	var project struct {
+		Target struct {
+			Scope struct {
+				Include []entry `json:"include"`
+				Exclude []entry `json:"exclude"`
+			} `json:"scope"`
+		} `json:"target"`
+	}
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, err
+	}
+
+	compile := func(entries []entry) ([]*regexp.Regexp, error) {
+		var patterns []*regexp.Regexp
+		for _, e := range entries {
+			if !e.Enabled {
+				continue
+			}
+			expr := e.Host
+			if expr == "" && e.Prefix != "" {
+				expr = "^" + regexp.QuoteMeta(NormalizeHost(e.Prefix)) + "$"
+			}
+			if expr == "" {
+				continue
+			}
+			// Burp matches case-insensitively
+			pattern, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("scope entry %q: %v", expr, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return patterns, nil
+	}
+
+	filter := &Filter{}
+	var err error
+	if filter.Include, err = compile(project.Target.Scope.Include); err != nil {
+		return nil, err
+	}
+	if filter.Exclude, err = compile(project.Target.Scope.Exclude); err != nil {
+		return nil, err
+	}
+	if len(filter.Include) == 0 {
+		return nil, fmt.Errorf("scope has no enabled include entries")
+	}
+	return filter, nil
+}
+
+// ParseList reads a plain scope file with one host or glob per line, such
+// as "example.com" or "*.example.com". Lines starting with "-" or "!"
+// exclude what follows them; blank lines and "#" comments are skipped.
+func ParseList(r io.Reader) (*Filter, error) {
+	filter := &Filter{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		target := &filter.Include
+		if line[0] == '-' || line[0] == '!' {
+			target = &filter.Exclude
+			line = strings.TrimSpace(line[1:])
+		}
+		pattern, err := Glob(line)
+		if err != nil {
+			return nil, err
+		}
+		*target = append(*target, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(filter.Include) == 0 {
+		return nil, fmt.Errorf("scope has no include entries")
+	}
+	return filter, nil
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// Browser user agents rotated between search engine requests
+var searchUserAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.4 Safari/605.1.15",
+	"Mozilla/5.0 (X11; Linux x86_64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:125.0) Gecko/20100101 Firefox/125.0",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 Edg/124.0.0.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/123.0.0.0 Safari/537.36",
+}
+
+// Text that shows an engine answered with a captcha or verification page
+// instead of results
+var searchBlockMarkers = map[string]string{
+	"yandex": "showcaptcha",
+	"baidu":  "wappass.baidu.com",
+}
+
+// Dork used by the scraping engines: every subdomain except www
+func searchQuery(domain string) string {
+	return fmt.Sprintf("site:*.%s -site:www.%s", domain, domain)
+}
+
+// Matches hostnames under the domain anywhere in a results page
+func searchHostPattern(domain string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+` + regexp.QuoteMeta(domain))
+}
+
+// Fetch a results page with a random browser user agent
+func fetchSearchPage(ctx context.Context, pageURL string) (string, error) {
+	req, _ := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	req.Header.Set("User-Agent", searchUserAgents[rand.Intn(len(searchUserAgents))])
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+
+	resp, err := fetchWithRetries(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	// Result links are often percent-encoded inside redirect URLs
+	page := string(body)
+	if unescaped, err := url.QueryUnescape(page); err == nil {
+		page += "\n" + unescaped
+	}
+	return page, nil
+}
+
+// Page through a search engine, stopping when a page brings nothing new. The
+// delay between pages is randomized around the configured value so the
+// scraping stays polite.
+func scrapeSearchEngine(ctx context.Context, source, name, domain string, opts searchEngineOptions, out chan<- Result, pageURL func(page int) string) {
+	pattern := searchHostPattern(domain)
+	seen := make(map[string]struct{})
+
+	for page := 0; page < opts.MaxPages; page++ {
+		if page > 0 {
+			time.Sleep(politeDelay(opts.DelaySeconds))
+		}
+
+		body, err := fetchSearchPage(ctx, pageURL(page))
+		if err != nil {
+			fmt.Printf("Error querying %s: %v\n", name, err)
+			return
+		}
+		if marker, ok := searchBlockMarkers[source]; ok && strings.Contains(body, marker) {
+			fmt.Printf("%s answered with a captcha. Skipping remaining pages.\n", name)
+			return
+		}
+
+		found := 0
+		for _, match := range pattern.FindAllString(body, -1) {
+			hostname := scope.NormalizeHost(match)
+			if _, exists := seen[hostname]; exists || !scope.IsInScope(hostname, domain) {
+				continue
+			}
+			seen[hostname] = struct{}{}
+			out <- Result{Host: hostname, Source: source}
+			found++
+		}
+		if found == 0 {
+			return
+		}
+	}
+}
+
+// Wait between one and two times the configured number of seconds
+func politeDelay(seconds float64) time.Duration {
+	base := time.Duration(seconds * float64(time.Second))
+	return base + time.Duration(rand.Int63n(int64(base)+1))
+}
+
+// Register the search engine sources
+func init() {
+	for _, source := range []sourceFunc{
+		{"bing", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromBing(ctx, domain, session.Config.Sources.Bing, out)
+		}},
+		{"duckduckgo", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromDuckDuckGo(ctx, domain, session.Config.Sources.DuckDuckGo, out)
+		}},
+		{"yandex", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromYandex(ctx, domain, session.Config.Sources.Yandex, out)
+		}},
+		{"baidu", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromBaidu(ctx, domain, session.Config.Sources.Baidu, out)
+		}},
+		{"google", func(ctx context.Context, domain string, session *Session, out chan<- Result) {
+			fetchFromGoogle(ctx, domain, session.Config.Sources.Google, out)
+		}},
+	} {
+		registerSource(source)
+	}
+}
+
+// Function to scrape Bing results
+func fetchFromBing(ctx context.Context, domain string, opts searchEngineOptions, out chan<- Result) {
+	query := url.QueryEscape(searchQuery(domain))
+	scrapeSearchEngine(ctx, "bing", "Bing", domain, opts, out, func(page int) string {
+		return fmt.Sprintf("https://www.bing.com/search?q=%s&first=%d", query, page*10+1)
+	})
+}
+
+// Function to scrape DuckDuckGo results from its HTML frontend
+func fetchFromDuckDuckGo(ctx context.Context, domain string, opts searchEngineOptions, out chan<- Result) {
+	query := url.QueryEscape(searchQuery(domain))
+	scrapeSearchEngine(ctx, "duckduckgo", "DuckDuckGo", domain, opts, out, func(page int) string {
+		return fmt.Sprintf("https://html.duckduckgo.com/html/?q=%s&s=%d&dc=%d", query, page*30, page*30+1)
+	})
+}
+
+// Function to scrape Yandex results, which often index Russian-hosted
+// infrastructure missing from western engines
+func fetchFromYandex(ctx context.Context, domain string, opts searchEngineOptions, out chan<- Result) {
+	query := url.QueryEscape("site:" + domain)
+	scrapeSearchEngine(ctx, "yandex", "Yandex", domain, opts, out, func(page int) string {
+		return fmt.Sprintf("https://yandex.com/search/?text=%s&p=%d", query, page)
+	})
+}
+
+// Function to scrape Baidu results, which cover Chinese-hosted infrastructure
+func fetchFromBaidu(ctx context.Context, domain string, opts searchEngineOptions, out chan<- Result) {
+	query := url.QueryEscape("site:" + domain)
+	scrapeSearchEngine(ctx, "baidu", "Baidu", domain, opts, out, func(page int) string {
+		return fmt.Sprintf("https://www.baidu.com/s?wd=%s&pn=%d", query, page*10)
+	})
+}
+
+// Function to query the Google Programmable Search Engine JSON API. Every
+// query is counted against a daily budget kept on disk, so repeated runs stay
+// inside the free quota.
+func fetchFromGoogle(ctx context.Context, domain string, opts googleOptions, out chan<- Result) {
+	if apiKeyGoogle == "" || googleSearchEngineID == "" {
+		sourceNotConfigured("Google")
+		return
+	}
+
+	usage := loadGoogleUsage()
+	query := "site:" + domain
+	start := 1
+	for sent := 0; sent < opts.MaxQueries && start > 0; sent++ {
+		if usage.Queries >= opts.DailyLimit {
+			fmt.Println("Google daily query limit reached. Skipping remaining pages.")
+			break
+		}
+
+		params := url.Values{}
+		params.Set("key", apiKeyGoogle)
+		params.Set("cx", googleSearchEngineID)
+		params.Set("q", query)
+		params.Set("start", fmt.Sprint(start))
+		req, _ := http.NewRequestWithContext(ctx, "GET", "https://www.googleapis.com/customsearch/v1?"+params.Encode(), nil)
+
+		usage.Queries++
+		resp, err := fetchWithRetries(req)
+		if err != nil {
+			fmt.Println("Error querying Google:", err)
+			break
+		}
+
+		var result struct {
+			Items []struct {
+				Link string `json:"link"`
+			} `json:"items"`
+			Queries struct {
+				NextPage []struct {
+					StartIndex int `json:"startIndex"`
+				} `json:"nextPage"`
+			} `json:"queries"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			break
+		}
+
+		for _, item := range result.Items {
+			if hostname := scope.NormalizeHost(item.Link); scope.IsInScope(hostname, domain) {
+				out <- Result{Host: hostname, Source: "google"}
+			}
+		}
+		// The API serves at most 100 results per query
+		start = 0
+		if len(result.Queries.NextPage) > 0 && result.Queries.NextPage[0].StartIndex <= 91 {
+			start = result.Queries.NextPage[0].StartIndex
+		}
+	}
+	saveGoogleUsage(usage)
+}
+
+// Queries sent to the Google API on a given day
+type googleUsage struct {
+	Date    string `json:"date"`
+	Queries int    `json:"queries"`
+}
+
+// File holding the Google query count, in the user cache directory
+func googleUsagePath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "leviathanmapper", "google-usage.json")
+}
+
+// Google resets the quota at midnight Pacific time
+func googleQuotaDay() string {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		location = time.UTC
+	}
+	return time.Now().In(location).Format("2006-01-02")
+}
+
+// Load today's query count, starting from zero on a new day
+func loadGoogleUsage() googleUsage {
+	today := googleQuotaDay()
+	var usage googleUsage
+	if data, err := os.ReadFile(googleUsagePath()); err == nil {
+		json.Unmarshal(data, &usage)
+	}
+	if usage.Date != today {
+		usage = googleUsage{Date: today}
+	}
+	return usage
+}
+
+// Persist the query count for the next runs of the day
+func saveGoogleUsage(usage googleUsage) {
+	path := googleUsagePath()
+	data, _ := json.Marshal(usage)
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		fmt.Println("Error saving Google query count:", err)
+	}
+}
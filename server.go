@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// Bearer token required by the API when set
+var apiToken = os.Getenv("LEVIATHANMAPPER_API_TOKEN")
+
+// Jobs waiting for the worker beyond which new ones are refused
+const maxQueuedJobs = 100
+
+// Job states
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobCancelled = "cancelled"
+	jobFailed    = "failed"
+)
+
+// An enumeration submitted to the API
+type job struct {
+	ID       string     `json:"id"`
+	Domain   string     `json:"domain"`
+	Sources  []string   `json:"sources,omitempty"` // Subset of the server sources, all of them when empty
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	Results  int        `json:"results"` // Number of results once the job ended
+	Created  time.Time  `json:"created"`
+	Started  *time.Time `json:"started,omitempty"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	results []datedResult
+	cancel  context.CancelFunc
+	live    chan Result // Results as they are found, for streaming RPCs
+	resume  bool        // Continue from the checkpoint of a run cut short by a restart
+}
+
+// Queue of jobs run one at a time, since a scan keeps its state in the
+// package globals, with the options given to the server on the command line
+type jobServer struct {
+	mu      sync.Mutex
+	jobs    map[string]*job
+	order   []string // IDs in submission order
+	queue   chan *job
+	jobsDir string // Where the jobs are kept across restarts, if anywhere
+
+	sources    []Source
+	session    *Session
+	historyDir string
+	internetDB bool
+}
+
+// Serve the API until ctx is cancelled, then stop the running job. With a
+// jobs directory, the jobs of the previous server are listed again and the
+// queued and running ones run first.
+func serveAPI(ctx context.Context, listen, jobsDir string, sources []Source, session *Session, historyDir string, internetDB bool) error {
+	restored, err := loadJobs(jobsDir)
+	if err != nil {
+		return fmt.Errorf("reading jobs: %v", err)
+	}
+	s := &jobServer{
+		jobs:       make(map[string]*job),
+		queue:      make(chan *job, maxQueuedJobs+len(restored)),
+		jobsDir:    jobsDir,
+		sources:    sources,
+		session:    session,
+		historyDir: historyDir,
+		internetDB: internetDB,
+	}
+	// Jobs cut short by a restart continue from their checkpoints
+	keepCheckpoints = jobsDir != ""
+	pending := 0
+	for _, j := range restored {
+		s.jobs[j.ID] = j
+		s.order = append(s.order, j.ID)
+		switch j.Status {
+		case jobRunning:
+			j.Status, j.Started, j.resume = jobQueued, nil, true
+			fallthrough
+		case jobQueued:
+			s.queue <- j
+			pending++
+		}
+	}
+	if len(restored) > 0 {
+		fmt.Printf("Restored %d jobs, %d of them to run\n", len(restored), pending)
+	}
+	go s.work(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", s.submit)
+	mux.HandleFunc("GET /jobs", s.list)
+	mux.HandleFunc("GET /jobs/{id}", s.status)
+	mux.HandleFunc("GET /jobs/{id}/results", s.results)
+	mux.HandleFunc("DELETE /jobs/{id}", s.remove)
+	mux.HandleFunc("POST /jobs/{id}/retry", s.retry)
+	mux.HandleFunc("POST /"+grpcService+"/Enumerate", s.enumerate)
+	server := &http.Server{Addr: listen, Handler: requireToken(mux), ReadHeaderTimeout: 10 * time.Second}
+	// gRPC clients connect with HTTP/2 without TLS
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+
+	// Streaming calls get to send their final status before the exit
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdown)
+	}()
+	fmt.Println("Listening on", listen)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// Reject requests without the LEVIATHANMAPPER_API_TOKEN bearer token, when
+// one is set
+func requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if apiToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(apiToken)) != 1 {
+			if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				writeGRPCStatus(w, false, grpcUnauthenticated, "missing or invalid API token")
+			} else {
+				writeError(w, http.StatusUnauthorized, "missing or invalid API token")
+			}
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Run the queued jobs in order
+func (s *jobServer) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			s.endQueuedStreams()
+			return
+		case j := <-s.queue:
+			s.run(ctx, j)
+		}
+	}
+}
+
+// End the calls of the streaming jobs still queued at shutdown, which never
+// ran
+func (s *jobServer) endQueuedStreams() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.Status == jobQueued && j.live != nil {
+			close(j.live)
+			j.live = nil
+		}
+	}
+}
+
+func (s *jobServer) run(ctx context.Context, j *job) {
+	s.mu.Lock()
+	if j.Status != jobQueued {
+		s.mu.Unlock()
+		return
+	}
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	started := time.Now()
+	j.Status, j.Started, j.cancel = jobRunning, &started, cancel
+	s.saveJob(j)
+	s.mu.Unlock()
+	if j.live != nil {
+		liveResults = func(r Result) {
+			select {
+			case j.live <- r:
+			case <-jobCtx.Done():
+			}
+		}
+		defer func() {
+			liveResults = nil
+			close(j.live)
+		}()
+	}
+
+	fmt.Printf("Job %s: enumerating %s\n", j.ID, j.Domain)
+	sources, err := selectSources(s.sources, strings.Join(j.Sources, ","))
+	var results []datedResult
+	if err == nil {
+		resumeScan = j.resume
+		results, err = enumerateTarget(jobCtx, j.Domain, sources, s.session, s.historyDir, s.internetDB)
+		if errors.Is(err, errTargetFinished) {
+			// The restart came after the checkpoint recorded the end of
+			// the scan but before the job did
+			resumeScan = false
+			results, err = enumerateTarget(jobCtx, j.Domain, sources, s.session, s.historyDir, s.internetDB)
+		}
+		resumeScan = false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.cancel = nil
+	if ctx.Err() != nil {
+		// Stopped by the shutdown of the server: the kept job stays running
+		// and continues from its checkpoint after the restart
+		fmt.Printf("Job %s: interrupted by the shutdown\n", j.ID)
+		return
+	}
+	finished := time.Now()
+	j.Finished = &finished
+	switch {
+	case err != nil:
+		j.Status, j.Error = jobFailed, err.Error()
+	case jobCtx.Err() != nil:
+		j.Status = jobCancelled
+	default:
+		j.Status = jobDone
+	}
+	// A cancelled job keeps what it found before stopping
+	j.results, j.Results = results, len(results)
+	s.saveJob(j)
+	fmt.Printf("Job %s: %s with %d results\n", j.ID, j.Status, j.Results)
+}
+
+// POST /jobs with {"domain": "example.com", "sources": ["crtsh"]}
+func (s *jobServer) submit(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Domain  string   `json:"domain"`
+		Sources []string `json:"sources"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	domain := scope.NormalizeHost(request.Domain)
+	if domain == "" {
+		writeError(w, http.StatusBadRequest, "missing domain")
+		return
+	}
+	if _, err := selectSources(s.sources, strings.Join(request.Sources, ",")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	j, ok := s.enqueue(domain, request.Sources, nil)
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "too many queued jobs")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// Queue a job, or report false when the queue is full. With live, the job
+// sends every result on it as it is found and closes it once done.
+func (s *jobServer) enqueue(domain string, sources []string, live chan Result) (job, bool) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	j := &job{ID: hex.EncodeToString(id), Domain: domain, Sources: sources, Status: jobQueued, Created: time.Now(), live: live}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case s.queue <- j:
+	default:
+		return job{}, false
+	}
+	s.jobs[j.ID] = j
+	s.order = append(s.order, j.ID)
+	s.saveJob(j)
+	return *j, true
+}
+
+// GET /jobs
+func (s *jobServer) list(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	jobs := make([]job, 0, len(s.order))
+	for _, id := range s.order {
+		jobs = append(jobs, *s.jobs[id])
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+// GET /jobs/{id}
+func (s *jobServer) status(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.job(w, r)
+	if ok {
+		writeJSON(w, http.StatusOK, j)
+	}
+}
+
+// GET /jobs/{id}/results, available once the job ended
+func (s *jobServer) results(w http.ResponseWriter, r *http.Request) {
+	j, ok := s.job(w, r)
+	if !ok {
+		return
+	}
+	if j.Status == jobQueued || j.Status == jobRunning {
+		writeError(w, http.StatusConflict, "job is "+j.Status)
+		return
+	}
+	results := j.results
+	if results == nil {
+		results = []datedResult{}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// DELETE /jobs/{id} cancels a queued or running job
+func (s *jobServer) remove(w http.ResponseWriter, r *http.Request) {
+	if !s.cancelJob(r.PathValue("id")) {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// POST /jobs/{id}/retry queues an ended job again, discarding its results
+func (s *jobServer) retry(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	j, ok := s.jobs[r.PathValue("id")]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	if j.Status == jobQueued || j.Status == jobRunning {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "job is "+j.Status)
+		return
+	}
+	select {
+	case s.queue <- j:
+	default:
+		s.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "too many queued jobs")
+		return
+	}
+	// A streaming job already ended its call; the retry is fetched with REST
+	j.Status, j.Error, j.Results, j.Started, j.Finished = jobQueued, "", 0, nil, nil
+	j.results, j.live, j.resume = nil, nil, false
+	s.saveJob(j)
+	retried := *j
+	s.mu.Unlock()
+	writeJSON(w, http.StatusAccepted, retried)
+}
+
+// Cancel a queued or running job, reporting false when there is none with
+// that ID
+func (s *jobServer) cancelJob(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return false
+	}
+	switch {
+	case j.Status == jobQueued:
+		finished := time.Now()
+		j.Status, j.Finished = jobCancelled, &finished
+		s.saveJob(j)
+		if j.live != nil {
+			close(j.live)
+		}
+	case j.cancel != nil:
+		j.cancel()
+	}
+	return true
+}
+
+// Copy of the job named in the path, or a 404 answer
+func (s *jobServer) job(w http.ResponseWriter, r *http.Request) (job, bool) {
+	j, ok := s.lookup(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown job")
+	}
+	return j, ok
+}
+
+// Copy of a job
+func (s *jobServer) lookup(id string) (job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return job{}, false
+	}
+	return *j, true
+}
+
+func writeJSON(w http.ResponseWriter, code int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, map[string]string{"error": message})
+}
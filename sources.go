@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// A provider of subdomains. A new source is a file that implements Source
+// and registers it from its init function; -sources then selects it by name.
+type Source interface {
+	Name() string
+	// Run enumerates the subdomains of domain, sending them on the returned
+	// channel, which is closed once the source is done
+	Run(ctx context.Context, domain string, session *Session) <-chan Result
+}
+
+// State shared by the sources of a scan
+type Session struct {
+	Config config // Per-source options, from -config
+}
+
+// A source backed by a function that sends its results on out and returns
+// once it is done
+type sourceFunc struct {
+	name string
+	run  func(ctx context.Context, domain string, session *Session, out chan<- Result)
+}
+
+func (s sourceFunc) Name() string { return s.name }
+
+func (s sourceFunc) Run(ctx context.Context, domain string, session *Session) <-chan Result {
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		s.run(ctx, domain, session, out)
+	}()
+	return out
+}
+
+// Passive sources, in the order they registered
+var registeredSources []Source
+
+// Make a source selectable with -sources
+func registerSource(source Source) {
+	for _, registered := range registeredSources {
+		if registered.Name() == source.Name() {
+			panic("source " + source.Name() + " registered twice")
+		}
+	}
+	registeredSources = append(registeredSources, source)
+}
+
+// Keep only the sources named in a comma-separated list; an empty list
+// selects every source
+func selectSources(all []Source, list string) ([]Source, error) {
+	if list == "" {
+		return all, nil
+	}
+
+	byName := make(map[string]Source, len(all))
+	for _, source := range all {
+		byName[source.Name()] = source
+	}
+	var selected []Source
+	for _, name := range strings.Split(list, ",") {
+		source, ok := byName[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown source %q", name)
+		}
+		selected = append(selected, source)
+	}
+	return selected, nil
+}
+
+// Run a source against a domain with its request timeout, adding everything
+// it reports
+func runSource(ctx context.Context, source Source, domain string, session *Session) {
+	ctx = withRequestTimeout(ctx, sourceTimeout(source.Name()))
+	for r := range source.Run(ctx, domain, session) {
+		addResult(r)
+	}
+}
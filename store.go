@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Directory receiving the raw responses of the probe, one file per host,
+// set by -store-responses
+var responseDir string
+
+// Append a response as read by the probe: request line, status line,
+// headers and the body read
+func appendResponse(raw []byte, resp *http.Response, body []byte) []byte {
+	if responseDir == "" {
+		return nil
+	}
+	var buf bytes.Buffer
+	buf.Write(raw)
+	fmt.Fprintf(&buf, "> GET %s\n", resp.Request.URL)
+	fmt.Fprintf(&buf, "%s %s\n", resp.Proto, resp.Status)
+	resp.Header.Write(&buf)
+	buf.WriteString("\n")
+	buf.Write(body)
+	buf.WriteString("\n\n")
+	return buf.Bytes()
+}
+
+// Write the responses of every service of a host to its file
+func storeResponses(host string, services []probeResult) {
+	var raw []byte
+	for _, service := range services {
+		raw = append(raw, service.responses...)
+	}
+	if len(raw) == 0 {
+		return
+	}
+	if err := os.WriteFile(filepath.Join(responseDir, host+".txt"), raw, 0o644); err != nil {
+		fmt.Println("Error storing the responses of", host+":", err)
+	}
+}
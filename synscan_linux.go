@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Source port of the SYN probes, which the answers are matched on
+const synSourcePort = 48713
+
+// Half-open scan: send a bare SYN to every port over a raw socket and count
+// the ports answering SYN-ACK as open. The kernel resets those connections
+// itself, having no socket for them. Needs root or CAP_NET_RAW; IPv6
+// addresses are connect-scanned.
+func synScanAll(ctx context.Context, ips []string, ports []int) (map[string][]int, error) {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_TCP)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+	// Short reads, so the receiver notices the end of the scan
+	timeout := syscall.NsecToTimeval((200 * time.Millisecond).Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return nil, err
+	}
+
+	open := make(map[string][]int)
+	var lock sync.Mutex
+	done := make(chan struct{})
+	var receiving sync.WaitGroup
+	receiving.Add(1)
+	go func() {
+		defer receiving.Done()
+		reported := make(map[string]bool)
+		buf := make([]byte, 1500)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil || n < 20 {
+				continue
+			}
+			ip, port, ok := synAckFrom(buf[:n])
+			key := net.JoinHostPort(ip, strconv.Itoa(port))
+			if !ok || reported[key] {
+				continue
+			}
+			reported[key] = true
+			lock.Lock()
+			open[ip] = append(open[ip], port)
+			lock.Unlock()
+		}
+	}()
+
+	var ipv6 []string
+	for _, ip := range ips {
+		dst := net.ParseIP(ip).To4()
+		if dst == nil {
+			ipv6 = append(ipv6, ip)
+			continue
+		}
+		src, err := sourceAddress(ip)
+		if err != nil {
+			continue
+		}
+		for _, port := range ports {
+			if ctx.Err() != nil {
+				break
+			}
+			packet := synPacket(src, dst, port)
+			addr := &syscall.SockaddrInet4{}
+			copy(addr.Addr[:], dst)
+			// A full send buffer is retried once after a pause
+			if err := syscall.Sendto(fd, packet, 0, addr); err == syscall.ENOBUFS {
+				time.Sleep(10 * time.Millisecond)
+				syscall.Sendto(fd, packet, 0, addr)
+			}
+		}
+	}
+	// Wait for the last answers unless the scan was interrupted
+	select {
+	case <-time.After(portScanTimeout):
+	case <-ctx.Done():
+	}
+	close(done)
+	receiving.Wait()
+
+	for ip, ports := range connectScanAll(ctx, ipv6, ports) {
+		open[ip] = ports
+	}
+	return open, nil
+}
+
+// Local address the kernel routes packets to ip from
+func sourceAddress(ip string) (net.IP, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, "80"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.To4(), nil
+}
+
+// TCP header of a SYN from the scan's source port to port
+func synPacket(src, dst net.IP, port int) []byte {
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint16(header[0:], synSourcePort)
+	binary.BigEndian.PutUint16(header[2:], uint16(port))
+	rand.Read(header[4:8]) // Sequence number
+	header[12] = 5 << 4    // Data offset: no options
+	header[13] = 0x02      // SYN
+	binary.BigEndian.PutUint16(header[14:], 1024)
+
+	// The checksum covers a pseudo-header with both addresses
+	pseudo := make([]byte, 0, 32)
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	pseudo = append(pseudo, 0, syscall.IPPROTO_TCP, 0, byte(len(header)))
+	pseudo = append(pseudo, header...)
+	binary.BigEndian.PutUint16(header[16:], internetChecksum(pseudo))
+	return header
+}
+
+// RFC 1071 checksum
+func internetChecksum(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
+// Address and port of a SYN-ACK answering one of the scan's probes, from an
+// IPv4 packet read off the raw socket
+func synAckFrom(packet []byte) (string, int, bool) {
+	ihl := int(packet[0]&0x0f) * 4
+	if len(packet) < ihl+14 {
+		return "", 0, false
+	}
+	tcp := packet[ihl:]
+	if binary.BigEndian.Uint16(tcp[2:]) != synSourcePort || tcp[13]&0x12 != 0x12 {
+		return "", 0, false
+	}
+	ip := net.IP(packet[12:16]).String()
+	return ip, int(binary.BigEndian.Uint16(tcp[0:])), true
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// SYN scans need raw sockets, only implemented on Linux
+func synScanAll(ctx context.Context, ips []string, ports []int) (map[string][]int, error) {
+	return nil, errors.New("SYN scan is only supported on Linux")
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Check the CNAME targets of the results for subdomain takeovers, set by
+// -takeover
+var checkTakeovers bool
+
+// How a service shows that the name pointing at it is not claimed. The
+// page of an unclaimed resource holds body; services marked nxdomain
+// instead release the CNAME target itself, which then does not exist.
+type takeoverFingerprint struct {
+	service  string
+	cnames   []string // Parts of the CNAME targets of the service
+	body     string
+	nxdomain bool
+}
+
+// Services known to let anyone claim a name left pointing at them, after
+// the can-i-take-over-xyz list
+var takeoverFingerprints = []takeoverFingerprint{
+	{service: "GitHub Pages", cnames: []string{".github.io"}, body: "There isn't a GitHub Pages site here."},
+	{service: "Heroku", cnames: []string{".herokuapp.com", ".herokudns.com"}, body: "no-such-app.html"},
+	{service: "Amazon S3", cnames: []string{".s3.amazonaws.com", ".s3-website", ".s3.dualstack."}, body: "NoSuchBucket"},
+	{service: "Amazon Elastic Beanstalk", cnames: []string{".elasticbeanstalk.com"}, nxdomain: true},
+	{service: "Microsoft Azure", cnames: []string{".azurewebsites.net", ".cloudapp.net", ".cloudapp.azure.com", ".trafficmanager.net", ".blob.core.windows.net", ".azureedge.net", ".azure-api.net"}, nxdomain: true},
+	{service: "Fastly", cnames: []string{".fastly.net"}, body: "Fastly error: unknown domain"},
+	{service: "Shopify", cnames: []string{".myshopify.com"}, body: "Sorry, this shop is currently unavailable."},
+	{service: "Tumblr", cnames: []string{"domains.tumblr.com"}, body: "Whatever you were looking for doesn't currently exist at this address."},
+	{service: "Ghost", cnames: []string{".ghost.io"}, body: "The thing you were looking for is no longer here"},
+	{service: "Pantheon", cnames: []string{".pantheonsite.io"}, body: "The gods are wise, but do not know of the site which you seek."},
+	{service: "Surge.sh", cnames: []string{".surge.sh"}, body: "project not found"},
+	{service: "Bitbucket", cnames: []string{".bitbucket.io"}, body: "Repository not found"},
+	{service: "Zendesk", cnames: []string{".zendesk.com"}, body: "Help Center Closed"},
+	{service: "WordPress.com", cnames: []string{".wordpress.com"}, body: "Do you want to register"},
+	{service: "Readme.io", cnames: []string{".readme.io"}, body: "Project doesnt exist... yet!"},
+	{service: "Webflow", cnames: []string{"proxy.webflow.com", "proxy-ssl.webflow.com"}, body: "The page you are looking for doesn't exist or has been moved."},
+	{service: "Agile CRM", cnames: []string{".agilecrm.com"}, body: "Sorry, this page is no longer available."},
+	{service: "Help Scout", cnames: []string{".helpscoutdocs.com"}, body: "No settings were found for this company:"},
+	{service: "Helpjuice", cnames: []string{".helpjuice.com"}, body: "We could not find what you're looking for."},
+	{service: "Kinsta", cnames: []string{".kinsta.cloud"}, body: "No Site For Domain"},
+	{service: "LaunchRock", cnames: []string{".launchrock.com"}, body: "It looks like you may have taken a wrong turn somewhere."},
+	{service: "Ngrok", cnames: []string{".ngrok.io"}, body: ".ngrok.io not found"},
+	{service: "Pingdom", cnames: []string{"stats.pingdom.com"}, body: "Sorry, couldn't find the status page"},
+	{service: "Canny", cnames: []string{".canny.io"}, body: "Company Not Found"},
+	{service: "SmartJobBoard", cnames: []string{".smartjobboard.com"}, body: "This job board website is either expired or its domain name is invalid."},
+}
+
+// Fingerprint of the service a CNAME chain points at, if any
+func takeoverService(chain []string) (takeoverFingerprint, bool) {
+	for _, name := range chain {
+		for _, fingerprint := range takeoverFingerprints {
+			for _, part := range fingerprint.cnames {
+				if strings.Contains(name, part) {
+					return fingerprint, true
+				}
+			}
+		}
+	}
+	return takeoverFingerprint{}, false
+}
+
+// Whether the pages of a host show the unclaimed-resource signature
+func servesTakeoverPage(ctx context.Context, host, signature string) bool {
+	for _, scheme := range []string{"https", "http"} {
+		if _, body, err := probeGet(ctx, scheme+"://"+host); err == nil && strings.Contains(string(body), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether a host pointing at a service can be taken over
+func takeoverCandidate(ctx context.Context, r datedResult, fingerprint takeoverFingerprint) bool {
+	if fingerprint.nxdomain {
+		return lookupHost(r.CNAMEs[len(r.CNAMEs)-1]).NXDomain
+	}
+	return servesTakeoverPage(ctx, r.Host, fingerprint.body)
+}
+
+// Flag the results whose CNAME points at a service that lets anyone claim
+// the resource behind it, and whose answer shows the resource is unclaimed
+func checkTakeoverResults(ctx context.Context, results []datedResult) {
+	services := make(map[string]takeoverFingerprint)
+	for _, r := range results {
+		if fingerprint, ok := takeoverService(r.CNAMEs); ok {
+			services[r.Host] = fingerprint
+		}
+	}
+	if len(services) == 0 {
+		return
+	}
+	fmt.Printf("Checking %d hosts for subdomain takeover\n", len(services))
+
+	// Pages are fetched from the resolved addresses, like the probe does
+	probeIPs = make(map[string]string)
+	for _, r := range results {
+		if _, exists := probeIPs[r.Host]; !exists && len(r.IPs) > 0 {
+			probeIPs[r.Host] = r.IPs[0]
+		}
+	}
+
+	vulnerable := make(map[string]string)
+	var lock sync.Mutex
+	pool := newWorkerPool(concurrency)
+	for _, r := range results {
+		fingerprint, ok := services[r.Host]
+		if !ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		delete(services, r.Host)
+		pool.Go(func() {
+			if takeoverCandidate(ctx, r, fingerprint) {
+				lock.Lock()
+				vulnerable[r.Host] = fingerprint.service
+				lock.Unlock()
+			}
+		})
+	}
+	pool.Wait()
+
+	reported := make(map[string]bool)
+	for i := range results {
+		service, found := vulnerable[results[i].Host]
+		if found && !reported[results[i].Host] {
+			reported[results[i].Host] = true
+			fmt.Printf("Possible subdomain takeover: %s (%s)\n", results[i].Host, service)
+		}
+		results[i].Takeover = service
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+// Report whether stdin is a pipe or a file rather than a terminal
+func stdinIsPiped() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// Read one target domain per line, skipping blank lines, comments and
+// repeated domains
+func readTargets(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return uniqueTargets(lines), scanner.Err()
+}
+
+// Normalize target domains and drop repeated ones, keeping the given order
+func uniqueTargets(domains []string) []string {
+	var targets []string
+	seen := make(map[string]struct{}, len(domains))
+	for _, domain := range domains {
+		domain = scope.NormalizeHost(domain)
+		if _, exists := seen[domain]; exists || domain == "" {
+			continue
+		}
+		seen[domain] = struct{}{}
+		targets = append(targets, domain)
+	}
+	return targets
+}
+
+// Values of a flag that can be repeated and takes comma-separated values,
+// such as -domain
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,4 @@
+HTTP/1.1 200 OK
+Content-Type: application/json
+
+{"status_code": "200", "results": ["mail.example.com", "a.example.com"]}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Request timeout of each source, by name; sources missing from it use
+// -timeout. Filled from source_timeouts in the config file and -source-timeout.
+var sourceTimeouts = make(map[string]time.Duration)
+
+// Timeout of the requests of a source
+func sourceTimeout(name string) time.Duration {
+	if timeout, ok := sourceTimeouts[name]; ok {
+		return timeout
+	}
+	return requestTimeout
+}
+
+// Parse a -source-timeout list, e.g. "crtsh=2m,wayback=90s"
+func parseSourceTimeouts(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, field := range strings.Split(value, ",") {
+		name, duration, found := strings.Cut(strings.TrimSpace(field), "=")
+		timeout, err := time.ParseDuration(strings.TrimSpace(duration))
+		if !found || err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid source timeout %q", field)
+		}
+		timeouts[strings.ToLower(strings.TrimSpace(name))] = timeout
+	}
+	return timeouts, nil
+}
+
+type requestTimeoutKey struct{}
+
+// Attach the timeout applied to every request made with ctx
+func withRequestTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, requestTimeoutKey{}, timeout)
+}
+
+// Transport bounding each request, body included, by the timeout of its
+// context, or -timeout when it carries none
+type timeoutTransport struct {
+	base http.RoundTripper
+}
+
+func (t timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout, ok := req.Context().Value(requestTimeoutKey{}).(time.Duration)
+	if !ok {
+		timeout = requestTimeout
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// Response body releasing the timeout of its request once closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
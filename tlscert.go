@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"LeviathanMapper/scope"
+)
+
+// A certificate presented by a probed HTTPS service
+type tlsCertificate struct {
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer"`
+	NotAfter time.Time `json:"not_after"`
+	Names    []string  `json:"names,omitempty"` // Subject alternative names
+}
+
+// Fields of a certificate kept in the results
+func certificateInfo(cert *x509.Certificate) *tlsCertificate {
+	issuer := cert.Issuer.CommonName
+	if len(cert.Issuer.Organization) > 0 {
+		issuer = cert.Issuer.Organization[0]
+	}
+	return &tlsCertificate{
+		Subject:  cert.Subject.CommonName,
+		Issuer:   issuer,
+		NotAfter: cert.NotAfter,
+		Names:    cert.DNSNames,
+	}
+}
+
+// Text shown for the certificate: issuer and expiry
+func (c *tlsCertificate) summary() string {
+	expiry := "expires " + c.NotAfter.Format("2006-01-02")
+	if time.Now().After(c.NotAfter) {
+		expiry = "expired " + c.NotAfter.Format("2006-01-02")
+	}
+	return "tls: " + c.Issuer + ", " + expiry
+}
+
+// In-scope names of the certificates presented to a batch of probed hosts
+// that are not among the known results yet, returned as new results.
+// Wildcard names stand for their parent zone.
+func certificateNames(domain string, known, batch []datedResult) []datedResult {
+	hosts := make(map[string]struct{}, len(known))
+	for _, r := range known {
+		hosts[r.Host] = struct{}{}
+	}
+
+	var found []datedResult
+	for _, r := range batch {
+		for _, service := range r.Probes {
+			if service.TLS == nil {
+				continue
+			}
+			for _, name := range service.TLS.Names {
+				host := scope.NormalizeHost(strings.TrimPrefix(name, "*."))
+				if _, exists := hosts[host]; exists || !scope.IsInScope(host, domain) || !resultFilter.Allows(host) || wasImported(host) || scopeOnly && !inEngagementScope(host) {
+					continue
+				}
+				hosts[host] = struct{}{}
+				found = append(found, datedResult{
+					Result:  Result{Host: host, Source: "tls"},
+					InScope: inEngagementScope(host),
+				})
+			}
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].Host < found[j].Host })
+	for _, r := range found {
+		if !quietStream {
+			fmt.Println("Subdomain found:", r.label())
+		}
+	}
+	fmt.Printf("Certificates named %d new hosts\n", len(found))
+	return found
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Open a raw TCP connection to addr through a proxy: CONNECT for HTTP and
+// HTTPS proxies, the CONNECT command for SOCKS5 ones. It serves the
+// connections that do not go through http.Transport, such as the JARM
+// handshakes. The proxy resolves addr when it is a name.
+func dialProxyTunnel(proxy *url.URL, addr string, timeout time.Duration) (net.Conn, error) {
+	port := proxy.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080", "socks5h": "1080"}[proxy.Scheme]
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(proxy.Hostname(), port), timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	switch proxy.Scheme {
+	case "https":
+		conn = tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		fallthrough
+	case "http":
+		err = connectHTTPTunnel(conn, proxy, addr)
+	case "socks5", "socks5h":
+		err = connectSOCKSTunnel(conn, proxy, addr)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme %q", proxy.Scheme)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func connectHTTPTunnel(conn net.Conn, proxy *url.URL, addr string) error {
+	request := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		request += "Proxy-Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(proxy.User.Username()+":"+password)) + "\r\n"
+	}
+	if _, err := io.WriteString(conn, request+"\r\n"); err != nil {
+		return err
+	}
+	// Nothing follows the answer until the client speaks
+	resp, err := http.ReadResponse(bufio.NewReaderSize(conn, 1), &http.Request{Method: "CONNECT"})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused the tunnel to %s: %s", addr, resp.Status)
+	}
+	return nil
+}
+
+// RFC 1928, with the username and password authentication of RFC 1929
+func connectSOCKSTunnel(conn net.Conn, proxy *url.URL, addr string) error {
+	greeting := []byte{5, 1, 0}
+	if proxy.User != nil {
+		greeting = []byte{5, 2, 0, 2}
+	}
+	if _, err := conn.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	switch {
+	case reply[0] != 5:
+		return errors.New("not a SOCKS5 proxy")
+	case reply[1] == 2 && proxy.User != nil:
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		auth := append([]byte{1, byte(len(username))}, username...)
+		auth = append(append(auth, byte(len(password))), password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 proxy rejected the credentials")
+		}
+	case reply[1] != 0:
+		return errors.New("SOCKS5 proxy offered no usable authentication")
+	}
+
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return err
+	}
+	request := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		request = append(append(request, 1), ip.To4()...)
+	} else if ip != nil {
+		request = append(append(request, 4), ip...)
+	} else {
+		request = append(append(request, 3, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return fmt.Errorf("SOCKS5 proxy refused the tunnel to %s (reply %d)", addr, header[1])
+	}
+	// Skip the address the proxy bound, then the port
+	bound := map[byte]int{1: 4, 4: 16}[header[3]]
+	if header[3] == 3 {
+		if _, err := io.ReadFull(conn, header[:1]); err != nil {
+			return err
+		}
+		bound = int(header[0])
+	}
+	_, err = io.ReadFull(conn, make([]byte, bound+2))
+	return err
+}
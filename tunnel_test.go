@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Serve a single connection on a local listener with handle, returning the
+// listener address
+func serveOnce(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		handle(conn)
+	}()
+	return listener.Addr().String()
+}
+
+// Check the tunnel carries bytes both ways once it is open
+func checkTunnelEcho(t *testing.T, conn net.Conn) {
+	t.Helper()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(conn, reply); err != nil || string(reply) != "HELLO" {
+		t.Errorf("got %q (%v) through the tunnel, want HELLO", reply, err)
+	}
+}
+
+// Answer the client's five bytes in upper case
+func echoUpper(conn io.ReadWriter) {
+	data := make([]byte, 5)
+	if _, err := io.ReadFull(conn, data); err == nil {
+		conn.Write(bytes.ToUpper(data))
+	}
+}
+
+func TestDialProxyTunnelHTTP(t *testing.T) {
+	var method, target, auth string
+	addr := serveOnce(t, func(conn net.Conn) {
+		reader := bufio.NewReader(conn)
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return
+		}
+		method, target, auth = req.Method, req.Host, req.Header.Get("Proxy-Authorization")
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		echoUpper(struct {
+			io.Reader
+			io.Writer
+		}{reader, conn})
+	})
+
+	proxy, _ := url.Parse("http://user:secret@" + addr)
+	conn, err := dialProxyTunnel(proxy, "www.example.com:443", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTunnelEcho(t, conn)
+	if method != "CONNECT" || target != "www.example.com:443" {
+		t.Errorf("proxy got %s %s, want CONNECT www.example.com:443", method, target)
+	}
+	if auth != "Basic dXNlcjpzZWNyZXQ=" {
+		t.Errorf("Proxy-Authorization %q, want the -proxy credentials", auth)
+	}
+}
+
+func TestDialProxyTunnelHTTPRefused(t *testing.T) {
+	addr := serveOnce(t, func(conn net.Conn) {
+		if _, err := http.ReadRequest(bufio.NewReader(conn)); err == nil {
+			io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n")
+		}
+	})
+	proxy, _ := url.Parse("http://" + addr)
+	if conn, err := dialProxyTunnel(proxy, "www.example.com:443", time.Second); err == nil {
+		conn.Close()
+		t.Error("tunnel opened although the proxy answered 403")
+	}
+}
+
+func TestDialProxyTunnelSOCKS5(t *testing.T) {
+	var userpass, request []byte
+	addr := serveOnce(t, func(conn net.Conn) {
+		greeting := make([]byte, 4)
+		if _, err := io.ReadFull(conn, greeting); err != nil || !bytes.Equal(greeting, []byte{5, 2, 0, 2}) {
+			return
+		}
+		conn.Write([]byte{5, 2})
+		// Version, username length and "user", password length and "secret"
+		userpass = make([]byte, 1+1+4+1+6)
+		if _, err := io.ReadFull(conn, userpass); err != nil {
+			return
+		}
+		conn.Write([]byte{1, 0})
+		// Domain name request for www.example.com:443
+		request = make([]byte, 4+1+15+2)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0x1f, 0x90})
+		echoUpper(conn)
+	})
+
+	proxy, _ := url.Parse("socks5://user:secret@" + addr)
+	conn, err := dialProxyTunnel(proxy, "www.example.com:443", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTunnelEcho(t, conn)
+	if want := append([]byte{1, 4}, "user\x06secret"...); !bytes.Equal(userpass, want) {
+		t.Errorf("credentials %q, want %q", userpass, want)
+	}
+	if want := append(append([]byte{5, 1, 0, 3, 15}, "www.example.com"...), 1, 187); !bytes.Equal(request, want) {
+		t.Errorf("request %v, want %v", request, want)
+	}
+}
+
+func TestDialProxyTunnelUnsupportedScheme(t *testing.T) {
+	addr := serveOnce(t, func(net.Conn) {})
+	proxy, _ := url.Parse("ftp://" + addr)
+	if conn, err := dialProxyTunnel(proxy, "www.example.com:443", time.Second); err == nil {
+		conn.Close()
+		t.Error("tunnel opened through an ftp proxy")
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Resolvers trusted to answer honestly, used when -validate is given
+// without -trusted-resolvers
+var defaultTrustedResolvers = []string{"8.8.8.8:53", "8.8.4.4:53", "1.1.1.1:53", "1.0.0.1:53"}
+
+var (
+	trustedResolvers []string // Servers of the validation pass, nil when it is off
+	trustedTurn      atomic.Uint32
+)
+
+// Look a host up on the trusted resolvers. A failed lookup returns a
+// resolution without a resolver, which is not taken as a rejection.
+func lookupTrusted(host string) resolution {
+	for attempt := 0; attempt < retryLimit; attempt++ {
+		server := trustedResolvers[int(trustedTurn.Add(1)-1)%len(trustedResolvers)]
+		if answer, err := lookupAt(server, host); err == nil {
+			return answer
+		}
+	}
+	return resolution{}
+}
+
+// Sources whose results come from resolving guesses on the resolver pool
+var massResolved = map[string]bool{"bruteforce": true, "permutation": true}
+
+// Resolve again every result that resolved, this time on the trusted
+// resolvers, and drop the ones they do not confirm. Poisoned or hijacking
+// public resolvers answer for names that do not exist; the trusted ones
+// answer NXDOMAIN or nothing for them.
+func validateResults(ctx context.Context, results []datedResult) []datedResult {
+	var hosts []string
+	seen := make(map[string]struct{})
+	for _, r := range results {
+		if _, exists := seen[r.Host]; !exists && (len(r.IPs) > 0 || massResolved[r.Source]) {
+			seen[r.Host] = struct{}{}
+			hosts = append(hosts, r.Host)
+		}
+	}
+	if len(hosts) == 0 {
+		return results
+	}
+
+	answers := resolveWith(ctx, hosts, lookupTrusted)
+	kept := results[:0]
+	rejected := make(map[string]struct{})
+	for _, r := range results {
+		if answer, checked := answers[r.Host]; checked && answer.Resolver != "" && len(answer.Addresses) == 0 {
+			rejected[r.Host] = struct{}{}
+			continue
+		}
+		kept = append(kept, r)
+	}
+	fmt.Printf("Trusted resolvers rejected %d of %d resolved names\n", len(rejected), len(hosts))
+	return kept
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"LeviathanMapper/scope"
+)
+
+const (
+	// Most NSEC records followed in one zone
+	zoneWalkLimit = 10000
+	// Random names queried to collect the NSEC3 hashes of a zone, and the
+	// number of probes in a row without a new hash that ends the collection
+	nsec3Probes      = 500
+	nsec3StaleProbes = 50
+)
+
+// Words hashed against the NSEC3 chain; -w replaces them with its wordlist
+var nsec3Words = defaultPermutationWords
+
+// Function to enumerate a DNSSEC-signed zone from its authoritative servers.
+// NSEC chains are followed name by name; for NSEC3 the hashed names are
+// collected and cracked against a wordlist.
+func fetchFromZoneWalk(ctx context.Context, domain string, out chan<- Result) {
+	servers, err := lookupNameservers(domain)
+	if err != nil {
+		fmt.Println("Error looking up nameservers for zone walking:", err)
+		return
+	}
+	for _, ns := range servers {
+		for _, ip := range lookupHost(ns).Addresses {
+			server := net.JoinHostPort(ip, "53")
+			msg, err := queryDNSSEC(server, randomLabel()+"."+domain, dnsTypeA)
+			if err != nil {
+				continue
+			}
+			switch {
+			case hasRecordType(msg.Authority, dnsTypeNSEC):
+				walkNSEC(ctx, server, domain, out)
+			case hasRecordType(msg.Authority, dnsTypeNSEC3):
+				crackNSEC3(ctx, server, domain, out)
+			default:
+				fmt.Println(domain, "does not answer with NSEC or NSEC3 records; it is probably not signed")
+			}
+			return
+		}
+	}
+	fmt.Println("Error zone walking", domain+": no authoritative server answered")
+}
+
+// Report whether any record of a section has the given type
+func hasRecordType(records []dnsRecord, rtype uint16) bool {
+	for _, record := range records {
+		if record.Type == rtype {
+			return true
+		}
+	}
+	return false
+}
+
+// Follow the NSEC chain of a zone from its apex until it wraps around
+func walkNSEC(ctx context.Context, server, domain string, out chan<- Result) {
+	found := 0
+	seen := map[string]struct{}{domain: {}}
+	for name := domain; found < zoneWalkLimit && ctx.Err() == nil; {
+		msg, err := queryDNSSEC(server, name, dnsTypeNSEC)
+		if err != nil {
+			fmt.Println("Error walking NSEC chain:", err)
+			break
+		}
+		next := ""
+		for _, record := range append(msg.Answers, msg.Authority...) {
+			if record.Type == dnsTypeNSEC && record.Name == name {
+				next = strings.Fields(record.Data)[0]
+				break
+			}
+		}
+		// Servers that synthesize NSEC answers on the fly ("black lies")
+		// point every name at a \000 child instead of the real next one
+		if strings.HasPrefix(next, "\x00.") {
+			fmt.Println(domain, "synthesizes NSEC answers; the zone cannot be walked")
+			break
+		}
+		if _, loop := seen[next]; next == "" || loop {
+			break
+		}
+		seen[next] = struct{}{}
+		if scope.IsInScope(next, domain) {
+			out <- Result{Host: next, Source: "zonewalk"}
+			found++
+		}
+		name = next
+	}
+	fmt.Printf("NSEC walking found %d names in %s\n", found, domain)
+}
+
+// NSEC3 parameters and hashed owner names collected from a zone
+type nsec3Chain struct {
+	salt       []byte
+	iterations int
+	hashes     map[string]struct{}
+}
+
+// Collect the NSEC3 hashes a zone reveals in its denial of existence
+// answers, then hash every word under the zone looking for matches
+func crackNSEC3(ctx context.Context, server, domain string, out chan<- Result) {
+	chain := nsec3Chain{hashes: make(map[string]struct{})}
+	stale := 0
+	for probe := 0; probe < nsec3Probes && stale < nsec3StaleProbes && ctx.Err() == nil; probe++ {
+		msg, err := queryDNSSEC(server, randomLabel()+"."+domain, dnsTypeA)
+		if err != nil {
+			continue
+		}
+		added := false
+		for _, record := range msg.Authority {
+			fields := strings.Fields(record.Data)
+			if record.Type != dnsTypeNSEC3 || len(fields) < 5 {
+				continue
+			}
+			chain.iterations, _ = strconv.Atoi(fields[2])
+			chain.salt, _ = hex.DecodeString(strings.TrimPrefix(fields[3], "-"))
+			for _, hash := range []string{strings.SplitN(record.Name, ".", 2)[0], fields[4]} {
+				if _, exists := chain.hashes[hash]; !exists {
+					chain.hashes[hash] = struct{}{}
+					added = true
+				}
+			}
+		}
+		if added {
+			stale = 0
+		} else {
+			stale++
+		}
+	}
+	if len(chain.hashes) == 0 {
+		fmt.Println("No NSEC3 hashes collected from", domain)
+		return
+	}
+
+	cracked := 0
+	for _, word := range nsec3Words {
+		name := word + "." + domain
+		if _, exists := chain.hashes[nsec3Hash(name, chain.salt, chain.iterations)]; exists {
+			out <- Result{Host: name, Source: "zonewalk"}
+			cracked++
+		}
+	}
+	fmt.Printf("Collected %d NSEC3 hashes from %s and cracked %d\n", len(chain.hashes), domain, cracked)
+}
+
+// NSEC3 hash of a name (RFC 5155): iterated SHA-1 over the wire form of the
+// name and the salt, written in lowercase base32hex
+func nsec3Hash(name string, salt []byte, iterations int) string {
+	digest := sha1.Sum(append(appendDNSName(nil, strings.ToLower(name)), salt...))
+	for i := 0; i < iterations; i++ {
+		digest = sha1.Sum(append(digest[:], salt...))
+	}
+	return strings.ToLower(base32.HexEncoding.WithPadding(base32.NoPadding).EncodeToString(digest[:]))
+}
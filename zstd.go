@@ -0,0 +1,803 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Zstandard (RFC 8878) for the .tar.zst project archives, as the standard
+// library has no implementation. The reader decodes any frame without a
+// dictionary; the writer in zstdwriter.go compresses about as well as
+// gzip.
+
+const (
+	zstdMagic         = 0xFD2FB528
+	zstdBlockMax      = 128 << 10
+	zstdWindowLog     = 20      // Window of the frames written
+	zstdMaxWindow     = 1 << 27 // Largest window accepted, as the zstd CLI does without --long
+	zstdHuffmanMaxLog = 11
+)
+
+var errZstdCorrupt = errors.New("zstd: corrupt input")
+
+// Literal length and match length codes: baseline and number of extra bits
+var (
+	zstdLLBase = [36]uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536}
+	zstdLLBits = [36]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	zstdMLBase = [53]uint32{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051, 4099, 8195, 16387, 32771, 65539}
+	zstdMLBits = [53]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+)
+
+// Predefined distributions of the sequence codes
+var (
+	zstdLLTable = mustFSETable([]int16{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}, 6)
+	zstdMLTable = mustFSETable([]int16{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}, 6)
+	zstdOFTable = mustFSETable([]int16{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5)
+)
+
+// Bits of a stream read backwards from its end marker, as FSE and Huffman
+// streams are. Reading past the start yields zeros and leaves pos negative.
+type zstdBackReader struct {
+	data []byte
+	pos  int // Bits left to read
+}
+
+func newZstdBackReader(data []byte) (*zstdBackReader, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errZstdCorrupt
+	}
+	return &zstdBackReader{data, (len(data)-1)*8 + bits.Len8(data[len(data)-1]) - 1}, nil
+}
+
+func (r *zstdBackReader) bitsAt(p, n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	if p < 0 {
+		if p+n <= 0 {
+			return 0
+		}
+		return r.bitsAt(0, p+n) << uint(-p)
+	}
+	var x uint64
+	for i, b := 0, p>>3; i < 8 && b+i < len(r.data); i++ {
+		x |= uint64(r.data[b+i]) << (8 * i)
+	}
+	return x >> uint(p&7) & (1<<uint(n) - 1)
+}
+
+func (r *zstdBackReader) peek(n int) uint64 { return r.bitsAt(r.pos-n, n) }
+
+func (r *zstdBackReader) read(n int) uint64 {
+	r.pos -= n
+	return r.bitsAt(r.pos, n)
+}
+
+// Bits written forwards, to be read back by zstdBackReader
+type zstdBitWriter struct {
+	out []byte
+	acc uint64
+	n   uint
+}
+
+func (w *zstdBitWriter) add(value uint64, n uint) {
+	w.acc |= (value & (1<<n - 1)) << w.n
+	for w.n += n; w.n >= 8; w.n -= 8 {
+		w.out = append(w.out, byte(w.acc))
+		w.acc >>= 8
+	}
+}
+
+// Append the end marker and return the stream
+func (w *zstdBitWriter) close() []byte {
+	w.add(1, 1)
+	if w.n > 0 {
+		w.out = append(w.out, byte(w.acc))
+	}
+	return w.out
+}
+
+// A decoding state of an FSE table
+type fseState struct {
+	symbol uint8
+	bits   uint8
+	base   uint16
+}
+
+type fseTable struct {
+	log    int
+	states []fseState
+	encode [][]uint16 // State coding each symbol from each next state, for the writer
+}
+
+// Spread the symbols of a normalized distribution over the states of a
+// table, as RFC 8878 section 4.1.1 describes
+func buildFSETable(norm []int16, log int) (*fseTable, error) {
+	size := 1 << log
+	t := &fseTable{log: log, states: make([]fseState, size)}
+	next := make([]int, len(norm))
+	high := size - 1
+	for s, p := range norm {
+		if p == -1 {
+			t.states[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = int(p)
+		}
+	}
+	position, step := 0, size>>1+size>>3+3
+	for s, p := range norm {
+		for i := 0; i < int(p); i++ {
+			t.states[position].symbol = uint8(s)
+			for position = (position + step) & (size - 1); position > high; position = (position + step) & (size - 1) {
+			}
+		}
+	}
+	if position != 0 {
+		return nil, errZstdCorrupt
+	}
+	for i := range t.states {
+		n := next[t.states[i].symbol]
+		next[t.states[i].symbol]++
+		t.states[i].bits = uint8(log - (bits.Len(uint(n)) - 1))
+		t.states[i].base = uint16(n<<t.states[i].bits - size)
+	}
+	return t, nil
+}
+
+// A predefined table, which the writer also encodes with
+func mustFSETable(norm []int16, log int) *fseTable {
+	t, err := buildFSETable(norm, log)
+	if err != nil {
+		panic(err)
+	}
+	t.addEncoding(len(norm))
+	return t
+}
+
+// Single-symbol table of the RLE mode
+func rleFSETable(symbol uint8) *fseTable {
+	return &fseTable{states: []fseState{{symbol: symbol}}}
+}
+
+// Parse the normalized distribution at the start of data into a table,
+// returning the bytes it took
+func readFSETable(data []byte, maxSymbol, maxLog int) (*fseTable, int, error) {
+	var bitPos int
+	readBits := func(n int) int {
+		v := 0
+		for i := 0; i < n; i++ {
+			if b := bitPos + i; b>>3 < len(data) && data[b>>3]>>uint(b&7)&1 != 0 {
+				v |= 1 << i
+			}
+		}
+		return v
+	}
+	log := readBits(4) + 5
+	bitPos = 4
+	if log > maxLog {
+		return nil, 0, errZstdCorrupt
+	}
+	remaining, threshold, nbBits := 1<<log+1, 1<<log, log+1
+	var norm []int16
+	for remaining > 1 && len(norm) <= maxSymbol {
+		max := 2*threshold - 1 - remaining
+		var value int
+		if v := readBits(nbBits - 1); v < max {
+			value = v
+			bitPos += nbBits - 1
+		} else {
+			value = readBits(nbBits)
+			if value >= threshold {
+				value -= max
+			}
+			bitPos += nbBits
+		}
+		p := value - 1
+		if p < 0 {
+			remaining += p
+		} else {
+			remaining -= p
+		}
+		norm = append(norm, int16(p))
+		if p == 0 {
+			// Zero probabilities are followed by a count of further zeros
+			for {
+				repeat := readBits(2)
+				bitPos += 2
+				for i := 0; i < repeat; i++ {
+					norm = append(norm, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+		}
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || len(norm) > maxSymbol+1 || bitPos > len(data)*8 {
+		return nil, 0, errZstdCorrupt
+	}
+	t, err := buildFSETable(norm, log)
+	return t, (bitPos + 7) / 8, err
+}
+
+// Huffman decoding table of the literals, indexed by the next maxBits bits
+type huffTable struct {
+	maxBits int
+	symbols []byte
+	lengths []uint8
+}
+
+// Parse a Huffman tree description, returning the bytes it took
+func readHuffmanTable(data []byte) (*huffTable, int, error) {
+	if len(data) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	var weights []uint8
+	size := int(data[0])
+	if size >= 128 {
+		// Direct representation: four bits per weight
+		count := size - 127
+		size = (count + 1) / 2
+		if 1+size > len(data) {
+			return nil, 0, errZstdCorrupt
+		}
+		for i := 0; i < count; i++ {
+			weights = append(weights, data[1+i/2]>>(4*uint(1-i%2))&0xf)
+		}
+	} else {
+		if 1+size > len(data) {
+			return nil, 0, errZstdCorrupt
+		}
+		table, n, err := readFSETable(data[1:1+size], 255, 6)
+		if err != nil {
+			return nil, 0, err
+		}
+		r, err := newZstdBackReader(data[1+n : 1+size])
+		if err != nil {
+			return nil, 0, err
+		}
+		// Two interleaved states, until the stream runs out
+		state := [2]uint64{r.read(table.log), r.read(table.log)}
+		for i := 0; len(weights) < 255; i ^= 1 {
+			s := table.states[state[i]]
+			weights = append(weights, s.symbol)
+			state[i] = uint64(s.base) + r.read(int(s.bits))
+			if r.pos < 0 {
+				weights = append(weights, table.states[state[i^1]].symbol)
+				break
+			}
+		}
+	}
+
+	sum := 0
+	for _, w := range weights {
+		if w > zstdHuffmanMaxLog {
+			return nil, 0, errZstdCorrupt
+		}
+		if w > 0 {
+			sum += 1 << (w - 1)
+		}
+	}
+	maxBits := bits.Len(uint(sum))
+	left := 1<<maxBits - sum
+	if sum == 0 || maxBits > zstdHuffmanMaxLog || left&(left-1) != 0 || len(weights) > 255 {
+		return nil, 0, errZstdCorrupt
+	}
+	weights = append(weights, uint8(bits.Len(uint(left))))
+
+	// Longer codes come first, by symbol within a length
+	t := &huffTable{maxBits: maxBits, symbols: make([]byte, 1<<maxBits), lengths: make([]uint8, 1<<maxBits)}
+	var start [zstdHuffmanMaxLog + 2]int
+	for _, w := range weights {
+		if w > 0 {
+			start[w+1] += 1 << (w - 1)
+		}
+	}
+	for w := 2; w <= maxBits+1; w++ {
+		start[w] += start[w-1]
+	}
+	for symbol, w := range weights {
+		if w == 0 {
+			continue
+		}
+		for i := start[w]; i < start[w]+1<<(w-1); i++ {
+			t.symbols[i] = byte(symbol)
+			t.lengths[i] = uint8(maxBits + 1 - int(w))
+		}
+		start[w] += 1 << (w - 1)
+	}
+	return t, 1 + size, nil
+}
+
+// Decode count literals from one Huffman stream
+func (t *huffTable) decode(out, stream []byte, count int) ([]byte, error) {
+	r, err := newZstdBackReader(stream)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < count; i++ {
+		index := r.peek(t.maxBits)
+		out = append(out, t.symbols[index])
+		r.pos -= int(t.lengths[index])
+	}
+	if r.pos != 0 {
+		return nil, errZstdCorrupt
+	}
+	return out, nil
+}
+
+// Streaming decoder of concatenated zstd frames
+type zstdReader struct {
+	in      *bufio.Reader
+	err     error
+	frames  int
+	inFrame bool
+	last    bool // Last block of the frame decoded
+	check   bool
+	hash    *xxh64
+	window  int
+	history []byte // Decoded bytes later sequences may copy from
+	pending []byte // Decoded bytes not read yet
+	repeat  [3]int
+	huff    *huffTable
+	ll      *fseTable
+	of      *fseTable
+	ml      *fseTable
+}
+
+func newZstdReader(r io.Reader) *zstdReader {
+	return &zstdReader{in: bufio.NewReader(r)}
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 && z.err == nil {
+		z.err = z.next()
+	}
+	if len(z.pending) > 0 {
+		n := copy(p, z.pending)
+		z.pending = z.pending[n:]
+		return n, nil
+	}
+	return 0, z.err
+}
+
+// Decode the next block, starting or ending frames as needed
+func (z *zstdReader) next() error {
+	if !z.inFrame {
+		return z.startFrame()
+	}
+	if z.last {
+		if z.check {
+			var sum [4]byte
+			if _, err := io.ReadFull(z.in, sum[:]); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			if binary.LittleEndian.Uint32(sum[:]) != uint32(z.hash.Sum64()) {
+				return errors.New("zstd: checksum mismatch")
+			}
+		}
+		z.inFrame = false
+		return nil
+	}
+
+	var header [3]byte
+	if _, err := io.ReadFull(z.in, header[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	value := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	z.last = value&1 != 0
+	size := value >> 3
+	if size > zstdBlockMax {
+		return errZstdCorrupt
+	}
+	if len(z.history) > 2*z.window {
+		z.history = append(z.history[:0], z.history[len(z.history)-z.window:]...)
+	}
+	start := len(z.history)
+	switch value >> 1 & 3 {
+	case 0:
+		block := make([]byte, size)
+		if _, err := io.ReadFull(z.in, block); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		z.history = append(z.history, block...)
+	case 1:
+		b, err := z.in.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		for i := 0; i < size; i++ {
+			z.history = append(z.history, b)
+		}
+	case 2:
+		block := make([]byte, size)
+		if _, err := io.ReadFull(z.in, block); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if err := z.decodeBlock(block); err != nil {
+			return err
+		}
+	default:
+		return errZstdCorrupt
+	}
+	z.pending = z.history[start:]
+	if z.check {
+		z.hash.Write(z.pending)
+	}
+	return nil
+}
+
+// Read a frame header, skipping skippable frames
+func (z *zstdReader) startFrame() error {
+	var magic [4]byte
+	if _, err := io.ReadFull(z.in, magic[:]); err != nil {
+		if err == io.EOF && z.frames > 0 {
+			return io.EOF
+		}
+		return io.ErrUnexpectedEOF
+	}
+	if m := binary.LittleEndian.Uint32(magic[:]); m&0xFFFFFFF0 == 0x184D2A50 {
+		var size [4]byte
+		if _, err := io.ReadFull(z.in, size[:]); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		_, err := z.in.Discard(int(binary.LittleEndian.Uint32(size[:])))
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	} else if m != zstdMagic {
+		return errors.New("zstd: not a zstd stream")
+	}
+
+	descriptor, err := z.in.ReadByte()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	singleSegment := descriptor&0x20 != 0
+	if descriptor&0x08 != 0 {
+		return errZstdCorrupt
+	}
+	if descriptor&3 != 0 {
+		return errors.New("zstd: frames with a dictionary are not supported")
+	}
+	window := 0
+	if !singleSegment {
+		b, err := z.in.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		base := 1 << (10 + b>>3)
+		window = base + base/8*int(b&7)
+	}
+	sizeBytes := [4]int{0, 2, 4, 8}[descriptor>>6]
+	if singleSegment && sizeBytes == 0 {
+		sizeBytes = 1
+	}
+	field := make([]byte, 8)
+	if _, err := io.ReadFull(z.in, field[:sizeBytes]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if singleSegment {
+		window = int(binary.LittleEndian.Uint64(field))
+		if sizeBytes == 2 {
+			window += 256
+		}
+	}
+	if window > zstdMaxWindow {
+		return fmt.Errorf("zstd: window of %d bytes is too large", window)
+	}
+
+	z.frames++
+	z.inFrame, z.last = true, false
+	z.check = descriptor&0x04 != 0
+	z.hash = newXXH64()
+	z.window = max(window, zstdBlockMax)
+	z.history = z.history[:0]
+	z.repeat = [3]int{1, 4, 8}
+	z.huff, z.ll, z.of, z.ml = nil, nil, nil, nil
+	return nil
+}
+
+// Decode a compressed block onto the history
+func (z *zstdReader) decodeBlock(block []byte) error {
+	literals, n, err := z.decodeLiterals(block)
+	if err != nil {
+		return err
+	}
+	data := block[n:]
+	if len(data) == 0 {
+		return errZstdCorrupt
+	}
+	count := int(data[0])
+	switch {
+	case count < 128:
+		data = data[1:]
+	case count < 255 && len(data) >= 2:
+		count = (count-128)<<8 | int(data[1])
+		data = data[2:]
+	case len(data) >= 3:
+		count = (int(data[1]) | int(data[2])<<8) + 0x7F00
+		data = data[3:]
+	default:
+		return errZstdCorrupt
+	}
+	if count == 0 {
+		z.history = append(z.history, literals...)
+		return nil
+	}
+
+	if len(data) == 0 {
+		return errZstdCorrupt
+	}
+	modes := data[0]
+	data = data[1:]
+	tables := []struct {
+		table      **fseTable
+		predefined *fseTable
+		maxSymbol  int
+		maxLog     int
+		mode       byte
+	}{
+		{&z.ll, zstdLLTable, 35, 9, modes >> 6},
+		{&z.of, zstdOFTable, 31, 8, modes >> 4 & 3},
+		{&z.ml, zstdMLTable, 52, 9, modes >> 2 & 3},
+	}
+	for _, t := range tables {
+		switch t.mode {
+		case 0:
+			*t.table = t.predefined
+		case 1:
+			if len(data) == 0 || int(data[0]) > t.maxSymbol {
+				return errZstdCorrupt
+			}
+			*t.table = rleFSETable(data[0])
+			data = data[1:]
+		case 2:
+			table, n, err := readFSETable(data, t.maxSymbol, t.maxLog)
+			if err != nil {
+				return err
+			}
+			*t.table = table
+			data = data[n:]
+		case 3:
+			if *t.table == nil {
+				return errZstdCorrupt
+			}
+		}
+	}
+
+	r, err := newZstdBackReader(data)
+	if err != nil {
+		return err
+	}
+	llState, ofState, mlState := r.read(z.ll.log), r.read(z.of.log), r.read(z.ml.log)
+	for i := 0; i < count; i++ {
+		ll, of, ml := z.ll.states[llState], z.of.states[ofState], z.ml.states[mlState]
+		if of.symbol > 31 {
+			return errZstdCorrupt
+		}
+		offset := 1<<of.symbol + int(r.read(int(of.symbol)))
+		matchLength := int(zstdMLBase[ml.symbol]) + int(r.read(int(zstdMLBits[ml.symbol])))
+		literalLength := int(zstdLLBase[ll.symbol]) + int(r.read(int(zstdLLBits[ll.symbol])))
+		if i < count-1 {
+			llState = uint64(ll.base) + r.read(int(ll.bits))
+			mlState = uint64(ml.base) + r.read(int(ml.bits))
+			ofState = uint64(of.base) + r.read(int(of.bits))
+		}
+
+		// Offset values up to 3 repeat one of the last offsets
+		if offset > 3 {
+			offset -= 3
+			z.repeat = [3]int{offset, z.repeat[0], z.repeat[1]}
+		} else {
+			index := offset - 1
+			if literalLength == 0 {
+				index++
+			}
+			switch index {
+			case 0:
+				offset = z.repeat[0]
+			case 1:
+				offset = z.repeat[1]
+				z.repeat = [3]int{offset, z.repeat[0], z.repeat[2]}
+			case 2:
+				offset = z.repeat[2]
+				z.repeat = [3]int{offset, z.repeat[0], z.repeat[1]}
+			case 3:
+				offset = z.repeat[0] - 1
+				z.repeat = [3]int{offset, z.repeat[0], z.repeat[1]}
+			}
+		}
+
+		if literalLength > len(literals) || offset <= 0 || offset > len(z.history)+literalLength {
+			return errZstdCorrupt
+		}
+		z.history = append(z.history, literals[:literalLength]...)
+		literals = literals[literalLength:]
+		from := len(z.history) - offset
+		for j := 0; j < matchLength; j++ {
+			z.history = append(z.history, z.history[from+j])
+		}
+	}
+	if r.pos != 0 {
+		return errZstdCorrupt
+	}
+	z.history = append(z.history, literals...)
+	return nil
+}
+
+// Decode the literals section at the start of a block, returning the bytes
+// it took
+func (z *zstdReader) decodeLiterals(block []byte) ([]byte, int, error) {
+	if len(block) == 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	var head [5]byte
+	copy(head[:], block)
+	kind, format := block[0]&3, block[0]>>2&3
+	if kind < 2 {
+		var size, n int
+		switch format {
+		case 0, 2:
+			size, n = int(head[0]>>3), 1
+		case 1:
+			size, n = int(head[0]>>4)|int(head[1])<<4, 2
+		case 3:
+			size, n = int(head[0]>>4)|int(head[1])<<4|int(head[2])<<12, 3
+		}
+		if kind == 1 {
+			if n >= len(block) {
+				return nil, 0, errZstdCorrupt
+			}
+			literals := make([]byte, size)
+			for i := range literals {
+				literals[i] = block[n]
+			}
+			return literals, n + 1, nil
+		}
+		if n+size > len(block) {
+			return nil, 0, errZstdCorrupt
+		}
+		return block[n : n+size], n + size, nil
+	}
+
+	var size, compressed, n int
+	header := uint64(head[0]) | uint64(head[1])<<8 | uint64(head[2])<<16 | uint64(head[3])<<24 | uint64(head[4])<<32
+	switch format {
+	case 0, 1:
+		size, compressed, n = int(header>>4&0x3FF), int(header>>14&0x3FF), 3
+	case 2:
+		size, compressed, n = int(header>>4&0x3FFF), int(header>>18&0x3FFF), 4
+	case 3:
+		size, compressed, n = int(header>>4&0x3FFFF), int(header>>22&0x3FFFF), 5
+	}
+	if n+compressed > len(block) || size > zstdBlockMax {
+		return nil, 0, errZstdCorrupt
+	}
+	data := block[n : n+compressed]
+	if kind == 2 {
+		table, used, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		z.huff = table
+		data = data[used:]
+	} else if z.huff == nil {
+		return nil, 0, errZstdCorrupt
+	}
+
+	literals := make([]byte, 0, size)
+	var err error
+	if format == 0 {
+		literals, err = z.huff.decode(literals, data, size)
+	} else {
+		// Four streams behind a table of the sizes of the first three
+		if len(data) < 6 {
+			return nil, 0, errZstdCorrupt
+		}
+		sizes := [4]int{int(binary.LittleEndian.Uint16(data)), int(binary.LittleEndian.Uint16(data[2:])), int(binary.LittleEndian.Uint16(data[4:]))}
+		sizes[3] = len(data) - 6 - sizes[0] - sizes[1] - sizes[2]
+		if sizes[3] <= 0 {
+			return nil, 0, errZstdCorrupt
+		}
+		data = data[6:]
+		segment := (size + 3) / 4
+		for i, streamSize := range sizes {
+			count := segment
+			if i == 3 {
+				count = size - 3*segment
+			}
+			if literals, err = z.huff.decode(literals, data[:streamSize], count); err != nil {
+				break
+			}
+			data = data[streamSize:]
+		}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return literals, n + compressed, nil
+}
+
+// XXH64 with a zero seed, the checksum of zstd frames
+type xxh64 struct {
+	v     [4]uint64
+	buf   []byte
+	total uint64
+}
+
+const (
+	xxhPrime1 uint64 = 11400714785074694791
+	xxhPrime2 uint64 = 14029467366897019727
+	xxhPrime3 uint64 = 1609587929392839161
+	xxhPrime4 uint64 = 9650029242287828579
+	xxhPrime5 uint64 = 2870177450012600261
+)
+
+func newXXH64() *xxh64 {
+	h := &xxh64{v: [4]uint64{xxhPrime1, xxhPrime2, 0, 0}}
+	// Wrapping, as the seed-dependent initial values are defined
+	h.v[0] += xxhPrime2
+	h.v[3] -= xxhPrime1
+	return h
+}
+
+func xxhRound(acc, input uint64) uint64 {
+	return bits.RotateLeft64(acc+input*xxhPrime2, 31) * xxhPrime1
+}
+
+func (h *xxh64) Write(p []byte) {
+	h.total += uint64(len(p))
+	h.buf = append(h.buf, p...)
+	i := 0
+	for ; i+32 <= len(h.buf); i += 32 {
+		for j := range h.v {
+			h.v[j] = xxhRound(h.v[j], binary.LittleEndian.Uint64(h.buf[i+8*j:]))
+		}
+	}
+	h.buf = append(h.buf[:0], h.buf[i:]...)
+}
+
+func (h *xxh64) Sum64() uint64 {
+	var sum uint64
+	if h.total >= 32 {
+		sum = bits.RotateLeft64(h.v[0], 1) + bits.RotateLeft64(h.v[1], 7) + bits.RotateLeft64(h.v[2], 12) + bits.RotateLeft64(h.v[3], 18)
+		for _, v := range h.v {
+			sum = (sum^xxhRound(0, v))*xxhPrime1 + xxhPrime4
+		}
+	} else {
+		sum = xxhPrime5
+	}
+	sum += h.total
+	rest := h.buf
+	for ; len(rest) >= 8; rest = rest[8:] {
+		sum ^= xxhRound(0, binary.LittleEndian.Uint64(rest))
+		sum = bits.RotateLeft64(sum, 27)*xxhPrime1 + xxhPrime4
+	}
+	if len(rest) >= 4 {
+		sum ^= uint64(binary.LittleEndian.Uint32(rest)) * xxhPrime1
+		sum = bits.RotateLeft64(sum, 23)*xxhPrime2 + xxhPrime3
+		rest = rest[4:]
+	}
+	for _, b := range rest {
+		sum ^= uint64(b) * xxhPrime5
+		sum = bits.RotateLeft64(sum, 11) * xxhPrime1
+	}
+	sum ^= sum >> 33
+	sum *= xxhPrime2
+	sum ^= sum >> 29
+	sum *= xxhPrime3
+	sum ^= sum >> 32
+	return sum
+}
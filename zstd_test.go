@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// Host records like those of a history file, as the zstd fixture holds them
+func testHostLines() []byte {
+	var b strings.Builder
+	sources := []string{"crtsh", "dns", "wayback"}
+	for i := 0; i < 60; i++ {
+		word := []string{"www", "mail", "api", "dev", "staging", "vpn", "admin", "portal", "cdn", "shop"}[i%10]
+		fmt.Fprintf(&b, `{"host": "%s.example.com", "ip": "10.0.%d.%d", "source": "%s"}`+"\n", word, i/7, i%250, sources[i%3])
+	}
+	return []byte(b.String())
+}
+
+// testHostLines compressed by "zstd -19", with Huffman and FSE coded
+// sections and a checksum
+const zstdFixture = "28b52ffd64b00e350c00320b231970cd0330420a4408bd23b150faff7f0886aa42b967fd739305076c03be2e5e13cf35" +
+	"74ff7f18ad5f4140ebf9b94c67abdeda0dedff0fc34e5910d07a7eac9bcb74b6ea6c60ff7ff85db061a72c9a45e8b94e" +
+	"546746683d3fc5562542d8653a191993297eab1eb19daca9d101aab560e891543ed1c53d30af2b10967365d3c69d28d1" +
+	"feff15200bc27759548082a831b6d149daef90480209b4d4011220310408418310300cc12b040acc2d90022aa12d0f84" +
+	"f0414e55d92b1cba28eec2bb0e2f16c141c8097b8030af42780610c507581ef187c815262245e44270f00319def73dcc" +
+	"7b1fc834ba0f303df7226a7b4916d7be8ff9b3afc31cecdb18d3f5418e899b400c802a00a928ba13948549b5cf2ce604" +
+	"f56e43376d8115528ccb70569215434b4123906247493aac9b181ca17812909d0063a653f38c79c9538977c0a6a94313" +
+	"a406a2a43dc68aa4c9ff52016457626b6560c77ebc05c0c94e496798ba710f4650b206d9fdc83e1132546e174230d025" +
+	"d862ca2744a8495fd10f7584e60fad0210f38c51"
+
+func TestZstdReaderFixture(t *testing.T) {
+	frame, err := hex.DecodeString(zstdFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(newZstdReader(bytes.NewReader(frame)))
+	if err != nil || !bytes.Equal(got, testHostLines()) {
+		t.Fatalf("got %q, %v", got, err)
+	}
+
+	frame[len(frame)-1] ^= 1
+	if _, err := io.ReadAll(newZstdReader(bytes.NewReader(frame))); err == nil {
+		t.Error("corrupt checksum accepted")
+	}
+}
+
+func TestZstdRoundTrip(t *testing.T) {
+	random := make([]byte, 200000)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs := map[string][]byte{
+		"empty":  nil,
+		"short":  []byte("www.example.com"),
+		"lines":  bytes.Repeat(testHostLines(), 300),
+		"random": random,
+		"run":    bytes.Repeat([]byte{0}, 300000),
+	}
+	for name, data := range inputs {
+		var compressed bytes.Buffer
+		w := newZstdWriter(&compressed)
+		for rest := data; len(rest) > 0; rest = rest[min(len(rest), 50000):] {
+			if _, err := w.Write(rest[:min(len(rest), 50000)]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(newZstdReader(&compressed))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: got %d bytes, %v", name, len(got), err)
+		}
+	}
+}
+
+func TestXXH64(t *testing.T) {
+	for input, want := range map[string]uint64{"": 0xEF46DB3751D8E999, "abc": 0x44BC2CF5AD770999} {
+		h := newXXH64()
+		h.Write([]byte(input))
+		if got := h.Sum64(); got != want {
+			t.Errorf("%q: got %x, want %x", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+const (
+	zstdHashLog     = 17
+	zstdSearchDepth = 24 // Earlier positions with the same hash tried for a match
+	zstdWindowMask  = 1<<zstdWindowLog - 1
+)
+
+// A match found by the writer, after litLength literals. The offset value
+// is coded as the format does: 1 repeats the last offset, larger values
+// are the distance plus 3.
+type zstdSequence struct {
+	litLength, matchLength, offsetValue int
+}
+
+// Streaming encoder writing a single zstd frame, finished by Close
+type zstdWriter struct {
+	out     io.Writer
+	hash    *xxh64
+	buf     []byte // Window of earlier input followed by the input not compressed yet
+	base    int    // Input position of buf[0]
+	start   int    // Index in buf of the input not compressed yet
+	hashed  int    // Index in buf of the first position not in the hash chains
+	table   []int  // Last input position+1 of each hashed 4-byte prefix
+	chain   []int  // Previous input position+1 with the same hash, by position in the window
+	repeat  [3]int // Last offsets, as the decoder tracks them
+	started bool
+	err     error
+}
+
+func newZstdWriter(w io.Writer) *zstdWriter {
+	return &zstdWriter{
+		out:    w,
+		hash:   newXXH64(),
+		table:  make([]int, 1<<zstdHashLog),
+		chain:  make([]int, 1<<zstdWindowLog),
+		repeat: [3]int{1, 4, 8},
+	}
+}
+
+func (z *zstdWriter) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	z.hash.Write(p)
+	z.buf = append(z.buf, p...)
+	for len(z.buf)-z.start > zstdBlockMax && z.err == nil {
+		z.err = z.writeBlock(z.start+zstdBlockMax, false)
+	}
+	if z.err != nil {
+		return 0, z.err
+	}
+	return len(p), nil
+}
+
+// Compress what is left as the last block and write the checksum
+func (z *zstdWriter) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.err = z.writeBlock(len(z.buf), true); z.err != nil {
+		return z.err
+	}
+	var sum [4]byte
+	binary.LittleEndian.PutUint32(sum[:], uint32(z.hash.Sum64()))
+	if _, z.err = z.out.Write(sum[:]); z.err != nil {
+		return z.err
+	}
+	z.err = errors.New("zstd: writer closed")
+	return nil
+}
+
+// Compress buf[start:end] into one block, stored raw when that is smaller
+func (z *zstdWriter) writeBlock(end int, last bool) error {
+	var out []byte
+	if !z.started {
+		// Frame header: checksum, no content size, 1 MiB window
+		out = binary.LittleEndian.AppendUint32(out, zstdMagic)
+		out = append(out, 0x04, (zstdWindowLog-10)<<3)
+		z.started = true
+	}
+
+	src := z.buf[z.start:end]
+	repeat := z.repeat
+	sequences, literals := z.findSequences(end)
+	body := encodeZstdSequences(encodeZstdLiterals(literals), sequences)
+	header := 0
+	if last {
+		header = 1
+	}
+	if len(src) > 0 && len(body) < len(src) {
+		header |= 2<<1 | len(body)<<3
+	} else {
+		// A raw block leaves the decoder's offsets as they were
+		z.repeat = repeat
+		header |= len(src) << 3
+		body = src
+	}
+	out = append(out, byte(header), byte(header>>8), byte(header>>16))
+	out = append(out, body...)
+	if _, err := z.out.Write(out); err != nil {
+		return err
+	}
+
+	// Keep one window of history for the next blocks
+	z.start = end
+	if drop := z.start - 1<<zstdWindowLog; drop > 1<<zstdWindowLog {
+		z.buf = append(z.buf[:0], z.buf[drop:]...)
+		z.base += drop
+		z.start -= drop
+		z.hashed -= drop
+	}
+	return nil
+}
+
+func (z *zstdWriter) hashAt(i int) uint32 {
+	return binary.LittleEndian.Uint32(z.buf[i:]) * 2654435761 >> (32 - zstdHashLog)
+}
+
+// Add the positions before i to the hash chains
+func (z *zstdWriter) insertUntil(i, end int) {
+	for ; z.hashed < i && z.hashed+4 <= end; z.hashed++ {
+		h, position := z.hashAt(z.hashed), z.base+z.hashed
+		z.chain[position&zstdWindowMask] = z.table[h]
+		z.table[h] = position + 1
+	}
+}
+
+// Bytes at i matching those at the earlier index c, up to end
+func (z *zstdWriter) matchLength(c, i, end int) int {
+	n := 0
+	for ; i+n+8 <= end; n += 8 {
+		if x := binary.LittleEndian.Uint64(z.buf[c+n:]) ^ binary.LittleEndian.Uint64(z.buf[i+n:]); x != 0 {
+			return n + bits.TrailingZeros64(x)/8
+		}
+	}
+	for i+n < end && z.buf[c+n] == z.buf[i+n] {
+		n++
+	}
+	return n
+}
+
+// Longest match for the bytes at i among the earlier positions sharing
+// their hash within the window
+func (z *zstdWriter) longestMatch(i, end int) (length, offset int) {
+	z.insertUntil(i, end)
+	candidate := z.table[z.hashAt(i)] - 1
+	for depth := 0; candidate >= 0 && depth < zstdSearchDepth; depth++ {
+		c := candidate - z.base
+		if c < 0 || c >= i || i-c >= 1<<zstdWindowLog {
+			break
+		}
+		if n := z.matchLength(c, i, end); n > length {
+			length, offset = n, i-c
+		}
+		// Entries older than the window may have been overwritten
+		next := z.chain[candidate&zstdWindowMask] - 1
+		if next >= candidate {
+			break
+		}
+		candidate = next
+	}
+	return length, offset
+}
+
+// Lazy LZ77 over buf[start:end], returning the matches and the literals
+// between them
+func (z *zstdWriter) findSequences(end int) ([]zstdSequence, []byte) {
+	var sequences []zstdSequence
+	var literals []byte
+	anchor := z.start
+	for i := z.start; i+4 <= end; {
+		length, offset := z.longestMatch(i, end)
+		// Repeating the last offset is the cheapest to code
+		if c := i - z.repeat[0]; i > anchor && c >= 0 {
+			if n := z.matchLength(c, i, end); n >= 4 && n+1 >= length {
+				length, offset = n, z.repeat[0]
+			}
+		}
+		if length < 4 {
+			i++
+			continue
+		}
+		// Unless the next byte starts a longer match
+		if i+5 <= end {
+			if n, o := z.longestMatch(i+1, end); n > length+1 {
+				i++
+				length, offset = n, o
+			}
+		}
+
+		value := offset + 3
+		if i > anchor && offset == z.repeat[0] {
+			value = 1
+		} else {
+			z.repeat = [3]int{offset, z.repeat[0], z.repeat[1]}
+		}
+		sequences = append(sequences, zstdSequence{i - anchor, length, value})
+		literals = append(literals, z.buf[anchor:i]...)
+		i += length
+		anchor = i
+	}
+	z.insertUntil(end, end)
+	return sequences, append(literals, z.buf[anchor:end]...)
+}
+
+// Literals section: Huffman coded when that saves space, otherwise raw or,
+// for a single repeated byte, RLE
+func encodeZstdLiterals(literals []byte) []byte {
+	header := func(kind, size int) []byte {
+		switch {
+		case size < 32:
+			return []byte{byte(kind | size<<3)}
+		case size < 4096:
+			return []byte{byte(kind | 1<<2 | size<<4), byte(size >> 4)}
+		}
+		return []byte{byte(kind | 3<<2 | size<<4), byte(size >> 4), byte(size >> 12)}
+	}
+	raw := append(header(0, len(literals)), literals...)
+	if len(literals) < 64 {
+		return raw
+	}
+
+	var counts [256]int
+	maxSymbol, distinct := 0, 0
+	for _, b := range literals {
+		if counts[b] == 0 {
+			distinct++
+		}
+		counts[b]++
+		maxSymbol = max(maxSymbol, int(b))
+	}
+	if distinct == 1 {
+		return append(header(1, len(literals)), literals[0])
+	}
+	lengths := huffmanLengths(counts[:maxSymbol+1], zstdHuffmanMaxLog)
+	maxBits := 0
+	for _, l := range lengths {
+		maxBits = max(maxBits, int(l))
+	}
+
+	// Codes in the order readHuffmanTable lays out the table
+	weights := make([]uint8, maxSymbol+1)
+	var start [zstdHuffmanMaxLog + 2]int
+	for s, l := range lengths {
+		if l > 0 {
+			weights[s] = uint8(maxBits + 1 - int(l))
+			start[weights[s]+1] += 1 << (weights[s] - 1)
+		}
+	}
+	for w := 2; w <= maxBits+1; w++ {
+		start[w] += start[w-1]
+	}
+	codes := make([]uint64, maxSymbol+1)
+	for s, w := range weights {
+		if w > 0 {
+			codes[s] = uint64(start[w] >> (w - 1))
+			start[w] += 1 << (w - 1)
+		}
+	}
+
+	// The weight of the last symbol is implied by the others
+	tree := huffmanTreeDescription(weights[:maxSymbol])
+	if tree == nil {
+		return raw
+	}
+	stream := func(segment []byte) []byte {
+		var w zstdBitWriter
+		for i := len(segment) - 1; i >= 0; i-- {
+			w.add(codes[segment[i]], uint(lengths[segment[i]]))
+		}
+		return w.close()
+	}
+
+	body := tree
+	format := 0
+	if len(literals) <= 1023 {
+		body = append(body, stream(literals)...)
+	} else {
+		segment := (len(literals) + 3) / 4
+		var streams [4][]byte
+		for i := range streams {
+			streams[i] = stream(literals[min(i*segment, len(literals)):min((i+1)*segment, len(literals))])
+		}
+		for _, s := range streams[:3] {
+			body = binary.LittleEndian.AppendUint16(body, uint16(len(s)))
+		}
+		for _, s := range streams {
+			body = append(body, s...)
+		}
+		format = 2
+		if len(literals) >= 1<<14 || len(body) >= 1<<14 {
+			format = 3
+		}
+	}
+	var sized []byte
+	switch format {
+	case 0:
+		if len(body) > 1023 {
+			return raw
+		}
+		h := 2 | len(literals)<<4 | len(body)<<14
+		sized = []byte{byte(h), byte(h >> 8), byte(h >> 16)}
+	case 2:
+		sized = binary.LittleEndian.AppendUint32(nil, uint32(2|2<<2|len(literals)<<4|len(body)<<18))
+	case 3:
+		h := uint64(2 | 3<<2 | len(literals)<<4 | len(body)<<22)
+		sized = []byte{byte(h), byte(h >> 8), byte(h >> 16), byte(h >> 24), byte(h >> 32)}
+	}
+	if len(sized)+len(body) >= len(raw) {
+		return raw
+	}
+	return append(sized, body...)
+}
+
+// Huffman weights as a tree description: four bits each for up to 128 of
+// them, FSE coded beyond that. Nil when they cannot be described.
+func huffmanTreeDescription(weights []uint8) []byte {
+	if len(weights) <= 128 {
+		tree := []byte{byte(127 + len(weights))}
+		for i := 0; i < len(weights); i += 2 {
+			b := weights[i] << 4
+			if i+1 < len(weights) {
+				b |= weights[i+1]
+			}
+			tree = append(tree, b)
+		}
+		return tree
+	}
+
+	counts := make([]int, zstdHuffmanMaxLog+1)
+	distinct := 0
+	for _, w := range weights {
+		if counts[w] == 0 {
+			distinct++
+		}
+		counts[w]++
+	}
+	if distinct == 1 {
+		return nil
+	}
+	norm := normalizeFSE(counts, 6)
+	table := fseEncodeTable(norm, 6)
+	// Each state starts on a state reading at least one bit, so the
+	// decoder runs out of bits right after the next to last weight
+	first := func(symbol uint8) uint16 {
+		best := -1
+		for i, s := range table.states {
+			if s.symbol == symbol && (best < 0 || s.bits > table.states[best].bits) {
+				best = i
+			}
+		}
+		return uint16(best)
+	}
+	var w zstdBitWriter
+	n := len(weights)
+	var state [2]uint16
+	state[(n-2)%2], state[(n-1)%2] = first(weights[n-2]), first(weights[n-1])
+	for i := n - 3; i >= 0; i-- {
+		table.encodeSymbol(&w, &state[i%2], weights[i])
+	}
+	w.add(uint64(state[1]), uint(table.log))
+	w.add(uint64(state[0]), uint(table.log))
+
+	data := append(writeFSETable(norm, 6), w.close()...)
+	if len(data) >= 128 {
+		return nil
+	}
+	return append([]byte{byte(len(data))}, data...)
+}
+
+// Code lengths of a Huffman code over the counts, none longer than
+// maxBits; counts are halved until the tree is shallow enough
+func huffmanLengths(counts []int, maxBits int) []uint8 {
+	weights := append([]int(nil), counts...)
+	for {
+		var symbols []int
+		for s, c := range weights {
+			if c > 0 {
+				symbols = append(symbols, s)
+			}
+		}
+		sort.SliceStable(symbols, func(i, j int) bool { return weights[symbols[i]] < weights[symbols[j]] })
+
+		// Two-queue construction: leaves in order, then the merged nodes
+		n := len(symbols)
+		freq := make([]int, 2*n-1)
+		parent := make([]int, 2*n-1)
+		for i, s := range symbols {
+			freq[i] = weights[s]
+		}
+		leaf, node := 0, n
+		pick := func(next int) int {
+			if leaf < n && (node >= next || freq[leaf] <= freq[node]) {
+				leaf++
+				return leaf - 1
+			}
+			node++
+			return node - 1
+		}
+		for next := n; next < 2*n-1; next++ {
+			a := pick(next)
+			b := pick(next)
+			freq[next] = freq[a] + freq[b]
+			parent[a], parent[b] = next, next
+		}
+		depth := make([]int, 2*n-1)
+		deepest := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+			deepest = max(deepest, depth[i])
+		}
+		if deepest <= maxBits {
+			lengths := make([]uint8, len(counts))
+			for i, s := range symbols {
+				lengths[s] = uint8(depth[i])
+			}
+			return lengths
+		}
+		for s := range weights {
+			if weights[s] > 0 {
+				weights[s] = max(1, weights[s]/2)
+			}
+		}
+	}
+}
+
+// Sequences section, each code with its own table when there are enough
+// sequences to pay for it
+func encodeZstdSequences(out []byte, sequences []zstdSequence) []byte {
+	switch n := len(sequences); {
+	case n < 128:
+		out = append(out, byte(n))
+	case n < 0x7F00:
+		out = append(out, byte(n>>8+128), byte(n))
+	default:
+		out = append(out, 255, byte(n-0x7F00), byte((n-0x7F00)>>8))
+	}
+	if len(sequences) == 0 {
+		return out
+	}
+
+	type coded struct {
+		ll, ml, of                uint8
+		llExtra, mlExtra, ofExtra uint64
+	}
+	codes := make([]coded, len(sequences))
+	llCounts, mlCounts, ofCounts := make([]int, len(zstdLLBase)), make([]int, len(zstdMLBase)), make([]int, 32)
+	for i, s := range sequences {
+		c := &codes[i]
+		for c.ll = 35; zstdLLBase[c.ll] > uint32(s.litLength); c.ll-- {
+		}
+		for c.ml = 52; zstdMLBase[c.ml] > uint32(s.matchLength); c.ml-- {
+		}
+		c.of = uint8(bits.Len(uint(s.offsetValue)) - 1)
+		c.llExtra = uint64(s.litLength) - uint64(zstdLLBase[c.ll])
+		c.mlExtra = uint64(s.matchLength) - uint64(zstdMLBase[c.ml])
+		c.ofExtra = uint64(s.offsetValue) - 1<<c.of
+		llCounts[c.ll]++
+		mlCounts[c.ml]++
+		ofCounts[c.of]++
+	}
+
+	// A single code is sent as RLE, a few sequences use the predefined
+	// tables and the rest get a table fitted to their codes
+	choose := func(counts []int, predefined *fseTable, maxLog int) (byte, *fseTable, []byte) {
+		distinct, last := 0, 0
+		for s, c := range counts {
+			if c > 0 {
+				distinct, last = distinct+1, s
+			}
+		}
+		if distinct == 1 {
+			table := rleFSETable(uint8(last))
+			table.addEncoding(last + 1)
+			return 1, table, []byte{byte(last)}
+		}
+		if len(sequences) < 64 && last < len(predefined.encode) {
+			return 0, predefined, nil
+		}
+		log := min(maxLog, max(5, bits.Len(uint(len(sequences)))-1))
+		for 1<<log < distinct {
+			log++
+		}
+		norm := normalizeFSE(counts[:last+1], log)
+		return 2, fseEncodeTable(norm, log), writeFSETable(norm, log)
+	}
+	llMode, llTable, llDescription := choose(llCounts, zstdLLTable, 9)
+	ofMode, ofTable, ofDescription := choose(ofCounts, zstdOFTable, 8)
+	mlMode, mlTable, mlDescription := choose(mlCounts, zstdMLTable, 9)
+	out = append(out, llMode<<6|ofMode<<4|mlMode<<2)
+	out = append(append(append(out, llDescription...), ofDescription...), mlDescription...)
+
+	// Written last to first, so the decoder reads them in order
+	var w zstdBitWriter
+	extras := func(c coded) {
+		w.add(c.llExtra, uint(zstdLLBits[c.ll]))
+		w.add(c.mlExtra, uint(zstdMLBits[c.ml]))
+		w.add(c.ofExtra, uint(c.of))
+	}
+	last := codes[len(codes)-1]
+	llState, mlState, ofState := llTable.encode[last.ll][0], mlTable.encode[last.ml][0], ofTable.encode[last.of][0]
+	extras(last)
+	for i := len(codes) - 2; i >= 0; i-- {
+		ofTable.encodeSymbol(&w, &ofState, codes[i].of)
+		mlTable.encodeSymbol(&w, &mlState, codes[i].ml)
+		llTable.encodeSymbol(&w, &llState, codes[i].ll)
+		extras(codes[i])
+	}
+	w.add(uint64(mlState), uint(mlTable.log))
+	w.add(uint64(ofState), uint(ofTable.log))
+	w.add(uint64(llState), uint(llTable.log))
+	return append(out, w.close()...)
+}
+
+// Fill in the state coding each symbol from each next state: the states
+// of a symbol split the range of next states between them
+func (t *fseTable) addEncoding(symbols int) {
+	t.encode = make([][]uint16, symbols)
+	for s := range t.encode {
+		t.encode[s] = make([]uint16, len(t.states))
+	}
+	for i, state := range t.states {
+		for x := int(state.base); x < int(state.base)+1<<state.bits; x++ {
+			t.encode[state.symbol][x] = uint16(i)
+		}
+	}
+}
+
+// Move to the state coding symbol, writing the bits that lead the decoder
+// back to the current one
+func (t *fseTable) encodeSymbol(w *zstdBitWriter, state *uint16, symbol uint8) {
+	next := t.encode[symbol][*state]
+	s := t.states[next]
+	w.add(uint64(*state-s.base), uint(s.bits))
+	*state = next
+}
+
+// Table of a distribution built by normalizeFSE
+func fseEncodeTable(norm []int16, log int) *fseTable {
+	t, err := buildFSETable(norm, log)
+	if err != nil {
+		panic(err)
+	}
+	t.addEncoding(len(norm))
+	return t
+}
+
+// Scale counts to probabilities summing to 1<<log, keeping every present
+// symbol at one state at least
+func normalizeFSE(counts []int, log int) []int16 {
+	total, size := 0, 1<<log
+	for _, c := range counts {
+		total += c
+	}
+	norm := make([]int16, len(counts))
+	sum, largest := 0, 0
+	for s, c := range counts {
+		if c == 0 {
+			continue
+		}
+		norm[s] = int16(max(1, c*size/total))
+		sum += int(norm[s])
+		if c > counts[largest] {
+			largest = s
+		}
+	}
+	for ; sum > size; sum-- {
+		most := 0
+		for s := range norm {
+			if norm[s] > norm[most] {
+				most = s
+			}
+		}
+		norm[most]--
+	}
+	norm[largest] += int16(size - sum)
+	return norm
+}
+
+// The distribution as readFSETable parses it
+func writeFSETable(norm []int16, log int) []byte {
+	var out []byte
+	var acc uint64
+	var n uint
+	put := func(value, count int) {
+		acc |= uint64(value) << n
+		for n += uint(count); n >= 8; n -= 8 {
+			out = append(out, byte(acc))
+			acc >>= 8
+		}
+	}
+	put(log-5, 4)
+	remaining, threshold, nbBits := 1<<log+1, 1<<log, log+1
+	previousZero := false
+	for s := 0; remaining > 1; {
+		if previousZero {
+			start := s
+			for norm[s] == 0 {
+				s++
+			}
+			for ; s >= start+3; start += 3 {
+				put(3, 2)
+			}
+			put(s-start, 2)
+		}
+		count := int(norm[s])
+		s++
+		max := 2*threshold - 1 - remaining
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		count++
+		if count >= threshold {
+			count += max
+		}
+		if count < max {
+			put(count, nbBits-1)
+		} else {
+			put(count, nbBits)
+		}
+		previousZero = count == 1
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if n > 0 {
+		out = append(out, byte(acc))
+	}
+	return out
+}